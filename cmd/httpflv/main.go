@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"flvParse/httpflv"
+	"flvParse/rtmp"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type fileFlags []string
+
+func (f *fileFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	var files fileFlags
+	httpAddr := flag.String("http", ":8080", "http-flv listen address")
+	rtmpAddr := flag.String("rtmp", ":1935", "rtmp publish listen address, empty to disable")
+	flag.Var(&files, "file", "serve a growing flv file, name=path, played as /live/<name>.flv")
+	flag.Parse()
+
+	server := httpflv.NewServer()
+
+	for _, file := range files {
+		i := strings.Index(file, "=")
+		if i <= 0 {
+			fmt.Printf("-file must be name=path, got:%v\n", file)
+			os.Exit(2)
+		}
+		name, path := file[:i], file[i+1:]
+		go func() {
+			if err := server.ServeFile("live/"+name, path); err != nil {
+				fmt.Printf("server.ServeFile(%v) failed, err:%v\n", path, err)
+			}
+		}()
+	}
+
+	if *rtmpAddr != "" {
+		rtmpServer := &rtmp.Server{Addr: *rtmpAddr, OnPublish: server.OnPublish}
+		go func() {
+			if err := rtmpServer.ListenAndServe(); err != nil {
+				fmt.Printf("rtmpServer.ListenAndServe failed, err:%v\n", err)
+				os.Exit(-1)
+			}
+		}()
+	}
+
+	if err := http.ListenAndServe(*httpAddr, server); err != nil {
+		fmt.Printf("http.ListenAndServe failed, err:%v\n", err)
+		os.Exit(-1)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"flvParse/rtmp"
+	"fmt"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n")
+	fmt.Fprintf(os.Stderr, "  rtmpclient publish [-loop] <in.flv> rtmp://host/app/stream\n")
+	fmt.Fprintf(os.Stderr, "  rtmpclient play [-duration 10s] rtmp://host/app/stream <out.flv>\n")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "publish":
+		fs := flag.NewFlagSet("publish", flag.ExitOnError)
+		loop := fs.Bool("loop", false, "publish the file again and again")
+		_ = fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			usage()
+		}
+
+		if err := rtmp.PublishFile(fs.Arg(1), fs.Arg(0), *loop); err != nil {
+			fmt.Printf("rtmp.PublishFile failed, err:%v\n", err)
+			os.Exit(-1)
+		}
+	case "play":
+		fs := flag.NewFlagSet("play", flag.ExitOnError)
+		duration := fs.Duration("duration", 0, "stop after this duration, 0 plays until the stream ends")
+		_ = fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			usage()
+		}
+
+		if err := rtmp.PlayToFile(fs.Arg(0), fs.Arg(1), *duration); err != nil {
+			fmt.Printf("rtmp.PlayToFile failed, err:%v\n", err)
+			os.Exit(-1)
+		}
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,394 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+)
+
+const (
+	aacSyncExtensionTypeSbr = 0x2B7
+	aacSyncExtensionTypePs  = 0x548
+
+	AacSbrSignallingNone                       = 0
+	AacSbrSignallingImplicit                   = 1
+	AacSbrSignallingExplicitHierarchical       = 2
+	AacSbrSignallingExplicitBackwardCompatible = 3
+)
+
+var AacSbrSignallingMap = map[uint8]string{
+	AacSbrSignallingNone:                       "none",
+	AacSbrSignallingImplicit:                   "implicit, up to the decoder",
+	AacSbrSignallingExplicitHierarchical:       "explicit hierarchical",
+	AacSbrSignallingExplicitBackwardCompatible: "explicit backward compatible",
+}
+
+// AacSamplingFrequencies is indexed by samplingFrequencyIndex
+var AacSamplingFrequencies = [13]uint32{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// AudioSpecificConfig is the ISO 14496-3 decoder configuration of the AAC
+// sequence header. AudioObjectType and SamplingFrequency describe the core
+// coder, the Extension fields SBR and PS.
+type AudioSpecificConfig struct {
+	AudioObjectType        uint8
+	SamplingFrequencyIndex uint8
+	SamplingFrequency      uint32
+	ChannelConfiguration   uint8
+	Channels               int
+
+	ExtensionAudioObjectType        uint8
+	ExtensionSamplingFrequencyIndex uint8
+	ExtensionSamplingFrequency      uint32
+	SbrPresent                      bool
+	PsPresent                       bool
+	SbrSignalling                   uint8
+
+	FrameLengthFlag    bool // 960 instead of 1024 samples per frame
+	DependsOnCoreCoder bool
+	CoreCoderDelay     uint16
+	ExtensionFlag      bool
+
+	Pce *ProgramConfigElement
+	Raw []byte
+	// Bits is the length of the config without the padding, 0 if the object
+	// type specific config was not parsed
+	Bits int
+}
+
+// ProgramConfigElement only keeps what is needed to count the channels
+type ProgramConfigElement struct {
+	ElementInstanceTag     uint8
+	ObjectType             uint8
+	SamplingFrequencyIndex uint8
+	FrontElements          []bool // is_cpe
+	SideElements           []bool
+	BackElements           []bool
+	LfeElements            int
+	Comment                string
+}
+
+func (p *ProgramConfigElement) Channels() int {
+	channels := p.LfeElements
+	for _, elements := range [][]bool{p.FrontElements, p.SideElements, p.BackElements} {
+		for _, isCpe := range elements {
+			channels++
+			if isCpe {
+				channels++
+			}
+		}
+	}
+	return channels
+}
+
+// aacChannels is the channel count of channelConfiguration 1-7
+var aacChannels = [8]int{0, 1, 2, 3, 4, 5, 6, 8}
+
+func readAudioObjectType(r *util.BitReader) (uint8, error) {
+	aot, err := r.ReadBits(5)
+	if err != nil {
+		return 0, err
+	}
+	if aot == AACProfileEscape {
+		ext, err := r.ReadBits(6)
+		if err != nil {
+			return 0, err
+		}
+		aot = 32 + ext
+	}
+	return uint8(aot), nil
+}
+
+func readSamplingFrequency(r *util.BitReader) (uint8, uint32, error) {
+	index, err := r.ReadBits(4)
+	if err != nil {
+		return 0, 0, err
+	}
+	if index == SamplingFrequencyEscapeValue {
+		frequency, err := r.ReadBits(24)
+		return uint8(index), frequency, err
+	}
+	if int(index) >= len(AacSamplingFrequencies) {
+		return 0, 0, fmt.Errorf("samplingFrequencyIndex %v is reserved", index)
+	}
+	return uint8(index), AacSamplingFrequencies[index], nil
+}
+
+// ParseAudioSpecificConfig parses the AudioSpecificConfig of ISO 14496-3
+// 1.6.2.1. Only GASpecificConfig object types are parsed past the header.
+func ParseAudioSpecificConfig(buf []byte) (*AudioSpecificConfig, error) {
+	r := util.NewBitReader(buf)
+	c := &AudioSpecificConfig{Raw: append([]byte(nil), buf...)}
+
+	var err error
+	if c.AudioObjectType, err = readAudioObjectType(r); err != nil {
+		return nil, fmt.Errorf("audioObjectType: %v", err)
+	}
+	if c.SamplingFrequencyIndex, c.SamplingFrequency, err = readSamplingFrequency(r); err != nil {
+		return nil, fmt.Errorf("samplingFrequency: %v", err)
+	}
+	channelConfiguration, err := r.ReadBits(4)
+	if err != nil {
+		return nil, fmt.Errorf("channelConfiguration: %v", err)
+	}
+	c.ChannelConfiguration = uint8(channelConfiguration)
+	if int(c.ChannelConfiguration) < len(aacChannels) {
+		c.Channels = aacChannels[c.ChannelConfiguration]
+	}
+
+	if c.AudioObjectType == AACProfileSBR || c.AudioObjectType == AACProfilePS {
+		// explicit hierarchical signalling, the core object type follows
+		c.ExtensionAudioObjectType = AACProfileSBR
+		c.SbrPresent = true
+		c.PsPresent = c.AudioObjectType == AACProfilePS
+		c.SbrSignalling = AacSbrSignallingExplicitHierarchical
+		if c.ExtensionSamplingFrequencyIndex, c.ExtensionSamplingFrequency, err = readSamplingFrequency(r); err != nil {
+			return nil, fmt.Errorf("extensionSamplingFrequency: %v", err)
+		}
+		if c.AudioObjectType, err = readAudioObjectType(r); err != nil {
+			return nil, fmt.Errorf("audioObjectType: %v", err)
+		}
+		if c.AudioObjectType == AACProfileERBSAC {
+			if _, err = r.ReadBits(4); err != nil { // extensionChannelConfiguration
+				return nil, fmt.Errorf("extensionChannelConfiguration: %v", err)
+			}
+		}
+	}
+
+	switch c.AudioObjectType {
+	case AACProfileMain, AACProfileLC, AACProfileSSR, AACProfileLTP, AACProfileScalable, AACProfileTwinVQ,
+		AACProfileERLC, AACProfileERLTP, AACProfileERScalable, AACProfileERTwinVQ, AACProfileERBSAC, AACProfileERLD:
+		if err = c.parseGASpecificConfig(r); err != nil {
+			return nil, fmt.Errorf("GASpecificConfig: %v", err)
+		}
+	default:
+		// the rest of the config is specific to the object type
+		return c, nil
+	}
+	c.Bits = r.BitPos()
+
+	if c.AudioObjectType >= AACProfileERLC && c.AudioObjectType <= AACProfileERLD {
+		epConfig, err := r.ReadBits(2)
+		if err != nil {
+			return nil, fmt.Errorf("epConfig: %v", err)
+		}
+		if epConfig == 2 || epConfig == 3 {
+			c.Bits = 0
+			return c, nil // ErrorProtectionSpecificConfig is not parsed
+		}
+		c.Bits = r.BitPos()
+	}
+
+	// backward compatible signalling appends the extension to the end
+	if c.ExtensionAudioObjectType != AACProfileSBR && r.BitsLeft() >= 16 {
+		syncExtensionType, _ := r.ReadBits(11)
+		if syncExtensionType == aacSyncExtensionTypeSbr {
+			if c.ExtensionAudioObjectType, err = readAudioObjectType(r); err != nil {
+				return nil, fmt.Errorf("extensionAudioObjectType: %v", err)
+			}
+			if c.ExtensionAudioObjectType == AACProfileSBR {
+				if c.SbrPresent, err = r.ReadFlag(); err != nil {
+					return nil, fmt.Errorf("sbrPresentFlag: %v", err)
+				}
+				c.Bits = r.BitPos()
+				if c.SbrPresent {
+					c.SbrSignalling = AacSbrSignallingExplicitBackwardCompatible
+					if c.ExtensionSamplingFrequencyIndex, c.ExtensionSamplingFrequency, err = readSamplingFrequency(r); err != nil {
+						return nil, fmt.Errorf("extensionSamplingFrequency: %v", err)
+					}
+					c.Bits = r.BitPos()
+					if r.BitsLeft() >= 12 {
+						syncExtensionType, _ = r.ReadBits(11)
+						if syncExtensionType == aacSyncExtensionTypePs {
+							if c.PsPresent, err = r.ReadFlag(); err != nil {
+								return nil, fmt.Errorf("psPresentFlag: %v", err)
+							}
+							c.Bits = r.BitPos()
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// without explicit signalling a decoder may still find SBR in the stream,
+	// typically doubling a sampling frequency of 24 kHz or less
+	if c.SbrSignalling == AacSbrSignallingNone && c.ExtensionAudioObjectType != AACProfileSBR &&
+		c.AudioObjectType == AACProfileLC && c.SamplingFrequency <= 24000 {
+		c.SbrSignalling = AacSbrSignallingImplicit
+	}
+
+	return c, nil
+}
+
+func (c *AudioSpecificConfig) parseGASpecificConfig(r *util.BitReader) error {
+	var err error
+	if c.FrameLengthFlag, err = r.ReadFlag(); err != nil {
+		return fmt.Errorf("frameLengthFlag: %v", err)
+	}
+	if c.DependsOnCoreCoder, err = r.ReadFlag(); err != nil {
+		return fmt.Errorf("dependsOnCoreCoder: %v", err)
+	}
+	if c.DependsOnCoreCoder {
+		coreCoderDelay, err := r.ReadBits(14)
+		if err != nil {
+			return fmt.Errorf("coreCoderDelay: %v", err)
+		}
+		c.CoreCoderDelay = uint16(coreCoderDelay)
+	}
+	if c.ExtensionFlag, err = r.ReadFlag(); err != nil {
+		return fmt.Errorf("extensionFlag: %v", err)
+	}
+	if c.ChannelConfiguration == AacChannelDefinedInAudioDecoderSpecificConfig {
+		if c.Pce, err = parseProgramConfigElement(r); err != nil {
+			return fmt.Errorf("program_config_element: %v", err)
+		}
+		c.Channels = c.Pce.Channels()
+	}
+	if c.AudioObjectType == AACProfileScalable || c.AudioObjectType == AACProfileERScalable {
+		if err = r.Skip(3); err != nil { // layerNr
+			return fmt.Errorf("layerNr: %v", err)
+		}
+	}
+	if c.ExtensionFlag {
+		if c.AudioObjectType == AACProfileERBSAC {
+			if err = r.Skip(5 + 11); err != nil { // numOfSubFrame, layer_length
+				return fmt.Errorf("numOfSubFrame: %v", err)
+			}
+		}
+		if c.AudioObjectType == AACProfileERLC || c.AudioObjectType == AACProfileERLTP ||
+			c.AudioObjectType == AACProfileERScalable || c.AudioObjectType == AACProfileERLD {
+			if err = r.Skip(3); err != nil { // aacSection/Scalefactor/SpectralDataResilienceFlag
+				return fmt.Errorf("aacSectionDataResilienceFlag: %v", err)
+			}
+		}
+		if err = r.Skip(1); err != nil { // extensionFlag3
+			return fmt.Errorf("extensionFlag3: %v", err)
+		}
+	}
+	return nil
+}
+
+func parseProgramConfigElement(r *util.BitReader) (*ProgramConfigElement, error) {
+	p := new(ProgramConfigElement)
+	elementInstanceTag, _ := r.ReadBits(4)
+	objectType, _ := r.ReadBits(2)
+	samplingFrequencyIndex, _ := r.ReadBits(4)
+	numFront, _ := r.ReadBits(4)
+	numSide, _ := r.ReadBits(4)
+	numBack, _ := r.ReadBits(4)
+	numLfe, _ := r.ReadBits(2)
+	numAssocData, _ := r.ReadBits(3)
+	numValidCc, err := r.ReadBits(4)
+	if err != nil {
+		return nil, err
+	}
+	p.ElementInstanceTag, p.ObjectType, p.SamplingFrequencyIndex = uint8(elementInstanceTag), uint8(objectType), uint8(samplingFrequencyIndex)
+	p.LfeElements = int(numLfe)
+
+	for _, mixdownBits := range []int{4, 4, 3} { // mono, stereo, matrix mixdown
+		present, err := r.ReadFlag()
+		if err != nil {
+			return nil, err
+		}
+		if present {
+			if err = r.Skip(mixdownBits); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	readElements := func(n uint32) ([]bool, error) {
+		elements := make([]bool, n)
+		for i := range elements {
+			isCpe, err := r.ReadFlag()
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = isCpe
+			if err = r.Skip(4); err != nil { // element_tag_select
+				return nil, err
+			}
+		}
+		return elements, nil
+	}
+	if p.FrontElements, err = readElements(numFront); err != nil {
+		return nil, err
+	}
+	if p.SideElements, err = readElements(numSide); err != nil {
+		return nil, err
+	}
+	if p.BackElements, err = readElements(numBack); err != nil {
+		return nil, err
+	}
+	if err = r.Skip(int(numLfe)*4 + int(numAssocData)*4 + int(numValidCc)*5); err != nil {
+		return nil, err
+	}
+
+	// byte_alignment is relative to the start of the AudioSpecificConfig
+	r.ByteAlign()
+	commentFieldBytes, err := r.ReadBits(8)
+	if err != nil {
+		return nil, err
+	}
+	comment := make([]byte, commentFieldBytes)
+	for i := range comment {
+		b, err := r.ReadBits(8)
+		if err != nil {
+			return nil, err
+		}
+		comment[i] = byte(b)
+	}
+	p.Comment = string(comment)
+
+	return p, nil
+}
+
+func (f *Flv) parseAudioSpecificConfig(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+
+	c, err := ParseAudioSpecificConfig(buf[index:end])
+	if err != nil {
+		return 0, fmt.Errorf("ParseAudioSpecificConfig failed, err:%v", err)
+	}
+
+	f.printf("aacProfile is %v\n", aacProfileString(c.AudioObjectType))
+	if c.SamplingFrequencyIndex == SamplingFrequencyEscapeValue {
+		f.printf("samplingFrequency is %v (explicit)\n", c.SamplingFrequency)
+	} else {
+		f.printf("samplingFrequency is %v\n", c.SamplingFrequency)
+	}
+	aacChannelString, ok := AacChannelMap[c.ChannelConfiguration]
+	if !ok {
+		aacChannelString = "reserved"
+	}
+	f.printf("aacChannel is %v, channels is %v\n", aacChannelString, c.Channels)
+	if c.Pce != nil {
+		f.printf("program config element front %v, side %v, back %v, lfe %v\n",
+			len(c.Pce.FrontElements), len(c.Pce.SideElements), len(c.Pce.BackElements), c.Pce.LfeElements)
+	}
+	if c.FrameLengthFlag {
+		f.printf("aac frame length is 960\n")
+	}
+	f.printf("sbr signalling is %v\n", AacSbrSignallingMap[c.SbrSignalling])
+	if c.SbrPresent {
+		f.printf("sbr extension samplingFrequency is %v, ps is %v\n", c.ExtensionSamplingFrequency, c.PsPresent)
+	}
+
+	f.AudioSpecificConfig = c
+	// the next raw frame writes its ADTS and LATM headers with the new config
+	f.aacAdts, f.aacAdtsErr = nil, nil
+	f.aacLoas, f.aacLoasErr = nil, nil
+	f.AACProfile = c.AudioObjectType
+	f.SamplingFrequency = c.SamplingFrequencyIndex
+	f.AacChannel = c.ChannelConfiguration
+
+	return end, nil
+}
+
+func aacProfileString(audioObjectType uint8) string {
+	if s, ok := AACProfileMap[audioObjectType]; ok {
+		return s
+	}
+	return fmt.Sprintf("audio object type %v", audioObjectType)
+}
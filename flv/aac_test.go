@@ -0,0 +1,181 @@
+package flv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAudioSpecificConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		asc     []byte
+		want    AudioSpecificConfig
+		wantErr string
+	}{
+		{"LC 44.1 kHz stereo", []byte{0x12, 0x10}, AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 4, SamplingFrequency: 44100,
+			ChannelConfiguration: 2, Channels: 2, Bits: 16,
+		}, ""},
+		// SBR is left to the decoder at 24 kHz and below
+		{"LC 22.05 kHz stereo, implicit SBR", []byte{0x13, 0x90}, AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 7, SamplingFrequency: 22050,
+			ChannelConfiguration: 2, Channels: 2, SbrSignalling: AacSbrSignallingImplicit, Bits: 16,
+		}, ""},
+		// object type 5 with the 44.1 kHz output and the LC core at 22.05 kHz
+		{"HE-AAC explicit hierarchical", []byte{0x2B, 0x92, 0x08, 0x00}, AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 7, SamplingFrequency: 22050,
+			ChannelConfiguration: 2, Channels: 2,
+			ExtensionAudioObjectType: AACProfileSBR, ExtensionSamplingFrequencyIndex: 4, ExtensionSamplingFrequency: 44100,
+			SbrPresent: true, SbrSignalling: AacSbrSignallingExplicitHierarchical, Bits: 25,
+		}, ""},
+		// object type 29, mono core at 24 kHz, 48 kHz output
+		{"HE-AAC v2 explicit hierarchical", []byte{0xEB, 0x09, 0x88, 0x00}, AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 6, SamplingFrequency: 24000,
+			ChannelConfiguration: 1, Channels: 1,
+			ExtensionAudioObjectType: AACProfileSBR, ExtensionSamplingFrequencyIndex: 3, ExtensionSamplingFrequency: 48000,
+			SbrPresent: true, PsPresent: true, SbrSignalling: AacSbrSignallingExplicitHierarchical, Bits: 25,
+		}, ""},
+		// syncExtensionType 0x2B7, object type 5, sbrPresentFlag, 44.1 kHz
+		{"HE-AAC backward compatible", bitFields(
+			AACProfileLC, 5, 7, 4, 2, 4, 0, 3,
+			aacSyncExtensionTypeSbr, 11, AACProfileSBR, 5, 1, 1, 4, 4,
+		), AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 7, SamplingFrequency: 22050,
+			ChannelConfiguration: 2, Channels: 2,
+			ExtensionAudioObjectType: AACProfileSBR, ExtensionSamplingFrequencyIndex: 4, ExtensionSamplingFrequency: 44100,
+			SbrPresent: true, SbrSignalling: AacSbrSignallingExplicitBackwardCompatible, Bits: 37,
+		}, ""},
+		// then syncExtensionType 0x548 and psPresentFlag
+		{"HE-AAC v2 backward compatible", bitFields(
+			AACProfileLC, 5, 7, 4, 2, 4, 0, 3,
+			aacSyncExtensionTypeSbr, 11, AACProfileSBR, 5, 1, 1, 4, 4,
+			aacSyncExtensionTypePs, 11, 1, 1,
+		), AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 7, SamplingFrequency: 22050,
+			ChannelConfiguration: 2, Channels: 2,
+			ExtensionAudioObjectType: AACProfileSBR, ExtensionSamplingFrequencyIndex: 4, ExtensionSamplingFrequency: 44100,
+			SbrPresent: true, PsPresent: true, SbrSignalling: AacSbrSignallingExplicitBackwardCompatible, Bits: 49,
+		}, ""},
+		// sbrPresentFlag 0 rules out implicit SBR
+		{"explicitly without SBR", bitFields(
+			AACProfileLC, 5, 7, 4, 2, 4, 0, 3,
+			aacSyncExtensionTypeSbr, 11, AACProfileSBR, 5, 0, 1,
+		), AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 7, SamplingFrequency: 22050,
+			ChannelConfiguration: 2, Channels: 2, ExtensionAudioObjectType: AACProfileSBR, Bits: 33,
+		}, ""},
+		{"escape frequency", bitFields(AACProfileLC, 5, SamplingFrequencyEscapeValue, 4, 37800, 24, 2, 4, 0, 3), AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: SamplingFrequencyEscapeValue, SamplingFrequency: 37800,
+			ChannelConfiguration: 2, Channels: 2, Bits: 40,
+		}, ""},
+		{"escape frequency in the SBR extension", bitFields(
+			AACProfileSBR, 5, 8, 4, 1, 4, SamplingFrequencyEscapeValue, 4, 32100, 24, AACProfileLC, 5, 0, 3,
+		), AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 8, SamplingFrequency: 16000,
+			ChannelConfiguration: 1, Channels: 1,
+			ExtensionAudioObjectType: AACProfileSBR, ExtensionSamplingFrequencyIndex: SamplingFrequencyEscapeValue, ExtensionSamplingFrequency: 32100,
+			SbrPresent: true, SbrSignalling: AacSbrSignallingExplicitHierarchical, Bits: 49,
+		}, ""},
+		// object type 31 escapes to 32 + 6 bits, USAC is not parsed further
+		{"escape object type", bitFields(AACProfileEscape, 5, AACProfileUSAC-32, 6, 3, 4, 2, 4, 0xFF, 8), AudioSpecificConfig{
+			AudioObjectType: AACProfileUSAC, SamplingFrequencyIndex: 3, SamplingFrequency: 48000,
+			ChannelConfiguration: 2, Channels: 2,
+		}, ""},
+		// 480 samples, extensionFlag with the resilience flags, epConfig 0
+		{"ER AAC LD", bitFields(AACProfileERLD, 5, 3, 4, 1, 4, 1, 1, 0, 1, 1, 1, 0, 3, 0, 1, 0, 2), AudioSpecificConfig{
+			AudioObjectType: AACProfileERLD, SamplingFrequencyIndex: 3, SamplingFrequency: 48000,
+			ChannelConfiguration: 1, Channels: 1, FrameLengthFlag: true, ExtensionFlag: true, Bits: 22,
+		}, ""},
+		{"ER AAC LD with error protection", bitFields(AACProfileERLD, 5, 3, 4, 1, 4, 0, 1, 0, 1, 0, 1, 2, 2), AudioSpecificConfig{
+			AudioObjectType: AACProfileERLD, SamplingFrequencyIndex: 3, SamplingFrequency: 48000,
+			ChannelConfiguration: 1, Channels: 1,
+		}, ""},
+		{"core coder delay", bitFields(AACProfileLC, 5, 4, 4, 2, 4, 0, 1, 1, 1, 1000, 14, 0, 1), AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 4, SamplingFrequency: 44100,
+			ChannelConfiguration: 2, Channels: 2, DependsOnCoreCoder: true, CoreCoderDelay: 1000, Bits: 30,
+		}, ""},
+		// 5.1 in a program config element: a front SCE and CPE, a back CPE
+		// and an LFE, 3 bits of byte alignment before the comment
+		{"program config element", bitFields(
+			AACProfileLC, 5, 3, 4, AacChannelDefinedInAudioDecoderSpecificConfig, 4, 0, 3,
+			0, 4, 1, 2, 3, 4, // element_instance_tag, object_type, sampling_frequency_index
+			2, 4, 0, 4, 1, 4, 1, 2, 0, 3, 0, 4, // front, side, back, lfe, assoc_data, valid_cc
+			0, 1, 0, 1, 0, 1, // no mixdown
+			0, 1, 0, 4, 1, 1, 1, 4, // front SCE and CPE
+			1, 1, 2, 4, // back CPE
+			0, 4, // lfe
+			0, 3, // byte_alignment
+			2, 8, 'a', 8, 'b', 8,
+		), AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 3, SamplingFrequency: 48000,
+			Channels: 6, Bits: 96,
+			Pce: &ProgramConfigElement{
+				ObjectType: 1, SamplingFrequencyIndex: 3,
+				FrontElements: []bool{false, true}, SideElements: []bool{}, BackElements: []bool{true},
+				LfeElements: 1, Comment: "ab",
+			},
+		}, ""},
+		// the matrix mixdown takes 3 bits and ends on a byte boundary
+		{"program config element with mixdown", bitFields(
+			AACProfileLC, 5, 3, 4, AacChannelDefinedInAudioDecoderSpecificConfig, 4, 0, 3,
+			5, 4, 1, 2, 3, 4,
+			1, 4, 1, 4, 0, 4, 0, 2, 0, 3, 0, 4,
+			0, 1, 0, 1, 1, 1, 5, 3,
+			1, 1, 0, 4, // front CPE
+			0, 1, 1, 4, // side SCE
+			0, 8,
+		), AudioSpecificConfig{
+			AudioObjectType: AACProfileLC, SamplingFrequencyIndex: 3, SamplingFrequency: 48000,
+			Channels: 3, Bits: 72,
+			Pce: &ProgramConfigElement{
+				ElementInstanceTag: 5, ObjectType: 1, SamplingFrequencyIndex: 3,
+				FrontElements: []bool{true}, SideElements: []bool{false}, BackElements: []bool{},
+			},
+		}, ""},
+		{"empty", nil, AudioSpecificConfig{}, "audioObjectType: read 5 bits with 0 bits left"},
+		{"reserved frequency", bitFields(AACProfileLC, 5, 13, 4, 2, 4, 0, 3), AudioSpecificConfig{}, "samplingFrequencyIndex 13 is reserved"},
+		{"truncated escape frequency", bitFields(AACProfileLC, 5, SamplingFrequencyEscapeValue, 4, 0xAC, 8)[:2], AudioSpecificConfig{}, "samplingFrequency: read 24 bits"},
+		{"reserved extension frequency", bitFields(AACProfileSBR, 5, 8, 4, 1, 4, 14, 4, AACProfileLC, 5, 0, 3), AudioSpecificConfig{}, "extensionSamplingFrequency: samplingFrequencyIndex 14 is reserved"},
+		{"truncated core coder delay", bitFields(AACProfileLC, 5, 4, 4, 2, 4, 0, 1, 1, 1, 0, 6), AudioSpecificConfig{}, "coreCoderDelay"},
+		{"truncated program config element", bitFields(
+			AACProfileLC, 5, 3, 4, AacChannelDefinedInAudioDecoderSpecificConfig, 4, 0, 3,
+			0, 4, 1, 2, 3, 4, 2, 4, 0, 4, 1, 4, 1, 2, 0, 3, 0, 4,
+		), AudioSpecificConfig{}, "program_config_element"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseAudioSpecificConfig(tt.asc)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseAudioSpecificConfig err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAudioSpecificConfig failed, err:%v", err)
+			}
+			tt.want.Raw = tt.asc
+			if !reflect.DeepEqual(*c, tt.want) {
+				t.Fatalf("ParseAudioSpecificConfig = %+v, want %+v", *c, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAudioSpecificConfigTag(t *testing.T) {
+	// a new config resets the headers of the previous one
+	buf := []byte{0xAF, 0x00, 0x13, 0x90}
+	f := tagFlv(buf)
+	f.aacAdts = &adtsWriter{}
+	if _, err := f.parseAudioSpecificConfig(buf, 2); err != nil {
+		t.Fatalf("parseAudioSpecificConfig failed, err:%v", err)
+	}
+	if f.aacAdts != nil || f.AACProfile != AACProfileLC || f.SamplingFrequency != 7 || f.AacChannel != 2 {
+		t.Fatalf("aacAdts %v profile %v frequency %v channel %v, want the new LC 22.05 kHz stereo config",
+			f.aacAdts, f.AACProfile, f.SamplingFrequency, f.AacChannel)
+	}
+	if f.AudioSpecificConfig.SbrSignalling != AacSbrSignallingImplicit {
+		t.Fatalf("SbrSignalling = %v, want implicit", f.AudioSpecificConfig.SbrSignalling)
+	}
+}
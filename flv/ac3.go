@@ -0,0 +1,161 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+)
+
+var Ac3SampleRateMap = map[uint8]string{
+	0: "48000",
+	1: "44100",
+	2: "32000",
+	3: "reserved",
+}
+
+var Ac3AcmodMap = map[uint8]string{
+	0: "1+1 (Ch1, Ch2)",
+	1: "1/0 (C)",
+	2: "2/0 (L, R)",
+	3: "3/0 (L, C, R)",
+	4: "2/1 (L, R, S)",
+	5: "3/1 (L, C, R, S)",
+	6: "2/2 (L, R, SL, SR)",
+	7: "3/2 (L, C, R, SL, SR)",
+}
+
+// Ac3SpecificBox is the dac3 payload
+type Ac3SpecificBox struct {
+	Fscod       uint8
+	Bsid        uint8
+	Bsmod       uint8
+	Acmod       uint8
+	Lfeon       uint8
+	BitRateCode uint8
+}
+
+type Eac3IndependentSubstream struct {
+	Fscod     uint8
+	Bsid      uint8
+	Asvc      uint8
+	Bsmod     uint8
+	Acmod     uint8
+	Lfeon     uint8
+	NumDepSub uint8
+	ChanLoc   uint16
+}
+
+// Eac3SpecificBox is the dec3 payload
+type Eac3SpecificBox struct {
+	DataRate   uint16
+	Substreams []Eac3IndependentSubstream
+}
+
+func (f *Flv) parseAc3AudioData(buf []byte, index int) (int, error) {
+
+	var err error
+	end := f.CurrentTag.Length
+
+	switch f.CurrentTag.AudioPacketType {
+	case AudioPacketTypeSequenceStart:
+		if f.CurrentTag.AudioFourCC == AudioFourCCAc3 {
+			err = f.parseAc3SpecificBox(buf[index:end])
+		} else {
+			err = f.parseEac3SpecificBox(buf[index:end])
+		}
+		if err != nil {
+			return 0, fmt.Errorf("parse %v sequence start failed, err:%v", f.CurrentTag.AudioFourCC, err)
+		}
+	case AudioPacketTypeCodedFrames:
+		if end-index < 2 || buf[index] != 0x0B || buf[index+1] != 0x77 {
+			return 0, fmt.Errorf("ac-3 syncword 0x0B77 not found")
+		}
+		f.printf("%v frames size is %v\n", AudioFourCCMap[f.CurrentTag.AudioFourCC], end-index)
+
+		// AC-3 and E-AC-3 sync frames are self delimiting, the raw file is playable
+		file := &f.ac3File
+		name := "./test.ac3"
+		if f.CurrentTag.AudioFourCC == AudioFourCCEac3 {
+			file = &f.eac3File
+			name = "./test.eac3"
+		}
+		if err = f.openExtractFile(file, name); err != nil {
+			return 0, fmt.Errorf("f.openExtractFile failed, err:%v", err)
+		}
+		_, _ = (*file).Write(buf[index:end])
+	}
+
+	return end, nil
+}
+
+func (f *Flv) parseAc3SpecificBox(buf []byte) error {
+	if len(buf) < 3 {
+		return fmt.Errorf("dac3 len %v < 3", len(buf))
+	}
+
+	r := util.NewBitReader(buf)
+	box := new(Ac3SpecificBox)
+	fscod, _ := r.ReadBits(2)
+	bsid, _ := r.ReadBits(5)
+	bsmod, _ := r.ReadBits(3)
+	acmod, _ := r.ReadBits(3)
+	lfeon, _ := r.ReadBits(1)
+	bitRateCode, _ := r.ReadBits(5)
+	box.Fscod, box.Bsid, box.Bsmod = uint8(fscod), uint8(bsid), uint8(bsmod)
+	box.Acmod, box.Lfeon, box.BitRateCode = uint8(acmod), uint8(lfeon), uint8(bitRateCode)
+
+	f.printf("ac-3 sampleRate is %v\n", Ac3SampleRateMap[box.Fscod])
+	f.printf("ac-3 bsid is %v, bsmod is %v\n", box.Bsid, box.Bsmod)
+	f.printf("ac-3 acmod is %v, lfeon is %v\n", Ac3AcmodMap[box.Acmod], box.Lfeon)
+	f.printf("ac-3 bitRateCode is %v\n", box.BitRateCode)
+
+	f.Ac3Config = box
+	return nil
+}
+
+func (f *Flv) parseEac3SpecificBox(buf []byte) error {
+	if len(buf) < 5 {
+		return fmt.Errorf("dec3 len %v < 5", len(buf))
+	}
+
+	r := util.NewBitReader(buf)
+	box := new(Eac3SpecificBox)
+	dataRate, _ := r.ReadBits(13)
+	numIndSubMinusOne, _ := r.ReadBits(3)
+	box.DataRate = uint16(dataRate)
+	f.printf("e-ac-3 dataRate is %v kbit/s\n", box.DataRate)
+
+	for i := 0; i <= int(numIndSubMinusOne); i++ {
+		var sub Eac3IndependentSubstream
+		fscod, _ := r.ReadBits(2)
+		bsid, _ := r.ReadBits(5)
+		_, _ = r.ReadBits(1) // reserved
+		asvc, _ := r.ReadBits(1)
+		bsmod, _ := r.ReadBits(3)
+		acmod, _ := r.ReadBits(3)
+		lfeon, _ := r.ReadBits(1)
+		_, _ = r.ReadBits(3) // reserved
+		numDepSub, err := r.ReadBits(4)
+		if err != nil {
+			return fmt.Errorf("independent substream %v: r.ReadBits failed, err:%v", i, err)
+		}
+		sub.Fscod, sub.Bsid, sub.Asvc, sub.Bsmod = uint8(fscod), uint8(bsid), uint8(asvc), uint8(bsmod)
+		sub.Acmod, sub.Lfeon, sub.NumDepSub = uint8(acmod), uint8(lfeon), uint8(numDepSub)
+		if numDepSub > 0 {
+			chanLoc, err := r.ReadBits(9)
+			if err != nil {
+				return fmt.Errorf("independent substream %v: r.ReadBits failed, err:%v", i, err)
+			}
+			sub.ChanLoc = uint16(chanLoc)
+		} else {
+			_, _ = r.ReadBits(1) // reserved
+		}
+
+		f.printf("e-ac-3 substream %v sampleRate is %v\n", i, Ac3SampleRateMap[sub.Fscod])
+		f.printf("e-ac-3 substream %v acmod is %v, lfeon is %v, numDepSub is %v\n",
+			i, Ac3AcmodMap[sub.Acmod], sub.Lfeon, sub.NumDepSub)
+		box.Substreams = append(box.Substreams, sub)
+	}
+
+	f.Eac3Config = box
+	return nil
+}
@@ -0,0 +1,94 @@
+package flv
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAc3SpecificBox(t *testing.T) {
+	// 48 kHz, bsid 8, complete main, 3/2 with LFE at 384 kbit/s
+	dac3 := bitFields(0, 2, 8, 5, 0, 3, 7, 3, 1, 1, 14, 5, 0, 5)
+	if want := []byte{0x10, 0x3D, 0xC0}; !bytes.Equal(dac3, want) {
+		t.Fatalf("dac3 = %x, want %x", dac3, want)
+	}
+
+	f := &Flv{Quiet: true}
+	if err := f.parseAc3SpecificBox(dac3); err != nil {
+		t.Fatalf("parseAc3SpecificBox failed, err:%v", err)
+	}
+	want := &Ac3SpecificBox{Bsid: 8, Acmod: 7, Lfeon: 1, BitRateCode: 14}
+	if !reflect.DeepEqual(f.Ac3Config, want) {
+		t.Fatalf("Ac3Config = %+v, want %+v", f.Ac3Config, want)
+	}
+
+	if err := f.parseAc3SpecificBox(dac3[:2]); err == nil || !strings.Contains(err.Error(), "dac3 len 2 < 3") {
+		t.Fatalf("parseAc3SpecificBox err:%v, want dac3 len 2 < 3", err)
+	}
+}
+
+func TestParseEac3SpecificBox(t *testing.T) {
+	tests := []struct {
+		name    string
+		dec3    []byte
+		want    *Eac3SpecificBox
+		wantErr string
+	}{
+		{"5.1 at 640 kbit/s", bitFields(
+			640, 13, 0, 3, // data_rate, num_ind_sub - 1
+			0, 2, 16, 5, 0, 1, 0, 1, 0, 3, 7, 3, 1, 1, 0, 3, 0, 4, 0, 1,
+		), &Eac3SpecificBox{DataRate: 640, Substreams: []Eac3IndependentSubstream{
+			{Bsid: 16, Acmod: 7, Lfeon: 1},
+		}}, ""},
+		{"7.1 with a dependent substream and a second program", bitFields(
+			1024, 13, 1, 3,
+			1, 2, 16, 5, 0, 1, 0, 1, 0, 3, 7, 3, 1, 1, 0, 3, 1, 4, 0x002, 9, // chan_loc
+			1, 2, 16, 5, 0, 1, 1, 1, 2, 3, 2, 3, 0, 1, 0, 3, 0, 4, 0, 1,
+		), &Eac3SpecificBox{DataRate: 1024, Substreams: []Eac3IndependentSubstream{
+			{Fscod: 1, Bsid: 16, Acmod: 7, Lfeon: 1, NumDepSub: 1, ChanLoc: 0x002},
+			{Fscod: 1, Bsid: 16, Asvc: 1, Bsmod: 2, Acmod: 2},
+		}}, ""},
+		{"short", []byte{0x50, 0x00, 0x20, 0x0F}, nil, "dec3 len 4 < 5"},
+		{"missing substream", bitFields(
+			640, 13, 1, 3,
+			0, 2, 16, 5, 0, 1, 0, 1, 0, 3, 7, 3, 1, 1, 0, 3, 0, 4, 0, 1,
+		), nil, "independent substream 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Flv{Quiet: true}
+			err := f.parseEac3SpecificBox(tt.dec3)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseEac3SpecificBox err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseEac3SpecificBox failed, err:%v", err)
+			}
+			if !reflect.DeepEqual(f.Eac3Config, tt.want) {
+				t.Fatalf("Eac3Config = %+v, want %+v", f.Eac3Config, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAc3CodedFrames(t *testing.T) {
+	for _, tt := range []struct {
+		buf     []byte
+		wantErr bool
+	}{
+		{[]byte{0x0B, 0x77, 0x00, 0x00}, false},
+		{[]byte{0x77, 0x0B, 0x00, 0x00}, true},
+		{[]byte{0x0B}, true},
+	} {
+		f := tagFlv(tt.buf)
+		f.CurrentTag.AudioPacketType = AudioPacketTypeCodedFrames
+		f.CurrentTag.AudioFourCC = AudioFourCCEac3
+		if _, err := f.parseAc3AudioData(tt.buf, 0); (err != nil) != tt.wantErr {
+			t.Fatalf("parseAc3AudioData(%x) err:%v, want error %v", tt.buf, err, tt.wantErr)
+		}
+	}
+}
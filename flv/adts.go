@@ -0,0 +1,82 @@
+package flv
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	adtsHeaderSize     = 7
+	adtsMaxFrameLength = 0x1FFF
+	adtsBufferFullness = 0x7FF // variable bitrate
+)
+
+// adtsWriter prefixes raw AAC frames with ADTS headers built from an
+// AudioSpecificConfig, without CRC
+type adtsWriter struct {
+	w       io.Writer
+	profile uint8
+	index   uint8
+	channel uint8
+}
+
+// newAdtsWriter fails for configs ADTS can not carry: object types without an
+// ADTS profile, explicit frequencies, channel configurations outside 1-7 and
+// explicitly signalled SBR/PS, which only the AudioSpecificConfig can express
+func newAdtsWriter(w io.Writer, c *AudioSpecificConfig) (*adtsWriter, error) {
+	if c == nil {
+		return nil, fmt.Errorf("no AudioSpecificConfig")
+	}
+	profile, ok := AACProfile2ADTSProfile[c.AudioObjectType]
+	if !ok {
+		return nil, fmt.Errorf("%v has no ADTS profile", aacProfileString(c.AudioObjectType))
+	}
+	if c.SamplingFrequencyIndex == SamplingFrequencyEscapeValue {
+		return nil, fmt.Errorf("explicit samplingFrequency %v can not be signalled in ADTS", c.SamplingFrequency)
+	}
+	if c.ChannelConfiguration == AacChannelDefinedInAudioDecoderSpecificConfig || c.ChannelConfiguration > AacChannelSevenPointOne {
+		return nil, fmt.Errorf("channelConfiguration %v can not be signalled in ADTS", c.ChannelConfiguration)
+	}
+	if c.SbrSignalling == AacSbrSignallingExplicitHierarchical || c.SbrSignalling == AacSbrSignallingExplicitBackwardCompatible {
+		return nil, fmt.Errorf("%v SBR can not be signalled in ADTS", AacSbrSignallingMap[c.SbrSignalling])
+	}
+
+	return &adtsWriter{
+		w:       w,
+		profile: profile,
+		index:   c.SamplingFrequencyIndex,
+		channel: c.ChannelConfiguration,
+	}, nil
+}
+
+// header returns the ADTS header of a frame with a single raw data block
+func (a *adtsWriter) header(payload []byte) ([]byte, error) {
+	frameLength := adtsHeaderSize + len(payload)
+	if frameLength > adtsMaxFrameLength {
+		return nil, fmt.Errorf("ADTS frame length %v > %v", frameLength, adtsMaxFrameLength)
+	}
+
+	header := make([]byte, adtsHeaderSize)
+	header[0] = 0xFF
+	header[1] = 0xF1 // MPEG-4, layer 0, protection absent
+	header[2] = a.profile<<6 | a.index<<2 | a.channel>>2
+	header[3] = a.channel<<6 | byte(frameLength>>11)
+	header[4] = byte(frameLength >> 3)
+	header[5] = byte(frameLength<<5) | adtsBufferFullness>>6
+	header[6] = byte(adtsBufferFullness&0x3F) << 2 // one raw data block
+	return header, nil
+}
+
+func (a *adtsWriter) WriteFrame(payload []byte) error {
+	header, err := a.header(payload)
+	if err != nil {
+		return err
+	}
+	if _, err = a.w.Write(header); err != nil {
+		return fmt.Errorf("write ADTS header failed, err:%v", err)
+	}
+	if _, err = a.w.Write(payload); err != nil {
+		return fmt.Errorf("write ADTS payload failed, err:%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package flv
+
+import (
+	"bytes"
+	"flvParse/util"
+	"strings"
+	"testing"
+)
+
+// bitFields packs value, width pairs MSB first
+func bitFields(fields ...uint32) []byte {
+	w := new(util.BitWriter)
+	for i := 0; i+1 < len(fields); i += 2 {
+		w.WriteBits(fields[i], int(fields[i+1]))
+	}
+	w.ByteAlign()
+	return w.Bytes()
+}
+
+// adtsHeader packs the fixed and variable header of ISO 13818-7 6.2 for one
+// raw data block without CRC
+func adtsHeader(profile, samplingFrequencyIndex, channelConfiguration, frameLength uint32) []byte {
+	return bitFields(
+		0xFFF, 12, // syncword
+		0, 1, // ID, MPEG-4
+		0, 2, // layer
+		1, 1, // protection_absent
+		profile, 2,
+		samplingFrequencyIndex, 4,
+		0, 1, // private_bit
+		channelConfiguration, 3,
+		0, 1, 0, 1, // original_copy, home
+		0, 1, 0, 1, // copyright_identification_bit and _start
+		frameLength, 13,
+		0x7FF, 11, // adts_buffer_fullness, VBR
+		0, 2, // number_of_raw_data_blocks_in_frame - 1
+	)
+}
+
+func TestAdtsWriterHeader(t *testing.T) {
+	// the header of a 371 byte LC 44.1 kHz stereo frame in a real ADTS file
+	if got, want := adtsHeader(1, 4, 2, 371), []byte{0xFF, 0xF1, 0x50, 0x80, 0x2E, 0x7F, 0xFC}; !bytes.Equal(got, want) {
+		t.Fatalf("adtsHeader = %x, want %x", got, want)
+	}
+
+	payload364 := make([]byte, 364)
+	for i := range payload364 {
+		payload364[i] = byte(i)
+	}
+	payload4 := []byte{0xDE, 0xAD, 0xBE, 0xEF}
+	payloadMax := make([]byte, adtsMaxFrameLength-adtsHeaderSize)
+
+	tests := []struct {
+		name    string
+		asc     []byte
+		payload []byte
+		want    []byte
+	}{
+		{"LC 44.1k stereo", []byte{0x12, 0x10}, payload364, adtsHeader(1, 4, 2, 371)},
+		{"LC 44.1k stereo short", []byte{0x12, 0x10}, payload4, adtsHeader(1, 4, 2, 11)},
+		{"LC 48k 5.1", []byte{0x11, 0xB0}, payload364, adtsHeader(1, 3, 6, 371)},
+		{"LC 48k 7.1 largest frame", []byte{0x11, 0xB8}, payloadMax, adtsHeader(1, 3, 7, adtsMaxFrameLength)},
+		{"Main 22.05k mono", []byte{0x0B, 0x88}, payload4, adtsHeader(0, 7, 1, 11)},
+		{"LTP 8k stereo", []byte{0x25, 0x90}, payload4, adtsHeader(3, 11, 2, 11)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseAudioSpecificConfig(tt.asc)
+			if err != nil {
+				t.Fatalf("ParseAudioSpecificConfig failed, err:%v", err)
+			}
+			out := new(bytes.Buffer)
+			a, err := newAdtsWriter(out, c)
+			if err != nil {
+				t.Fatalf("newAdtsWriter failed, err:%v", err)
+			}
+			if err = a.WriteFrame(tt.payload); err != nil {
+				t.Fatalf("WriteFrame failed, err:%v", err)
+			}
+
+			if got := out.Bytes()[:adtsHeaderSize]; !bytes.Equal(got, tt.want) {
+				t.Fatalf("header = %x, want %x", got, tt.want)
+			}
+			if got := out.Bytes()[adtsHeaderSize:]; !bytes.Equal(got, tt.payload) {
+				t.Fatalf("payload differs")
+			}
+		})
+	}
+
+	c, _ := ParseAudioSpecificConfig([]byte{0x12, 0x10})
+	a, _ := newAdtsWriter(new(bytes.Buffer), c)
+	if err := a.WriteFrame(append(payloadMax, 0x00)); err == nil || !strings.Contains(err.Error(), "ADTS frame length 8192 > 8191") {
+		t.Fatalf("WriteFrame err:%v, want ADTS frame length 8192 > 8191", err)
+	}
+}
+
+func TestAdtsWriterRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		asc     []byte
+		wantErr string
+	}{
+		// AOT 5, 24 kHz stereo, extension 48 kHz, core AOT 2
+		{"explicit hierarchical SBR", bitFields(5, 5, 6, 4, 2, 4, 3, 4, 2, 5, 0, 3), "SBR can not be signalled"},
+		// AOT 29, 24 kHz mono, extension 48 kHz, core AOT 2
+		{"explicit hierarchical PS", bitFields(29, 5, 6, 4, 1, 4, 3, 4, 2, 5, 0, 3), "SBR can not be signalled"},
+		// LC 24 kHz stereo, then sync 0x2B7, AOT 5, sbrPresentFlag, 48 kHz
+		{"explicit backward compatible SBR", bitFields(2, 5, 6, 4, 2, 4, 0, 3, 0x2B7, 11, 5, 5, 1, 1, 3, 4), "SBR can not be signalled"},
+		// LC 44.1 kHz, channel configuration 0 with a PCE of one front CPE
+		{"channel configuration 0 with PCE", bitFields(2, 5, 4, 4, 0, 4, 0, 3,
+			0, 4, 1, 2, 4, 4, 1, 4, 0, 4, 0, 4, 0, 2, 0, 3, 0, 4, 0, 1, 0, 1, 0, 1, 1, 1, 0, 4,
+			0, 1, 0, 8), "channelConfiguration 0"},
+		// LC, escape index 15 with an explicit 44100 Hz, stereo
+		{"escape sampling frequency index", bitFields(2, 5, 15, 4, 44100, 24, 2, 4, 0, 3), "explicit samplingFrequency 44100"},
+		// LC 44.1 kHz, reserved channel configuration 8
+		{"channel configuration 8", bitFields(2, 5, 4, 4, 8, 4, 0, 3), "channelConfiguration 8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseAudioSpecificConfig(tt.asc)
+			if err != nil {
+				t.Fatalf("ParseAudioSpecificConfig(%x) failed, err:%v", tt.asc, err)
+			}
+			_, err = newAdtsWriter(new(bytes.Buffer), c)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("newAdtsWriter err:%v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
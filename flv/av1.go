@@ -0,0 +1,393 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+)
+
+const (
+	Av1ObuTypeSequenceHeader       = 1
+	Av1ObuTypeTemporalDelimiter    = 2
+	Av1ObuTypeFrameHeader          = 3
+	Av1ObuTypeTileGroup            = 4
+	Av1ObuTypeMetadata             = 5
+	Av1ObuTypeFrame                = 6
+	Av1ObuTypeRedundantFrameHeader = 7
+	Av1ObuTypeTileList             = 8
+	Av1ObuTypePadding              = 15
+)
+
+var Av1ObuTypeMap = map[uint8]string{
+	Av1ObuTypeSequenceHeader:       "OBU_SEQUENCE_HEADER",
+	Av1ObuTypeTemporalDelimiter:    "OBU_TEMPORAL_DELIMITER",
+	Av1ObuTypeFrameHeader:          "OBU_FRAME_HEADER",
+	Av1ObuTypeTileGroup:            "OBU_TILE_GROUP",
+	Av1ObuTypeMetadata:             "OBU_METADATA",
+	Av1ObuTypeFrame:                "OBU_FRAME",
+	Av1ObuTypeRedundantFrameHeader: "OBU_REDUNDANT_FRAME_HEADER",
+	Av1ObuTypeTileList:             "OBU_TILE_LIST",
+	Av1ObuTypePadding:              "OBU_PADDING",
+}
+
+var av1TemporalDelimiter = []byte{Av1ObuTypeTemporalDelimiter<<3 | 0b010, 0x00}
+
+type Av1CodecConfigurationRecord struct {
+	SeqProfile                       uint8
+	SeqLevelIdx0                     uint8
+	SeqTier0                         uint8
+	HighBitdepth                     uint8
+	TwelveBit                        uint8
+	Monochrome                       uint8
+	ChromaSubsamplingX               uint8
+	ChromaSubsamplingY               uint8
+	ChromaSamplePosition             uint8
+	InitialPresentationDelayPresent  uint8
+	InitialPresentationDelayMinusOne uint8
+	ConfigObus                       []byte
+}
+
+type av1Obu struct {
+	Type   uint8
+	Header []byte // obu_header and the optional extension
+	Data   []byte // obu payload
+	Raw    []byte // the whole obu
+}
+
+func (f *Flv) parseAv1ExVideoPacket(buf []byte, index int) (int, error) {
+
+	var err error
+
+	switch f.CurrentTag.VideoPacketType {
+	case VideoPacketTypeSequenceStart:
+		index, err = f.parseAv1CodecConfigurationRecord(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseAv1CodecConfigurationRecord failed, err:%v", err)
+		}
+	case VideoPacketTypeCodedFrames, VideoPacketTypeCodedFramesX:
+		index, err = f.parseAv1TemporalUnit(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseAv1TemporalUnit failed, err:%v", err)
+		}
+	default:
+		index = f.CurrentTag.Length
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseAv1CodecConfigurationRecord(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	if end-index < 4 {
+		return 0, fmt.Errorf("AV1CodecConfigurationRecord len %v < 4", end-index)
+	}
+
+	marker := buf[index] >> 7
+	version := buf[index] & 0b01111111
+	if marker != 1 || version != 1 {
+		return 0, fmt.Errorf("marker or version != 1, marker:%v, version:%v", marker, version)
+	}
+	f.printf("marker is 1, version is 1\n")
+	index++
+
+	config := new(Av1CodecConfigurationRecord)
+	config.SeqProfile = buf[index] >> 5
+	config.SeqLevelIdx0 = buf[index] & 0b00011111
+	f.printf("seqProfile is %v\n", config.SeqProfile)
+	f.printf("seqLevelIdx0 is %v\n", config.SeqLevelIdx0)
+	index++
+
+	config.SeqTier0 = buf[index] >> 7
+	config.HighBitdepth = (buf[index] >> 6) & 0b1
+	config.TwelveBit = (buf[index] >> 5) & 0b1
+	config.Monochrome = (buf[index] >> 4) & 0b1
+	config.ChromaSubsamplingX = (buf[index] >> 3) & 0b1
+	config.ChromaSubsamplingY = (buf[index] >> 2) & 0b1
+	config.ChromaSamplePosition = buf[index] & 0b11
+	f.printf("seqTier0 is %v\n", config.SeqTier0)
+	f.printf("highBitdepth is %v, twelveBit is %v, monochrome is %v\n",
+		config.HighBitdepth, config.TwelveBit, config.Monochrome)
+	f.printf("chromaSubsamplingX is %v, chromaSubsamplingY is %v, chromaSamplePosition is %v\n",
+		config.ChromaSubsamplingX, config.ChromaSubsamplingY, config.ChromaSamplePosition)
+	index++
+
+	config.InitialPresentationDelayPresent = (buf[index] >> 4) & 0b1
+	if config.InitialPresentationDelayPresent == 1 {
+		config.InitialPresentationDelayMinusOne = buf[index] & 0b1111
+		f.printf("initialPresentationDelayMinusOne is %v\n", config.InitialPresentationDelayMinusOne)
+	}
+	index++
+
+	config.ConfigObus = append([]byte(nil), buf[index:end]...)
+	f.printf("configOBUs size is %v\n", len(config.ConfigObus))
+
+	obus, err := f.parseAv1Obus(config.ConfigObus)
+	if err != nil {
+		return 0, fmt.Errorf("f.parseAv1Obus failed, err:%v", err)
+	}
+	for _, obu := range obus {
+		if obu.Type == Av1ObuTypeSequenceHeader {
+			if err = f.parseAv1SequenceHeaderObu(obu.Data); err != nil {
+				return 0, fmt.Errorf("f.parseAv1SequenceHeaderObu failed, err:%v", err)
+			}
+		}
+	}
+
+	f.Av1Config = config
+	return end, nil
+}
+
+func (f *Flv) parseAv1TemporalUnit(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+
+	obus, err := f.parseAv1Obus(buf[index:end])
+	if err != nil {
+		return 0, fmt.Errorf("f.parseAv1Obus failed, err:%v", err)
+	}
+
+	hasSequenceHeader := false
+	for _, obu := range obus {
+		if obu.Type == Av1ObuTypeSequenceHeader {
+			hasSequenceHeader = true
+			if err = f.parseAv1SequenceHeaderObu(obu.Data); err != nil {
+				return 0, fmt.Errorf("f.parseAv1SequenceHeaderObu failed, err:%v", err)
+			}
+		}
+	}
+
+	// the low overhead bitstream needs a temporal delimiter at the start of every
+	// temporal unit, and decoders need the sequence header before a key frame
+	temporalUnit := make([]byte, 0, end-index+len(av1TemporalDelimiter))
+	if len(obus) == 0 || obus[0].Type != Av1ObuTypeTemporalDelimiter {
+		temporalUnit = append(temporalUnit, av1TemporalDelimiter...)
+	}
+	for _, obu := range obus {
+		temporalUnit = append(temporalUnit, obu.Raw...)
+	}
+	if !hasSequenceHeader && f.CurrentTag.FrameType == FrameTypeKeyFrame && f.Av1Config != nil {
+		withConfig := append([]byte(nil), temporalUnit[:len(av1TemporalDelimiter)]...)
+		withConfig = append(withConfig, f.Av1Config.ConfigObus...)
+		temporalUnit = append(withConfig, temporalUnit[len(av1TemporalDelimiter):]...)
+	}
+
+	if err = f.openExtractFile(&f.obuFile, "./test.obu"); err != nil {
+		return 0, fmt.Errorf("f.openExtractFile failed, err:%v", err)
+	}
+	_, _ = f.obuFile.Write(temporalUnit)
+
+	if err = f.openIvfWriter(&f.av1IvfFile, "./test.av1.ivf", "AV01"); err != nil {
+		return 0, fmt.Errorf("f.openIvfWriter failed, err:%v", err)
+	}
+	if f.av1IvfFile != nil {
+		if f.av1IvfFile.Width == 0 {
+			f.av1IvfFile.Width, f.av1IvfFile.Height = f.VideoWidth, f.VideoHeight
+		}
+		if err = f.av1IvfFile.WriteFrame(uint64(f.CurrentTag.Timestamp), temporalUnit); err != nil {
+			return 0, fmt.Errorf("av1IvfFile.WriteFrame failed, err:%v", err)
+		}
+	}
+
+	return end, nil
+}
+
+// parseAv1Obus splits a low overhead bitstream into its OBUs
+func (f *Flv) parseAv1Obus(buf []byte) ([]*av1Obu, error) {
+	obus := make([]*av1Obu, 0)
+	index := 0
+	for index < len(buf) {
+		start := index
+		header := buf[index]
+		if header>>7 != 0 {
+			return nil, fmt.Errorf("obu_forbidden_bit is not 0")
+		}
+		obuType := (header >> 3) & 0b1111
+		extensionFlag := (header >> 2) & 0b1
+		hasSizeField := (header >> 1) & 0b1
+		index++
+		if extensionFlag == 1 {
+			index++
+		}
+		if index > len(buf) {
+			return nil, fmt.Errorf("obu header truncated")
+		}
+		headerEnd := index
+
+		size := len(buf) - index
+		if hasSizeField == 1 {
+			value, n, err := readLeb128(buf[index:])
+			if err != nil {
+				return nil, fmt.Errorf("readLeb128 failed, err:%v", err)
+			}
+			index += n
+			if uint64(len(buf)-index) < value {
+				return nil, fmt.Errorf("obu size %v > remaining %v", value, len(buf)-index)
+			}
+			size = int(value)
+		}
+
+		obuTypeString, ok := Av1ObuTypeMap[obuType]
+		if !ok {
+			obuTypeString = fmt.Sprintf("reserved obu type %v", obuType)
+		}
+		f.printf("%v size is %v\n", obuTypeString, size)
+
+		obu := &av1Obu{
+			Type:   obuType,
+			Header: buf[start:headerEnd],
+			Data:   buf[index : index+size],
+			Raw:    buf[start : index+size],
+		}
+		if hasSizeField == 0 {
+			// give the obu a size field so it can be concatenated with others
+			raw := append([]byte(nil), obu.Header...)
+			raw[0] |= 0b010
+			raw = append(raw, writeLeb128(uint64(size))...)
+			obu.Raw = append(raw, obu.Data...)
+		}
+		obus = append(obus, obu)
+
+		index += size
+	}
+	return obus, nil
+}
+
+func (f *Flv) parseAv1SequenceHeaderObu(buf []byte) error {
+	r := util.NewBitReader(buf)
+
+	seqProfile, _ := r.ReadBits(3)
+	stillPicture, _ := r.ReadBits(1)
+	reducedStillPictureHeader, err := r.ReadBits(1)
+	if err != nil {
+		return fmt.Errorf("r.ReadBits failed, err:%v", err)
+	}
+	f.printf("seq_profile is %v, still_picture is %v\n", seqProfile, stillPicture)
+
+	if reducedStillPictureHeader == 1 {
+		if _, err = r.ReadBits(5); err != nil {
+			return fmt.Errorf("r.ReadBits failed, err:%v", err)
+		}
+	} else {
+		timingInfoPresent, err := r.ReadBits(1)
+		if err != nil {
+			return fmt.Errorf("r.ReadBits failed, err:%v", err)
+		}
+		decoderModelInfoPresent := uint32(0)
+		bufferDelayLength := 0
+		if timingInfoPresent == 1 {
+			numUnitsInDisplayTick, _ := r.ReadBits(32)
+			timeScale, _ := r.ReadBits(32)
+			equalPictureInterval, err := r.ReadBits(1)
+			if err != nil {
+				return fmt.Errorf("r.ReadBits failed, err:%v", err)
+			}
+			f.printf("num_units_in_display_tick is %v, time_scale is %v\n", numUnitsInDisplayTick, timeScale)
+			if equalPictureInterval == 1 {
+				if _, err = readUvlc(r); err != nil {
+					return fmt.Errorf("readUvlc failed, err:%v", err)
+				}
+			}
+			decoderModelInfoPresent, err = r.ReadBits(1)
+			if err != nil {
+				return fmt.Errorf("r.ReadBits failed, err:%v", err)
+			}
+			if decoderModelInfoPresent == 1 {
+				bufferDelayLengthMinusOne, _ := r.ReadBits(5)
+				bufferDelayLength = int(bufferDelayLengthMinusOne) + 1
+				if err = r.Skip(32 + 5 + 5); err != nil {
+					return fmt.Errorf("r.Skip failed, err:%v", err)
+				}
+			}
+		}
+
+		initialDisplayDelayPresent, _ := r.ReadBits(1)
+		operatingPointsCntMinusOne, err := r.ReadBits(5)
+		if err != nil {
+			return fmt.Errorf("r.ReadBits failed, err:%v", err)
+		}
+		for i := 0; i <= int(operatingPointsCntMinusOne); i++ {
+			_, _ = r.ReadBits(12) // operating_point_idc
+			seqLevelIdx, err := r.ReadBits(5)
+			if err != nil {
+				return fmt.Errorf("r.ReadBits failed, err:%v", err)
+			}
+			if seqLevelIdx > 7 {
+				_, _ = r.ReadBits(1) // seq_tier
+			}
+			if decoderModelInfoPresent == 1 {
+				decoderModelPresent, _ := r.ReadBits(1)
+				if decoderModelPresent == 1 {
+					// decoder_buffer_delay, encoder_buffer_delay, low_delay_mode_flag
+					_ = r.Skip(2*bufferDelayLength + 1)
+				}
+			}
+			if initialDisplayDelayPresent == 1 {
+				initialDisplayDelayPresentForThisOp, _ := r.ReadBits(1)
+				if initialDisplayDelayPresentForThisOp == 1 {
+					_ = r.Skip(4)
+				}
+			}
+		}
+	}
+
+	frameWidthBitsMinusOne, _ := r.ReadBits(4)
+	frameHeightBitsMinusOne, _ := r.ReadBits(4)
+	maxFrameWidthMinusOne, _ := r.ReadBits(int(frameWidthBitsMinusOne) + 1)
+	maxFrameHeightMinusOne, err := r.ReadBits(int(frameHeightBitsMinusOne) + 1)
+	if err != nil {
+		return fmt.Errorf("r.ReadBits failed, err:%v", err)
+	}
+
+	f.VideoWidth = uint16(maxFrameWidthMinusOne + 1)
+	f.VideoHeight = uint16(maxFrameHeightMinusOne + 1)
+	f.printf("max_frame_width is %v, max_frame_height is %v\n", f.VideoWidth, f.VideoHeight)
+
+	return nil
+}
+
+func readUvlc(r *util.BitReader) (uint32, error) {
+	leadingZeros := 0
+	for {
+		done, err := r.ReadBits(1)
+		if err != nil {
+			return 0, err
+		}
+		if done == 1 {
+			break
+		}
+		leadingZeros++
+	}
+	if leadingZeros >= 32 {
+		return 0xFFFFFFFF, nil
+	}
+	value, err := r.ReadBits(leadingZeros)
+	if err != nil {
+		return 0, err
+	}
+	return value + (1 << uint(leadingZeros)) - 1, nil
+}
+
+func readLeb128(buf []byte) (uint64, int, error) {
+	var value uint64
+	for i := 0; i < 8; i++ {
+		if i >= len(buf) {
+			return 0, 0, fmt.Errorf("leb128 truncated")
+		}
+		value |= uint64(buf[i]&0x7F) << (uint(i) * 7)
+		if buf[i]&0x80 == 0 {
+			return value, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("leb128 longer than 8 bytes")
+}
+
+func writeLeb128(value uint64) []byte {
+	buf := make([]byte, 0, 8)
+	for {
+		b := byte(value & 0x7F)
+		value >>= 7
+		if value != 0 {
+			buf = append(buf, b|0x80)
+		} else {
+			return append(buf, b)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package flv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLeb128(t *testing.T) {
+	tests := []struct {
+		value uint64
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{300, []byte{0xAC, 0x02}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{1<<56 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F}},
+	}
+	for _, tt := range tests {
+		if got := writeLeb128(tt.value); !bytes.Equal(got, tt.want) {
+			t.Fatalf("writeLeb128(%v) = %x, want %x", tt.value, got, tt.want)
+		}
+		// bytes after the value are not read
+		value, n, err := readLeb128(append(tt.want, 0xFF))
+		if err != nil {
+			t.Fatalf("readLeb128(%x) failed, err:%v", tt.want, err)
+		}
+		if value != tt.value || n != len(tt.want) {
+			t.Fatalf("readLeb128(%x) = %v, %v, want %v, %v", tt.want, value, n, tt.value, len(tt.want))
+		}
+	}
+
+	// a padded encoding is allowed
+	if value, n, err := readLeb128([]byte{0x81, 0x80, 0x00}); err != nil || value != 1 || n != 3 {
+		t.Fatalf("readLeb128 of a padded 1 = %v, %v, %v, want 1, 3", value, n, err)
+	}
+
+	errTests := []struct {
+		buf     []byte
+		wantErr string
+	}{
+		{nil, "truncated"},
+		{[]byte{0x80}, "truncated"},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01}, "longer than 8 bytes"},
+	}
+	for _, tt := range errTests {
+		if _, _, err := readLeb128(tt.buf); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Fatalf("readLeb128(%x) err:%v, want %q", tt.buf, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseAv1Obus(t *testing.T) {
+	tests := []struct {
+		name     string
+		buf      []byte
+		wantType []uint8
+		wantData [][]byte
+		wantRaw  [][]byte
+		wantErr  string
+	}{
+		{"temporal delimiter and a frame with size fields",
+			[]byte{0x12, 0x00, 0x32, 0x02, 0xAA, 0xBB},
+			[]uint8{Av1ObuTypeTemporalDelimiter, Av1ObuTypeFrame},
+			[][]byte{{}, {0xAA, 0xBB}},
+			[][]byte{{0x12, 0x00}, {0x32, 0x02, 0xAA, 0xBB}}, ""},
+		{"the last obu without a size field gets one",
+			[]byte{0x12, 0x00, 0x30, 0xAA, 0xBB, 0xCC},
+			[]uint8{Av1ObuTypeTemporalDelimiter, Av1ObuTypeFrame},
+			[][]byte{{}, {0xAA, 0xBB, 0xCC}},
+			[][]byte{{0x12, 0x00}, {0x32, 0x03, 0xAA, 0xBB, 0xCC}}, ""},
+		{"extension header",
+			[]byte{0x36, 0x28, 0x01, 0xAA},
+			[]uint8{Av1ObuTypeFrame},
+			[][]byte{{0xAA}},
+			[][]byte{{0x36, 0x28, 0x01, 0xAA}}, ""},
+		{"empty", nil, nil, nil, nil, ""},
+		{"forbidden bit", []byte{0x92, 0x00}, nil, nil, nil, "obu_forbidden_bit"},
+		{"truncated extension header", []byte{0x36}, nil, nil, nil, "obu header truncated"},
+		{"truncated size", []byte{0x32, 0x80}, nil, nil, nil, "leb128 truncated"},
+		{"size past the end", []byte{0x32, 0x03, 0xAA, 0xBB}, nil, nil, nil, "obu size 3 > remaining 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Flv{Quiet: true}
+			obus, err := f.parseAv1Obus(tt.buf)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseAv1Obus err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAv1Obus failed, err:%v", err)
+			}
+			if len(obus) != len(tt.wantType) {
+				t.Fatalf("%v obus, want %v", len(obus), len(tt.wantType))
+			}
+			for i, obu := range obus {
+				if obu.Type != tt.wantType[i] || !bytes.Equal(obu.Data, tt.wantData[i]) || !bytes.Equal(obu.Raw, tt.wantRaw[i]) {
+					t.Fatalf("obu %v = type %v data %x raw %x, want type %v data %x raw %x",
+						i, obu.Type, obu.Data, obu.Raw, tt.wantType[i], tt.wantData[i], tt.wantRaw[i])
+				}
+			}
+		})
+	}
+}
+
+// av1SequenceHeader is a main profile 1920x1080 sequence header OBU payload
+// with 30 fps timing info and seq_level_idx 8
+func av1SequenceHeader() []byte {
+	return bitFields(
+		0, 3, // seq_profile
+		0, 1, // still_picture
+		0, 1, // reduced_still_picture_header
+		1, 1, // timing_info_present_flag
+		1, 32, // num_units_in_display_tick
+		30, 32, // time_scale
+		1, 1, // equal_picture_interval
+		1, 1, // num_ticks_per_picture_minus_1, uvlc 0
+		0, 1, // decoder_model_info_present_flag
+		0, 1, // initial_display_delay_present_flag
+		0, 5, // operating_points_cnt_minus_1
+		0, 12, // operating_point_idc
+		8, 5, // seq_level_idx
+		0, 1, // seq_tier
+		10, 4, // frame_width_bits_minus_1
+		10, 4, // frame_height_bits_minus_1
+		1919, 11, // max_frame_width_minus_1
+		1079, 11, // max_frame_height_minus_1
+	)
+}
+
+func TestParseAv1SequenceHeaderObu(t *testing.T) {
+	tests := []struct {
+		name       string
+		buf        []byte
+		wantWidth  uint16
+		wantHeight uint16
+		wantErr    bool
+	}{
+		{"timing info and an operating point", av1SequenceHeader(), 1920, 1080, false},
+		{"reduced still picture header", bitFields(
+			0, 3, // seq_profile
+			1, 1, // still_picture
+			1, 1, // reduced_still_picture_header
+			4, 5, // seq_level_idx
+			7, 4, // frame_width_bits_minus_1
+			6, 4, // frame_height_bits_minus_1
+			255, 8, // max_frame_width_minus_1
+			99, 7, // max_frame_height_minus_1
+		), 256, 100, false},
+		{"decoder model info", bitFields(
+			0, 3, 0, 1, 0, 1,
+			1, 1, // timing_info_present_flag
+			1, 32, 25, 32,
+			0, 1, // equal_picture_interval
+			1, 1, // decoder_model_info_present_flag
+			4, 5, // buffer_delay_length_minus_1
+			0, 32, // num_units_in_decoding_tick
+			0, 5, 0, 5, // buffer_removal_time_length_minus_1, frame_presentation_time_length_minus_1
+			1, 1, // initial_display_delay_present_flag
+			0, 5, // operating_points_cnt_minus_1
+			0, 12, // operating_point_idc
+			4, 5, // seq_level_idx
+			1, 1, // decoder_model_present_for_this_op
+			0, 5, 0, 5, 0, 1, // decoder_buffer_delay, encoder_buffer_delay, low_delay_mode_flag
+			1, 1, // initial_display_delay_present_for_this_op
+			9, 4, // initial_display_delay_minus_1
+			9, 4, 8, 4, // frame_width_bits_minus_1, frame_height_bits_minus_1
+			639, 10, 359, 9,
+		), 640, 360, false},
+		{"truncated", av1SequenceHeader()[:4], 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Flv{Quiet: true}
+			err := f.parseAv1SequenceHeaderObu(tt.buf)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseAv1SequenceHeaderObu succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAv1SequenceHeaderObu failed, err:%v", err)
+			}
+			if f.VideoWidth != tt.wantWidth || f.VideoHeight != tt.wantHeight {
+				t.Fatalf("size = %vx%v, want %vx%v", f.VideoWidth, f.VideoHeight, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestParseAv1CodecConfigurationRecord(t *testing.T) {
+	sequenceHeader := av1SequenceHeader()
+	configObus := append([]byte{0x0A, byte(len(sequenceHeader))}, sequenceHeader...)
+	// marker and version 1, main profile level 8, 4:2:0 with chroma position 1,
+	// no initial presentation delay
+	av1C := append([]byte{0x81, 0x08, 0x0D, 0x00}, configObus...)
+
+	f := tagFlv(av1C)
+	if _, err := f.parseAv1CodecConfigurationRecord(av1C, 0); err != nil {
+		t.Fatalf("parseAv1CodecConfigurationRecord failed, err:%v", err)
+	}
+	want := &Av1CodecConfigurationRecord{
+		SeqLevelIdx0:         8,
+		ChromaSubsamplingX:   1,
+		ChromaSubsamplingY:   1,
+		ChromaSamplePosition: 1,
+		ConfigObus:           configObus,
+	}
+	if !reflect.DeepEqual(f.Av1Config, want) {
+		t.Fatalf("Av1Config = %+v, want %+v", f.Av1Config, want)
+	}
+	if f.VideoWidth != 1920 || f.VideoHeight != 1080 {
+		t.Fatalf("size = %vx%v, want 1920x1080", f.VideoWidth, f.VideoHeight)
+	}
+
+	errTests := []struct {
+		name    string
+		buf     []byte
+		wantErr string
+	}{
+		{"short", av1C[:3], "len 3 < 4"},
+		{"no marker", append([]byte{0x01}, av1C[1:]...), "marker or version != 1"},
+		{"version 2", append([]byte{0x82}, av1C[1:]...), "marker or version != 1"},
+		{"truncated config obu", av1C[:len(av1C)-1], "obu size"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tagFlv(tt.buf).parseAv1CodecConfigurationRecord(tt.buf, 0); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseAv1CodecConfigurationRecord err:%v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseAv1TemporalUnit(t *testing.T) {
+	sequenceHeader := av1SequenceHeader()
+	configObus := append([]byte{0x0A, byte(len(sequenceHeader))}, sequenceHeader...)
+	// a frame OBU without a size field
+	frame := []byte{0x30, 0xAA, 0xBB}
+
+	tests := []struct {
+		name      string
+		frameType uint8
+		buf       []byte
+		want      []byte
+	}{
+		{"key frame gets the temporal delimiter and the sequence header", FrameTypeKeyFrame, frame,
+			append(append([]byte{0x12, 0x00}, configObus...), 0x32, 0x02, 0xAA, 0xBB)},
+		{"inter frame gets the temporal delimiter", FrameTypeInterFrame, frame,
+			[]byte{0x12, 0x00, 0x32, 0x02, 0xAA, 0xBB}},
+		{"temporal delimiter and sequence header already there", FrameTypeKeyFrame,
+			append(append([]byte{0x12, 0x00}, configObus...), 0x32, 0x02, 0xAA, 0xBB),
+			append(append([]byte{0x12, 0x00}, configObus...), 0x32, 0x02, 0xAA, 0xBB)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ioutil.TempFile("", "obu")
+			if err != nil {
+				t.Fatalf("ioutil.TempFile failed, err:%v", err)
+			}
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			f := tagFlv(tt.buf)
+			f.obuFile = out
+			f.CurrentTag.FrameType = tt.frameType
+			f.Av1Config = &Av1CodecConfigurationRecord{ConfigObus: configObus}
+			if _, err = f.parseAv1TemporalUnit(tt.buf, 0); err != nil {
+				t.Fatalf("parseAv1TemporalUnit failed, err:%v", err)
+			}
+			written, err := ioutil.ReadFile(out.Name())
+			if err != nil {
+				t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+			}
+			if !bytes.Equal(written, tt.want) {
+				t.Fatalf("wrote %x, want %x", written, tt.want)
+			}
+		})
+	}
+}
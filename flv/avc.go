@@ -0,0 +1,688 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+	"strings"
+)
+
+const (
+	AvcNalUnitTypeNonIdr         = 1
+	AvcNalUnitTypePartitionA     = 2
+	AvcNalUnitTypePartitionB     = 3
+	AvcNalUnitTypePartitionC     = 4
+	AvcNalUnitTypeIdr            = 5
+	AvcNalUnitTypeSei            = 6
+	AvcNalUnitTypeSps            = 7
+	AvcNalUnitTypePps            = 8
+	AvcNalUnitTypeAud            = 9
+	AvcNalUnitTypeEndOfSequence  = 10
+	AvcNalUnitTypeEndOfStream    = 11
+	AvcNalUnitTypeFiller         = 12
+	AvcNalUnitTypeSpsExtension   = 13
+	AvcNalUnitTypePrefix         = 14
+	AvcNalUnitTypeSubsetSps      = 15
+	AvcNalUnitTypeAuxiliarySlice = 19
+	AvcNalUnitTypeSliceExtension = 20
+
+	AvcNalUnitTypeMark byte = 0b00011111
+
+	AvcSliceTypeP  = 0
+	AvcSliceTypeB  = 1
+	AvcSliceTypeI  = 2
+	AvcSliceTypeSP = 3
+	AvcSliceTypeSI = 4
+
+	avcAspectRatioIdcExtendedSar = 255
+)
+
+// avcSampleAspectRatios is indexed by aspect_ratio_idc 1-16
+var avcSampleAspectRatios = [17][2]uint32{
+	{0, 0}, {1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11}, {32, 11},
+	{80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+var AvcNalUnitTypeMap = map[uint8]string{
+	AvcNalUnitTypeNonIdr:         "non-IDR slice",
+	AvcNalUnitTypePartitionA:     "slice data partition A",
+	AvcNalUnitTypePartitionB:     "slice data partition B",
+	AvcNalUnitTypePartitionC:     "slice data partition C",
+	AvcNalUnitTypeIdr:            "IDR slice",
+	AvcNalUnitTypeSei:            "SEI",
+	AvcNalUnitTypeSps:            "SPS",
+	AvcNalUnitTypePps:            "PPS",
+	AvcNalUnitTypeAud:            "AUD",
+	AvcNalUnitTypeEndOfSequence:  "end of sequence",
+	AvcNalUnitTypeEndOfStream:    "end of stream",
+	AvcNalUnitTypeFiller:         "filler",
+	AvcNalUnitTypeSpsExtension:   "SPS extension",
+	AvcNalUnitTypePrefix:         "prefix",
+	AvcNalUnitTypeSubsetSps:      "subset SPS",
+	AvcNalUnitTypeAuxiliarySlice: "auxiliary slice",
+	AvcNalUnitTypeSliceExtension: "slice extension",
+}
+
+var AvcSliceTypeMap = map[uint32]string{
+	AvcSliceTypeP:  "P",
+	AvcSliceTypeB:  "B",
+	AvcSliceTypeI:  "I",
+	AvcSliceTypeSP: "SP",
+	AvcSliceTypeSI: "SI",
+}
+
+var AvcChromaFormatMap = map[uint32]string{
+	0: "monochrome",
+	1: "4:2:0",
+	2: "4:2:2",
+	3: "4:4:4",
+}
+
+// AvcDecoderConfigurationRecord is the AVC sequence header
+type AvcDecoderConfigurationRecord struct {
+	ConfigurationVersion uint8
+	AvcProfileIndication uint8
+	ProfileCompatibility uint8
+	AvcLevelIndication   uint8
+	LengthSizeMinusOne   uint8
+	Sps                  [][]byte
+	Pps                  [][]byte
+
+	// SpsInfo is the first SPS parsed
+	SpsInfo *AvcSps
+}
+
+// CodecString is the RFC 6381 avc1.PPCCLL string
+func (c *AvcDecoderConfigurationRecord) CodecString() string {
+	return fmt.Sprintf("avc1.%02x%02x%02x", c.AvcProfileIndication, c.ProfileCompatibility, c.AvcLevelIndication)
+}
+
+// AvcSps is the part of an H.264 sequence parameter set needed to describe
+// the stream and to parse slice headers and SEI
+type AvcSps struct {
+	ProfileIdc          uint8
+	ConstraintFlags     uint8
+	LevelIdc            uint8
+	SeqParameterSetId   uint32
+	ChromaFormatIdc     uint32
+	SeparateColourPlane bool
+	BitDepthLuma        uint32
+	BitDepthChroma      uint32
+
+	Log2MaxFrameNum         uint32
+	PicOrderCntType         uint32
+	Log2MaxPicOrderCntLsb   uint32
+	DeltaPicOrderAlwaysZero bool
+	MaxNumRefFrames         uint32
+	FrameMbsOnly            bool
+	Width                   uint32 // after cropping
+	Height                  uint32
+
+	// VUI
+	SarWidth                uint32
+	SarHeight               uint32
+	FullRange               bool
+	ColourPrimaries         uint32
+	TransferCharacteristics uint32
+	MatrixCoefficients      uint32
+	TimingInfoPresent       bool
+	NumUnitsInTick          uint32
+	TimeScale               uint32
+	FixedFrameRate          bool
+	CpbDpbDelaysPresent     bool
+	CpbRemovalDelayLength   uint32
+	DpbOutputDelayLength    uint32
+	TimeOffsetLength        uint32
+	PicStructPresent        bool
+	MaxNumReorderFrames     uint32
+	BitstreamRestriction    bool
+}
+
+// FrameRate is time_scale / (2 * num_units_in_tick), 0 without timing info
+func (s *AvcSps) FrameRate() float64 {
+	if !s.TimingInfoPresent || s.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(s.TimeScale) / float64(2*s.NumUnitsInTick)
+}
+
+// ParseAvcSps parses a SPS NAL unit including its header byte
+func ParseAvcSps(nal []byte) (*AvcSps, error) {
+	if len(nal) < 4 {
+		return nil, fmt.Errorf("sps len %v < 4", len(nal))
+	}
+	if nal[0]&AvcNalUnitTypeMark != AvcNalUnitTypeSps {
+		return nil, fmt.Errorf("nal_unit_type %v is not sps", nal[0]&AvcNalUnitTypeMark)
+	}
+
+	r := util.NewBitReader(util.RemoveEmulationPrevention(nal[1:]))
+	s := &AvcSps{ChromaFormatIdc: 1, BitDepthLuma: 8, BitDepthChroma: 8}
+	profileIdc, _ := r.ReadBits(8)
+	constraintFlags, _ := r.ReadBits(8)
+	levelIdc, _ := r.ReadBits(8)
+	s.ProfileIdc, s.ConstraintFlags, s.LevelIdc = uint8(profileIdc), uint8(constraintFlags), uint8(levelIdc)
+
+	var err error
+	ue := func(name string) uint32 {
+		if err != nil {
+			return 0
+		}
+		var x uint32
+		if x, err = r.ReadUE(); err != nil {
+			err = fmt.Errorf("%v: %v", name, err)
+		}
+		return x
+	}
+	bits := func(name string, n int) uint32 {
+		if err != nil {
+			return 0
+		}
+		var x uint32
+		if x, err = r.ReadBits(n); err != nil {
+			err = fmt.Errorf("%v: %v", name, err)
+		}
+		return x
+	}
+
+	s.SeqParameterSetId = ue("seq_parameter_set_id")
+	switch s.ProfileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		s.ChromaFormatIdc = ue("chroma_format_idc")
+		if s.ChromaFormatIdc == 3 {
+			s.SeparateColourPlane = bits("separate_colour_plane_flag", 1) == 1
+		}
+		s.BitDepthLuma = ue("bit_depth_luma_minus8") + 8
+		s.BitDepthChroma = ue("bit_depth_chroma_minus8") + 8
+		bits("qpprime_y_zero_transform_bypass_flag", 1)
+		if bits("seq_scaling_matrix_present_flag", 1) == 1 {
+			lists := 8
+			if s.ChromaFormatIdc == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists && err == nil; i++ {
+				if bits("seq_scaling_list_present_flag", 1) == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				if err = skipAvcScalingList(r, size); err != nil {
+					err = fmt.Errorf("scaling_list: %v", err)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.Log2MaxFrameNum = ue("log2_max_frame_num_minus4") + 4
+	s.PicOrderCntType = ue("pic_order_cnt_type")
+	switch s.PicOrderCntType {
+	case 0:
+		s.Log2MaxPicOrderCntLsb = ue("log2_max_pic_order_cnt_lsb_minus4") + 4
+	case 1:
+		s.DeltaPicOrderAlwaysZero = bits("delta_pic_order_always_zero_flag", 1) == 1
+		if err == nil {
+			_, err = r.ReadSE() // offset_for_non_ref_pic
+		}
+		if err == nil {
+			_, err = r.ReadSE() // offset_for_top_to_bottom_field
+		}
+		cycle := ue("num_ref_frames_in_pic_order_cnt_cycle")
+		for i := uint32(0); i < cycle && err == nil; i++ {
+			_, err = r.ReadSE() // offset_for_ref_frame
+		}
+	}
+	s.MaxNumRefFrames = ue("max_num_ref_frames")
+	bits("gaps_in_frame_num_value_allowed_flag", 1)
+	widthInMbs := ue("pic_width_in_mbs_minus1") + 1
+	heightInMapUnits := ue("pic_height_in_map_units_minus1") + 1
+	s.FrameMbsOnly = bits("frame_mbs_only_flag", 1) == 1
+	if !s.FrameMbsOnly {
+		bits("mb_adaptive_frame_field_flag", 1)
+	}
+	bits("direct_8x8_inference_flag", 1)
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	if bits("frame_cropping_flag", 1) == 1 {
+		cropLeft = ue("frame_crop_left_offset")
+		cropRight = ue("frame_crop_right_offset")
+		cropTop = ue("frame_crop_top_offset")
+		cropBottom = ue("frame_crop_bottom_offset")
+	}
+	vuiPresent := bits("vui_parameters_present_flag", 1) == 1
+	if err != nil {
+		return nil, err
+	}
+
+	frameHeightFactor := uint32(1)
+	if !s.FrameMbsOnly {
+		frameHeightFactor = 2
+	}
+	cropUnitX, cropUnitY := uint32(1), frameHeightFactor
+	if !s.SeparateColourPlane && s.ChromaFormatIdc != 0 {
+		subWidthC, subHeightC := uint32(2), uint32(2)
+		if s.ChromaFormatIdc == 2 {
+			subHeightC = 1
+		} else if s.ChromaFormatIdc == 3 {
+			subWidthC, subHeightC = 1, 1
+		}
+		cropUnitX, cropUnitY = subWidthC, subHeightC*frameHeightFactor
+	}
+	codedWidth := uint64(widthInMbs) * 16
+	codedHeight := uint64(heightInMapUnits) * 16 * uint64(frameHeightFactor)
+	cropWidth := uint64(cropUnitX) * (uint64(cropLeft) + uint64(cropRight))
+	cropHeight := uint64(cropUnitY) * (uint64(cropTop) + uint64(cropBottom))
+	if cropWidth >= codedWidth || cropHeight >= codedHeight {
+		return nil, fmt.Errorf("crop %vx%v does not fit the coded size %vx%v", cropWidth, cropHeight, codedWidth, codedHeight)
+	}
+	s.Width = uint32(codedWidth - cropWidth)
+	s.Height = uint32(codedHeight - cropHeight)
+
+	if vuiPresent {
+		if err = s.parseVui(r); err != nil {
+			return nil, fmt.Errorf("vui_parameters: %v", err)
+		}
+	}
+
+	return s, nil
+}
+
+// AvcPps keeps the fields slice headers depend on
+type AvcPps struct {
+	PicParameterSetId                 uint32
+	SeqParameterSetId                 uint32
+	EntropyCodingModeFlag             bool
+	BottomFieldPicOrderInFramePresent bool
+}
+
+// ParseAvcPps parses the start of a PPS NAL unit including its header byte
+func ParseAvcPps(nal []byte) (*AvcPps, error) {
+	if len(nal) < 2 {
+		return nil, fmt.Errorf("pps len %v < 2", len(nal))
+	}
+	if nal[0]&AvcNalUnitTypeMark != AvcNalUnitTypePps {
+		return nil, fmt.Errorf("nal_unit_type %v is not pps", nal[0]&AvcNalUnitTypeMark)
+	}
+
+	r := util.NewBitReader(util.RemoveEmulationPrevention(nal[1:]))
+	p := new(AvcPps)
+	var err error
+	if p.PicParameterSetId, err = r.ReadUE(); err != nil {
+		return nil, fmt.Errorf("pic_parameter_set_id: %v", err)
+	}
+	if p.SeqParameterSetId, err = r.ReadUE(); err != nil {
+		return nil, fmt.Errorf("seq_parameter_set_id: %v", err)
+	}
+	if p.EntropyCodingModeFlag, err = r.ReadFlag(); err != nil {
+		return nil, fmt.Errorf("entropy_coding_mode_flag: %v", err)
+	}
+	if p.BottomFieldPicOrderInFramePresent, err = r.ReadFlag(); err != nil {
+		return nil, fmt.Errorf("bottom_field_pic_order_in_frame_present_flag: %v", err)
+	}
+	return p, nil
+}
+
+// AvcSliceHeader is the start of a slice header, up to pic_order_cnt_lsb
+type AvcSliceHeader struct {
+	NalUnitType       uint8
+	NalRefIdc         uint8
+	FirstMbInSlice    uint32
+	SliceType         uint32 // 0-4, the +5 variants folded
+	PicParameterSetId uint32
+	FrameNum          uint32
+	FieldPic          bool
+	BottomField       bool
+	IdrPicId          uint32
+	PicOrderCntLsb    uint32
+}
+
+// parseAvcSliceHeader needs the PPS and SPS the slice refers to for the
+// fields after pic_parameter_set_id, without them only those are returned
+func parseAvcSliceHeader(nal []byte, spsMap map[uint32]*AvcSps, ppsMap map[uint32]*AvcPps) (*AvcSliceHeader, error) {
+	if len(nal) < 2 {
+		return nil, fmt.Errorf("slice len %v < 2", len(nal))
+	}
+
+	// slice headers are short, only their start is unescaped
+	rbspSize := len(nal)
+	if rbspSize > 64 {
+		rbspSize = 64
+	}
+	r := util.NewBitReader(util.RemoveEmulationPrevention(nal[1:rbspSize]))
+	h := &AvcSliceHeader{NalUnitType: nal[0] & AvcNalUnitTypeMark, NalRefIdc: (nal[0] >> 5) & 0b11}
+	var err error
+	if h.FirstMbInSlice, err = r.ReadUE(); err != nil {
+		return nil, fmt.Errorf("first_mb_in_slice: %v", err)
+	}
+	if h.SliceType, err = r.ReadUE(); err != nil {
+		return nil, fmt.Errorf("slice_type: %v", err)
+	}
+	if h.SliceType > 9 {
+		return nil, fmt.Errorf("slice_type %v > 9", h.SliceType)
+	}
+	h.SliceType %= 5
+	if h.PicParameterSetId, err = r.ReadUE(); err != nil {
+		return nil, fmt.Errorf("pic_parameter_set_id: %v", err)
+	}
+
+	pps, ok := ppsMap[h.PicParameterSetId]
+	if !ok {
+		return h, nil
+	}
+	sps, ok := spsMap[pps.SeqParameterSetId]
+	if !ok {
+		return h, nil
+	}
+	if sps.SeparateColourPlane {
+		if err = r.Skip(2); err != nil { // colour_plane_id
+			return nil, fmt.Errorf("colour_plane_id: %v", err)
+		}
+	}
+	if h.FrameNum, err = r.ReadBits(int(sps.Log2MaxFrameNum)); err != nil {
+		return nil, fmt.Errorf("frame_num: %v", err)
+	}
+	if !sps.FrameMbsOnly {
+		if h.FieldPic, err = r.ReadFlag(); err != nil {
+			return nil, fmt.Errorf("field_pic_flag: %v", err)
+		}
+		if h.FieldPic {
+			if h.BottomField, err = r.ReadFlag(); err != nil {
+				return nil, fmt.Errorf("bottom_field_flag: %v", err)
+			}
+		}
+	}
+	if h.NalUnitType == AvcNalUnitTypeIdr {
+		if h.IdrPicId, err = r.ReadUE(); err != nil {
+			return nil, fmt.Errorf("idr_pic_id: %v", err)
+		}
+	}
+	if sps.PicOrderCntType == 0 {
+		if h.PicOrderCntLsb, err = r.ReadBits(int(sps.Log2MaxPicOrderCntLsb)); err != nil {
+			return nil, fmt.Errorf("pic_order_cnt_lsb: %v", err)
+		}
+	}
+	return h, nil
+}
+
+// AvcTagSummary describes the NAL units of one AVC NALU tag
+type AvcTagSummary struct {
+	NalUnitTypes []uint8
+	Slices       []*AvcSliceHeader
+	HasIdr       bool
+	// OpenGop is a keyframe tag starting with a non-IDR I slice, a recovery
+	// point pictures before it may be referenced by the following frames
+	OpenGop bool
+	// MislabeledKeyframe is a keyframe tag without any I slice, or an IDR in
+	// a tag not flagged as keyframe
+	MislabeledKeyframe bool
+	// MissingParameterSets is an IDR whose PPS or SPS was not seen before
+	MissingParameterSets bool
+	Sei                  []*AvcSeiMessage
+}
+
+// parseAvcNalu classifies one NAL unit of the current tag and keeps track of
+// the parameter sets seen so far
+func (f *Flv) parseAvcNalu(nal []byte) error {
+	if len(nal) < 1 {
+		return fmt.Errorf("empty nalu")
+	}
+	if f.CurrentTag.AvcSummary == nil {
+		f.CurrentTag.AvcSummary = new(AvcTagSummary)
+	}
+	summary := f.CurrentTag.AvcSummary
+	nalUnitType := nal[0] & AvcNalUnitTypeMark
+	summary.NalUnitTypes = append(summary.NalUnitTypes, nalUnitType)
+
+	switch nalUnitType {
+	case AvcNalUnitTypeSps:
+		sps, err := ParseAvcSps(nal)
+		if err != nil {
+			f.printf("in band sps is not parsed, err:%v\n", err)
+			return nil
+		}
+		f.setAvcSps(sps)
+	case AvcNalUnitTypePps:
+		pps, err := ParseAvcPps(nal)
+		if err != nil {
+			f.printf("in band pps is not parsed, err:%v\n", err)
+			return nil
+		}
+		f.setAvcPps(pps)
+	case AvcNalUnitTypeSei:
+		f.parseAvcSeiNalu(nal, summary)
+	case AvcNalUnitTypeNonIdr, AvcNalUnitTypeIdr:
+		h, err := parseAvcSliceHeader(nal, f.avcSps, f.avcPps)
+		if err != nil {
+			f.printf("slice header is not parsed, err:%v\n", err)
+			return nil
+		}
+		summary.Slices = append(summary.Slices, h)
+		if nalUnitType == AvcNalUnitTypeIdr {
+			summary.HasIdr = true
+			pps, ok := f.avcPps[h.PicParameterSetId]
+			if !ok {
+				summary.MissingParameterSets = true
+			} else if _, ok = f.avcSps[pps.SeqParameterSetId]; !ok {
+				summary.MissingParameterSets = true
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Flv) setAvcSps(sps *AvcSps) {
+	if f.avcSps == nil {
+		f.avcSps = make(map[uint32]*AvcSps)
+	}
+	f.avcSps[sps.SeqParameterSetId] = sps
+	f.avcLastSps = sps
+}
+
+func (f *Flv) setAvcPps(pps *AvcPps) {
+	if f.avcPps == nil {
+		f.avcPps = make(map[uint32]*AvcPps)
+	}
+	f.avcPps[pps.PicParameterSetId] = pps
+}
+
+// summarizeAvcTag prints the NAL units of the tag and flags GOP structure
+// problems against the FrameType of the tag
+func (f *Flv) summarizeAvcTag() {
+	summary := f.CurrentTag.AvcSummary
+	if summary == nil {
+		return
+	}
+
+	keyFrame := f.CurrentTag.FrameType == FrameTypeKeyFrame
+	hasISlice := false
+	for _, slice := range summary.Slices {
+		if slice.SliceType == AvcSliceTypeI || slice.SliceType == AvcSliceTypeSI {
+			hasISlice = true
+		}
+	}
+	if keyFrame && !summary.HasIdr {
+		if len(summary.Slices) > 0 && summary.Slices[0].NalUnitType == AvcNalUnitTypeNonIdr && hasISlice {
+			summary.OpenGop = true
+		} else {
+			summary.MislabeledKeyframe = true
+		}
+	}
+	if !keyFrame && summary.HasIdr {
+		summary.MislabeledKeyframe = true
+	}
+
+	nalus := make([]string, 0, len(summary.NalUnitTypes))
+	slice := 0
+	for _, nalUnitType := range summary.NalUnitTypes {
+		s, ok := AvcNalUnitTypeMap[nalUnitType]
+		if !ok {
+			s = fmt.Sprintf("nal_unit_type %v", nalUnitType)
+		}
+		if (nalUnitType == AvcNalUnitTypeNonIdr || nalUnitType == AvcNalUnitTypeIdr) && slice < len(summary.Slices) {
+			h := summary.Slices[slice]
+			s += fmt.Sprintf("(%v frame_num %v)", AvcSliceTypeMap[h.SliceType], h.FrameNum)
+			slice++
+		}
+		nalus = append(nalus, s)
+	}
+	f.printf("avc nalus are %v\n", strings.Join(nalus, ", "))
+
+	if summary.OpenGop {
+		f.printf("avc keyframe without IDR starts with an I slice, open GOP\n")
+	}
+	if summary.MislabeledKeyframe {
+		if keyFrame {
+			f.printf("avc tag is flagged as keyframe without IDR or I slice\n")
+		} else {
+			f.printf("avc tag with IDR is not flagged as keyframe\n")
+		}
+	}
+	if summary.MissingParameterSets {
+		f.printf("avc IDR without SPS/PPS before it\n")
+	}
+}
+
+func skipAvcScalingList(r *util.BitReader, size int) error {
+	lastScale, nextScale := int32(8), int32(8)
+	for j := 0; j < size; j++ {
+		if nextScale != 0 {
+			deltaScale, err := r.ReadSE()
+			if err != nil {
+				return err
+			}
+			nextScale = (lastScale + deltaScale + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+	return nil
+}
+
+func (s *AvcSps) parseVui(r *util.BitReader) error {
+	var err error
+	flag := func() bool {
+		if err != nil {
+			return false
+		}
+		var x bool
+		x, err = r.ReadFlag()
+		return x
+	}
+	bits := func(n int) uint32 {
+		if err != nil {
+			return 0
+		}
+		var x uint32
+		x, err = r.ReadBits(n)
+		return x
+	}
+	ue := func() uint32 {
+		if err != nil {
+			return 0
+		}
+		var x uint32
+		x, err = r.ReadUE()
+		return x
+	}
+
+	if flag() { // aspect_ratio_info_present_flag
+		aspectRatioIdc := bits(8)
+		if aspectRatioIdc == avcAspectRatioIdcExtendedSar {
+			s.SarWidth, s.SarHeight = bits(16), bits(16)
+		} else if int(aspectRatioIdc) < len(avcSampleAspectRatios) {
+			s.SarWidth, s.SarHeight = avcSampleAspectRatios[aspectRatioIdc][0], avcSampleAspectRatios[aspectRatioIdc][1]
+		}
+	}
+	if flag() { // overscan_info_present_flag
+		bits(1)
+	}
+	if flag() { // video_signal_type_present_flag
+		bits(3) // video_format
+		s.FullRange = flag()
+		if flag() { // colour_description_present_flag
+			s.ColourPrimaries, s.TransferCharacteristics, s.MatrixCoefficients = bits(8), bits(8), bits(8)
+		}
+	}
+	if flag() { // chroma_loc_info_present_flag
+		ue()
+		ue()
+	}
+	s.TimingInfoPresent = flag()
+	if s.TimingInfoPresent {
+		s.NumUnitsInTick, s.TimeScale = bits(32), bits(32)
+		s.FixedFrameRate = flag()
+	}
+	nalHrd := flag()
+	if nalHrd && err == nil {
+		err = s.parseHrd(r)
+	}
+	vclHrd := flag()
+	if vclHrd && err == nil {
+		err = s.parseHrd(r)
+	}
+	if nalHrd || vclHrd {
+		s.CpbDpbDelaysPresent = true
+		bits(1) // low_delay_hrd_flag
+	}
+	s.PicStructPresent = flag()
+	s.BitstreamRestriction = flag()
+	if s.BitstreamRestriction {
+		bits(1) // motion_vectors_over_pic_boundaries_flag
+		ue()    // max_bytes_per_pic_denom
+		ue()    // max_bits_per_mb_denom
+		ue()    // log2_max_mv_length_horizontal
+		ue()    // log2_max_mv_length_vertical
+		s.MaxNumReorderFrames = ue()
+		ue() // max_dec_frame_buffering
+	}
+	return err
+}
+
+func (s *AvcSps) parseHrd(r *util.BitReader) error {
+	cpbCnt, err := r.ReadUE()
+	if err != nil {
+		return err
+	}
+	if err = r.Skip(8); err != nil { // bit_rate_scale, cpb_size_scale
+		return err
+	}
+	for i := uint32(0); i <= cpbCnt; i++ {
+		if _, err = r.ReadUE(); err != nil { // bit_rate_value_minus1
+			return err
+		}
+		if _, err = r.ReadUE(); err != nil { // cpb_size_value_minus1
+			return err
+		}
+		if err = r.Skip(1); err != nil { // cbr_flag
+			return err
+		}
+	}
+	if err = r.Skip(5); err != nil { // initial_cpb_removal_delay_length_minus1
+		return err
+	}
+	cpbRemovalDelayLength, _ := r.ReadBits(5)
+	dpbOutputDelayLength, _ := r.ReadBits(5)
+	timeOffsetLength, err := r.ReadBits(5)
+	if err != nil {
+		return err
+	}
+	s.CpbRemovalDelayLength = cpbRemovalDelayLength + 1
+	s.DpbOutputDelayLength = dpbOutputDelayLength + 1
+	s.TimeOffsetLength = timeOffsetLength
+	return nil
+}
+
+func (f *Flv) printAvcSps(s *AvcSps) {
+	f.printf("sps profile_idc is %v, level_idc is %v\n", s.ProfileIdc, s.LevelIdc)
+	f.printf("sps width is %v, height is %v\n", s.Width, s.Height)
+	f.printf("sps chroma format is %v, bit depth is %v/%v\n", AvcChromaFormatMap[s.ChromaFormatIdc], s.BitDepthLuma, s.BitDepthChroma)
+	if s.SarWidth != 0 {
+		f.printf("sps sar is %v:%v\n", s.SarWidth, s.SarHeight)
+	}
+	if s.TimingInfoPresent {
+		f.printf("sps num_units_in_tick is %v, time_scale is %v, frame rate is %.3f, fixed is %v\n",
+			s.NumUnitsInTick, s.TimeScale, s.FrameRate(), s.FixedFrameRate)
+	}
+}
@@ -0,0 +1,390 @@
+package flv
+
+import (
+	"flvParse/util"
+	"math"
+	"math/bits"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// spsWriter builds SPS NAL units field by field
+type spsWriter struct {
+	util.BitWriter
+}
+
+func (w *spsWriter) ue(x uint32) {
+	n := bits.Len32(x + 1)
+	w.WriteBits(0, n-1)
+	w.WriteBits(x+1, n)
+}
+
+// nal adds the rbsp_trailing_bits, the header byte and the emulation
+// prevention bytes
+func (w *spsWriter) nal() []byte {
+	w.WriteBits(1, 1)
+	w.ByteAlign()
+	nal := []byte{0x67}
+	zeros := 0
+	for _, b := range w.Bytes() {
+		if zeros >= 2 && b <= 3 {
+			nal = append(nal, 0x03)
+			zeros = 0
+		}
+		nal = append(nal, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return nal
+}
+
+// sps1080p is a High profile 1920x1080 SPS, 1088 coded rows with a bottom
+// crop of 8, 29.97 fps VUI timing and max_num_reorder_frames 2
+func sps1080p(cropBottom uint32) []byte {
+	w := new(spsWriter)
+	w.WriteBits(100, 8) // profile_idc
+	w.WriteBits(0, 8)   // constraint flags
+	w.WriteBits(40, 8)  // level_idc
+	w.ue(0)             // seq_parameter_set_id
+	w.ue(1)             // chroma_format_idc
+	w.ue(0)             // bit_depth_luma_minus8
+	w.ue(0)             // bit_depth_chroma_minus8
+	w.WriteBits(0, 1)   // qpprime_y_zero_transform_bypass_flag
+	w.WriteBits(0, 1)   // seq_scaling_matrix_present_flag
+	w.ue(0)             // log2_max_frame_num_minus4
+	w.ue(0)             // pic_order_cnt_type
+	w.ue(2)             // log2_max_pic_order_cnt_lsb_minus4
+	w.ue(4)             // max_num_ref_frames
+	w.WriteBits(0, 1)   // gaps_in_frame_num_value_allowed_flag
+	w.ue(119)           // pic_width_in_mbs_minus1
+	w.ue(67)            // pic_height_in_map_units_minus1
+	w.WriteBits(1, 1)   // frame_mbs_only_flag
+	w.WriteBits(1, 1)   // direct_8x8_inference_flag
+	w.WriteBits(1, 1)   // frame_cropping_flag
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(cropBottom)  // in units of 2 rows for 4:2:0
+	w.WriteBits(1, 1) // vui_parameters_present_flag
+
+	w.WriteBits(1, 1) // aspect_ratio_info_present_flag
+	w.WriteBits(1, 8) // 1:1
+	w.WriteBits(0, 1) // overscan_info_present_flag
+	w.WriteBits(0, 1) // video_signal_type_present_flag
+	w.WriteBits(1, 1) // chroma_loc_info_present_flag
+	w.ue(0)
+	w.ue(0)
+	w.WriteBits(1, 1)     // timing_info_present_flag
+	w.WriteBits(1001, 32) // byte aligned, 00 00 03 e9 is escaped to 00 00 03 03 e9
+	w.WriteBits(60000, 32)
+	w.WriteBits(1, 1) // fixed_frame_rate_flag
+	w.WriteBits(0, 1) // nal_hrd_parameters_present_flag
+	w.WriteBits(0, 1) // vcl_hrd_parameters_present_flag
+	w.WriteBits(0, 1) // pic_struct_present_flag
+	w.WriteBits(1, 1) // bitstream_restriction_flag
+	w.WriteBits(1, 1) // motion_vectors_over_pic_boundaries_flag
+	w.ue(2)           // max_bytes_per_pic_denom
+	w.ue(1)           // max_bits_per_mb_denom
+	w.ue(16)          // log2_max_mv_length_horizontal
+	w.ue(16)          // log2_max_mv_length_vertical
+	w.ue(2)           // max_num_reorder_frames
+	w.ue(4)           // max_dec_frame_buffering
+	return w.nal()
+}
+
+func TestParseAvcSps(t *testing.T) {
+	nal := sps1080p(4)
+	if !strings.Contains(string(nal), "\x00\x00\x03\x03") {
+		t.Fatalf("sps %x has no emulation prevention byte", nal)
+	}
+	s, err := ParseAvcSps(nal)
+	if err != nil {
+		t.Fatalf("ParseAvcSps(%x) failed, err:%v", nal, err)
+	}
+
+	if s.ProfileIdc != 100 || s.LevelIdc != 40 || s.ChromaFormatIdc != 1 || s.BitDepthLuma != 8 {
+		t.Fatalf("profile %v level %v chroma %v bit depth %v, want 100 40 1 8", s.ProfileIdc, s.LevelIdc, s.ChromaFormatIdc, s.BitDepthLuma)
+	}
+	if s.Log2MaxPicOrderCntLsb != 6 || s.MaxNumRefFrames != 4 {
+		t.Fatalf("log2_max_pic_order_cnt_lsb %v max_num_ref_frames %v, want 6 4", s.Log2MaxPicOrderCntLsb, s.MaxNumRefFrames)
+	}
+	if s.Width != 1920 || s.Height != 1080 {
+		t.Fatalf("size %vx%v, want 1920x1080", s.Width, s.Height)
+	}
+	if s.SarWidth != 1 || s.SarHeight != 1 {
+		t.Fatalf("sar %v:%v, want 1:1", s.SarWidth, s.SarHeight)
+	}
+	if !s.TimingInfoPresent || !s.FixedFrameRate || math.Abs(s.FrameRate()-30000.0/1001) > 1e-9 {
+		t.Fatalf("FrameRate() = %v, want 29.97", s.FrameRate())
+	}
+	if !s.BitstreamRestriction || s.MaxNumReorderFrames != 2 {
+		t.Fatalf("bitstream_restriction %v max_num_reorder_frames %v, want true 2", s.BitstreamRestriction, s.MaxNumReorderFrames)
+	}
+}
+
+func TestParseAvcSpsCropTooLarge(t *testing.T) {
+	// 1088 coded rows, a bottom crop of 2*544 rows leaves nothing
+	for _, cropBottom := range []uint32{544, 600, 0x7FFFFFFF} {
+		if _, err := ParseAvcSps(sps1080p(cropBottom)); err == nil || !strings.Contains(err.Error(), "crop") {
+			t.Fatalf("ParseAvcSps with crop %v err:%v, want a crop error", cropBottom, err)
+		}
+	}
+}
+
+// avcNalu builds a NAL unit with the given header byte, fields writes the RBSP
+func avcNalu(header byte, fields func(w *spsWriter)) []byte {
+	w := new(spsWriter)
+	fields(w)
+	nal := w.nal()
+	nal[0] = header
+	return nal
+}
+
+// avcPps is a CAVLC PPS referring to an SPS
+func avcPps(ppsId, spsId uint32) []byte {
+	return avcNalu(0x68, func(w *spsWriter) {
+		w.ue(ppsId)
+		w.ue(spsId)
+		w.WriteBits(0, 1) // entropy_coding_mode_flag
+		w.WriteBits(0, 1) // bottom_field_pic_order_in_frame_present_flag
+		w.ue(0)           // num_slice_groups_minus1
+	})
+}
+
+// avcSlice is a slice header for sps1080p, 4 bits of frame_num and 6 bits of
+// pic_order_cnt_lsb, an IDR also has idr_pic_id 3
+func avcSlice(header byte, sliceType, ppsId, frameNum, picOrderCntLsb uint32) []byte {
+	return avcNalu(header, func(w *spsWriter) {
+		w.ue(0) // first_mb_in_slice
+		w.ue(sliceType)
+		w.ue(ppsId)
+		w.WriteBits(frameNum, 4)
+		if header&AvcNalUnitTypeMark == AvcNalUnitTypeIdr {
+			w.ue(3)
+		}
+		w.WriteBits(picOrderCntLsb, 6)
+		w.WriteBits(0xAA, 8) // the rest of the slice
+	})
+}
+
+// spsInterlaced is a Baseline 720x576 field coded SPS with id 1, 5 bits of
+// frame_num and pic_order_cnt_type 2
+func spsInterlaced() []byte {
+	return avcNalu(0x67, func(w *spsWriter) {
+		w.WriteBits(66, 8)
+		w.WriteBits(0, 8)
+		w.WriteBits(30, 8)
+		w.ue(1) // seq_parameter_set_id
+		w.ue(1) // log2_max_frame_num_minus4
+		w.ue(2) // pic_order_cnt_type
+		w.ue(1) // max_num_ref_frames
+		w.WriteBits(0, 1)
+		w.ue(44)          // pic_width_in_mbs_minus1
+		w.ue(17)          // pic_height_in_map_units_minus1
+		w.WriteBits(0, 1) // frame_mbs_only_flag
+		w.WriteBits(1, 1) // mb_adaptive_frame_field_flag
+		w.WriteBits(1, 1) // direct_8x8_inference_flag
+		w.WriteBits(0, 1) // frame_cropping_flag
+		w.WriteBits(0, 1) // vui_parameters_present_flag
+	})
+}
+
+// avcParameterSets parses sps1080p with PPS 0 and spsInterlaced with PPS 1
+func avcParameterSets(t *testing.T) (map[uint32]*AvcSps, map[uint32]*AvcPps) {
+	t.Helper()
+	spsMap, ppsMap := make(map[uint32]*AvcSps), make(map[uint32]*AvcPps)
+	for _, nal := range [][]byte{sps1080p(4), spsInterlaced()} {
+		sps, err := ParseAvcSps(nal)
+		if err != nil {
+			t.Fatalf("ParseAvcSps failed, err:%v", err)
+		}
+		spsMap[sps.SeqParameterSetId] = sps
+	}
+	for _, nal := range [][]byte{avcPps(0, 0), avcPps(1, 1), avcPps(2, 7)} {
+		pps, err := ParseAvcPps(nal)
+		if err != nil {
+			t.Fatalf("ParseAvcPps failed, err:%v", err)
+		}
+		ppsMap[pps.PicParameterSetId] = pps
+	}
+	return spsMap, ppsMap
+}
+
+func TestParseAvcSliceHeader(t *testing.T) {
+	spsMap, ppsMap := avcParameterSets(t)
+	if sps := spsMap[1]; sps.FrameMbsOnly || sps.Width != 720 || sps.Height != 576 || sps.Log2MaxFrameNum != 5 {
+		t.Fatalf("interlaced sps = %+v, want 720x576 fields", sps)
+	}
+
+	tests := []struct {
+		name    string
+		nal     []byte
+		want    AvcSliceHeader
+		wantErr string
+	}{
+		// slice_type 7 is I with all slices of the picture I
+		{"IDR", avcSlice(0x65, 7, 0, 0, 0), AvcSliceHeader{
+			NalUnitType: AvcNalUnitTypeIdr, NalRefIdc: 3, SliceType: AvcSliceTypeI, IdrPicId: 3,
+		}, ""},
+		{"P", avcSlice(0x41, 5, 0, 5, 10), AvcSliceHeader{
+			NalUnitType: AvcNalUnitTypeNonIdr, NalRefIdc: 2, SliceType: AvcSliceTypeP, FrameNum: 5, PicOrderCntLsb: 10,
+		}, ""},
+		{"non-reference B", avcSlice(0x01, 1, 0, 6, 4), AvcSliceHeader{
+			NalUnitType: AvcNalUnitTypeNonIdr, SliceType: AvcSliceTypeB, FrameNum: 6, PicOrderCntLsb: 4,
+		}, ""},
+		{"non-IDR I at frame_num 15", avcSlice(0x61, 2, 0, 15, 63), AvcSliceHeader{
+			NalUnitType: AvcNalUnitTypeNonIdr, NalRefIdc: 3, SliceType: AvcSliceTypeI, FrameNum: 15, PicOrderCntLsb: 63,
+		}, ""},
+		{"bottom field", avcNalu(0x41, func(w *spsWriter) {
+			w.ue(0)
+			w.ue(0)
+			w.ue(1)
+			w.WriteBits(17, 5) // frame_num
+			w.WriteBits(1, 1)  // field_pic_flag
+			w.WriteBits(1, 1)  // bottom_field_flag
+		}), AvcSliceHeader{
+			NalUnitType: AvcNalUnitTypeNonIdr, NalRefIdc: 2, PicParameterSetId: 1, FrameNum: 17, FieldPic: true, BottomField: true,
+		}, ""},
+		{"frame of a field coded stream", avcNalu(0x21, func(w *spsWriter) {
+			w.ue(0)
+			w.ue(6)
+			w.ue(1)
+			w.WriteBits(2, 5)
+			w.WriteBits(0, 1)
+		}), AvcSliceHeader{
+			NalUnitType: AvcNalUnitTypeNonIdr, NalRefIdc: 1, SliceType: AvcSliceTypeB, PicParameterSetId: 1, FrameNum: 2,
+		}, ""},
+		// without the PPS or its SPS the header ends at pic_parameter_set_id
+		{"unknown PPS", avcSlice(0x41, 0, 5, 5, 10), AvcSliceHeader{
+			NalUnitType: AvcNalUnitTypeNonIdr, NalRefIdc: 2, PicParameterSetId: 5,
+		}, ""},
+		{"unknown SPS", avcSlice(0x41, 0, 2, 5, 10), AvcSliceHeader{
+			NalUnitType: AvcNalUnitTypeNonIdr, NalRefIdc: 2, PicParameterSetId: 2,
+		}, ""},
+		{"short", []byte{0x65}, AvcSliceHeader{}, "slice len 1 < 2"},
+		{"slice_type 10", avcNalu(0x41, func(w *spsWriter) { w.ue(0); w.ue(10); w.ue(0) }), AvcSliceHeader{}, "slice_type 10 > 9"},
+		// PPS 1 refers to the 5 bits of frame_num, 3 bits are left
+		{"truncated frame_num", []byte{0x41, 0xD0}, AvcSliceHeader{}, "frame_num"},
+		{"truncated idr_pic_id", []byte{0x65, 0xE0}, AvcSliceHeader{}, "idr_pic_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := parseAvcSliceHeader(tt.nal, spsMap, ppsMap)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseAvcSliceHeader err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAvcSliceHeader failed, err:%v", err)
+			}
+			if !reflect.DeepEqual(*h, tt.want) {
+				t.Fatalf("parseAvcSliceHeader = %+v, want %+v", *h, tt.want)
+			}
+		})
+	}
+}
+
+// avcNaluTag is the body of an AVC NALU tag from the byte after the
+// CompositionTime, with 4 byte length prefixes
+func avcNaluTag(nals ...[]byte) []byte {
+	var buf []byte
+	for _, nal := range nals {
+		buf = append(buf, u32(uint32(len(nal)))...)
+		buf = append(buf, nal...)
+	}
+	return buf
+}
+
+func TestSummarizeAvcTag(t *testing.T) {
+	idr := avcSlice(0x65, 7, 0, 0, 0)
+	tests := []struct {
+		name      string
+		known     bool // sps1080p and PPS 0 are known from the sequence header
+		frameType uint8
+		nals      [][]byte
+		want      AvcTagSummary
+	}{
+		{"IDR after the sequence header", true, FrameTypeKeyFrame, [][]byte{idr}, AvcTagSummary{
+			NalUnitTypes: []uint8{AvcNalUnitTypeIdr},
+			Slices:       []*AvcSliceHeader{{NalUnitType: AvcNalUnitTypeIdr, NalRefIdc: 3, SliceType: AvcSliceTypeI, IdrPicId: 3}},
+			HasIdr:       true,
+		}},
+		{"IDR with in band SPS and PPS", false, FrameTypeKeyFrame, [][]byte{sps1080p(4), avcPps(0, 0), idr}, AvcTagSummary{
+			NalUnitTypes: []uint8{AvcNalUnitTypeSps, AvcNalUnitTypePps, AvcNalUnitTypeIdr},
+			Slices:       []*AvcSliceHeader{{NalUnitType: AvcNalUnitTypeIdr, NalRefIdc: 3, SliceType: AvcSliceTypeI, IdrPicId: 3}},
+			HasIdr:       true,
+		}},
+		// the slice_type is known without the parameter sets
+		{"IDR without SPS and PPS", false, FrameTypeKeyFrame, [][]byte{idr}, AvcTagSummary{
+			NalUnitTypes:         []uint8{AvcNalUnitTypeIdr},
+			Slices:               []*AvcSliceHeader{{NalUnitType: AvcNalUnitTypeIdr, NalRefIdc: 3, SliceType: AvcSliceTypeI}},
+			HasIdr:               true,
+			MissingParameterSets: true,
+		}},
+		{"IDR with a PPS of an unknown SPS", false, FrameTypeKeyFrame, [][]byte{avcPps(0, 0), idr}, AvcTagSummary{
+			NalUnitTypes:         []uint8{AvcNalUnitTypePps, AvcNalUnitTypeIdr},
+			Slices:               []*AvcSliceHeader{{NalUnitType: AvcNalUnitTypeIdr, NalRefIdc: 3, SliceType: AvcSliceTypeI}},
+			HasIdr:               true,
+			MissingParameterSets: true,
+		}},
+		// a recovery point, the following B frames may reference earlier ones
+		{"open GOP", true, FrameTypeKeyFrame, [][]byte{avcSlice(0x61, 7, 0, 4, 8), avcSlice(0x61, 7, 0, 4, 8)}, AvcTagSummary{
+			NalUnitTypes: []uint8{AvcNalUnitTypeNonIdr, AvcNalUnitTypeNonIdr},
+			Slices: []*AvcSliceHeader{
+				{NalUnitType: AvcNalUnitTypeNonIdr, NalRefIdc: 3, SliceType: AvcSliceTypeI, FrameNum: 4, PicOrderCntLsb: 8},
+				{NalUnitType: AvcNalUnitTypeNonIdr, NalRefIdc: 3, SliceType: AvcSliceTypeI, FrameNum: 4, PicOrderCntLsb: 8},
+			},
+			OpenGop: true,
+		}},
+		{"keyframe of a P slice", true, FrameTypeKeyFrame, [][]byte{avcSlice(0x41, 5, 0, 1, 2)}, AvcTagSummary{
+			NalUnitTypes:       []uint8{AvcNalUnitTypeNonIdr},
+			Slices:             []*AvcSliceHeader{{NalUnitType: AvcNalUnitTypeNonIdr, NalRefIdc: 2, FrameNum: 1, PicOrderCntLsb: 2}},
+			MislabeledKeyframe: true,
+		}},
+		{"keyframe without slices", true, FrameTypeKeyFrame, [][]byte{{0x09, 0xF0}}, AvcTagSummary{
+			NalUnitTypes:       []uint8{AvcNalUnitTypeAud},
+			MislabeledKeyframe: true,
+		}},
+		{"IDR in an inter frame", true, FrameTypeInterFrame, [][]byte{idr}, AvcTagSummary{
+			NalUnitTypes:       []uint8{AvcNalUnitTypeIdr},
+			Slices:             []*AvcSliceHeader{{NalUnitType: AvcNalUnitTypeIdr, NalRefIdc: 3, SliceType: AvcSliceTypeI, IdrPicId: 3}},
+			HasIdr:             true,
+			MislabeledKeyframe: true,
+		}},
+		{"B frame", true, FrameTypeInterFrame, [][]byte{{0x09, 0x30}, avcSlice(0x01, 6, 0, 2, 4)}, AvcTagSummary{
+			NalUnitTypes: []uint8{AvcNalUnitTypeAud, AvcNalUnitTypeNonIdr},
+			Slices:       []*AvcSliceHeader{{NalUnitType: AvcNalUnitTypeNonIdr, SliceType: AvcSliceTypeB, FrameNum: 2, PicOrderCntLsb: 4}},
+		}},
+		// a slice header that can not be parsed is left out
+		{"broken slice", true, FrameTypeInterFrame, [][]byte{{0x41, 0x00}}, AvcTagSummary{
+			NalUnitTypes: []uint8{AvcNalUnitTypeNonIdr},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := avcNaluTag(tt.nals...)
+			f := tagFlv(buf)
+			f.CurrentTag.FrameType = tt.frameType
+			f.CurrentTag.AVCPacketType = AvcPacketTypeAvcNalu
+			f.avcLengthSize = 4
+			if tt.known {
+				sps, _ := ParseAvcSps(sps1080p(4))
+				pps, _ := ParseAvcPps(avcPps(0, 0))
+				f.setAvcSps(sps)
+				f.setAvcPps(pps)
+			}
+			if _, err := f.parseAvcVideoPacket(buf, 0); err != nil {
+				t.Fatalf("parseAvcVideoPacket failed, err:%v", err)
+			}
+			if !reflect.DeepEqual(*f.CurrentTag.AvcSummary, tt.want) {
+				t.Fatalf("AvcSummary = %+v, want %+v", *f.CurrentTag.AvcSummary, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package flv
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	cea608ModePopOn   = 0
+	cea608ModeRollUp  = 1
+	cea608ModePaintOn = 2
+
+	// cea608LastCueDuration ends the cue still displayed at the end of the stream
+	cea608LastCueDuration = 2000
+)
+
+// cea608Chars are the standard characters that differ from ASCII
+var cea608Chars = map[byte]rune{
+	0x2A: 'á', 0x5C: 'é', 0x5E: 'í', 0x5F: 'ó', 0x60: 'ú',
+	0x7B: 'ç', 0x7C: '÷', 0x7D: 'Ñ', 0x7E: 'ñ', 0x7F: '█',
+}
+
+// cea608SpecialChars follow 0x11 0x30-0x3F, the extended ones 0x12 and 0x13
+// 0x20-0x3F and replace the character before them
+var cea608SpecialChars = []rune("®°½¿™¢£♪à èâêîôû")
+var cea608ExtendedChars = [2][]rune{
+	[]rune("ÁÉÓÚÜü‘¡*'—©℠•“”ÀÂÇÈÊËëÎÏïÔÙùÛ«»"),
+	[]rune("ÃãÍÌìÒòÕõ{}\\^_|~ÄäÖöß¥¤│ÅåØø┌┐└┘"),
+}
+
+// captionData is a CEA-608 byte pair with the PTS of its picture in ms
+type captionData struct {
+	pts   int64
+	data1 byte
+	data2 byte
+}
+
+type captionCue struct {
+	start int64
+	end   int64
+	text  string
+}
+
+// cea608Memory is a caption memory as rows, the last row holds the cursor.
+// Row positions from the preamble address codes are not kept.
+type cea608Memory []string
+
+func (m *cea608Memory) write(s string) {
+	if len(*m) == 0 {
+		*m = append(*m, "")
+	}
+	(*m)[len(*m)-1] += s
+}
+
+func (m *cea608Memory) backspace() {
+	if len(*m) == 0 {
+		return
+	}
+	row := []rune((*m)[len(*m)-1])
+	if len(row) > 0 {
+		(*m)[len(*m)-1] = string(row[:len(row)-1])
+	}
+}
+
+func (m *cea608Memory) newRow() {
+	if len(*m) > 0 && (*m)[len(*m)-1] == "" {
+		return
+	}
+	*m = append(*m, "")
+}
+
+func (m cea608Memory) text() string {
+	rows := make([]string, 0, len(m))
+	for _, row := range m {
+		if row = strings.TrimSpace(row); row != "" {
+			rows = append(rows, row)
+		}
+	}
+	return strings.Join(rows, "\n")
+}
+
+// cea608Decoder turns the CC1 channel of field 1 into cues, a cue lasting
+// while the displayed memory does not change. Roll-up and paint-on text is
+// displayed as it arrives.
+type cea608Decoder struct {
+	mode         int
+	rollUpRows   int
+	displayed    cea608Memory
+	nonDisplayed cea608Memory
+	channel      int
+	lastControl  uint16
+
+	cueText  string
+	cueStart int64
+	cues     []captionCue
+
+	// pending holds the pairs in presentation order until no later picture
+	// can precede them, lastPts is the PTS of the last decoded pair
+	pending []captionData
+	lastPts int64
+}
+
+func (d *cea608Decoder) target() *cea608Memory {
+	if d.mode == cea608ModePopOn {
+		return &d.nonDisplayed
+	}
+	return &d.displayed
+}
+
+// commit starts a new cue when the displayed text changed
+func (d *cea608Decoder) commit(pts int64) {
+	text := d.displayed.text()
+	if text == d.cueText {
+		return
+	}
+	if d.cueText != "" && pts > d.cueStart {
+		d.cues = append(d.cues, captionCue{start: d.cueStart, end: pts, text: d.cueText})
+	}
+	d.cueText, d.cueStart = text, pts
+}
+
+func (d *cea608Decoder) decode(pts int64, data1 byte, data2 byte) {
+	b1, b2 := data1&0x7F, data2&0x7F // odd parity
+	if b1 == 0 && b2 == 0 {
+		return
+	}
+
+	if b1 >= 0x10 && b1 <= 0x1F {
+		// control codes are sent twice, the repetition is ignored
+		code := uint16(b1)<<8 | uint16(b2)
+		if code == d.lastControl {
+			d.lastControl = 0
+			return
+		}
+		d.lastControl = code
+		d.channel = 1
+		if b1&0x08 != 0 {
+			d.channel = 2
+		}
+		if d.channel == 1 {
+			d.control(pts, b1, b2)
+		}
+		return
+	}
+
+	d.lastControl = 0
+	if d.channel == 2 {
+		return
+	}
+	for _, b := range []byte{b1, b2} {
+		if b < 0x20 {
+			continue
+		}
+		if r, ok := cea608Chars[b]; ok {
+			d.target().write(string(r))
+		} else {
+			d.target().write(string(rune(b)))
+		}
+	}
+	if d.mode != cea608ModePopOn {
+		d.commit(pts)
+	}
+}
+
+func (d *cea608Decoder) control(pts int64, b1 byte, b2 byte) {
+	switch {
+	case b1 == 0x14 && b2 >= 0x20 && b2 <= 0x2F:
+		d.miscControl(pts, b2)
+	case b1 == 0x11 && b2 >= 0x20 && b2 <= 0x2F: // mid-row code
+		d.target().write(" ")
+	case b1 == 0x11 && b2 >= 0x30 && b2 <= 0x3F:
+		d.target().write(string(cea608SpecialChars[b2-0x30]))
+	case (b1 == 0x12 || b1 == 0x13) && b2 >= 0x20 && b2 <= 0x3F:
+		d.target().backspace()
+		d.target().write(string(cea608ExtendedChars[b1-0x12][b2-0x20]))
+	case b1 == 0x17 && b2 >= 0x21 && b2 <= 0x23: // tab offset
+	case b2 >= 0x40: // preamble address code
+		d.target().newRow()
+	}
+	if d.mode != cea608ModePopOn {
+		d.commit(pts)
+	}
+}
+
+func (d *cea608Decoder) miscControl(pts int64, b2 byte) {
+	switch b2 {
+	case 0x20: // resume caption loading
+		d.mode = cea608ModePopOn
+	case 0x21: // backspace
+		d.target().backspace()
+	case 0x25, 0x26, 0x27: // roll-up captions 2-4 rows
+		if d.mode != cea608ModeRollUp {
+			d.displayed = nil
+			d.commit(pts)
+		}
+		d.mode = cea608ModeRollUp
+		d.rollUpRows = int(b2-0x25) + 2
+	case 0x29: // resume direct captioning
+		d.mode = cea608ModePaintOn
+	case 0x2C: // erase displayed memory
+		d.displayed = nil
+		d.commit(pts)
+	case 0x2D: // carriage return
+		if d.mode == cea608ModeRollUp {
+			d.commit(pts)
+			d.displayed.newRow()
+			if len(d.displayed) > d.rollUpRows {
+				d.displayed = d.displayed[len(d.displayed)-d.rollUpRows:]
+			}
+		} else {
+			d.target().newRow()
+		}
+	case 0x2E: // erase non-displayed memory
+		d.nonDisplayed = nil
+	case 0x2F: // end of caption
+		d.mode = cea608ModePopOn
+		d.displayed, d.nonDisplayed = d.nonDisplayed, d.displayed
+		d.commit(pts)
+	}
+}
+
+// push queues a pair of a picture in decoding order and decodes the pairs
+// presented at or before dts, a later picture is not presented before its own
+// decoding timestamp. Only the pairs within the reorder depth stay queued.
+func (d *cea608Decoder) push(cc captionData, dts int64) {
+	d.pending = append(d.pending, cc)
+	sort.SliceStable(d.pending, func(i, j int) bool { return d.pending[i].pts < d.pending[j].pts })
+
+	n := 0
+	for ; n < len(d.pending) && d.pending[n].pts <= dts; n++ {
+		d.decode(d.pending[n].pts, d.pending[n].data1, d.pending[n].data2)
+		d.lastPts = d.pending[n].pts
+	}
+	d.pending = d.pending[:copy(d.pending, d.pending[n:])]
+}
+
+// finish decodes the queued pairs and ends the cue still displayed
+func (d *cea608Decoder) finish() []captionCue {
+	for _, cc := range d.pending {
+		d.decode(cc.pts, cc.data1, cc.data2)
+		d.lastPts = cc.pts
+	}
+	d.pending = nil
+	if d.cueText != "" {
+		d.cues = append(d.cues, captionCue{start: d.cueStart, end: d.lastPts + cea608LastCueDuration, text: d.cueText})
+		d.cueText = ""
+	}
+	return d.cues
+}
+
+func formatCaptionTime(ms int64, sep string) string {
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%v%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// writeCaptions writes the CEA-608 captions as ./test.srt and ./test.vtt
+func (f *Flv) writeCaptions() error {
+	if f.captions == nil {
+		return nil
+	}
+	cues := f.captions.finish()
+	f.captions = nil
+	if len(cues) == 0 {
+		return nil
+	}
+
+	srt := new(strings.Builder)
+	vtt := new(strings.Builder)
+	vtt.WriteString("WEBVTT\n\n")
+	for i, cue := range cues {
+		fmt.Fprintf(srt, "%v\n%v --> %v\n%v\n\n", i+1, formatCaptionTime(cue.start, ","), formatCaptionTime(cue.end, ","), cue.text)
+		fmt.Fprintf(vtt, "%v --> %v\n%v\n\n", formatCaptionTime(cue.start, "."), formatCaptionTime(cue.end, "."), cue.text)
+	}
+
+	for name, content := range map[string]string{"./test.srt": srt.String(), "./test.vtt": vtt.String()} {
+		name = f.trackFileName(name)
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			return fmt.Errorf("ioutil.WriteFile(%q) failed, err:%v", name, err)
+		}
+	}
+	return nil
+}
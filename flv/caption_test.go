@@ -0,0 +1,178 @@
+package flv
+
+import (
+	"io/ioutil"
+	"math/bits"
+	"reflect"
+	"testing"
+)
+
+// cea608Parity sets the odd parity bit of a CEA-608 byte
+func cea608Parity(b byte) byte {
+	if bits.OnesCount8(b)%2 == 0 {
+		return b | 0x80
+	}
+	return b
+}
+
+// cea608Text splits s into the byte pairs of a caption, an odd length is
+// padded with 0x00
+func cea608Text(pts int64, s string) []captionData {
+	var data []captionData
+	for i := 0; i < len(s); i += 2 {
+		cc := captionData{pts: pts, data1: cea608Parity(s[i]), data2: cea608Parity(0)}
+		if i+1 < len(s) {
+			cc.data2 = cea608Parity(s[i+1])
+		}
+		data = append(data, cc)
+	}
+	return data
+}
+
+// cea608Control is a control code sent twice, as encoders do
+func cea608Control(pts int64, b1 byte, b2 byte) []captionData {
+	cc := captionData{pts: pts, data1: cea608Parity(b1), data2: cea608Parity(b2)}
+	return []captionData{cc, cc}
+}
+
+func cea608Pairs(pairs ...[]captionData) []captionData {
+	var data []captionData
+	for _, p := range pairs {
+		data = append(data, p...)
+	}
+	return data
+}
+
+func TestCea608Decoder(t *testing.T) {
+	tests := []struct {
+		name string
+		data []captionData
+		want []captionCue
+	}{
+		// the text is loaded off screen and shown by the end of caption
+		{"pop-on", cea608Pairs(
+			cea608Control(0, 0x14, 0x20), // resume caption loading
+			cea608Control(0, 0x14, 0x2E), // erase non-displayed memory
+			cea608Control(0, 0x14, 0x70), // preamble address code, row 14
+			cea608Text(0, "HELLO"),
+			cea608Control(500, 0x14, 0x2D), // carriage return
+			cea608Text(500, "WORLD"),
+			cea608Control(1000, 0x14, 0x2F), // end of caption
+			cea608Control(3000, 0x14, 0x2C), // erase displayed memory
+		), []captionCue{{1000, 3000, "HELLO\nWORLD"}}},
+		// each end of caption swaps the memories, the third shows A again
+		{"end of caption swap", cea608Pairs(
+			cea608Control(0, 0x14, 0x20),
+			cea608Text(0, "A"),
+			cea608Control(1000, 0x14, 0x2F),
+			cea608Text(1500, "B"),
+			cea608Control(2000, 0x14, 0x2F),
+			cea608Control(3000, 0x14, 0x2F),
+		), []captionCue{{1000, 2000, "A"}, {2000, 3000, "B"}, {3000, 5000, "A"}}},
+		// the rows scroll up on carriage return, two rows stay displayed
+		{"roll-up", cea608Pairs(
+			cea608Control(0, 0x14, 0x25), // roll-up captions 2 rows
+			cea608Control(0, 0x14, 0x70),
+			cea608Text(0, "ONE"),
+			cea608Control(1000, 0x14, 0x2D),
+			cea608Text(1000, "TWO"),
+			cea608Control(2000, 0x14, 0x2D),
+			cea608Text(2000, "THREE"),
+		), []captionCue{{0, 1000, "ONE"}, {1000, 2000, "ONE\nTWO"}, {2000, 4000, "TWO\nTHREE"}}},
+		// paint-on text is shown as it arrives, a backspace sent twice is
+		// done once, a third one again
+		{"paint-on and duplicate control codes", cea608Pairs(
+			cea608Control(0, 0x14, 0x29), // resume direct captioning
+			cea608Text(0, "ABC"),
+			cea608Control(500, 0x14, 0x21), // backspace
+			cea608Control(1000, 0x14, 0x21),
+			cea608Control(1000, 0x14, 0x21)[:1],
+		), []captionCue{{0, 500, "ABC"}, {500, 1000, "AB"}}},
+		// the extended characters replace the standard one sent before them
+		{"special and extended characters", cea608Pairs(
+			cea608Control(0, 0x14, 0x20),
+			cea608Control(0, 0x11, 0x37), // ♪
+			cea608Text(0, " A"),
+			cea608Control(0, 0x12, 0x20), // Á
+			cea608Text(0, "\x2A\x7E"),    // á ñ
+			cea608Text(0, "i"),
+			cea608Control(0, 0x13, 0x24), // ì
+			cea608Control(1000, 0x14, 0x2F),
+		), []captionCue{{1000, 3000, "♪ Ááñì"}}},
+		// CC2 on field 1 is skipped until a CC1 control code
+		{"CC2 is skipped", cea608Pairs(
+			cea608Control(0, 0x14, 0x29),
+			cea608Text(0, "A"),
+			cea608Control(500, 0x1C, 0x29),
+			cea608Text(500, "ZZ"),
+			cea608Control(1000, 0x14, 0x29),
+			cea608Text(1000, "B"),
+		), []captionCue{{0, 1000, "A"}, {1000, 3000, "AB"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := new(cea608Decoder)
+			for _, cc := range tt.data {
+				d.push(cc, cc.pts)
+			}
+			if got := d.finish(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("cues = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCaptions(t *testing.T) {
+	inTempDir(t)
+
+	// I P B B in decoding order, the pairs are decoded in presentation order
+	// and only those a later picture could precede stay queued
+	tags := []struct {
+		dts, cts    uint32
+		data        []captionData
+		wantPending int
+	}{
+		{0, 0, cea608Control(0, 0x14, 0x20), 0},
+		{33, 100, cea608Control(133, 0x14, 0x2F), 2},
+		{67, 0, cea608Text(67, "HELL"), 2},
+		{100, 0, cea608Text(100, "O"), 2},
+		{133, 67, nil, 2},
+		{1133, 0, cea608Control(1133, 0x14, 0x2C), 0},
+		{1500, 0, cea608Pairs(cea608Control(1500, 0x14, 0x29), cea608Control(1500, 0x11, 0x37)), 0},
+	}
+	f := &Flv{Quiet: true}
+	for _, tag := range tags {
+		f.CurrentTag = &CurrentTag{Timestamp: tag.dts, CompositionTime: int32(tag.cts)}
+		if tag.data != nil {
+			var triplets []byte
+			for _, cc := range tag.data {
+				triplets = append(triplets, 0xFC, cc.data1, cc.data2)
+			}
+			if err := f.parseAvcNalu(ga94Sei(len(tag.data), triplets)); err != nil {
+				t.Fatalf("parseAvcNalu failed, err:%v", err)
+			}
+		}
+		if f.captions == nil || len(f.captions.pending) != tag.wantPending {
+			t.Fatalf("pending after tag %v = %+v, want %v pairs", tag.dts, f.captions, tag.wantPending)
+		}
+	}
+	if err := f.writeCaptions(); err != nil {
+		t.Fatalf("writeCaptions failed, err:%v", err)
+	}
+
+	for name, want := range map[string]string{
+		"test.srt": "1\n00:00:00,133 --> 00:00:01,133\nHELLO\n\n" +
+			"2\n00:00:01,500 --> 00:00:03,500\n♪\n\n",
+		"test.vtt": "WEBVTT\n\n" +
+			"00:00:00.133 --> 00:00:01.133\nHELLO\n\n" +
+			"00:00:01.500 --> 00:00:03.500\n♪\n\n",
+	} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+		}
+		if string(data) != want {
+			t.Fatalf("%v = %q, want %q", name, data, want)
+		}
+	}
+}
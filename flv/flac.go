@@ -0,0 +1,187 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+)
+
+const (
+	FlacMetadataBlockTypeStreamInfo    = 0
+	FlacMetadataBlockTypePadding       = 1
+	FlacMetadataBlockTypeApplication   = 2
+	FlacMetadataBlockTypeSeekTable     = 3
+	FlacMetadataBlockTypeVorbisComment = 4
+	FlacMetadataBlockTypeCueSheet      = 5
+	FlacMetadataBlockTypePicture       = 6
+
+	flacStreamInfoSize = 34
+)
+
+var FlacMetadataBlockTypeMap = map[uint8]string{
+	FlacMetadataBlockTypeStreamInfo:    "STREAMINFO",
+	FlacMetadataBlockTypePadding:       "PADDING",
+	FlacMetadataBlockTypeApplication:   "APPLICATION",
+	FlacMetadataBlockTypeSeekTable:     "SEEKTABLE",
+	FlacMetadataBlockTypeVorbisComment: "VORBIS_COMMENT",
+	FlacMetadataBlockTypeCueSheet:      "CUESHEET",
+	FlacMetadataBlockTypePicture:       "PICTURE",
+}
+
+type FlacStreamInfo struct {
+	MinBlockSize  uint16
+	MaxBlockSize  uint16
+	MinFrameSize  uint32
+	MaxFrameSize  uint32
+	SampleRate    uint32
+	Channels      uint8
+	BitsPerSample uint8
+	TotalSamples  uint64
+	Md5           []byte
+}
+
+func (f *Flv) parseFlacAudioData(buf []byte, index int) (int, error) {
+
+	var err error
+
+	switch f.CurrentTag.AudioPacketType {
+	case AudioPacketTypeSequenceStart:
+		index, err = f.parseFlacSequenceStart(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseFlacSequenceStart failed, err:%v", err)
+		}
+	case AudioPacketTypeCodedFrames:
+		end := f.CurrentTag.Length
+		if end-index < 2 || buf[index] != 0xFF || buf[index+1]&0xFE != 0xF8 {
+			return 0, fmt.Errorf("flac frame sync code not found")
+		}
+		f.printf("flac frame size is %v\n", end-index)
+		if f.flacMetadata == nil {
+			f.printf("flac frame before the sequence start, not extracted\n")
+			return end, nil
+		}
+		if err = f.openFlacFile(); err != nil {
+			return 0, err
+		}
+		_, _ = f.flacFile.Write(buf[index:end])
+		index = end
+	default:
+		index = f.CurrentTag.Length
+	}
+
+	return index, nil
+}
+
+// parseFlacSequenceStart parses the FLAC metadata blocks. Some muxers store the
+// dfLa box payload with its version and flags, or the fLaC marker in front.
+func (f *Flv) parseFlacSequenceStart(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+
+	if end-index >= 4 && string(buf[index:index+4]) == "fLaC" {
+		index += 4
+	} else if end-index >= 8 && buf[index] == 0 && buf[index+1] == 0 && buf[index+2] == 0 && buf[index+3] == 0 &&
+		buf[index+4]&0x7F == FlacMetadataBlockTypeStreamInfo {
+		index += 4
+	}
+
+	metadata := make([]byte, 0, end-index)
+	last := false
+	for !last {
+		if end-index < 4 {
+			return 0, fmt.Errorf("metadata block header len %v < 4", end-index)
+		}
+		last = buf[index]>>7 == 1
+		blockType := buf[index] & 0x7F
+		length, err := util.BytesToUint32ByBigEndian(buf[index+1 : index+4])
+		if err != nil {
+			return 0, fmt.Errorf("util.BytesToUint32ByBigEndian failed, err:%v", err)
+		}
+		if end-index-4 < int(length) {
+			return 0, fmt.Errorf("metadata block len %v > remaining %v", length, end-index-4)
+		}
+		blockTypeString, ok := FlacMetadataBlockTypeMap[blockType]
+		if !ok {
+			blockTypeString = fmt.Sprintf("reserved block type %v", blockType)
+		}
+		f.printf("flac metadata block %v size is %v\n", blockTypeString, length)
+
+		if blockType == FlacMetadataBlockTypeStreamInfo {
+			if err = f.parseFlacStreamInfo(buf[index+4 : index+4+int(length)]); err != nil {
+				return 0, fmt.Errorf("f.parseFlacStreamInfo failed, err:%v", err)
+			}
+		}
+
+		metadata = append(metadata, buf[index:index+4+int(length)]...)
+		index += 4 + int(length)
+		if index == end {
+			break
+		}
+	}
+
+	if f.FlacStreamInfo == nil {
+		return 0, fmt.Errorf("no STREAMINFO metadata block")
+	}
+	f.flacMetadata = metadata
+
+	return end, nil
+}
+
+func (f *Flv) parseFlacStreamInfo(buf []byte) error {
+	if len(buf) < flacStreamInfoSize {
+		return fmt.Errorf("STREAMINFO len %v < %v", len(buf), flacStreamInfoSize)
+	}
+
+	r := util.NewBitReader(buf)
+	info := new(FlacStreamInfo)
+	minBlockSize, _ := r.ReadBits(16)
+	maxBlockSize, _ := r.ReadBits(16)
+	info.MinBlockSize, info.MaxBlockSize = uint16(minBlockSize), uint16(maxBlockSize)
+	info.MinFrameSize, _ = r.ReadBits(24)
+	info.MaxFrameSize, _ = r.ReadBits(24)
+	info.SampleRate, _ = r.ReadBits(20)
+	channelsMinusOne, _ := r.ReadBits(3)
+	bitsPerSampleMinusOne, _ := r.ReadBits(5)
+	info.Channels = uint8(channelsMinusOne) + 1
+	info.BitsPerSample = uint8(bitsPerSampleMinusOne) + 1
+	totalSamplesHigh, _ := r.ReadBits(4)
+	totalSamplesLow, err := r.ReadBits(32)
+	if err != nil {
+		return fmt.Errorf("r.ReadBits failed, err:%v", err)
+	}
+	info.TotalSamples = uint64(totalSamplesHigh)<<32 | uint64(totalSamplesLow)
+	info.Md5 = append([]byte(nil), buf[18:34]...)
+
+	f.printf("flac blockSize is %v-%v\n", info.MinBlockSize, info.MaxBlockSize)
+	f.printf("flac frameSize is %v-%v\n", info.MinFrameSize, info.MaxFrameSize)
+	f.printf("flac sampleRate is %v\n", info.SampleRate)
+	f.printf("flac channels is %v\n", info.Channels)
+	f.printf("flac bitsPerSample is %v\n", info.BitsPerSample)
+	f.printf("flac totalSamples is %v\n", info.TotalSamples)
+
+	f.FlacStreamInfo = info
+	return nil
+}
+
+// openFlacFile starts the native FLAC file with the marker and the metadata
+// blocks, the last one flagged as such
+func (f *Flv) openFlacFile() error {
+	if f.DisableExtract || f.flacFile != nil {
+		return nil
+	}
+	if err := f.openExtractFile(&f.flacFile, "./test.flac"); err != nil {
+		return fmt.Errorf("f.openExtractFile failed, err:%v", err)
+	}
+
+	metadata := append([]byte(nil), f.flacMetadata...)
+	lastHeader := 0
+	for i := 0; i < len(metadata); {
+		metadata[i] &= 0x7F
+		lastHeader = i
+		length := int(metadata[i+1])<<16 | int(metadata[i+2])<<8 | int(metadata[i+3])
+		i += 4 + length
+	}
+	metadata[lastHeader] |= 0x80
+
+	_, _ = f.flacFile.Write([]byte("fLaC"))
+	_, _ = f.flacFile.Write(metadata)
+	return nil
+}
@@ -0,0 +1,105 @@
+package flv
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var flacMd5 = []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// flacStreamInfo is a 44.1 kHz stereo 16 bit STREAMINFO with 2^32 + 1 samples
+func flacStreamInfo() []byte {
+	info := bitFields(
+		4096, 16, // min block size
+		4096, 16, // max block size
+		14, 24, // min frame size
+		16384, 24, // max frame size
+		44100, 20, // sample rate
+		1, 3, // channels - 1
+		15, 5, // bits per sample - 1
+		1, 4, 1, 32, // total samples
+	)
+	return append(info, flacMd5...)
+}
+
+func TestParseFlacSequenceStart(t *testing.T) {
+	info := flacStreamInfo()
+	streamInfoBlock := append([]byte{FlacMetadataBlockTypeStreamInfo, 0x00, 0x00, flacStreamInfoSize}, info...)
+	lastStreamInfoBlock := append([]byte{0x80 | FlacMetadataBlockTypeStreamInfo, 0x00, 0x00, flacStreamInfoSize}, info...)
+	paddingBlock := []byte{0x80 | FlacMetadataBlockTypePadding, 0x00, 0x00, 0x02, 0x00, 0x00}
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name         string
+		buf          []byte
+		wantMetadata []byte
+		wantErr      string
+	}{
+		{"metadata blocks", cat(streamInfoBlock, paddingBlock), cat(streamInfoBlock, paddingBlock), ""},
+		{"fLaC marker", cat([]byte("fLaC"), lastStreamInfoBlock), lastStreamInfoBlock, ""},
+		{"dfLa version and flags", cat([]byte{0, 0, 0, 0}, lastStreamInfoBlock), lastStreamInfoBlock, ""},
+		{"last block not flagged", streamInfoBlock, streamInfoBlock, ""},
+		{"no STREAMINFO", []byte{0x80 | FlacMetadataBlockTypePadding, 0x00, 0x00, 0x00}, nil, "no STREAMINFO metadata block"},
+		{"truncated block header", cat(streamInfoBlock, []byte{0x81, 0x00}), nil, "metadata block header len 2 < 4"},
+		{"block past the end", lastStreamInfoBlock[:30], nil, "metadata block len 34 > remaining 26"},
+		{"short STREAMINFO", cat([]byte{0x80, 0x00, 0x00, 0x10}, info[:16]), nil, "STREAMINFO len 16 < 34"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tagFlv(tt.buf)
+			_, err := f.parseFlacSequenceStart(tt.buf, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseFlacSequenceStart err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFlacSequenceStart failed, err:%v", err)
+			}
+			want := &FlacStreamInfo{
+				MinBlockSize:  4096,
+				MaxBlockSize:  4096,
+				MinFrameSize:  14,
+				MaxFrameSize:  16384,
+				SampleRate:    44100,
+				Channels:      2,
+				BitsPerSample: 16,
+				TotalSamples:  1<<32 + 1,
+				Md5:           flacMd5,
+			}
+			if !reflect.DeepEqual(f.FlacStreamInfo, want) {
+				t.Fatalf("FlacStreamInfo = %+v, want %+v", f.FlacStreamInfo, want)
+			}
+			if !bytes.Equal(f.flacMetadata, tt.wantMetadata) {
+				t.Fatalf("flacMetadata = %x, want %x", f.flacMetadata, tt.wantMetadata)
+			}
+		})
+	}
+}
+
+func TestParseFlacCodedFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     []byte
+		wantErr bool
+	}{
+		{"fixed blocksize sync code", []byte{0xFF, 0xF8, 0x69, 0x08}, false},
+		{"variable blocksize sync code", []byte{0xFF, 0xF9, 0x69, 0x08}, false},
+		{"bad sync code", []byte{0xFF, 0xF0, 0x69, 0x08}, true},
+		{"short", []byte{0xFF}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// before the sequence start nothing is written
+			f := tagFlv(tt.buf)
+			f.CurrentTag.AudioPacketType = AudioPacketTypeCodedFrames
+			_, err := f.parseFlacAudioData(tt.buf, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFlacAudioData err:%v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
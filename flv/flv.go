@@ -1,8 +1,10 @@
 package flv
 
 import (
+	"bytes"
 	"flvParse/util"
 	"fmt"
+	"image"
 	"os"
 )
 
@@ -25,11 +27,20 @@ const (
 	FrameTypeMark byte = 0b11110000
 	CodecIDMark   byte = 0b00001111
 
+	VideoIsExHeaderMark   byte = 0b10000000
+	ExVideoFrameTypeMark  byte = 0b01110000
+	ExVideoPacketTypeMark byte = 0b00001111
+
+	AvMultitrackTypeMark byte = 0b11110000
+
 	SoundFormatMark byte = 0b11110000
 	SoundRateMark   byte = 0b00001100
 	SoundSizeMark   byte = 0b00000010
 	SoundTypeMark   byte = 0b00000001
 
+	AudioPacketTypeMark byte = 0b00001111
+	AudioModExTypeMark  byte = 0b11110000
+
 	AvcDecoderConfigurationRecordReserved0                     byte = 0b11111100
 	AvcDecoderConfigurationRecordLengthSizeMinusOne            byte = 0b00000011
 	AvcDecoderConfigurationRecordReserved1                     byte = 0b11100000
@@ -62,11 +73,31 @@ const (
 	CodecIDOn2Vp6WithAlphaChannel = 5
 	CodecIDScreenVideoVersion2    = 6
 	CodecIDAvc                    = 7
+	CodecIDHevc                   = 12 // not in the spec, used by Chinese CDNs
 
 	AvcPacketTypeAvcSequenceHeader = 0
 	AvcPacketTypeAvcNalu           = 1
 	AvcPacketTypeAvcEndOfSequence  = 2 // lower level NALU sequence ender is not required or supported
 
+	VideoPacketTypeSequenceStart        = 0
+	VideoPacketTypeCodedFrames          = 1
+	VideoPacketTypeSequenceEnd          = 2
+	VideoPacketTypeCodedFramesX         = 3 // CompositionTime is implicitly 0
+	VideoPacketTypeMetadata             = 4
+	VideoPacketTypeMPEG2TSSequenceStart = 5
+	VideoPacketTypeMultitrack           = 6
+
+	VideoCommandStartSeek = 0 // start of client-side seeking video frame sequence
+	VideoCommandEndSeek   = 1 // end of client-side seeking video frame sequence
+
+	AvMultitrackTypeOneTrack             = 0
+	AvMultitrackTypeManyTracks           = 1
+	AvMultitrackTypeManyTracksManyCodecs = 2
+
+	VideoFourCCHevc = "hvc1"
+	VideoFourCCAv1  = "av01"
+	VideoFourCCVp9  = "vp09"
+
 	ScriptDataValueTypeNumber          = 0
 	ScriptDataValueTypeBoolean         = 1
 	ScriptDataValueTypeString          = 2
@@ -91,6 +122,7 @@ const (
 	SoundFormatG711ALawLogarithmicPcm  = 7
 	SoundFormatG711MuLawLogarithmicPcm = 8
 	SoundFormatreserved                = 9
+	SoundFormatExHeader                = 9 // Enhanced RTMP, the FourCC follows
 	SoundFormatAAC                     = 10
 	SoundFormatSpeex                   = 11
 	SoundFormatMP3_8kHz                = 14
@@ -110,13 +142,48 @@ const (
 	AACPacketTypeAacSequenceHeader = 0
 	AACPacketTypeAacRaw            = 1
 
-	AACProfileMain = 0x01
-	AACProfileLC   = 0x02
-	AACProfileSSR  = 0x03
+	AudioPacketTypeSequenceStart      = 0
+	AudioPacketTypeCodedFrames        = 1
+	AudioPacketTypeSequenceEnd        = 2
+	AudioPacketTypeMultichannelConfig = 4
+	AudioPacketTypeMultitrack         = 5
+	AudioPacketTypeModEx              = 7
+
+	AudioPacketModExTypeTimestampOffsetNano = 0
+
+	AudioChannelOrderUnspecified = 0
+	AudioChannelOrderNative      = 1
+	AudioChannelOrderCustom      = 2
+
+	AudioFourCCOpus = "Opus"
+	AudioFourCCFlac = "fLaC"
+	AudioFourCCAc3  = "ac-3"
+	AudioFourCCEac3 = "ec-3"
+	AudioFourCCMp3  = ".mp3"
+	AudioFourCCAac  = "mp4a"
+
+	AACProfileMain       = 0x01
+	AACProfileLC         = 0x02
+	AACProfileSSR        = 0x03
+	AACProfileLTP        = 4
+	AACProfileSBR        = 5
+	AACProfileScalable   = 6
+	AACProfileTwinVQ     = 7
+	AACProfileERLC       = 17
+	AACProfileERLTP      = 19
+	AACProfileERScalable = 20
+	AACProfileERTwinVQ   = 21
+	AACProfileERBSAC     = 22
+	AACProfileERLD       = 23
+	AACProfilePS         = 29
+	AACProfileEscape     = 31
+	AACProfileERELD      = 39
+	AACProfileUSAC       = 42
 
 	ADTSProfileMain = 0b00
 	ADTSProfileLC   = 0b01
 	ADTSProfileSSR  = 0b10
+	ADTSProfileLTP  = 0b11
 
 	SamplingFrequency96000       = 0x00
 	SamplingFrequency88200       = 0x01
@@ -171,6 +238,34 @@ var CodeIdMap = map[uint8]string{
 	CodecIDOn2Vp6WithAlphaChannel: "On2 VP6 with alpha channel",
 	CodecIDScreenVideoVersion2:    "Screen video version 2",
 	CodecIDAvc:                    "AVC",
+	CodecIDHevc:                   "HEVC",
+}
+
+var VideoPacketTypeMap = map[uint8]string{
+	VideoPacketTypeSequenceStart:        "SequenceStart",
+	VideoPacketTypeCodedFrames:          "CodedFrames",
+	VideoPacketTypeSequenceEnd:          "SequenceEnd",
+	VideoPacketTypeCodedFramesX:         "CodedFramesX",
+	VideoPacketTypeMetadata:             "Metadata",
+	VideoPacketTypeMPEG2TSSequenceStart: "MPEG2TSSequenceStart",
+	VideoPacketTypeMultitrack:           "Multitrack",
+}
+
+var VideoCommandMap = map[uint8]string{
+	VideoCommandStartSeek: "start of client-side seeking video frame sequence",
+	VideoCommandEndSeek:   "end of client-side seeking video frame sequence",
+}
+
+var AvMultitrackTypeMap = map[uint8]string{
+	AvMultitrackTypeOneTrack:             "OneTrack",
+	AvMultitrackTypeManyTracks:           "ManyTracks",
+	AvMultitrackTypeManyTracksManyCodecs: "ManyTracksManyCodecs",
+}
+
+var VideoFourCCMap = map[string]string{
+	VideoFourCCHevc: "HEVC",
+	VideoFourCCAv1:  "AV1",
+	VideoFourCCVp9:  "VP9",
 }
 
 var AvcPacketTypeMap = map[uint8]string{
@@ -189,7 +284,7 @@ var SoundFormatMap = map[uint8]string{
 	SoundFormatNellymoser:              "Nellymoser",
 	SoundFormatG711ALawLogarithmicPcm:  "G.711 A-law logarithmic PCM",
 	SoundFormatG711MuLawLogarithmicPcm: "G.711 mu-law logarithmic PCM",
-	SoundFormatreserved:                "reserved",
+	SoundFormatExHeader:                "ExHeader",
 	SoundFormatAAC:                     "AAC",
 	SoundFormatSpeex:                   "Speex",
 	SoundFormatMP3_8kHz:                "MP3 8 kHz",
@@ -218,16 +313,54 @@ var AACPacketTypeMap = map[uint8]string{
 	AACPacketTypeAacRaw:            "AAC raw",
 }
 
+var AudioPacketTypeMap = map[uint8]string{
+	AudioPacketTypeSequenceStart:      "SequenceStart",
+	AudioPacketTypeCodedFrames:        "CodedFrames",
+	AudioPacketTypeSequenceEnd:        "SequenceEnd",
+	AudioPacketTypeMultichannelConfig: "MultichannelConfig",
+	AudioPacketTypeMultitrack:         "Multitrack",
+	AudioPacketTypeModEx:              "ModEx",
+}
+
+var AudioChannelOrderMap = map[uint8]string{
+	AudioChannelOrderUnspecified: "Unspecified",
+	AudioChannelOrderNative:      "Native",
+	AudioChannelOrderCustom:      "Custom",
+}
+
+var AudioFourCCMap = map[string]string{
+	AudioFourCCOpus: "Opus",
+	AudioFourCCFlac: "FLAC",
+	AudioFourCCAc3:  "AC-3",
+	AudioFourCCEac3: "E-AC-3",
+	AudioFourCCMp3:  "MP3",
+	AudioFourCCAac:  "AAC",
+}
+
 var AACProfileMap = map[uint8]string{
-	AACProfileMain: "AAC Main",
-	AACProfileLC:   "AAC LC",
-	AACProfileSSR:  "AAC SSR",
+	AACProfileMain:       "AAC Main",
+	AACProfileLC:         "AAC LC",
+	AACProfileSSR:        "AAC SSR",
+	AACProfileLTP:        "AAC LTP",
+	AACProfileSBR:        "SBR (HE-AAC)",
+	AACProfileScalable:   "AAC Scalable",
+	AACProfileTwinVQ:     "TwinVQ",
+	AACProfileERLC:       "ER AAC LC",
+	AACProfileERLTP:      "ER AAC LTP",
+	AACProfileERScalable: "ER AAC Scalable",
+	AACProfileERTwinVQ:   "ER TwinVQ",
+	AACProfileERBSAC:     "ER BSAC",
+	AACProfileERLD:       "ER AAC LD",
+	AACProfilePS:         "PS (HE-AAC v2)",
+	AACProfileERELD:      "ER AAC ELD",
+	AACProfileUSAC:       "USAC",
 }
 
 var AACProfile2ADTSProfile = map[uint8]uint8{
 	AACProfileMain: ADTSProfileMain,
 	AACProfileLC:   ADTSProfileLC,
 	AACProfileSSR:  ADTSProfileSSR,
+	AACProfileLTP:  ADTSProfileLTP,
 }
 
 var SamplingFrequencyMap = map[uint8]string{
@@ -280,44 +413,267 @@ var ScriptDataValueTypeSet = map[uint8]string{
 type Flv struct {
 	State              int
 	PreviousTagSizeNum int
-
-	AACProfile        uint8
-	SamplingFrequency uint8
-	AacChannel        uint8
+	HasAudio           bool // TypeFlagsAudio of the header
+	HasVideo           bool // TypeFlagsVideo of the header
+
+	Quiet          bool // do not print the parse log
+	DisableExtract bool // do not write the elementary streams to ./test.*
+
+	// RenderScreenVideo decompresses the screen video blocks and writes every
+	// frame to ./test.screen.<frame>.png
+	RenderScreenVideo bool
+
+	// PcmBigEndian treats SoundFormat 0 as big endian, the platform it was
+	// recorded on, instead of little endian
+	PcmBigEndian bool
+
+	// Mp3XingHeader starts ./test.mp3 with a Xing or Info tag so that players
+	// get the duration right
+	Mp3XingHeader bool
+	Mp3IsVbr      bool
+
+	// AacM4a also writes the AAC frames into ./test.m4a, AacLoas into
+	// ./test.loas as LOAS/LATM
+	AacM4a  bool
+	AacLoas bool
+
+	// OnTag is called after every complete tag, tag.Data is only valid during the call
+	OnTag func(tag *CurrentTag) error
+
+	// Timeline unwraps and rebases the tag timestamps
+	Timeline TimestampNormalizer
+
+	// MetaData holds the Number properties of the script data, e.g. the
+	// framerate and duration of onMetaData
+	MetaData map[string]float64
+
+	AACProfile          uint8
+	SamplingFrequency   uint8
+	AacChannel          uint8
+	AudioSpecificConfig *AudioSpecificConfig
+
+	VideoWidth  uint16
+	VideoHeight uint16
+	AvcConfig   *AvcDecoderConfigurationRecord
+	avcSps      map[uint32]*AvcSps
+	avcPps      map[uint32]*AvcPps
+	avcLastSps  *AvcSps
+	// captions decodes the CEA-608 pairs of the SEI as the tags arrive
+	captions *cea608Decoder
+	// NAL unit length prefix sizes from the sequence headers
+	avcLengthSize  int
+	hevcLengthSize int
+	HevcConfig     *HevcDecoderConfigurationRecord
+	Av1Config      *Av1CodecConfigurationRecord
+	Vp9Config      *VpCodecConfigurationRecord
+	VideoReorder   VideoReorderStats
+	reorderPts     []int64
+
+	OpusHead       *OpusHead
+	FlacStreamInfo *FlacStreamInfo
+	Ac3Config      *Ac3SpecificBox
+	Eac3Config     *Eac3SpecificBox
+	flacMetadata   []byte
+
+	// AudioTrackIds and VideoTrackIds select the multitrack tracks to parse and
+	// extract, nil means all of them
+	AudioTrackIds []uint8
+	VideoTrackIds []uint8
+
+	// extracted elementary streams, opened on first use
+	h264File             *os.File
+	h265File             *os.File
+	aacAdts              *adtsWriter
+	aacAdtsErr           error
+	m4aFile              *m4aWriter
+	loasFile             *os.File
+	aacLoas              *loasWriter
+	aacLoasErr           error
+	aacFile              *os.File
+	obuFile              *os.File
+	av1IvfFile           *ivfWriter
+	vp9IvfFile           *ivfWriter
+	vp6IvfFile           *ivfWriter
+	vp6aIvfFile          *ivfWriter
+	opusFile             *oggWriter
+	opusGranule          int64
+	flacFile             *os.File
+	ac3File              *os.File
+	eac3File             *os.File
+	wavFile              *wavWriter
+	speexFile            *oggWriter
+	speexGranule         int64
+	speexFirstTimestamp  int64
+	nellymoserFile       *os.File
+	nellymoserSampleRate uint32
+	mp3File              *mp3Writer
+	mp3Pending           []byte
+	mp3Bitrate           uint32
+
+	screenFrame  *image.RGBA
+	screenFrames int
+
+	trackId uint8
+	tracks  map[uint16]*Flv
 
 	CurrentTag *CurrentTag
 }
 
 type CurrentTag struct {
 	Length        int
+	Timestamp     uint32 // TimestampExtended and Timestamp in ms
+	Data          []byte // tag header and body, without PreviousTagSize
 	Filter        uint8
 	TagType       uint8
 	FrameType     uint8
 	CodeId        uint8
 	AVCPacketType uint8
-	SoundFormat   uint8
-	AACPacketType uint8
-	SoundRate     uint8
+
+	IsExHeader      bool
+	VideoFourCC     string
+	VideoPacketType uint8
+	CompositionTime int32
+	Pts             int64 // Timestamp plus CompositionTime
+	IsCommandFrame  bool
+	VideoCommand    uint8
+	H263Header      *H263VideoPacketHeader
+	Vp6Header       *Vp6FrameHeader
+	ScreenVideo     *ScreenVideoPacket
+	AvcSummary      *AvcTagSummary
+
+	SoundFormat     uint8
+	AACPacketType   uint8
+	SoundRate       uint8
+	SoundSize       uint8
+	SoundType       uint8
+	AudioFourCC     string
+	AudioPacketType uint8
+
+	IsMultitrack         bool
+	MultitrackType       uint8
+	MultitrackPacketType uint8
+	Tracks               []*TrackPayload
+
+	// NormalizedTimestamp is Timestamp on the 64-bit Flv.Timeline, it does
+	// not go back within the audio or the video tags
+	NormalizedTimestamp int64
+}
+
+func (f *Flv) printf(format string, a ...interface{}) {
+	if !f.Quiet {
+		fmt.Printf(format, a...)
+	}
+}
+
+func (f *Flv) println(a ...interface{}) {
+	if !f.Quiet {
+		fmt.Println(a...)
+	}
+}
+
+// openExtractFile creates the output file on first use, unless extraction is disabled
+func (f *Flv) openExtractFile(file **os.File, name string) error {
+	if f.DisableExtract || *file != nil {
+		return nil
+	}
+
+	var err error
+	name = f.trackFileName(name)
+	*file, err = os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile(%q) failed, err:%v", name, err)
+	}
+	return nil
+}
+
+func (f *Flv) openIvfWriter(w **ivfWriter, name string, fourCC string) error {
+	if f.DisableExtract || *w != nil {
+		return nil
+	}
+
+	var err error
+	*w, err = newIvfWriter(f.trackFileName(name), fourCC)
+	if err != nil {
+		return fmt.Errorf("newIvfWriter failed, err:%v", err)
+	}
+	return nil
 }
 
-var h264File *os.File
-var aacFile *os.File
+// Close finishes the extracted files, writing headers that need the final sizes
+func (f *Flv) Close() error {
+	var err error
+	for _, t := range f.tracks {
+		if errClose := t.Close(); errClose != nil && err == nil {
+			err = errClose
+		}
+	}
+	f.tracks = nil
+	if errCaptions := f.writeCaptions(); errCaptions != nil && err == nil {
+		err = fmt.Errorf("f.writeCaptions failed, err:%v", errCaptions)
+	}
+	for _, w := range []**ivfWriter{&f.av1IvfFile, &f.vp9IvfFile, &f.vp6IvfFile, &f.vp6aIvfFile} {
+		if *w == nil {
+			continue
+		}
+		if errClose := (*w).Close(); errClose != nil && err == nil {
+			err = fmt.Errorf("ivfWriter.Close failed, err:%v", errClose)
+		}
+		*w = nil
+	}
+	if f.m4aFile != nil {
+		if errClose := f.m4aFile.Close(); errClose != nil && err == nil {
+			err = fmt.Errorf("m4aWriter.Close failed, err:%v", errClose)
+		}
+		f.m4aFile = nil
+	}
+	if f.mp3File != nil {
+		if errClose := f.mp3File.Close(); errClose != nil && err == nil {
+			err = fmt.Errorf("mp3Writer.Close failed, err:%v", errClose)
+		}
+		f.mp3File = nil
+	}
+	if f.wavFile != nil {
+		if errClose := f.wavFile.Close(); errClose != nil && err == nil {
+			err = fmt.Errorf("wavWriter.Close failed, err:%v", errClose)
+		}
+		f.wavFile = nil
+	}
+	for _, w := range []**oggWriter{&f.opusFile, &f.speexFile} {
+		if *w == nil {
+			continue
+		}
+		if errClose := (*w).Close(); errClose != nil && err == nil {
+			err = fmt.Errorf("oggWriter.Close failed, err:%v", errClose)
+		}
+		*w = nil
+	}
+	for _, file := range []**os.File{&f.h264File, &f.h265File, &f.aacFile, &f.obuFile, &f.flacFile, &f.ac3File, &f.eac3File, &f.nellymoserFile, &f.loasFile} {
+		if *file == nil {
+			continue
+		}
+		if errClose := (*file).Close(); errClose != nil && err == nil {
+			err = fmt.Errorf("file.Close failed, err:%v", errClose)
+		}
+		*file = nil
+	}
+	return err
+}
 
 func (f *Flv) Parse(buf []byte) ([]byte, error) {
-	//fmt.Println("Parse")
+	//f.println("Parse")
 
 	var ok bool
 	var err error
 
-	if h264File == nil {
-		h264File, err = os.OpenFile("./test.264", os.O_CREATE|os.O_RDWR, 0)
+	if !f.DisableExtract && f.h264File == nil {
+		f.h264File, err = os.OpenFile("./test.264", os.O_CREATE|os.O_RDWR, 0)
 		if err != nil {
 			return nil, fmt.Errorf("os.OpenFile(\"./test.h264\", os.O_CREATE|os.O_RDWR, 0) failed, err:%v\n", err)
 		}
 	}
 
-	if aacFile == nil {
-		aacFile, err = os.OpenFile("./test.aac", os.O_CREATE|os.O_RDWR, 0)
+	if !f.DisableExtract && f.aacFile == nil {
+		f.aacFile, err = os.OpenFile("./test.aac", os.O_CREATE|os.O_RDWR, 0)
 		if err != nil {
 			return nil, fmt.Errorf("os.OpenFile(\"./test.aac\", os.O_CREATE|os.O_RDWR, 0) failed, err:%v\n", err)
 		}
@@ -330,7 +686,7 @@ func (f *Flv) Parse(buf []byte) ([]byte, error) {
 			}
 			if ok {
 				f.State = PreviousTagSize
-				fmt.Println()
+				f.println()
 			}
 		}
 		if f.State == PreviousTagSize {
@@ -341,7 +697,7 @@ func (f *Flv) Parse(buf []byte) ([]byte, error) {
 			if ok {
 				f.State = Tag
 				f.PreviousTagSizeNum++
-				fmt.Println()
+				f.println()
 			}
 		}
 		if f.State == Tag {
@@ -351,7 +707,7 @@ func (f *Flv) Parse(buf []byte) ([]byte, error) {
 			}
 			if ok {
 				f.State = PreviousTagSize
-				fmt.Println()
+				f.println()
 			}
 		}
 		if !ok || len(buf) == 0 {
@@ -363,47 +719,49 @@ func (f *Flv) Parse(buf []byte) ([]byte, error) {
 }
 
 func (f *Flv) parseHeader(buf []byte) ([]byte, bool, error) {
-	fmt.Println("parseHeader")
+	f.println("parseHeader")
 	if len(buf) < 9 {
 		return buf, false, nil
 	}
 	if buf[0] != 0x46 {
 		return nil, false, fmt.Errorf("signature0 != 0x46, signature0:%x", buf[0])
 	}
-	fmt.Println("Signature0 is 0x46")
+	f.println("Signature0 is 0x46")
 
 	if buf[1] != 0x4C {
 		return nil, false, fmt.Errorf("signature1 != 0x4C, signature1:%x", buf[1])
 	}
-	fmt.Println("Signature1 is 0x4C")
+	f.println("Signature1 is 0x4C")
 
 	if buf[2] != 0x56 {
 		return nil, false, fmt.Errorf("signature2 != 0x56, signature2:%x", buf[2])
 	}
-	fmt.Println("Signature2 is 0x56")
+	f.println("Signature2 is 0x56")
 
 	if buf[3] != 0x01 {
 		return nil, false, fmt.Errorf("version != 0x01, version:%x", buf[3])
 	}
-	fmt.Println("Version is 0x01")
+	f.println("Version is 0x01")
 
 	typeFlagsReserved0 := (buf[4] & TypeFlagsReserved0Mark) >> 3
 	if typeFlagsReserved0 != 0 {
 		return nil, false, fmt.Errorf("TypeFlagsReserved0 != 0, TypeFlagsReserved:%x", typeFlagsReserved0)
 	}
-	fmt.Println("TypeFlagsReserved0 is 0")
+	f.println("TypeFlagsReserved0 is 0")
 
 	typeFlagsAudio := (buf[4] & TypeFlagsAudioMark) >> 2
-	fmt.Printf("TypeFlagsAudio is %v\n", typeFlagsAudio)
+	f.printf("TypeFlagsAudio is %v\n", typeFlagsAudio)
+	f.HasAudio = typeFlagsAudio == 1
 
 	typeFlagsReserved1 := (buf[4] & TypeFlagsReserved1Mark) >> 1
 	if typeFlagsReserved1 != 0 {
 		return nil, false, fmt.Errorf("typeFlagsReserved1 != 0, TypeFlagsReserved1:%x", typeFlagsReserved1)
 	}
-	fmt.Printf("TypeFlagsReserved1 is %v\n", typeFlagsReserved1)
+	f.printf("TypeFlagsReserved1 is %v\n", typeFlagsReserved1)
 
 	typeFlagsVideo := (buf[4] & TypeFlagsVideoMark) >> 0
-	fmt.Printf("TypeFlagsVideo is %v\n", typeFlagsVideo)
+	f.printf("TypeFlagsVideo is %v\n", typeFlagsVideo)
+	f.HasVideo = typeFlagsVideo == 1
 
 	DataOffset, err := util.BytesToUint32ByBigEndian(buf[5:9])
 	if err != nil {
@@ -412,21 +770,21 @@ func (f *Flv) parseHeader(buf []byte) ([]byte, bool, error) {
 	if DataOffset != 9 {
 		return nil, false, fmt.Errorf("DataOffset != 9, DataOffset != 9:%v", DataOffset)
 	}
-	fmt.Println("DataOffset is 9")
+	f.println("DataOffset is 9")
 
 	return buf[9:], true, nil
 }
 
 func (f *Flv) parsePreviousTagSize(buf []byte) ([]byte, bool, error) {
 	if len(buf) < 4 {
-		return nil, false, nil
+		return buf, false, nil
 	}
 
 	previousTagSize, err := util.BytesToUint32ByBigEndian(buf[:4])
 	if err != nil {
 		return nil, false, fmt.Errorf("util.BytesToUint32ByBigEndian(buf[:4]) failed, err:%v", err)
 	}
-	fmt.Printf("PreviousTagSize%v is %v\n", f.PreviousTagSizeNum, previousTagSize)
+	f.printf("PreviousTagSize%v is %v\n", f.PreviousTagSizeNum, previousTagSize)
 
 	return buf[4:], true, nil
 }
@@ -453,7 +811,7 @@ func (f *Flv) parseTag(buf []byte) ([]byte, bool, error) {
 	if reserved != 0 {
 		return nil, false, fmt.Errorf("reserved != 0, reserved:%v", reserved)
 	}
-	fmt.Println("Reserved is 0")
+	f.println("Reserved is 0")
 
 	filter := buf[index] & TagFilterMark >> 5
 	filterString, ok := FilterMap[filter]
@@ -461,28 +819,32 @@ func (f *Flv) parseTag(buf []byte) ([]byte, bool, error) {
 		return nil, false, fmt.Errorf("FilterMap[filter] failed, filter:%v", filter)
 	}
 	f.CurrentTag.Filter = filter
-	fmt.Printf("Filter is %v\n", filterString)
+	f.printf("Filter is %v\n", filterString)
 
 	tagType := util.BytesToUint8ByBigEndian(buf[index] & TagTagTypeMark)
 	if _, ok := TagTypeMap[tagType]; !ok {
 		return nil, false, fmt.Errorf("TagType is illegal, TagType:%v", tagType)
 	}
 	f.CurrentTag.TagType = tagType
-	fmt.Printf("TagType is %v\n", TagTypeMap[tagType])
+	f.printf("TagType is %v\n", TagTypeMap[tagType])
 	index += 1
 
-	fmt.Printf("DataSize is %v\n", dataSize)
+	f.printf("DataSize is %v\n", dataSize)
 	index += 3
 
 	timestamp, err := util.BytesToUint32ByBigEndian(buf[index : index+3])
 	if err != nil {
 		return nil, false, fmt.Errorf("util.BytesToUint32ByBigEndian failed, err:%v", err)
 	}
-	fmt.Printf("Timestamp is %v\n", timestamp)
+	f.printf("Timestamp is %v\n", timestamp)
 	index += 3
 
 	timestampExtended := util.BytesToUint8ByBigEndian(buf[index])
-	fmt.Printf("TimestampExtended is %v\n", timestampExtended)
+	f.printf("TimestampExtended is %v\n", timestampExtended)
+	f.CurrentTag.Timestamp = uint32(timestampExtended)<<24 | timestamp
+	f.printf("Timestamp in ms is %v\n", f.CurrentTag.Timestamp)
+	f.CurrentTag.Pts = int64(f.CurrentTag.Timestamp)
+	f.normalizeTimestamp()
 	index += 1
 
 	streamID, err := util.BytesToUint32ByBigEndian(buf[index : index+3])
@@ -492,7 +854,7 @@ func (f *Flv) parseTag(buf []byte) ([]byte, bool, error) {
 	if streamID != 0 {
 		return nil, false, fmt.Errorf("streamID != 0, streamID:%v", streamID)
 	}
-	fmt.Println("streamID is 0")
+	f.println("streamID is 0")
 	index += 3
 
 	if f.CurrentTag.TagType == TagTypeAudio {
@@ -526,7 +888,14 @@ func (f *Flv) parseTag(buf []byte) ([]byte, bool, error) {
 		return nil, false, fmt.Errorf("f.parseData failed, err:%v", err)
 	}
 
-	//fmt.Printf("end index:%v\n", index)
+	if f.OnTag != nil {
+		f.CurrentTag.Data = buf[:11+dataSize]
+		if err = f.OnTag(f.CurrentTag); err != nil {
+			return nil, false, fmt.Errorf("f.OnTag failed, err:%v", err)
+		}
+	}
+
+	//f.printf("end index:%v\n", index)
 	return buf[11+dataSize:], true, nil
 }
 
@@ -541,28 +910,35 @@ func (f *Flv) parseAudioTagHeader(buf []byte, index int) (int, error) {
 		return 0, fmt.Errorf("SoundFormatMap[soundFormat] failed, soundFormat:%v", soundFormat)
 	}
 	f.CurrentTag.SoundFormat = soundFormat
-	fmt.Printf("soundFormat is %v\n", soundFormatString)
+	f.printf("soundFormat is %v\n", soundFormatString)
+
+	if soundFormat == SoundFormatExHeader {
+		return f.parseExAudioTagHeader(buf, index)
+	}
 
 	soundRate := util.BytesToUint8ByBigEndian((buf[index] & SoundRateMark) >> 2)
 	soundRateString, ok := SoundRateMap[soundRate]
 	if !ok {
 		return 0, fmt.Errorf("SoundRateMap[soundRate] failed, soundRate:%v", soundRate)
 	}
-	fmt.Printf("soundRate is %v\n", soundRateString)
+	f.CurrentTag.SoundRate = soundRate
+	f.printf("soundRate is %v\n", soundRateString)
 
 	soundSize := util.BytesToUint8ByBigEndian((buf[index] & SoundSizeMark) >> 1)
 	soundSizeString, ok := SoundSizeMap[soundSize]
 	if !ok {
 		return 0, fmt.Errorf("SoundSizeMap[soundRate] failed, soundSize:%v", soundSize)
 	}
-	fmt.Printf("soundSize is %v\n", soundSizeString)
+	f.CurrentTag.SoundSize = soundSize
+	f.printf("soundSize is %v\n", soundSizeString)
 
 	soundType := util.BytesToUint8ByBigEndian((buf[index] & SoundTypeMark) >> 0)
 	soundTypeString, ok := SoundTypeMap[soundType]
 	if !ok {
 		return 0, fmt.Errorf("soundTypeMap[soundType] failed, soundType:%v", soundType)
 	}
-	fmt.Printf("soundType is %v\n", soundTypeString)
+	f.CurrentTag.SoundType = soundType
+	f.printf("soundType is %v\n", soundTypeString)
 
 	index += 1
 
@@ -576,11 +952,87 @@ func (f *Flv) parseAudioTagHeader(buf []byte, index int) (int, error) {
 			return 0, fmt.Errorf("AACPacketTypeMap[aacPacketType] failed, aacPacketType:%v", aacPacketType)
 		}
 		f.CurrentTag.AACPacketType = aacPacketType
-		fmt.Printf("aacPacketType is %v\n", aacPacketTypeString)
+		f.printf("aacPacketType is %v\n", aacPacketTypeString)
+
+		index += 1
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseExAudioTagHeader(buf []byte, index int) (int, error) {
+	f.CurrentTag.IsExHeader = true
+
+	end := f.CurrentTag.Length
+	audioPacketType := util.BytesToUint8ByBigEndian(buf[index] & AudioPacketTypeMark)
+	index += 1
+
+	for audioPacketType == AudioPacketTypeModEx {
+		if end-index < 1 {
+			return 0, fmt.Errorf("modExDataSize len 0 < 1")
+		}
+		modExDataSize := int(buf[index]) + 1
+		index += 1
+		if modExDataSize == 256 {
+			if end-index < 2 {
+				return 0, fmt.Errorf("modExDataSize len %v < 2", end-index)
+			}
+			size, err := util.BytesToUint16ByBigEndian(buf[index : index+2])
+			if err != nil {
+				return 0, fmt.Errorf("util.BytesToUint16ByBigEndian failed, err:%v", err)
+			}
+			modExDataSize = int(size) + 1
+			index += 2
+		}
+		if end-index < modExDataSize+1 {
+			return 0, fmt.Errorf("modExDataSize %v > remaining %v", modExDataSize, end-index-1)
+		}
+		modExData := buf[index : index+modExDataSize]
+		index += modExDataSize
 
+		modExType := (buf[index] & AudioModExTypeMark) >> 4
+		audioPacketType = buf[index] & AudioPacketTypeMark
 		index += 1
+
+		if modExType == AudioPacketModExTypeTimestampOffsetNano && len(modExData) >= 3 {
+			timestampOffsetNano := uint32(modExData[0])<<16 | uint32(modExData[1])<<8 | uint32(modExData[2])
+			f.printf("timestampOffsetNano is %v\n", timestampOffsetNano)
+		} else {
+			f.printf("modExType %v with %v bytes is skipped\n", modExType, modExDataSize)
+		}
 	}
 
+	audioPacketTypeString, ok := AudioPacketTypeMap[audioPacketType]
+	if !ok {
+		return 0, fmt.Errorf("AudioPacketTypeMap[audioPacketType] is not ok, audioPacketType:%v", audioPacketType)
+	}
+	f.CurrentTag.AudioPacketType = audioPacketType
+	f.printf("AudioPacketType is %v\n", audioPacketTypeString)
+
+	if audioPacketType == AudioPacketTypeMultitrack {
+		var err error
+		index, err = f.parseMultitrackHeader(buf, index, AudioPacketTypeMap)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseMultitrackHeader failed, err:%v", err)
+		}
+		f.CurrentTag.AudioPacketType = f.CurrentTag.MultitrackPacketType
+		if f.CurrentTag.MultitrackType == AvMultitrackTypeManyTracksManyCodecs {
+			return index, nil
+		}
+	}
+
+	if end-index < 4 {
+		return 0, fmt.Errorf("audioFourCC len %v < 4", end-index)
+	}
+	audioFourCC := string(buf[index : index+4])
+	audioFourCCString, ok := AudioFourCCMap[audioFourCC]
+	if !ok {
+		return 0, fmt.Errorf("AudioFourCCMap[audioFourCC] is not ok, audioFourCC:%q", audioFourCC)
+	}
+	f.CurrentTag.AudioFourCC = audioFourCC
+	f.printf("AudioFourCC is %v\n", audioFourCCString)
+	index += 4
+
 	return index, nil
 }
 
@@ -589,13 +1041,17 @@ func (f *Flv) parseVideoTagHeader(buf []byte, index int) (int, error) {
 		return 0, fmt.Errorf("len(buf) < 1")
 	}
 
+	if buf[index]&VideoIsExHeaderMark != 0 {
+		return f.parseExVideoTagHeader(buf, index)
+	}
+
 	frameType := util.BytesToUint8ByBigEndian(buf[index] & FrameTypeMark >> 4)
 	frameTypeString, ok := FrameTypeMap[frameType]
 	if !ok {
 		return 0, fmt.Errorf("FrameTypeMap[frameType] is not ok, frameType:%v", frameType)
 	}
 	f.CurrentTag.FrameType = frameType
-	fmt.Printf("FrameType is %v\n", frameTypeString)
+	f.printf("FrameType is %v\n", frameTypeString)
 
 	codeId := util.BytesToUint8ByBigEndian(buf[index] & CodecIDMark)
 	codeIdString, ok := CodeIdMap[codeId]
@@ -603,11 +1059,17 @@ func (f *Flv) parseVideoTagHeader(buf []byte, index int) (int, error) {
 		return 0, fmt.Errorf("CodeIdMap[codeId] is not ok, codeId:%v", codeId)
 	}
 	f.CurrentTag.CodeId = codeId
-	fmt.Printf("CodeId is %v\n", codeIdString)
+	f.printf("CodeId is %v\n", codeIdString)
 
 	index += 1
 
-	if codeId == CodecIDAvc {
+	// the VideoCommand of a command frame may follow without the AVCPacketType
+	// and CompositionTime
+	if frameType == FrameTypeVideoInfoOrCommandFrame && f.CurrentTag.Length-index < 4 {
+		return index, nil
+	}
+
+	if codeId == CodecIDAvc || codeId == CodecIDHevc {
 		if len(buf[index:]) < 4 {
 			return 0, fmt.Errorf("len(buf[index:]) < 4")
 		}
@@ -618,7 +1080,7 @@ func (f *Flv) parseVideoTagHeader(buf []byte, index int) (int, error) {
 			return 0, fmt.Errorf("AvcPacketTypeMap[avcPacketType] is not ok, avcPacketType:%v", avcPacketType)
 		}
 		f.CurrentTag.AVCPacketType = avcPacketType
-		fmt.Printf("AvcPacketType is %v\n", avcPacketTypeString)
+		f.printf("AvcPacketType is %v\n", avcPacketTypeString)
 		index += 1
 
 		compositionTime, err := util.BytesToInt32ByBigEndian(buf[index : index+3])
@@ -628,13 +1090,93 @@ func (f *Flv) parseVideoTagHeader(buf []byte, index int) (int, error) {
 		if avcPacketType != AvcPacketTypeAvcNalu && compositionTime != 0 {
 			return 0, fmt.Errorf("CompositionTime must to be 0")
 		}
-		fmt.Printf("CompositionTime is %v\n", compositionTime)
+		f.setCompositionTime(compositionTime, avcPacketType == AvcPacketTypeAvcNalu)
 		index += 3
 	}
 
 	return index, nil
 }
 
+func (f *Flv) parseExVideoTagHeader(buf []byte, index int) (int, error) {
+	f.CurrentTag.IsExHeader = true
+	f.printf("IsExHeader is 1\n")
+
+	frameType := util.BytesToUint8ByBigEndian(buf[index] & ExVideoFrameTypeMark >> 4)
+	frameTypeString, ok := FrameTypeMap[frameType]
+	if !ok {
+		return 0, fmt.Errorf("FrameTypeMap[frameType] is not ok, frameType:%v", frameType)
+	}
+	f.CurrentTag.FrameType = frameType
+	f.printf("FrameType is %v\n", frameTypeString)
+
+	videoPacketType := util.BytesToUint8ByBigEndian(buf[index] & ExVideoPacketTypeMark)
+	videoPacketTypeString, ok := VideoPacketTypeMap[videoPacketType]
+	if !ok {
+		return 0, fmt.Errorf("VideoPacketTypeMap[videoPacketType] is not ok, videoPacketType:%v", videoPacketType)
+	}
+	f.CurrentTag.VideoPacketType = videoPacketType
+	f.printf("VideoPacketType is %v\n", videoPacketTypeString)
+
+	index += 1
+
+	// a command frame has no FourCC, the VideoCommand follows
+	if frameType == FrameTypeVideoInfoOrCommandFrame && videoPacketType != VideoPacketTypeMetadata {
+		return index, nil
+	}
+
+	if videoPacketType == VideoPacketTypeMultitrack {
+		var err error
+		index, err = f.parseMultitrackHeader(buf, index, VideoPacketTypeMap)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseMultitrackHeader failed, err:%v", err)
+		}
+		f.CurrentTag.VideoPacketType = f.CurrentTag.MultitrackPacketType
+		if f.CurrentTag.MultitrackType == AvMultitrackTypeManyTracksManyCodecs {
+			return index, nil
+		}
+	}
+
+	if len(buf[index:]) < 4 {
+		return 0, fmt.Errorf("len(buf[index:]) < 4")
+	}
+	videoFourCC := string(buf[index : index+4])
+	videoFourCCString, ok := VideoFourCCMap[videoFourCC]
+	if !ok {
+		return 0, fmt.Errorf("VideoFourCCMap[videoFourCC] is not ok, videoFourCC:%q", videoFourCC)
+	}
+	f.CurrentTag.VideoFourCC = videoFourCC
+	f.printf("VideoFourCC is %v\n", videoFourCCString)
+	index += 4
+
+	// the CompositionTime of a multitrack tag is in front of every track
+	if !f.CurrentTag.IsMultitrack {
+		return f.parseExVideoCompositionTime(buf, index)
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseExVideoCompositionTime(buf []byte, index int) (int, error) {
+	if f.CurrentTag.VideoFourCC != VideoFourCCHevc || f.CurrentTag.VideoPacketType != VideoPacketTypeCodedFrames {
+		if f.CurrentTag.VideoPacketType == VideoPacketTypeCodedFrames || f.CurrentTag.VideoPacketType == VideoPacketTypeCodedFramesX {
+			f.setCompositionTime(0, true)
+		}
+		return index, nil
+	}
+
+	if len(buf[index:]) < 3 {
+		return 0, fmt.Errorf("len(buf[index:]) < 3")
+	}
+	compositionTime, err := util.BytesToInt32ByBigEndian(buf[index : index+3])
+	if err != nil {
+		return 0, fmt.Errorf("util.BytesToInt32ByBigEndian failed, err:%v", err)
+	}
+	f.setCompositionTime(compositionTime, true)
+	index += 3
+
+	return index, nil
+}
+
 func (f *Flv) parseEncryptionHeader(buf []byte, index int) (int, error) {
 	return 0, fmt.Errorf("parseEncryptionHeader error")
 }
@@ -691,18 +1233,144 @@ func (f *Flv) parseAudioDataEncryptedBody(buf []byte, index int) (int, error) {
 
 func (f *Flv) parseAudioDataAudioTagBody(buf []byte, index int) (int, error) {
 	var err error
-	if f.CurrentTag.SoundFormat == SoundFormatAAC {
+	if f.CurrentTag.IsExHeader {
+		index, err = f.parseExAudioTagBody(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseExAudioTagBody failed, err:%v", err)
+		}
+	} else if f.CurrentTag.SoundFormat == SoundFormatAAC {
 		index, err = f.parseAacAudioData(buf, index)
 		if err != nil {
 			return 0, fmt.Errorf("f.parseAacAudioData failed, err:%v", err)
 		}
+	} else if f.CurrentTag.SoundFormat == SoundFormatMp3 || f.CurrentTag.SoundFormat == SoundFormatMP3_8kHz {
+		index, err = f.parseMp3AudioData(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseMp3AudioData failed, err:%v", err)
+		}
+	} else if f.CurrentTag.SoundFormat == SoundFormatLinearPcmPlatformEndian ||
+		f.CurrentTag.SoundFormat == SoundFormatAdpcm ||
+		f.CurrentTag.SoundFormat == SoundFormatLinearPcmLittleEndian ||
+		f.CurrentTag.SoundFormat == SoundFormatG711ALawLogarithmicPcm ||
+		f.CurrentTag.SoundFormat == SoundFormatG711MuLawLogarithmicPcm {
+		index, err = f.parsePcmAudioData(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parsePcmAudioData failed, err:%v", err)
+		}
+	} else if f.CurrentTag.SoundFormat == SoundFormatSpeex {
+		index, err = f.parseSpeexAudioData(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseSpeexAudioData failed, err:%v", err)
+		}
+	} else if f.CurrentTag.SoundFormat == SoundFormatNellymoser16kHzMono ||
+		f.CurrentTag.SoundFormat == SoundFormatNellymoser8kHzMono ||
+		f.CurrentTag.SoundFormat == SoundFormatNellymoser {
+		index, err = f.parseNellymoserAudioData(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseNellymoserAudioData failed, err:%v", err)
+		}
 	} else {
-		fmt.Printf("AudioDataAudioTagBody: Varies by format\n")
+		f.printf("AudioDataAudioTagBody: Varies by format\n")
 	}
 
 	return index, nil
 }
 
+func (f *Flv) parseExAudioTagBody(buf []byte, index int) (int, error) {
+
+	var err error
+
+	if f.CurrentTag.IsMultitrack {
+		return f.parseMultitrackBody(buf, index)
+	}
+
+	switch f.CurrentTag.AudioPacketType {
+	case AudioPacketTypeMultichannelConfig:
+		return f.parseAudioMultichannelConfig(buf, index)
+	case AudioPacketTypeSequenceEnd:
+		return f.CurrentTag.Length, nil
+	}
+
+	switch f.CurrentTag.AudioFourCC {
+	case AudioFourCCOpus:
+		index, err = f.parseOpusAudioData(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseOpusAudioData failed, err:%v", err)
+		}
+	case AudioFourCCFlac:
+		index, err = f.parseFlacAudioData(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseFlacAudioData failed, err:%v", err)
+		}
+	case AudioFourCCAc3, AudioFourCCEac3:
+		index, err = f.parseAc3AudioData(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseAc3AudioData failed, err:%v", err)
+		}
+	case AudioFourCCMp3:
+		if f.CurrentTag.AudioPacketType == AudioPacketTypeCodedFrames {
+			index, err = f.parseMp3AudioData(buf, index)
+			if err != nil {
+				return 0, fmt.Errorf("f.parseMp3AudioData failed, err:%v", err)
+			}
+		} else {
+			index = f.CurrentTag.Length
+		}
+	case AudioFourCCAac:
+		// the same payloads as the legacy AAC tags, without the AACPacketType byte
+		if f.CurrentTag.AudioPacketType == AudioPacketTypeSequenceStart {
+			f.CurrentTag.AACPacketType = AACPacketTypeAacSequenceHeader
+		} else {
+			f.CurrentTag.AACPacketType = AACPacketTypeAacRaw
+		}
+		index, err = f.parseAacAudioData(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseAacAudioData failed, err:%v", err)
+		}
+	default:
+		f.printf("%v audio data is not decoded\n", f.CurrentTag.AudioFourCC)
+		index = f.CurrentTag.Length
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseAudioMultichannelConfig(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	if end-index < 2 {
+		return 0, fmt.Errorf("MultichannelConfig len %v < 2", end-index)
+	}
+
+	audioChannelOrder := buf[index]
+	audioChannelOrderString, ok := AudioChannelOrderMap[audioChannelOrder]
+	if !ok {
+		return 0, fmt.Errorf("AudioChannelOrderMap[audioChannelOrder] is not ok, audioChannelOrder:%v", audioChannelOrder)
+	}
+	channelCount := int(buf[index+1])
+	f.printf("audioChannelOrder is %v\n", audioChannelOrderString)
+	f.printf("channelCount is %v\n", channelCount)
+	index += 2
+
+	switch audioChannelOrder {
+	case AudioChannelOrderCustom:
+		if end-index < channelCount {
+			return 0, fmt.Errorf("audioChannelMapping len %v < %v", end-index, channelCount)
+		}
+		f.printf("audioChannelMapping is %v\n", buf[index:index+channelCount])
+	case AudioChannelOrderNative:
+		if end-index < 4 {
+			return 0, fmt.Errorf("audioChannelFlags len %v < 4", end-index)
+		}
+		audioChannelFlags, err := util.BytesToUint32ByBigEndian(buf[index : index+4])
+		if err != nil {
+			return 0, fmt.Errorf("util.BytesToUint32ByBigEndian failed, err:%v", err)
+		}
+		f.printf("audioChannelFlags is 0x%08x\n", audioChannelFlags)
+	}
+
+	return end, nil
+}
+
 func (f *Flv) parseAacAudioData(buf []byte, index int) (int, error) {
 
 	var err error
@@ -722,66 +1390,91 @@ func (f *Flv) parseAacAudioData(buf []byte, index int) (int, error) {
 }
 
 func (f *Flv) parseRawAacFrameData(buf []byte, index int) (int, error) {
-	aacFrameLength := f.CurrentTag.Length - index + 7
-	adtsChannel := f.AacChannel & 0b00000111
-	byte0 := byte(0xFF)
-	byte1 := byte(0xF1)
-	byte2 := AACProfile2ADTSProfile[f.AACProfile]<<6 + f.SamplingFrequency<<2 + adtsChannel>>2
-	byte3 := adtsChannel<<6 + uint8(aacFrameLength>>11)
-	byte4 := byte(aacFrameLength >> 3)
-	byte5 := byte(aacFrameLength<<5 + 0b00011111)
-	byte6 := byte(0b11111100)
+	end := f.CurrentTag.Length
+	f.printf("has Raw AAC frame data but not decode\n")
 
-	_, _ = aacFile.Write([]byte{byte0, byte1, byte2, byte3, byte4, byte5, byte6})
+	if f.DisableExtract {
+		return end, nil
+	}
+	frame := buf[index:end]
+	if err := f.writeAdtsFrame(frame); err != nil {
+		return 0, err
+	}
+	if f.AacM4a {
+		if err := f.writeM4aFrame(frame); err != nil {
+			return 0, err
+		}
+	}
+	if f.AacLoas {
+		if err := f.writeLoasFrame(frame); err != nil {
+			return 0, err
+		}
+	}
 
-	_, _ = aacFile.Write(buf[index:f.CurrentTag.Length])
-	fmt.Printf("has Raw AAC frame data but not decode\n")
-	return f.CurrentTag.Length, nil
+	return end, nil
 }
 
-func (f *Flv) parseAudioSpecificConfig(buf []byte, index int) (int, error) {
-
-	if len(buf[index:]) < 2 {
-		return 0, fmt.Errorf("len(buf[index:]) < 2")
+func (f *Flv) writeAdtsFrame(frame []byte) error {
+	if f.aacAdts == nil {
+		if f.aacAdtsErr != nil {
+			return nil
+		}
+		if err := f.openExtractFile(&f.aacFile, "./test.aac"); err != nil {
+			return fmt.Errorf("f.openExtractFile failed, err:%v", err)
+		}
+		f.aacAdts, f.aacAdtsErr = newAdtsWriter(f.aacFile, f.AudioSpecificConfig)
+		if f.aacAdtsErr != nil {
+			f.printf("raw AAC frames are not extracted, newAdtsWriter failed, err:%v\n", f.aacAdtsErr)
+			return nil
+		}
 	}
-
-	aacProfile := (buf[index] & AacProfileMark) >> 3
-	aacProfileString, ok := AACProfileMap[aacProfile]
-	if !ok {
-		return 0, fmt.Errorf("AACProfileMap[aacProfile] failed, aacProfile:%v", aacProfile)
+	if err := f.aacAdts.WriteFrame(frame); err != nil {
+		return fmt.Errorf("aacAdts.WriteFrame failed, err:%v", err)
 	}
-	f.AACProfile = aacProfile
-	fmt.Printf("aacProfile is %v\n", aacProfileString)
+	return nil
+}
 
-	samplingFrequency := ((buf[index] & SamplingFrequency0Mark) << 1) +
-		((buf[index+1] & SamplingFrequency1Mark) >> 7)
-	samplingFrequencyString, ok := SamplingFrequencyMap[samplingFrequency]
-	if !ok {
-		return 0, fmt.Errorf("SamplingFrequencyMap[samplingFrequency] failed, "+
-			"samplingFrequencyString:%v", samplingFrequencyString)
+// writeM4aFrame keeps the first AudioSpecificConfig, an M4A can not switch
+func (f *Flv) writeM4aFrame(frame []byte) error {
+	if f.AudioSpecificConfig == nil {
+		f.printf("raw AAC frame before the sequence header, not written to m4a\n")
+		return nil
 	}
-	f.SamplingFrequency = samplingFrequency
-	fmt.Printf("samplingFrequency is %v\n", samplingFrequencyString)
-
-	index++
-
-	aacChannel := (buf[index] & AacChannelMark) >> 3
-	aacChannelString, ok := AacChannelMap[aacChannel]
-	if !ok {
-		aacChannelString = "reserved"
+	if f.m4aFile == nil {
+		var err error
+		f.m4aFile, err = newM4aWriter(f.trackFileName("./test.m4a"), f.AudioSpecificConfig)
+		if err != nil {
+			return fmt.Errorf("newM4aWriter failed, err:%v", err)
+		}
 	}
-	f.AacChannel = aacProfile
-	fmt.Printf("aacChannel is %v\n", aacChannelString)
-
-	audioSpecificConfigOther := buf[index] & AudioSpecificConfigOtherMark
-	if audioSpecificConfigOther != 0 {
-		return 0, fmt.Errorf("audioSpecificConfigOther is not 0b000")
+	if !bytes.Equal(f.m4aFile.config.Raw, f.AudioSpecificConfig.Raw) {
+		f.printf("AudioSpecificConfig changed, raw AAC frame not written to m4a\n")
+		return nil
 	}
-	fmt.Printf("audioSpecificConfigOther is 0b000\n")
-
-	index++
+	if err := f.m4aFile.WriteFrame(frame); err != nil {
+		return fmt.Errorf("m4aFile.WriteFrame failed, err:%v", err)
+	}
+	return nil
+}
 
-	return index, nil
+func (f *Flv) writeLoasFrame(frame []byte) error {
+	if f.aacLoas == nil {
+		if f.aacLoasErr != nil {
+			return nil
+		}
+		if err := f.openExtractFile(&f.loasFile, "./test.loas"); err != nil {
+			return fmt.Errorf("f.openExtractFile failed, err:%v", err)
+		}
+		f.aacLoas, f.aacLoasErr = newLoasWriter(f.loasFile, f.AudioSpecificConfig)
+		if f.aacLoasErr != nil {
+			f.printf("raw AAC frames are not written to loas, newLoasWriter failed, err:%v\n", f.aacLoasErr)
+			return nil
+		}
+	}
+	if err := f.aacLoas.WriteFrame(frame); err != nil {
+		return fmt.Errorf("aacLoas.WriteFrame failed, err:%v", err)
+	}
+	return nil
 }
 
 func (f *Flv) parseVideoData(buf []byte, index int) (int, error) {
@@ -803,6 +1496,44 @@ func (f *Flv) parseVideoData(buf []byte, index int) (int, error) {
 	return index, nil
 }
 
+func (f *Flv) parseVideoCommandFrame(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	if end-index < 1 {
+		return 0, fmt.Errorf("VideoCommand len %v < 1", end-index)
+	}
+
+	// with the AVC header present the command is the last byte
+	videoCommand := buf[end-1]
+	videoCommandString, ok := VideoCommandMap[videoCommand]
+	if !ok {
+		return 0, fmt.Errorf("VideoCommandMap[videoCommand] is not ok, videoCommand:%v", videoCommand)
+	}
+	f.CurrentTag.IsCommandFrame = true
+	f.CurrentTag.VideoCommand = videoCommand
+	f.printf("VideoCommand is %v\n", videoCommandString)
+
+	return end, nil
+}
+
+// parseExVideoMetadata parses the AMF encoded name and object of an Enhanced
+// RTMP metadata frame, e.g. colorInfo
+func (f *Flv) parseExVideoMetadata(buf []byte, index int) (int, error) {
+	var err error
+	end := f.CurrentTag.Length
+
+	for index < end {
+		index, err = f.parseScriptDataValue(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseScriptDataValue failed, err:%v", err)
+		}
+	}
+	if index > end {
+		return 0, fmt.Errorf("metadata overruns the tag by %v bytes", index-end)
+	}
+
+	return end, nil
+}
+
 func (f *Flv) parseVideoDataEncryptedBody(buf []byte, index int) (int, error) {
 	return 0, fmt.Errorf("parseVideoDataEncryptedBody error")
 }
@@ -811,24 +1542,36 @@ func (f *Flv) parseVideoDataTagBody(buf []byte, index int) (int, error) {
 
 	var err error
 
-	if f.CurrentTag.FrameType == FrameTypeVideoInfoOrCommandFrame {
-		return 0, fmt.Errorf("FrameTypeVideoInfoOrCommandFrame error")
+	if f.CurrentTag.FrameType == FrameTypeVideoInfoOrCommandFrame &&
+		!(f.CurrentTag.IsExHeader && f.CurrentTag.VideoPacketType == VideoPacketTypeMetadata) {
+		index, err = f.parseVideoCommandFrame(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseVideoCommandFrame failed, err:%v", err)
+		}
+	} else if f.CurrentTag.IsExHeader {
+		index, err = f.parseExVideoTagBody(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseExVideoTagBody failed, err:%v", err)
+		}
 	} else {
 
 		if f.CurrentTag.CodeId == CodecIDSorensonH263 {
-			return 0, fmt.Errorf("CodecIDSorensonH263 error")
-		}
-		if f.CurrentTag.CodeId == CodecIDScreenVideo {
-			return 0, fmt.Errorf("CodecIDScreenVideo error")
-		}
-		if f.CurrentTag.CodeId == CodecIDOn2Vp6 {
-			return 0, fmt.Errorf("CodecIDOn2Vp6 error")
+			index, err = f.parseH263VideoPacket(buf, index)
+			if err != nil {
+				return 0, fmt.Errorf("f.parseH263VideoPacket failed, err:%v", err)
+			}
 		}
-		if f.CurrentTag.CodeId == CodecIDOn2Vp6WithAlphaChannel {
-			return 0, fmt.Errorf("CodecIDOn2Vp6WithAlphaChannel error")
+		if f.CurrentTag.CodeId == CodecIDScreenVideo || f.CurrentTag.CodeId == CodecIDScreenVideoVersion2 {
+			index, err = f.parseScreenVideoPacket(buf, index)
+			if err != nil {
+				return 0, fmt.Errorf("f.parseScreenVideoPacket failed, err:%v", err)
+			}
 		}
-		if f.CurrentTag.CodeId == CodecIDScreenVideoVersion2 {
-			return 0, fmt.Errorf("CodecIDScreenVideoVersion2 error")
+		if f.CurrentTag.CodeId == CodecIDOn2Vp6 || f.CurrentTag.CodeId == CodecIDOn2Vp6WithAlphaChannel {
+			index, err = f.parseVp6VideoPacket(buf, index)
+			if err != nil {
+				return 0, fmt.Errorf("f.parseVp6VideoPacket failed, err:%v", err)
+			}
 		}
 		if f.CurrentTag.CodeId == CodecIDAvc {
 			index, err = f.parseAvcVideoPacket(buf, index)
@@ -836,6 +1579,46 @@ func (f *Flv) parseVideoDataTagBody(buf []byte, index int) (int, error) {
 				return 0, fmt.Errorf("f.parseAvcVideoPacket failed, err:%v", err)
 			}
 		}
+		if f.CurrentTag.CodeId == CodecIDHevc {
+			index, err = f.parseHevcVideoPacket(buf, index)
+			if err != nil {
+				return 0, fmt.Errorf("f.parseHevcVideoPacket failed, err:%v", err)
+			}
+		}
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseExVideoTagBody(buf []byte, index int) (int, error) {
+
+	var err error
+
+	if f.CurrentTag.IsMultitrack {
+		return f.parseMultitrackBody(buf, index)
+	}
+
+	if f.CurrentTag.VideoPacketType == VideoPacketTypeMetadata {
+		return f.parseExVideoMetadata(buf, index)
+	}
+
+	if f.CurrentTag.VideoFourCC == VideoFourCCHevc {
+		index, err = f.parseHevcExVideoPacket(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseHevcExVideoPacket failed, err:%v", err)
+		}
+	}
+	if f.CurrentTag.VideoFourCC == VideoFourCCAv1 {
+		index, err = f.parseAv1ExVideoPacket(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseAv1ExVideoPacket failed, err:%v", err)
+		}
+	}
+	if f.CurrentTag.VideoFourCC == VideoFourCCVp9 {
+		index, err = f.parseVp9ExVideoPacket(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseVp9ExVideoPacket failed, err:%v", err)
+		}
 	}
 
 	return index, nil
@@ -853,47 +1636,61 @@ func (f *Flv) parseAvcVideoPacket(buf []byte, index int) (int, error) {
 	}
 
 	if f.CurrentTag.AVCPacketType == AvcPacketTypeAvcNalu {
-		index, err = f.parseOneOrMoreNalus(buf, index)
+		index, err = f.parseOneOrMoreNalus(buf, index, f.avcLengthSize, f.h264File, f.parseAvcNalu)
 		if err != nil {
 			return 0, fmt.Errorf("f.parseOneOrMoreNalus failed, err:%v", err)
 		}
+		f.summarizeAvcTag()
 	}
 
 	return index, nil
 }
 
 func (f *Flv) parseAvcDecoderConfigurationRecord(buf []byte, index int) (int, error) {
-	if len(buf[index:]) < 6 {
-		return 0, fmt.Errorf("len(buf[index:]) < 5")
+	end := f.CurrentTag.Length
+	if end-index < 6 {
+		return 0, fmt.Errorf("AVCDecoderConfigurationRecord len %v < 6", end-index)
 	}
 
+	config := new(AvcDecoderConfigurationRecord)
+
 	configurationVersion := buf[index]
 	if configurationVersion != 1 {
 		return 0, fmt.Errorf("configurationVersion != 1")
 	}
+	config.ConfigurationVersion = configurationVersion
 	index++
-	fmt.Printf("configurationVersion is 0x1\n")
+	f.printf("configurationVersion is 0x1\n")
 
 	avcProfileIndication := buf[index]
 	index++
-	fmt.Printf("avcProfileIndication is 0x%x\n", avcProfileIndication)
+	f.printf("avcProfileIndication is 0x%x\n", avcProfileIndication)
 
 	profileCompatibility := buf[index]
 	index++
-	fmt.Printf("profileCompatibility is 0x%x\n", profileCompatibility)
+	f.printf("profileCompatibility is 0x%x\n", profileCompatibility)
 
 	avcLevelIndication := buf[index]
 	index++
-	fmt.Printf("avcLevelIndication is 0x%x\n", avcLevelIndication)
+	f.printf("avcLevelIndication is 0x%x\n", avcLevelIndication)
+
+	config.AvcProfileIndication = avcProfileIndication
+	config.ProfileCompatibility = profileCompatibility
+	config.AvcLevelIndication = avcLevelIndication
+	f.printf("codec is %v\n", config.CodecString())
 
 	reserved0 := buf[index] & AvcDecoderConfigurationRecordReserved0 >> 2
 	if reserved0 != 0b00111111 {
 		return 0, fmt.Errorf("reserved != 0b00111111")
 	}
-	fmt.Printf("reserved0 is 0b%6b\n", reserved0)
+	f.printf("reserved0 is 0b%6b\n", reserved0)
 
 	lengthSizeMinusOne := buf[index] & AvcDecoderConfigurationRecordLengthSizeMinusOne
-	fmt.Printf("lengthSizeMinusOne is %v\n", lengthSizeMinusOne)
+	f.printf("lengthSizeMinusOne is %v\n", lengthSizeMinusOne)
+	if lengthSizeMinusOne == 2 {
+		return 0, fmt.Errorf("lengthSizeMinusOne 2 is not allowed")
+	}
+	config.LengthSizeMinusOne = lengthSizeMinusOne
 
 	index++
 
@@ -901,45 +1698,56 @@ func (f *Flv) parseAvcDecoderConfigurationRecord(buf []byte, index int) (int, er
 	if reserved1 != 0b00000111 {
 		return 0, fmt.Errorf("reserved1 != 0b00000111")
 	}
-	fmt.Printf("reserved1 is 0b%3b\n", reserved1)
+	f.printf("reserved1 is 0b%3b\n", reserved1)
 
 	numberOfSequenceParameterSets := buf[index] &
 		AvcDecoderConfigurationRecordNumberOfSequenceParameterSets
-	fmt.Printf("numberOfSequenceParameterSets is %v\n", numberOfSequenceParameterSets)
+	f.printf("numberOfSequenceParameterSets is %v\n", numberOfSequenceParameterSets)
 
 	index++
 
 	for i := 0; i < int(numberOfSequenceParameterSets); i++ {
-		if len(buf[index:]) < 2 {
-			return 0, fmt.Errorf("len(buf) < 2")
+		if end-index < 2 {
+			return 0, fmt.Errorf("sps %v: len < 2", i)
 		}
 		spsSize, err := util.BytesToUint32ByBigEndian(buf[index : index+2])
 		if err != nil {
 			return 0, fmt.Errorf("util.BytesToUint32ByBigEndian, err:%v", err)
 		}
 		index += 2
-		fmt.Printf("spsSize is %v\n", spsSize)
+		f.printf("spsSize is %v\n", spsSize)
 
-		if len(buf[index:]) < int(spsSize) {
-			return 0, fmt.Errorf("len(buf[index:]) < int(spsSize)")
+		if end-index < int(spsSize) {
+			return 0, fmt.Errorf("sps len %v > remaining %v", spsSize, end-index)
 		}
 		sps := buf[index : index+int(spsSize)]
+		config.Sps = append(config.Sps, append([]byte(nil), sps...))
+		if config.SpsInfo == nil {
+			// the SPS is only informational, the stream is extracted without it
+			if spsInfo, err := ParseAvcSps(sps); err != nil {
+				f.printf("sps is not parsed, err:%v\n", err)
+			} else {
+				f.setAvcSps(spsInfo)
+				f.printAvcSps(spsInfo)
+				config.SpsInfo = spsInfo
+			}
+		}
 
-		_, _ = h264File.Write([]byte{0x00, 0x00, 0x00, 0x01})
-		_, _ = h264File.Write(sps)
+		_, _ = f.h264File.Write([]byte{0x00, 0x00, 0x00, 0x01})
+		_, _ = f.h264File.Write(sps)
 
 		index += int(spsSize)
 	}
 
-	if len(buf[index:]) < 1 {
-		return 0, fmt.Errorf("len(buf[index:]) < 1")
+	if end-index < 1 {
+		return 0, fmt.Errorf("numOfPictureParameterSets len 0 < 1")
 	}
 	numberOfPictureParameterSets := buf[index]
 	index++
 
 	for i := 0; i < int(numberOfPictureParameterSets); i++ {
-		if len(buf[index:]) < 2 {
-			return 0, fmt.Errorf("len(buf) < 2")
+		if end-index < 2 {
+			return 0, fmt.Errorf("pps %v: len < 2", i)
 		}
 		ppsSize, err := util.BytesToUint32ByBigEndian(buf[index : index+2])
 		if err != nil {
@@ -947,47 +1755,74 @@ func (f *Flv) parseAvcDecoderConfigurationRecord(buf []byte, index int) (int, er
 		}
 		index += 2
 
-		if len(buf[index:]) < int(ppsSize) {
-			return 0, fmt.Errorf("len(buf[index:]) < int(ppsSize)")
+		if end-index < int(ppsSize) {
+			return 0, fmt.Errorf("pps len %v > remaining %v", ppsSize, end-index)
 		}
 
 		pps := buf[index : index+int(ppsSize)]
+		config.Pps = append(config.Pps, append([]byte(nil), pps...))
+		if ppsInfo, err := ParseAvcPps(pps); err == nil {
+			f.setAvcPps(ppsInfo)
+		}
 
-		_, _ = h264File.Write([]byte{0x00, 0x00, 0x00, 0x01})
-		_, _ = h264File.Write(pps)
+		_, _ = f.h264File.Write([]byte{0x00, 0x00, 0x00, 0x01})
+		_, _ = f.h264File.Write(pps)
 
 		index += int(ppsSize)
 	}
 
-	return f.CurrentTag.Length, nil
+	f.AvcConfig = config
+	f.avcLengthSize = int(config.LengthSizeMinusOne) + 1
+	if config.SpsInfo != nil {
+		f.VideoWidth, f.VideoHeight = uint16(config.SpsInfo.Width), uint16(config.SpsInfo.Height)
+	}
+
+	return end, nil
 }
 
-func (f *Flv) parseOneOrMoreNalus(buf []byte, index int) (int, error) {
-	for true {
-		if len(buf) < 4 {
-			return 0, fmt.Errorf("len(buf) < 4")
+// parseOneOrMoreNalus writes the NAL units to out as Annex B, onNalu if not nil
+// is called with every NAL unit. lengthSize is the size of the NAL unit length
+// prefix from the sequence header, 4 without one.
+func (f *Flv) parseOneOrMoreNalus(buf []byte, index int, lengthSize int, out *os.File, onNalu func(nal []byte) error) (int, error) {
+	end := f.CurrentTag.Length
+	if lengthSize == 0 {
+		lengthSize = 4
+	}
+	if lengthSize == 3 {
+		return 0, fmt.Errorf("nalu length prefix of 3 bytes is not allowed")
+	}
+
+	for index < end {
+		if end-index < lengthSize {
+			return 0, fmt.Errorf("nalu length prefix of %v bytes with %v bytes left", lengthSize, end-index)
 		}
-		naluLen, err := util.BytesToUint32ByBigEndian(buf[index : index+4])
+		naluLen, err := util.BytesToUint32ByBigEndian(buf[index : index+lengthSize])
 		if err != nil {
-			return 0, fmt.Errorf("util.BytesToUint32ByBigEndian(buf[index:index+4]), err:%v", err)
+			return 0, fmt.Errorf("util.BytesToUint32ByBigEndian(buf[index:index+%v]), err:%v", lengthSize, err)
 		}
-		index += 4
+		index += lengthSize
 
-		if len(buf[index:]) < int(naluLen) {
-			return 0, fmt.Errorf("len(buf[index:]) < int(naluLen)")
+		if uint32(end-index) < naluLen {
+			return 0, fmt.Errorf("nalu len %v > remaining %v", naluLen, end-index)
+		}
+		f.printf("nalu len:%v\n", naluLen)
+		if naluLen == 0 {
+			continue
+		}
+		nal := buf[index : index+int(naluLen)]
+		if onNalu != nil {
+			if err = onNalu(nal); err != nil {
+				return 0, err
+			}
 		}
-		fmt.Printf("nalu len:%v\n", naluLen)
 
-		_, _ = h264File.Write([]byte{0x00, 0x00, 0x00, 0x01})
-		_, _ = h264File.Write(buf[index : index+int(naluLen)])
+		_, _ = out.Write([]byte{0x00, 0x00, 0x00, 0x01})
+		_, _ = out.Write(nal)
 
 		index += int(naluLen)
-
-		if index == f.CurrentTag.Length {
-			return f.CurrentTag.Length, nil
-		}
 	}
-	return 0, fmt.Errorf("parseOneOrMoreNalus not run this")
+
+	return end, nil
 }
 
 func (f *Flv) parseScriptData(buf []byte, index int) (int, error) {
@@ -1035,7 +1870,7 @@ func (f *Flv) parseScriptDataValue(buf []byte, index int) (int, error) {
 	if !ok {
 		return 0, fmt.Errorf("ScriptDataValueTypeSet[valueType] is not ok, valueType:%v", valueType)
 	}
-	fmt.Printf("Script Data Value Type is %v\n", valueTypeString)
+	f.printf("Script Data Value Type is %v\n", valueTypeString)
 
 	if valueType == ScriptDataValueTypeNumber {
 		if len(buf[index:]) < 8 {
@@ -1045,7 +1880,7 @@ func (f *Flv) parseScriptDataValue(buf []byte, index int) (int, error) {
 		if err != nil {
 			return 0, fmt.Errorf("util.ByteToFloat64 failed, err:%v ", err)
 		}
-		fmt.Printf("Script Data Value Number is %f\n", doubleValue)
+		f.printf("Script Data Value Number is %f\n", doubleValue)
 		index += 8
 	}
 
@@ -1054,7 +1889,7 @@ func (f *Flv) parseScriptDataValue(buf []byte, index int) (int, error) {
 			return 0, fmt.Errorf("ScriptDataValueTypeBoolean error: len(buf) < 1")
 		}
 		booleanValue := util.BytesToUint8ByBigEndian(buf[index])
-		fmt.Printf("Script Data Value Boolean is %v\n", booleanValue)
+		f.printf("Script Data Value Boolean is %v\n", booleanValue)
 
 		index += 1
 	}
@@ -1067,7 +1902,10 @@ func (f *Flv) parseScriptDataValue(buf []byte, index int) (int, error) {
 	}
 
 	if valueType == ScriptDataValueTypeObject {
-		return 0, fmt.Errorf("ScriptDataValueTypeObject error")
+		index, err = f.parseScriptDataObject(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseScriptDataObject failed, err:%v", err)
+		}
 	}
 
 	if valueType == ScriptDataValueTypeReference {
@@ -1108,7 +1946,7 @@ func (f *Flv) parseScriptDataString(buf []byte, index int) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("util.BytesToUint16ByBigEndian failed, err:%v", err)
 	}
-	//fmt.Printf("stringLength is %v\n", stringLength)
+	//f.printf("stringLength is %v\n", stringLength)
 	index += 2
 
 	if len(buf[index:]) < int(stringLength) {
@@ -1116,7 +1954,7 @@ func (f *Flv) parseScriptDataString(buf []byte, index int) (int, error) {
 	}
 
 	stringData := string(buf[index : index+int(stringLength)])
-	fmt.Printf("Script Data Value String is %v\n", stringData)
+	f.printf("Script Data Value String is %v\n", stringData)
 
 	index += int(stringLength)
 
@@ -1135,19 +1973,40 @@ func (f *Flv) parseScriptDataEcmaArray(buf []byte, index int) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("util.BytesToUint32ByBigEndian failed, err:%v", err)
 	}
-	fmt.Printf("ECMAArrayLength is %v\n", ecmaArrayLength)
+	f.printf("ECMAArrayLength is %v\n", ecmaArrayLength)
 	index += 4
 
 	var i int64 = 0
 	for ; i < int64(ecmaArrayLength); i++ {
-		index, err = f.parseScriptDataString(buf, index)
+		index, err = f.parseScriptDataProperty(buf, index)
 		if err != nil {
-			return 0, fmt.Errorf("f.parseScriptDataString failed, err:%v", err)
+			return 0, fmt.Errorf("f.parseScriptDataProperty failed, err:%v", err)
 		}
+	}
 
-		index, err = f.parseScriptDataValue(buf, index)
+	index, err = f.parseScriptDataObjectEnd(buf, index)
+	if err != nil {
+		return 0, fmt.Errorf("f.parseScriptDataObjectEnd failed, err:%v", err)
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseScriptDataObject(buf []byte, index int) (int, error) {
+
+	var err error
+
+	for {
+		if len(buf[index:]) < 3 {
+			return 0, fmt.Errorf("len(buf[index:]) < 3")
+		}
+		if buf[index] == 0 && buf[index+1] == 0 && buf[index+2] == ScriptDataValueTypeObjectEndMarker {
+			break
+		}
+
+		index, err = f.parseScriptDataProperty(buf, index)
 		if err != nil {
-			return 0, fmt.Errorf("f.parseScriptDataValue failed, err:%v", err)
+			return 0, fmt.Errorf("f.parseScriptDataProperty failed, err:%v", err)
 		}
 	}
 
@@ -1159,6 +2018,36 @@ func (f *Flv) parseScriptDataEcmaArray(buf []byte, index int) (int, error) {
 	return index, nil
 }
 
+// parseScriptDataProperty parses a name and value of an object or ECMA array,
+// Number values are kept in f.MetaData, e.g. the onMetaData framerate
+func (f *Flv) parseScriptDataProperty(buf []byte, index int) (int, error) {
+	nameIndex := index
+	index, err := f.parseScriptDataString(buf, index)
+	if err != nil {
+		return 0, fmt.Errorf("f.parseScriptDataString failed, err:%v", err)
+	}
+	name := string(buf[nameIndex+2 : index])
+
+	valueIndex := index
+	index, err = f.parseScriptDataValue(buf, index)
+	if err != nil {
+		return 0, fmt.Errorf("f.parseScriptDataValue failed, err:%v", err)
+	}
+
+	if buf[valueIndex] == ScriptDataValueTypeNumber {
+		value, err := util.ByteToFloat64(buf[valueIndex+1 : valueIndex+9])
+		if err != nil {
+			return 0, fmt.Errorf("util.ByteToFloat64 failed, err:%v", err)
+		}
+		if f.MetaData == nil {
+			f.MetaData = make(map[string]float64)
+		}
+		f.MetaData[name] = value
+	}
+
+	return index, nil
+}
+
 func (f *Flv) parseScriptDataObjectEnd(buf []byte, index int) (int, error) {
 	if len(buf) < 3 {
 		return 0, fmt.Errorf("len(buf) < 3")
@@ -1171,7 +2060,7 @@ func (f *Flv) parseScriptDataObjectEnd(buf []byte, index int) (int, error) {
 		return 0, fmt.Errorf("objectEndMark is not 0 0 9, objectEndMark:%x", objectEndMark)
 	}
 
-	fmt.Println("objectEndMark is 0 0 9")
+	f.println("objectEndMark is 0 0 9")
 
 	index += 3
 	return index, nil
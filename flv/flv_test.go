@@ -0,0 +1,209 @@
+package flv
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// tagFlv is a quiet parser positioned on a tag of len(buf) bytes
+func tagFlv(buf []byte) *Flv {
+	return &Flv{
+		Quiet:          true,
+		DisableExtract: true,
+		CurrentTag:     &CurrentTag{Length: len(buf)},
+	}
+}
+
+func TestParseOneOrMoreNalus(t *testing.T) {
+	tests := []struct {
+		name       string
+		lengthSize int
+		nalus      []byte
+		want       [][]byte
+		wantErr    string
+	}{
+		{"1 byte prefix", 1, []byte{2, 0x65, 0xAA, 1, 0x06}, [][]byte{{0x65, 0xAA}, {0x06}}, ""},
+		{"2 byte prefix", 2, []byte{0, 2, 0x65, 0xAA, 0, 1, 0x06}, [][]byte{{0x65, 0xAA}, {0x06}}, ""},
+		{"4 byte prefix", 4, []byte{0, 0, 0, 2, 0x65, 0xAA, 0, 0, 0, 1, 0x06}, [][]byte{{0x65, 0xAA}, {0x06}}, ""},
+		{"no sequence header uses 4 bytes", 0, []byte{0, 0, 0, 1, 0x09}, [][]byte{{0x09}}, ""},
+		{"zero length nalu is skipped", 4, []byte{0, 0, 0, 0, 0, 0, 0, 1, 0x09}, [][]byte{{0x09}}, ""},
+		{"empty body", 4, nil, nil, ""},
+		{"truncated length prefix", 4, []byte{0, 0, 0, 1, 0x09, 0, 0}, nil, "nalu length prefix of 4 bytes with 2 bytes left"},
+		{"truncated 2 byte prefix", 2, []byte{0}, nil, "nalu length prefix of 2 bytes with 1 bytes left"},
+		{"nalu past the tag end", 4, []byte{0, 0, 0, 3, 0x65, 0xAA}, nil, "nalu len 3 > remaining 2"},
+		{"huge nalu length", 4, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x65}, nil, "nalu len 4294967295 > remaining 1"},
+		{"3 byte prefix", 3, []byte{0, 0, 1, 0x09}, nil, "3 bytes is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ioutil.TempFile("", "nalus")
+			if err != nil {
+				t.Fatalf("ioutil.TempFile failed, err:%v", err)
+			}
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			// a tag header and the AVC packet header before the NAL units
+			const index = 16
+			buf := append(make([]byte, index), tt.nalus...)
+			f := tagFlv(buf)
+
+			var got [][]byte
+			next, err := f.parseOneOrMoreNalus(buf, index, tt.lengthSize, out, func(nal []byte) error {
+				got = append(got, nal)
+				return nil
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseOneOrMoreNalus err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOneOrMoreNalus failed, err:%v", err)
+			}
+			if next != len(buf) {
+				t.Fatalf("parseOneOrMoreNalus = %v, want %v", next, len(buf))
+			}
+
+			var annexB []byte
+			if len(got) != len(tt.want) {
+				t.Fatalf("%v nalus %x, want %x", len(got), got, tt.want)
+			}
+			for i := range tt.want {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Fatalf("nalu %v = %x, want %x", i, got[i], tt.want[i])
+				}
+				annexB = append(annexB, 0, 0, 0, 1)
+				annexB = append(annexB, tt.want[i]...)
+			}
+			written, err := ioutil.ReadFile(out.Name())
+			if err != nil {
+				t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+			}
+			if !bytes.Equal(written, annexB) {
+				t.Fatalf("wrote %x, want %x", written, annexB)
+			}
+		})
+	}
+}
+
+func TestDecoderConfigurationRecordLengthSize(t *testing.T) {
+	// configurationVersion 1, High 4.0, reserved bits and lengthSizeMinusOne 2
+	avc := []byte{0x01, 0x64, 0x00, 0x28, 0xFE, 0xE1, 0x00, 0x00}
+	if _, err := tagFlv(avc).parseAvcDecoderConfigurationRecord(avc, 0); err == nil || !strings.Contains(err.Error(), "lengthSizeMinusOne 2") {
+		t.Fatalf("parseAvcDecoderConfigurationRecord err:%v, want lengthSizeMinusOne 2 rejected", err)
+	}
+
+	hevc := make([]byte, 23)
+	hevc[0] = 0x01
+	hevc[21] = 0x0E
+	if _, err := tagFlv(hevc).parseHevcDecoderConfigurationRecord(hevc, 0); err == nil || !strings.Contains(err.Error(), "lengthSizeMinusOne 2") {
+		t.Fatalf("parseHevcDecoderConfigurationRecord err:%v, want lengthSizeMinusOne 2 rejected", err)
+	}
+
+	hevc[21] = 0x0F
+	f := tagFlv(hevc)
+	if _, err := f.parseHevcDecoderConfigurationRecord(hevc, 0); err != nil {
+		t.Fatalf("parseHevcDecoderConfigurationRecord failed, err:%v", err)
+	}
+	if f.hevcLengthSize != 4 {
+		t.Fatalf("hevcLengthSize = %v, want 4", f.hevcLengthSize)
+	}
+}
+
+func TestAvcDecoderConfigurationRecordTagLength(t *testing.T) {
+	sps, pps := sps1080p(4), avcPps(0, 0)
+	record := []byte{0x01, 0x64, 0x00, 0x28, 0xFF, 0xE1}
+	record = append(append(record, byte(len(sps)>>8), byte(len(sps))), sps...)
+	record = append(append(record, 0x01, byte(len(pps)>>8), byte(len(pps))), pps...)
+	// the header of the next tag follows the record in buf
+	buf := append(append([]byte(nil), record...), 0x00, 0x00, 0x00, 0x2A, 0x09)
+
+	spsEnd := 8 + len(sps)
+	tests := []struct {
+		name    string
+		length  int
+		wantErr string
+	}{
+		{"whole record", len(record), ""},
+		{"header", 5, "AVCDecoderConfigurationRecord len 5 < 6"},
+		{"sps size", 7, "sps 0: len < 2"},
+		{"sps", spsEnd - 1, fmt.Sprintf("sps len %v > remaining %v", len(sps), len(sps)-1)},
+		{"numOfPictureParameterSets", spsEnd, "numOfPictureParameterSets len 0 < 1"},
+		{"pps size", spsEnd + 2, "pps 0: len < 2"},
+		{"pps", len(record) - 1, fmt.Sprintf("pps len %v > remaining %v", len(pps), len(pps)-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tagFlv(buf)
+			f.CurrentTag.Length = tt.length
+			index, err := f.parseAvcDecoderConfigurationRecord(buf, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseAvcDecoderConfigurationRecord err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAvcDecoderConfigurationRecord failed, err:%v", err)
+			}
+			if index != len(record) {
+				t.Fatalf("index = %v, want %v", index, len(record))
+			}
+			if f.VideoWidth != 1920 || f.VideoHeight != 1080 {
+				t.Fatalf("video size %vx%v, want 1920x1080", f.VideoWidth, f.VideoHeight)
+			}
+		})
+	}
+}
+
+func TestExAudioTagHeaderTagLength(t *testing.T) {
+	modEx := SoundFormatExHeader<<4 | AudioPacketTypeModEx
+	codedFrames := AudioPacketModExTypeTimestampOffsetNano<<4 | AudioPacketTypeCodedFrames
+	// a 3 byte timestampOffsetNano, then the Opus FourCC
+	header := []byte{byte(modEx), 0x02, 0x00, 0x01, 0x00, byte(codedFrames), 'O', 'p', 'u', 's'}
+	// a 256 byte ModEx data with the 16-bit size
+	long := append([]byte{byte(modEx), 0xFF, 0x00, 0xFF}, make([]byte, 256)...)
+	long = append(long, byte(codedFrames), 'O', 'p', 'u', 's')
+
+	tests := []struct {
+		name    string
+		buf     []byte
+		length  int
+		wantErr string
+	}{
+		{"whole header", header, len(header), ""},
+		{"16-bit size", long, len(long), ""},
+		{"modExDataSize", header, 1, "modExDataSize len 0 < 1"},
+		{"16-bit modExDataSize", long, 3, "modExDataSize len 1 < 2"},
+		{"modExData", header, 4, "modExDataSize 3 > remaining 1"},
+		{"16-bit modExData", long, 100, "modExDataSize 256 > remaining 95"},
+		{"audioFourCC", header, 8, "audioFourCC len 2 < 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the next tag follows the header in buf
+			buf := append(append([]byte(nil), tt.buf...), 0x00, 0x00, 0x00, 0x2A, 0x08)
+			f := tagFlv(buf)
+			f.CurrentTag.Length = tt.length
+			index, err := f.parseExAudioTagHeader(buf, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseExAudioTagHeader err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExAudioTagHeader failed, err:%v", err)
+			}
+			if index != len(tt.buf) || f.CurrentTag.AudioFourCC != AudioFourCCOpus {
+				t.Fatalf("index %v AudioFourCC %q, want %v %q", index, f.CurrentTag.AudioFourCC, len(tt.buf), AudioFourCCOpus)
+			}
+		})
+	}
+}
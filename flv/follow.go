@@ -0,0 +1,52 @@
+package flv
+
+import (
+	"io"
+	"time"
+)
+
+const DefaultFollowPollInterval = 200 * time.Millisecond
+
+// FollowReader reads a file that is still being written, like tail -f. On EOF
+// it waits for more bytes and only returns io.EOF once nothing was appended
+// for IdleTimeout. A zero IdleTimeout waits forever.
+type FollowReader struct {
+	Reader       io.Reader
+	IdleTimeout  time.Duration
+	PollInterval time.Duration
+
+	lastData time.Time
+}
+
+func NewFollowReader(r io.Reader, idleTimeout time.Duration) *FollowReader {
+	return &FollowReader{
+		Reader:       r,
+		IdleTimeout:  idleTimeout,
+		PollInterval: DefaultFollowPollInterval,
+	}
+}
+
+func (r *FollowReader) Read(p []byte) (int, error) {
+	if r.lastData.IsZero() {
+		r.lastData = time.Now()
+	}
+
+	for {
+		n, err := r.Reader.Read(p)
+		if n > 0 {
+			r.lastData = time.Now()
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+
+		if r.IdleTimeout > 0 && time.Since(r.lastData) >= r.IdleTimeout {
+			return 0, io.EOF
+		}
+		time.Sleep(r.PollInterval)
+	}
+}
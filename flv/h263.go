@@ -0,0 +1,151 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+)
+
+const (
+	H263PictureSizeCustom8  = 0
+	H263PictureSizeCustom16 = 1
+	H263PictureSizeCif      = 2
+	H263PictureSizeQcif     = 3
+	H263PictureSizeSqcif    = 4
+	H263PictureSize320x240  = 5
+	H263PictureSize160x120  = 6
+
+	H263PictureTypeIntra           = 0
+	H263PictureTypeInter           = 1
+	H263PictureTypeDisposableInter = 2
+
+	h263PictureStartCode     = 1
+	h263PictureStartCodeBits = 17
+	h263MaxExtraInformation  = 256
+)
+
+var H263PictureTypeMap = map[uint8]string{
+	H263PictureTypeIntra:           "intra frame",
+	H263PictureTypeInter:           "inter frame",
+	H263PictureTypeDisposableInter: "disposable inter frame",
+}
+
+var h263PictureSizes = map[uint8][2]uint16{
+	H263PictureSizeCif:     {352, 288},
+	H263PictureSizeQcif:    {176, 144},
+	H263PictureSizeSqcif:   {128, 96},
+	H263PictureSize320x240: {320, 240},
+	H263PictureSize160x120: {160, 120},
+}
+
+// H263VideoPacketHeader is the picture layer of a Sorenson H.263 video packet
+type H263VideoPacketHeader struct {
+	Version           uint8
+	TemporalReference uint8
+	PictureSize       uint8
+	Width             uint16
+	Height            uint16
+	PictureType       uint8
+	DeblockingFlag    bool
+	Quantizer         uint8
+	ExtraInformation  []byte
+}
+
+func (f *Flv) parseH263VideoPacket(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+
+	header, err := parseH263VideoPacketHeader(buf[index:end])
+	if err != nil {
+		return 0, fmt.Errorf("parseH263VideoPacketHeader failed, err:%v", err)
+	}
+	f.CurrentTag.H263Header = header
+	f.VideoWidth, f.VideoHeight = header.Width, header.Height
+
+	f.printf("h263 version is %v\n", header.Version)
+	f.printf("h263 temporalReference is %v\n", header.TemporalReference)
+	f.printf("h263 picture size is %vx%v\n", header.Width, header.Height)
+	f.printf("h263 pictureType is %v\n", H263PictureTypeMap[header.PictureType])
+	f.printf("h263 deblockingFlag is %v\n", header.DeblockingFlag)
+	f.printf("h263 quantizer is %v\n", header.Quantizer)
+	if len(header.ExtraInformation) > 0 {
+		f.printf("h263 extraInformation is %v\n", header.ExtraInformation)
+	}
+	f.printf("h263 macroblock data is not decoded\n")
+
+	return end, nil
+}
+
+func parseH263VideoPacketHeader(buf []byte) (*H263VideoPacketHeader, error) {
+	r := util.NewBitReader(buf)
+
+	pictureStartCode, err := r.ReadBits(h263PictureStartCodeBits)
+	if err != nil {
+		return nil, err
+	}
+	if pictureStartCode != h263PictureStartCode {
+		return nil, fmt.Errorf("PictureStartCode != 1, PictureStartCode:%v", pictureStartCode)
+	}
+
+	header := new(H263VideoPacketHeader)
+	version, _ := r.ReadBits(5)
+	if version > 1 {
+		return nil, fmt.Errorf("version is neither 0 nor 1, version:%v", version)
+	}
+	temporalReference, _ := r.ReadBits(8)
+	pictureSize, err := r.ReadBits(3)
+	if err != nil {
+		return nil, err
+	}
+	header.Version = uint8(version)
+	header.TemporalReference = uint8(temporalReference)
+	header.PictureSize = uint8(pictureSize)
+
+	switch pictureSize {
+	case H263PictureSizeCustom8, H263PictureSizeCustom16:
+		bits := 8
+		if pictureSize == H263PictureSizeCustom16 {
+			bits = 16
+		}
+		width, _ := r.ReadBits(bits)
+		height, err := r.ReadBits(bits)
+		if err != nil {
+			return nil, err
+		}
+		header.Width, header.Height = uint16(width), uint16(height)
+	default:
+		size, ok := h263PictureSizes[header.PictureSize]
+		if !ok {
+			return nil, fmt.Errorf("PictureSize is reserved, PictureSize:%v", pictureSize)
+		}
+		header.Width, header.Height = size[0], size[1]
+	}
+
+	pictureType, _ := r.ReadBits(2)
+	if _, ok := H263PictureTypeMap[uint8(pictureType)]; !ok {
+		return nil, fmt.Errorf("PictureType is reserved, PictureType:%v", pictureType)
+	}
+	deblockingFlag, _ := r.ReadFlag()
+	quantizer, err := r.ReadBits(5)
+	if err != nil {
+		return nil, err
+	}
+	header.PictureType = uint8(pictureType)
+	header.DeblockingFlag = deblockingFlag
+	header.Quantizer = uint8(quantizer)
+
+	for len(header.ExtraInformation) < h263MaxExtraInformation {
+		extraInformationFlag, err := r.ReadFlag()
+		if err != nil {
+			return nil, err
+		}
+		if !extraInformationFlag {
+			break
+		}
+		extraInformation, err := r.ReadBits(8)
+		if err != nil {
+			return nil, err
+		}
+		header.ExtraInformation = append(header.ExtraInformation, byte(extraInformation))
+	}
+
+	return header, nil
+}
@@ -0,0 +1,95 @@
+package flv
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// h263Header packs the Sorenson H.263 picture layer up to the picture size,
+// then the given fields
+func h263Header(version uint32, pictureSize uint32, rest ...uint32) []byte {
+	fields := []uint32{
+		h263PictureStartCode, h263PictureStartCodeBits,
+		version, 5,
+		7, 8, // TemporalReference
+		pictureSize, 3,
+	}
+	return bitFields(append(fields, rest...)...)
+}
+
+func TestParseH263VideoPacketHeader(t *testing.T) {
+	// a version 1 picture starts with 00 00 84, as in Sorenson Spark streams
+	if got := h263Header(1, H263PictureSizeCif, 0, 2, 0, 1, 10, 5, 0, 1); !bytes.HasPrefix(got, []byte{0x00, 0x00, 0x84}) {
+		t.Fatalf("h263Header = %x, want 000084 first", got)
+	}
+
+	tests := []struct {
+		name    string
+		buf     []byte
+		want    *H263VideoPacketHeader
+		wantErr string
+	}{
+		{"CIF intra", h263Header(1, H263PictureSizeCif,
+			H263PictureTypeIntra, 2, 0, 1, 10, 5, 0, 1),
+			&H263VideoPacketHeader{Version: 1, TemporalReference: 7, PictureSize: H263PictureSizeCif,
+				Width: 352, Height: 288, Quantizer: 10}, ""},
+		{"320x240 disposable inter with deblocking", h263Header(0, H263PictureSize320x240,
+			H263PictureTypeDisposableInter, 2, 1, 1, 31, 5, 0, 1),
+			&H263VideoPacketHeader{TemporalReference: 7, PictureSize: H263PictureSize320x240,
+				Width: 320, Height: 240, PictureType: H263PictureTypeDisposableInter, DeblockingFlag: true, Quantizer: 31}, ""},
+		{"custom 8 bit size", h263Header(1, H263PictureSizeCustom8,
+			200, 8, 100, 8, H263PictureTypeInter, 2, 0, 1, 4, 5, 0, 1),
+			&H263VideoPacketHeader{Version: 1, TemporalReference: 7, PictureSize: H263PictureSizeCustom8,
+				Width: 200, Height: 100, PictureType: H263PictureTypeInter, Quantizer: 4}, ""},
+		{"custom 16 bit size", h263Header(1, H263PictureSizeCustom16,
+			1000, 16, 600, 16, H263PictureTypeIntra, 2, 0, 1, 4, 5, 0, 1),
+			&H263VideoPacketHeader{Version: 1, TemporalReference: 7, PictureSize: H263PictureSizeCustom16,
+				Width: 1000, Height: 600, Quantizer: 4}, ""},
+		{"extra information", h263Header(1, H263PictureSizeQcif,
+			H263PictureTypeIntra, 2, 0, 1, 4, 5, 1, 1, 0xAB, 8, 1, 1, 0xCD, 8, 0, 1),
+			&H263VideoPacketHeader{Version: 1, TemporalReference: 7, PictureSize: H263PictureSizeQcif,
+				Width: 176, Height: 144, Quantizer: 4, ExtraInformation: []byte{0xAB, 0xCD}}, ""},
+		{"bad start code", bitFields(2, 17, 0, 32), nil, "PictureStartCode != 1"},
+		{"version 2", h263Header(2, H263PictureSizeCif, 0, 16), nil, "version is neither 0 nor 1"},
+		{"reserved picture size", h263Header(1, 7, 0, 16), nil, "PictureSize is reserved"},
+		{"reserved picture type", h263Header(1, H263PictureSizeCif, 3, 2, 0, 14), nil, "PictureType is reserved"},
+		{"truncated custom size", h263Header(1, H263PictureSizeCustom16, 1000, 16)[:6], nil, "bits left"},
+		{"truncated extra information", h263Header(1, H263PictureSizeQcif,
+			H263PictureTypeIntra, 2, 0, 1, 4, 5, 1, 1), nil, "bits left"},
+		{"empty", nil, nil, "bits left"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseH263VideoPacketHeader(tt.buf)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseH263VideoPacketHeader err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseH263VideoPacketHeader failed, err:%v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseH263VideoPacketHeader = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseH263VideoPacket(t *testing.T) {
+	// the FLV video tag header byte, then the picture layer
+	buf := append([]byte{0x12}, h263Header(1, H263PictureSize160x120, H263PictureTypeInter, 2, 0, 1, 8, 5, 0, 1)...)
+	f := tagFlv(buf)
+	if _, err := f.parseH263VideoPacket(buf, 1); err != nil {
+		t.Fatalf("parseH263VideoPacket failed, err:%v", err)
+	}
+	if f.CurrentTag.H263Header == nil || f.CurrentTag.H263Header.PictureType != H263PictureTypeInter {
+		t.Fatalf("H263Header = %+v, want an inter frame", f.CurrentTag.H263Header)
+	}
+	if f.VideoWidth != 160 || f.VideoHeight != 120 {
+		t.Fatalf("size = %vx%v, want 160x120", f.VideoWidth, f.VideoHeight)
+	}
+}
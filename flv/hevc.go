@@ -0,0 +1,236 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+)
+
+const (
+	HevcNaluTypeVps       = 32
+	HevcNaluTypeSps       = 33
+	HevcNaluTypePps       = 34
+	HevcNaluTypePrefixSei = 39
+	HevcNaluTypeSuffixSei = 40
+)
+
+var HevcNaluTypeMap = map[uint8]string{
+	HevcNaluTypeVps:       "VPS",
+	HevcNaluTypeSps:       "SPS",
+	HevcNaluTypePps:       "PPS",
+	HevcNaluTypePrefixSei: "prefix SEI",
+	HevcNaluTypeSuffixSei: "suffix SEI",
+}
+
+// HevcDecoderConfigurationRecord is the hvcC of ISO 14496-15, the parameter
+// sets are kept without their length prefix
+type HevcDecoderConfigurationRecord struct {
+	ConfigurationVersion             uint8
+	GeneralProfileSpace              uint8
+	GeneralTierFlag                  uint8
+	GeneralProfileIdc                uint8
+	GeneralProfileCompatibilityFlags uint32
+	GeneralConstraintIndicatorFlags  []byte
+	GeneralLevelIdc                  uint8
+	ChromaFormat                     uint8
+	BitDepthLumaMinus8               uint8
+	BitDepthChromaMinus8             uint8
+	LengthSizeMinusOne               uint8
+	Vps                              [][]byte
+	Sps                              [][]byte
+	Pps                              [][]byte
+}
+
+// parseHevcVideoPacket parses the legacy CodecID 12 body, which follows the AVC layout
+func (f *Flv) parseHevcVideoPacket(buf []byte, index int) (int, error) {
+
+	var err error
+
+	if f.CurrentTag.AVCPacketType == AvcPacketTypeAvcSequenceHeader {
+		index, err = f.parseHevcDecoderConfigurationRecord(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseHevcDecoderConfigurationRecord failed, err:%v", err)
+		}
+	}
+
+	if f.CurrentTag.AVCPacketType == AvcPacketTypeAvcNalu {
+		if err = f.openExtractFile(&f.h265File, "./test.265"); err != nil {
+			return 0, fmt.Errorf("f.openExtractFile failed, err:%v", err)
+		}
+		index, err = f.parseOneOrMoreNalus(buf, index, f.hevcLengthSize, f.h265File, nil)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseOneOrMoreNalus failed, err:%v", err)
+		}
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseHevcExVideoPacket(buf []byte, index int) (int, error) {
+
+	var err error
+
+	switch f.CurrentTag.VideoPacketType {
+	case VideoPacketTypeSequenceStart:
+		index, err = f.parseHevcDecoderConfigurationRecord(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseHevcDecoderConfigurationRecord failed, err:%v", err)
+		}
+	case VideoPacketTypeCodedFrames, VideoPacketTypeCodedFramesX:
+		if err = f.openExtractFile(&f.h265File, "./test.265"); err != nil {
+			return 0, fmt.Errorf("f.openExtractFile failed, err:%v", err)
+		}
+		index, err = f.parseOneOrMoreNalus(buf, index, f.hevcLengthSize, f.h265File, nil)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseOneOrMoreNalus failed, err:%v", err)
+		}
+	default:
+		index = f.CurrentTag.Length
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseHevcDecoderConfigurationRecord(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	if end-index < 23 {
+		return 0, fmt.Errorf("HEVCDecoderConfigurationRecord len %v < 23", end-index)
+	}
+
+	configurationVersion := buf[index]
+	if configurationVersion != 1 {
+		return 0, fmt.Errorf("configurationVersion != 1")
+	}
+	config := &HevcDecoderConfigurationRecord{ConfigurationVersion: configurationVersion}
+	f.printf("configurationVersion is 0x1\n")
+	index++
+
+	generalProfileSpace := buf[index] >> 6
+	generalTierFlag := (buf[index] >> 5) & 0b1
+	generalProfileIdc := buf[index] & 0b00011111
+	f.printf("generalProfileSpace is %v\n", generalProfileSpace)
+	f.printf("generalTierFlag is %v\n", generalTierFlag)
+	f.printf("generalProfileIdc is %v\n", generalProfileIdc)
+	config.GeneralProfileSpace = generalProfileSpace
+	config.GeneralTierFlag = generalTierFlag
+	config.GeneralProfileIdc = generalProfileIdc
+	index++
+
+	generalProfileCompatibilityFlags, err := util.BytesToUint32ByBigEndian(buf[index : index+4])
+	if err != nil {
+		return 0, fmt.Errorf("util.BytesToUint32ByBigEndian failed, err:%v", err)
+	}
+	f.printf("generalProfileCompatibilityFlags is 0x%08x\n", generalProfileCompatibilityFlags)
+	config.GeneralProfileCompatibilityFlags = generalProfileCompatibilityFlags
+	index += 4
+
+	f.printf("generalConstraintIndicatorFlags is 0x%x\n", buf[index:index+6])
+	config.GeneralConstraintIndicatorFlags = append([]byte(nil), buf[index:index+6]...)
+	index += 6
+
+	generalLevelIdc := buf[index]
+	f.printf("generalLevelIdc is %v\n", generalLevelIdc)
+	config.GeneralLevelIdc = generalLevelIdc
+	index++
+
+	minSpatialSegmentationIdc, err := util.BytesToUint16ByBigEndian(buf[index : index+2])
+	if err != nil {
+		return 0, fmt.Errorf("util.BytesToUint16ByBigEndian failed, err:%v", err)
+	}
+	f.printf("minSpatialSegmentationIdc is %v\n", minSpatialSegmentationIdc&0x0FFF)
+	index += 2
+
+	f.printf("parallelismType is %v\n", buf[index]&0b11)
+	index++
+
+	config.ChromaFormat = buf[index] & 0b11
+	f.printf("chromaFormat is %v\n", config.ChromaFormat)
+	index++
+
+	config.BitDepthLumaMinus8 = buf[index] & 0b111
+	f.printf("bitDepthLumaMinus8 is %v\n", config.BitDepthLumaMinus8)
+	index++
+
+	config.BitDepthChromaMinus8 = buf[index] & 0b111
+	f.printf("bitDepthChromaMinus8 is %v\n", config.BitDepthChromaMinus8)
+	index++
+
+	avgFrameRate, err := util.BytesToUint16ByBigEndian(buf[index : index+2])
+	if err != nil {
+		return 0, fmt.Errorf("util.BytesToUint16ByBigEndian failed, err:%v", err)
+	}
+	f.printf("avgFrameRate is %v\n", avgFrameRate)
+	index += 2
+
+	f.printf("constantFrameRate is %v\n", buf[index]>>6)
+	f.printf("numTemporalLayers is %v\n", (buf[index]>>3)&0b111)
+	f.printf("temporalIdNested is %v\n", (buf[index]>>2)&0b1)
+	lengthSizeMinusOne := buf[index] & 0b11
+	f.printf("lengthSizeMinusOne is %v\n", lengthSizeMinusOne)
+	if lengthSizeMinusOne == 2 {
+		return 0, fmt.Errorf("lengthSizeMinusOne 2 is not allowed")
+	}
+	config.LengthSizeMinusOne = lengthSizeMinusOne
+	index++
+
+	numOfArrays := buf[index]
+	f.printf("numOfArrays is %v\n", numOfArrays)
+	index++
+
+	if err = f.openExtractFile(&f.h265File, "./test.265"); err != nil {
+		return 0, fmt.Errorf("f.openExtractFile failed, err:%v", err)
+	}
+
+	for i := 0; i < int(numOfArrays); i++ {
+		if end-index < 3 {
+			return 0, fmt.Errorf("nalu array %v: len < 3", i)
+		}
+		naluType := buf[index] & 0b00111111
+		naluTypeString, ok := HevcNaluTypeMap[naluType]
+		if !ok {
+			naluTypeString = fmt.Sprintf("type %v", naluType)
+		}
+		index++
+
+		numNalus, err := util.BytesToUint16ByBigEndian(buf[index : index+2])
+		if err != nil {
+			return 0, fmt.Errorf("util.BytesToUint16ByBigEndian failed, err:%v", err)
+		}
+		index += 2
+
+		for j := 0; j < int(numNalus); j++ {
+			if end-index < 2 {
+				return 0, fmt.Errorf("nalu %v of array %v: len < 2", j, i)
+			}
+			naluLength, err := util.BytesToUint16ByBigEndian(buf[index : index+2])
+			if err != nil {
+				return 0, fmt.Errorf("util.BytesToUint16ByBigEndian failed, err:%v", err)
+			}
+			index += 2
+
+			if end-index < int(naluLength) {
+				return 0, fmt.Errorf("%v len %v > remaining %v", naluTypeString, naluLength, end-index)
+			}
+			f.printf("%v size is %v\n", naluTypeString, naluLength)
+
+			nalu := append([]byte(nil), buf[index:index+int(naluLength)]...)
+			switch naluType {
+			case HevcNaluTypeVps:
+				config.Vps = append(config.Vps, nalu)
+			case HevcNaluTypeSps:
+				config.Sps = append(config.Sps, nalu)
+			case HevcNaluTypePps:
+				config.Pps = append(config.Pps, nalu)
+			}
+
+			_, _ = f.h265File.Write([]byte{0x00, 0x00, 0x00, 0x01})
+			_, _ = f.h265File.Write(buf[index : index+int(naluLength)])
+
+			index += int(naluLength)
+		}
+	}
+
+	f.HevcConfig = config
+	f.hevcLengthSize = int(config.LengthSizeMinusOne) + 1
+
+	return f.CurrentTag.Length, nil
+}
@@ -0,0 +1,155 @@
+package flv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var (
+	hevcVps = []byte{0x40, 0x01, 0x0C, 0x01}
+	hevcSps = []byte{0x42, 0x01, 0x01, 0x01, 0x60}
+	hevcPps = []byte{0x44, 0x01, 0xC1}
+	// an IDR_W_RADL and a TRAIL_R slice
+	hevcIdr   = []byte{0x26, 0x01, 0xAF, 0x06}
+	hevcTrail = []byte{0x02, 0x01, 0xD0}
+)
+
+// hvcC is a Main 3.1 4:2:0 8 bit HEVCDecoderConfigurationRecord with a 4 byte
+// NAL unit length
+func hvcC() []byte {
+	buf := []byte{
+		0x01,                   // configurationVersion
+		0x01,                   // general_profile_space 0, tier 0, profile_idc 1
+		0x60, 0x00, 0x00, 0x00, // general_profile_compatibility_flags
+		0x90, 0x00, 0x00, 0x00, 0x00, 0x00, // general_constraint_indicator_flags
+		0x5D,       // general_level_idc
+		0xF0, 0x00, // min_spatial_segmentation_idc
+		0xFC,       // parallelismType
+		0xFD,       // chromaFormat 1
+		0xF8,       // bitDepthLumaMinus8
+		0xF8,       // bitDepthChromaMinus8
+		0x00, 0x00, // avgFrameRate
+		0x0F, // 1 temporal layer, nested, lengthSizeMinusOne 3
+		0x03, // numOfArrays
+	}
+	for _, nalu := range [][]byte{hevcVps, hevcSps, hevcPps} {
+		// array_completeness and the NAL unit type
+		buf = append(buf, 0x80|nalu[0]>>1, 0x00, 0x01, 0x00, byte(len(nalu)))
+		buf = append(buf, nalu...)
+	}
+	return buf
+}
+
+// lengthPrefixed joins the NAL units with 4 byte length prefixes
+func lengthPrefixed(nalus ...[]byte) []byte {
+	var buf []byte
+	for _, nalu := range nalus {
+		buf = append(buf, 0x00, 0x00, 0x00, byte(len(nalu)))
+		buf = append(buf, nalu...)
+	}
+	return buf
+}
+
+func TestParseHevc(t *testing.T) {
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	hvc1 := []byte(VideoFourCCHevc)
+
+	tests := []struct {
+		name string
+		tags []synthTag
+	}{
+		{"legacy CodecID 12", []synthTag{
+			{TagTypeVideo, 0, cat([]byte{0x1C, 0x00, 0x00, 0x00, 0x00}, hvcC())},
+			{TagTypeVideo, 0, cat([]byte{0x1C, 0x01, 0x00, 0x00, 0x28}, lengthPrefixed(hevcIdr))},
+			{TagTypeVideo, 40, cat([]byte{0x2C, 0x01, 0x00, 0x00, 0x00}, lengthPrefixed(hevcTrail))},
+		}},
+		{"Enhanced RTMP hvc1", []synthTag{
+			{TagTypeVideo, 0, cat([]byte{0x80 | 0x10 | VideoPacketTypeSequenceStart}, hvc1, hvcC())},
+			{TagTypeVideo, 0, cat([]byte{0x80 | 0x10 | VideoPacketTypeCodedFrames}, hvc1, []byte{0x00, 0x00, 0x28}, lengthPrefixed(hevcIdr))},
+			{TagTypeVideo, 40, cat([]byte{0x80 | 0x20 | VideoPacketTypeCodedFramesX}, hvc1, lengthPrefixed(hevcTrail))},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ioutil.TempFile("", "hevc")
+			if err != nil {
+				t.Fatalf("ioutil.TempFile failed, err:%v", err)
+			}
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			// nothing is opened, the NAL units go to the file already set
+			f := &Flv{Quiet: true, DisableExtract: true, h265File: out}
+			var compositionTimes []int32
+			f.OnTag = func(tag *CurrentTag) error {
+				compositionTimes = append(compositionTimes, tag.CompositionTime)
+				return nil
+			}
+			if _, err = f.Parse(synthFlv(tt.tags)); err != nil {
+				t.Fatalf("f.Parse failed, err:%v", err)
+			}
+
+			want := &HevcDecoderConfigurationRecord{
+				ConfigurationVersion:             1,
+				GeneralProfileIdc:                1,
+				GeneralProfileCompatibilityFlags: 0x60000000,
+				GeneralConstraintIndicatorFlags:  []byte{0x90, 0x00, 0x00, 0x00, 0x00, 0x00},
+				GeneralLevelIdc:                  93,
+				ChromaFormat:                     1,
+				LengthSizeMinusOne:               3,
+				Vps:                              [][]byte{hevcVps},
+				Sps:                              [][]byte{hevcSps},
+				Pps:                              [][]byte{hevcPps},
+			}
+			if !reflect.DeepEqual(f.HevcConfig, want) {
+				t.Fatalf("HevcConfig = %+v, want %+v", f.HevcConfig, want)
+			}
+			if f.hevcLengthSize != 4 {
+				t.Fatalf("hevcLengthSize = %v, want 4", f.hevcLengthSize)
+			}
+			if wantCts := []int32{0, 40, 0}; !reflect.DeepEqual(compositionTimes, wantCts) {
+				t.Fatalf("CompositionTime = %v, want %v", compositionTimes, wantCts)
+			}
+
+			// the parameter sets, then the frames, all as Annex B
+			var annexB []byte
+			for _, nalu := range [][]byte{hevcVps, hevcSps, hevcPps, hevcIdr, hevcTrail} {
+				annexB = append(annexB, 0x00, 0x00, 0x00, 0x01)
+				annexB = append(annexB, nalu...)
+			}
+			written, err := ioutil.ReadFile(out.Name())
+			if err != nil {
+				t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+			}
+			if !bytes.Equal(written, annexB) {
+				t.Fatalf("wrote %x, want %x", written, annexB)
+			}
+		})
+	}
+}
+
+func TestParseHevcDecoderConfigurationRecordTruncated(t *testing.T) {
+	config := hvcC()
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"short fixed part", config[:22]},
+		{"truncated array header", config[:24]},
+		{"parameter set past the end", config[:len(config)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tagFlv(tt.buf)
+			if _, err := f.parseHevcDecoderConfigurationRecord(tt.buf, 0); err == nil {
+				t.Fatalf("parseHevcDecoderConfigurationRecord of %v bytes succeeded", len(tt.buf))
+			}
+			if f.HevcConfig != nil {
+				t.Fatalf("HevcConfig = %+v, want nil", f.HevcConfig)
+			}
+		})
+	}
+}
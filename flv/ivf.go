@@ -0,0 +1,69 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const ivfHeaderSize = 32
+
+// ivfWriter writes frames into an IVF file with a 1/1000 timebase. Width,
+// height and the frame count are patched into the header on Close.
+type ivfWriter struct {
+	file   *os.File
+	fourCC string
+	Width  uint16
+	Height uint16
+	frames uint32
+}
+
+func newIvfWriter(name string, fourCC string) (*ivfWriter, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(%q) failed, err:%v", name, err)
+	}
+
+	w := &ivfWriter{file: file, fourCC: fourCC}
+	if _, err = file.Write(w.header()); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("file.Write failed, err:%v", err)
+	}
+	return w, nil
+}
+
+func (w *ivfWriter) header() []byte {
+	header := make([]byte, ivfHeaderSize)
+	copy(header[0:4], "DKIF")
+	binary.LittleEndian.PutUint16(header[4:6], 0)
+	binary.LittleEndian.PutUint16(header[6:8], ivfHeaderSize)
+	copy(header[8:12], w.fourCC)
+	binary.LittleEndian.PutUint16(header[12:14], w.Width)
+	binary.LittleEndian.PutUint16(header[14:16], w.Height)
+	binary.LittleEndian.PutUint32(header[16:20], 1000)
+	binary.LittleEndian.PutUint32(header[20:24], 1)
+	binary.LittleEndian.PutUint32(header[24:28], w.frames)
+	return header
+}
+
+func (w *ivfWriter) WriteFrame(pts uint64, frame []byte) error {
+	header := make([]byte, 12)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(frame)))
+	binary.LittleEndian.PutUint64(header[4:12], pts)
+	if _, err := w.file.Write(header); err != nil {
+		return fmt.Errorf("w.file.Write failed, err:%v", err)
+	}
+	if _, err := w.file.Write(frame); err != nil {
+		return fmt.Errorf("w.file.Write failed, err:%v", err)
+	}
+	w.frames++
+	return nil
+}
+
+func (w *ivfWriter) Close() error {
+	if _, err := w.file.WriteAt(w.header(), 0); err != nil {
+		_ = w.file.Close()
+		return fmt.Errorf("w.file.WriteAt failed, err:%v", err)
+	}
+	return w.file.Close()
+}
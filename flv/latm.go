@@ -0,0 +1,86 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+	"io"
+)
+
+const (
+	loasSyncWord       = 0x2B7
+	loasMaxMuxLength   = 0x1FFF
+	latmConfigInterval = 20 // frames between StreamMuxConfig repetitions
+)
+
+// loasWriter wraps raw AAC frames into LOAS AudioSyncStream frames with one
+// LATM AudioMuxElement each. The StreamMuxConfig is repeated so that decoders
+// can join in the middle of the stream.
+type loasWriter struct {
+	w      io.Writer
+	config *AudioSpecificConfig
+	frames int
+}
+
+func newLoasWriter(w io.Writer, config *AudioSpecificConfig) (*loasWriter, error) {
+	if config == nil {
+		return nil, fmt.Errorf("no AudioSpecificConfig")
+	}
+	if config.Bits == 0 {
+		// audioMuxVersion 0 carries the config without a length
+		return nil, fmt.Errorf("the length of the %v config is unknown", aacProfileString(config.AudioObjectType))
+	}
+	return &loasWriter{w: w, config: config}, nil
+}
+
+func (l *loasWriter) WriteFrame(payload []byte) error {
+	m := new(util.BitWriter)
+
+	// AudioMuxElement(muxConfigPresent=1)
+	useSameStreamMux := l.frames%latmConfigInterval != 0
+	if useSameStreamMux {
+		m.WriteBits(1, 1)
+	} else {
+		m.WriteBits(0, 1)
+		l.writeStreamMuxConfig(m)
+	}
+	// PayloadLengthInfo for frameLengthType 0
+	length := len(payload)
+	for ; length >= 255; length -= 255 {
+		m.WriteBits(255, 8)
+	}
+	m.WriteBits(uint32(length), 8)
+	m.WriteBytes(payload, len(payload)*8)
+	m.ByteAlign()
+
+	element := m.Bytes()
+	if len(element) > loasMaxMuxLength {
+		return fmt.Errorf("AudioMuxElement len %v > %v", len(element), loasMaxMuxLength)
+	}
+	sync := new(util.BitWriter)
+	sync.WriteBits(loasSyncWord, 11)
+	sync.WriteBits(uint32(len(element)), 13)
+
+	if _, err := l.w.Write(sync.Bytes()); err != nil {
+		return fmt.Errorf("write LOAS header failed, err:%v", err)
+	}
+	if _, err := l.w.Write(element); err != nil {
+		return fmt.Errorf("write AudioMuxElement failed, err:%v", err)
+	}
+	l.frames++
+	return nil
+}
+
+// writeStreamMuxConfig writes audioMuxVersion 0 with one program, one layer
+// and the AudioSpecificConfig bits inline
+func (l *loasWriter) writeStreamMuxConfig(m *util.BitWriter) {
+	m.WriteBits(0, 1) // audioMuxVersion
+	m.WriteBits(1, 1) // allStreamsSameTimeFraming
+	m.WriteBits(0, 6) // numSubFrames
+	m.WriteBits(0, 4) // numProgram
+	m.WriteBits(0, 3) // numLayer
+	m.WriteBytes(l.config.Raw, l.config.Bits)
+	m.WriteBits(0, 3)    // frameLengthType
+	m.WriteBits(0xFF, 8) // latmBufferFullness
+	m.WriteBits(0, 1)    // otherDataPresent
+	m.WriteBits(0, 1)    // crcCheckPresent
+}
@@ -0,0 +1,110 @@
+package flv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// loasFrame is the AudioSyncStream header of ISO 14496-3 1.7.2 before an
+// AudioMuxElement of size bytes
+func loasFrame(size int, element []byte) []byte {
+	return append(bitFields(0x2B7, 11, uint32(size), 13), element...)
+}
+
+func TestLoasWriter(t *testing.T) {
+	c, err := ParseAudioSpecificConfig([]byte{0x12, 0x10})
+	if err != nil {
+		t.Fatalf("ParseAudioSpecificConfig failed, err:%v", err)
+	}
+	out := new(bytes.Buffer)
+	l, err := newLoasWriter(out, c)
+	if err != nil {
+		t.Fatalf("newLoasWriter failed, err:%v", err)
+	}
+
+	// the first AudioMuxElement carries the StreamMuxConfig with the 16 bits
+	// of the AudioSpecificConfig
+	first := bitFields(
+		0, 1, // useSameStreamMux
+		0, 1, 1, 1, 0, 6, 0, 4, 0, 3, // audioMuxVersion, allStreamsSameTimeFraming, numSubFrames, numProgram, numLayer
+		0x1210, 16,
+		0, 3, 0xFF, 8, // frameLengthType, latmBufferFullness
+		0, 1, 0, 1, // otherDataPresent, crcCheckPresent
+		3, 8, // PayloadLengthInfo
+		0xAABBCC, 24,
+	)
+	// as in LOAS streams of LC 44.1 kHz stereo
+	if !bytes.HasPrefix(first, []byte{0x20, 0x00, 0x12, 0x10, 0x1F, 0xE0}) {
+		t.Fatalf("AudioMuxElement = %x, want 20001210 1fe0 first", first)
+	}
+	if err = l.WriteFrame([]byte{0xAA, 0xBB, 0xCC}); err != nil {
+		t.Fatalf("WriteFrame failed, err:%v", err)
+	}
+	if want := loasFrame(10, first); !bytes.Equal(out.Bytes(), want) {
+		t.Fatalf("first frame = %x, want %x", out.Bytes(), want)
+	}
+
+	// then useSameStreamMux, payloads of 255 bytes and more take a length
+	// byte per 255 bytes
+	payload := bytes.Repeat([]byte{0x5A}, 300)
+	out.Reset()
+	if err = l.WriteFrame(payload); err != nil {
+		t.Fatalf("WriteFrame failed, err:%v", err)
+	}
+	fields := []uint32{1, 1, 255, 8, 45, 8}
+	for _, b := range payload {
+		fields = append(fields, uint32(b), 8)
+	}
+	if want := loasFrame(303, bitFields(fields...)); !bytes.Equal(out.Bytes(), want) {
+		t.Fatalf("second frame = %x, want %x", out.Bytes(), want)
+	}
+
+	// the StreamMuxConfig is repeated every 20 frames
+	for i := 2; i < latmConfigInterval; i++ {
+		if err = l.WriteFrame([]byte{0x01}); err != nil {
+			t.Fatalf("WriteFrame failed, err:%v", err)
+		}
+	}
+	out.Reset()
+	if err = l.WriteFrame([]byte{0xAA, 0xBB, 0xCC}); err != nil {
+		t.Fatalf("WriteFrame failed, err:%v", err)
+	}
+	if want := loasFrame(10, first); !bytes.Equal(out.Bytes(), want) {
+		t.Fatalf("frame %v = %x, want %x", latmConfigInterval, out.Bytes(), want)
+	}
+
+	if err = l.WriteFrame(make([]byte, loasMaxMuxLength)); err == nil || !strings.Contains(err.Error(), "AudioMuxElement len 8225 > 8191") {
+		t.Fatalf("WriteFrame err:%v, want AudioMuxElement len 8225 > 8191", err)
+	}
+
+	// USAC is not parsed past the header, its config length is unknown
+	usac, _ := ParseAudioSpecificConfig(bitFields(AACProfileEscape, 5, AACProfileUSAC-32, 6, 3, 4, 2, 4))
+	if _, err = newLoasWriter(out, usac); err == nil || !strings.Contains(err.Error(), "the length of the") {
+		t.Fatalf("newLoasWriter err:%v, want the length of the config is unknown", err)
+	}
+}
+
+func TestLoasWriterConfigBits(t *testing.T) {
+	// only the 25 bits of an HE-AAC config go into the StreamMuxConfig, the
+	// frameLengthType follows without the padding
+	c, err := ParseAudioSpecificConfig([]byte{0x2B, 0x92, 0x08, 0x00})
+	if err != nil {
+		t.Fatalf("ParseAudioSpecificConfig failed, err:%v", err)
+	}
+	out := new(bytes.Buffer)
+	l, err := newLoasWriter(out, c)
+	if err != nil {
+		t.Fatalf("newLoasWriter failed, err:%v", err)
+	}
+	if err = l.WriteFrame([]byte{0x77}); err != nil {
+		t.Fatalf("WriteFrame failed, err:%v", err)
+	}
+	element := bitFields(0, 1, 0, 1, 1, 1, 0, 6, 0, 4, 0, 3,
+		0x2B9208<<1, 25,
+		0, 3, 0xFF, 8, 0, 1, 0, 1,
+		1, 8, 0x77, 8)
+	if want := loasFrame(len(element), element); !bytes.Equal(out.Bytes(), want) {
+		t.Fatalf("frame = %x, want %x", out.Bytes(), want)
+	}
+}
@@ -0,0 +1,235 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	mp4TrackId               = 1
+	mp4ObjectTypeAac         = 0x40
+	mp4StreamTypeAudio       = 0x05
+	mp4DescrTagEs            = 0x03
+	mp4DescrTagDecoderConfig = 0x04
+	mp4DescrTagDecSpecific   = 0x05
+	mp4DescrTagSlConfig      = 0x06
+	mp4MdatHeaderSize        = 16 // with the 64-bit largesize
+)
+
+// m4aWriter writes raw AAC frames into an audio only MP4. The frames go
+// straight into mdat, the sample table and moov are written on Close.
+type m4aWriter struct {
+	file       *os.File
+	config     *AudioSpecificConfig
+	mdatOffset int64
+	sizes      []uint32
+	mdatSize   uint64
+}
+
+func newM4aWriter(name string, config *AudioSpecificConfig) (*m4aWriter, error) {
+	if config == nil {
+		return nil, fmt.Errorf("no AudioSpecificConfig")
+	}
+	if config.SamplingFrequency == 0 {
+		return nil, fmt.Errorf("samplingFrequency is 0")
+	}
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(%q) failed, err:%v", name, err)
+	}
+
+	ftyp := mp4Box("ftyp", []byte("M4A "), []byte{0, 0, 0, 0}, []byte("M4A mp42isom"))
+	mdat := make([]byte, mp4MdatHeaderSize)
+	binary.BigEndian.PutUint32(mdat[0:4], 1)
+	copy(mdat[4:8], "mdat")
+	if _, err = file.Write(append(ftyp, mdat...)); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("file.Write failed, err:%v", err)
+	}
+
+	return &m4aWriter{file: file, config: config, mdatOffset: int64(len(ftyp))}, nil
+}
+
+func (w *m4aWriter) WriteFrame(frame []byte) error {
+	if _, err := w.file.Write(frame); err != nil {
+		return fmt.Errorf("w.file.Write failed, err:%v", err)
+	}
+	w.sizes = append(w.sizes, uint32(len(frame)))
+	w.mdatSize += uint64(len(frame))
+	return nil
+}
+
+// frameSamples is the duration of every AAC frame, which is what makes the
+// M4A duration exact where the millisecond FLV timestamps are not
+func (w *m4aWriter) frameSamples() uint32 {
+	if w.config.FrameLengthFlag {
+		return 960
+	}
+	return 1024
+}
+
+func (w *m4aWriter) Close() error {
+	largesize := make([]byte, 8)
+	binary.BigEndian.PutUint64(largesize, mp4MdatHeaderSize+w.mdatSize)
+	if _, err := w.file.WriteAt(largesize, w.mdatOffset+8); err != nil {
+		_ = w.file.Close()
+		return fmt.Errorf("w.file.WriteAt failed, err:%v", err)
+	}
+	if _, err := w.file.Seek(0, io.SeekEnd); err != nil {
+		_ = w.file.Close()
+		return fmt.Errorf("w.file.Seek failed, err:%v", err)
+	}
+	if _, err := w.file.Write(w.moov()); err != nil {
+		_ = w.file.Close()
+		return fmt.Errorf("w.file.Write failed, err:%v", err)
+	}
+	return w.file.Close()
+}
+
+func (w *m4aWriter) moov() []byte {
+	timescale := w.config.SamplingFrequency
+	duration := uint64(len(w.sizes)) * uint64(w.frameSamples())
+	channels := w.config.Channels
+	if channels == 0 {
+		channels = 2
+	}
+
+	// version 1 boxes have 64-bit times and durations, needed past 2^32 samples
+	version, times, durationField := uint8(0), u32(0), u32(uint32(duration))
+	if duration > 0xFFFFFFFF {
+		version, times, durationField = 1, u64(0), u64(duration)
+	}
+
+	mvhd := mp4FullBox("mvhd", version, 0,
+		times, times, u32(timescale), durationField,
+		u32(0x00010000), u16(0x0100), make([]byte, 10), mp4Matrix(), make([]byte, 24), u32(mp4TrackId+1))
+	tkhd := mp4FullBox("tkhd", version, 0x000007,
+		times, times, u32(mp4TrackId), u32(0), durationField,
+		make([]byte, 8), u16(0), u16(0), u16(0x0100), u16(0), mp4Matrix(), u32(0), u32(0))
+	mdhd := mp4FullBox("mdhd", version, 0,
+		times, times, u32(timescale), durationField, u16(0x55C4), u16(0)) // und
+	hdlr := mp4FullBox("hdlr", 0, 0, u32(0), []byte("soun"), make([]byte, 12), []byte("SoundHandler\x00"))
+	smhd := mp4FullBox("smhd", 0, 0, u16(0), u16(0))
+	dinf := mp4Box("dinf", mp4FullBox("dref", 0, 0, u32(1), mp4FullBox("url ", 0, 1)))
+
+	// the sample entry rate is 16.16 fixed point, higher rates only go into mdhd
+	sampleRate := timescale
+	if sampleRate > 0xFFFF {
+		sampleRate = 0
+	}
+	mp4a := mp4Box("mp4a",
+		make([]byte, 6), u16(1), // data_reference_index
+		make([]byte, 8), u16(uint16(channels)), u16(16), u32(0), u32(sampleRate<<16),
+		w.esds())
+	stsd := mp4FullBox("stsd", 0, 0, u32(1), mp4a)
+	stts := mp4FullBox("stts", 0, 0, u32(1), u32(uint32(len(w.sizes))), u32(w.frameSamples()))
+	if len(w.sizes) == 0 {
+		stts = mp4FullBox("stts", 0, 0, u32(0))
+	}
+	stsc := mp4FullBox("stsc", 0, 0, u32(1), u32(1), u32(uint32(len(w.sizes))), u32(1))
+	stsz := new(bytes.Buffer)
+	for _, size := range w.sizes {
+		stsz.Write(u32(size))
+	}
+	stszBox := mp4FullBox("stsz", 0, 0, u32(0), u32(uint32(len(w.sizes))), stsz.Bytes())
+	// one chunk with all the samples
+	chunkOffset := uint64(w.mdatOffset) + mp4MdatHeaderSize
+	var stco []byte
+	if chunkOffset+w.mdatSize > 0xFFFFFFFF {
+		stco = mp4FullBox("co64", 0, 0, u32(1), u64(chunkOffset))
+	} else {
+		stco = mp4FullBox("stco", 0, 0, u32(1), u32(uint32(chunkOffset)))
+	}
+	stbl := mp4Box("stbl", stsd, stts, stsc, stszBox, stco)
+
+	minf := mp4Box("minf", smhd, dinf, stbl)
+	mdia := mp4Box("mdia", mdhd, hdlr, minf)
+	trak := mp4Box("trak", tkhd, mdia)
+	return mp4Box("moov", mvhd, trak)
+}
+
+// esds carries the AudioSpecificConfig bytes of the sequence header as they are
+func (w *m4aWriter) esds() []byte {
+	var maxFrame, total uint64
+	for _, size := range w.sizes {
+		total += uint64(size)
+		if uint64(size) > maxFrame {
+			maxFrame = uint64(size)
+		}
+	}
+	framesPerSecond := uint64(w.config.SamplingFrequency) / uint64(w.frameSamples())
+	var avgBitrate uint64
+	if len(w.sizes) > 0 {
+		avgBitrate = total * 8 * uint64(w.config.SamplingFrequency) / (uint64(len(w.sizes)) * uint64(w.frameSamples()))
+	}
+	maxBitrate := maxFrame * 8 * (framesPerSecond + 1)
+
+	decSpecific := mp4Descriptor(mp4DescrTagDecSpecific, w.config.Raw)
+	decoderConfig := mp4Descriptor(mp4DescrTagDecoderConfig, bytesJoin(
+		[]byte{mp4ObjectTypeAac, mp4StreamTypeAudio<<2 | 1},
+		u32(uint32(maxFrame))[1:], // bufferSizeDB
+		u32(uint32(maxBitrate)), u32(uint32(avgBitrate)),
+		decSpecific))
+	slConfig := mp4Descriptor(mp4DescrTagSlConfig, []byte{0x02})
+	es := mp4Descriptor(mp4DescrTagEs, bytesJoin(u16(0), []byte{0}, decoderConfig, slConfig))
+	return mp4FullBox("esds", 0, 0, es)
+}
+
+func mp4Box(boxType string, payloads ...[]byte) []byte {
+	payload := bytesJoin(payloads...)
+	box := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(box[0:4], uint32(8+len(payload)))
+	copy(box[4:8], boxType)
+	return append(box, payload...)
+}
+
+func mp4FullBox(boxType string, version uint8, flags uint32, payloads ...[]byte) []byte {
+	versionFlags := u32(uint32(version)<<24 | flags&0xFFFFFF)
+	return mp4Box(boxType, append([][]byte{versionFlags}, payloads...)...)
+}
+
+// mp4Descriptor is an ISO 14496-1 descriptor with the size in 7-bit groups
+func mp4Descriptor(tag uint8, payload []byte) []byte {
+	size := len(payload)
+	var sizeBytes []byte
+	for {
+		sizeBytes = append([]byte{byte(size & 0x7F)}, sizeBytes...)
+		size >>= 7
+		if size == 0 {
+			break
+		}
+	}
+	for i := 0; i < len(sizeBytes)-1; i++ {
+		sizeBytes[i] |= 0x80
+	}
+	return bytesJoin([]byte{tag}, sizeBytes, payload)
+}
+
+func mp4Matrix() []byte {
+	return bytesJoin(u32(0x00010000), u32(0), u32(0), u32(0), u32(0x00010000), u32(0), u32(0), u32(0), u32(0x40000000))
+}
+
+func bytesJoin(s ...[]byte) []byte {
+	return bytes.Join(s, nil)
+}
+
+func u16(x uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, x)
+	return b
+}
+
+func u32(x uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, x)
+	return b
+}
+
+func u64(x uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, x)
+	return b
+}
@@ -0,0 +1,219 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// findMp4Box returns the payload of the box at path, stsd and mp4a skip their
+// fields before the child boxes
+func findMp4Box(t *testing.T, buf []byte, path ...string) []byte {
+	t.Helper()
+	for _, boxType := range path {
+		found := false
+		for len(buf) >= 8 {
+			size := int(binary.BigEndian.Uint32(buf[0:4]))
+			if size < 8 || size > len(buf) {
+				t.Fatalf("box %q size %v with %v bytes left", buf[4:8], size, len(buf))
+			}
+			if string(buf[4:8]) == boxType {
+				buf, found = buf[8:size], true
+				break
+			}
+			buf = buf[size:]
+		}
+		if !found {
+			t.Fatalf("box %q of %v not found", boxType, path)
+		}
+		switch boxType {
+		case "stsd":
+			buf = buf[8:] // version, flags and entry_count
+		case "mp4a":
+			buf = buf[28:] // the audio sample entry
+		}
+	}
+	return buf
+}
+
+// mp4HeaderDuration is the version, timescale and duration of mvhd or mdhd
+func mp4HeaderDuration(payload []byte) (uint8, uint32, uint64) {
+	if payload[0] == 1 {
+		return 1, binary.BigEndian.Uint32(payload[20:24]), binary.BigEndian.Uint64(payload[24:32])
+	}
+	return 0, binary.BigEndian.Uint32(payload[12:16]), uint64(binary.BigEndian.Uint32(payload[16:20]))
+}
+
+// tkhdDuration is the version and duration of tkhd
+func tkhdDuration(payload []byte) (uint8, uint64) {
+	if payload[0] == 1 {
+		return 1, binary.BigEndian.Uint64(payload[28:36])
+	}
+	return 0, uint64(binary.BigEndian.Uint32(payload[20:24]))
+}
+
+func TestM4aWriter(t *testing.T) {
+	dir := inTempDir(t)
+
+	tests := []struct {
+		name          string
+		asc           []byte
+		frames        [][]byte
+		wantTimescale uint32
+		wantDuration  uint64
+		wantEsds      []byte
+	}{
+		// 3 frames of 1024 samples, 30 bytes at most, 60 bytes in 3072/44100 s
+		{"LC 44.1 kHz stereo", []byte{0x12, 0x10}, [][]byte{make([]byte, 10), make([]byte, 20), make([]byte, 30)}, 44100, 3 * 1024, []byte{
+			0x00, 0x00, 0x00, 0x27, 'e', 's', 'd', 's', 0x00, 0x00, 0x00, 0x00,
+			0x03, 0x19, 0x00, 0x00, 0x00, // ES_Descriptor, ES_ID 0, no flags
+			0x04, 0x11, 0x40, 0x15, // DecoderConfigDescriptor, AAC, audio stream
+			0x00, 0x00, 0x1E, // bufferSizeDB 30
+			0x00, 0x00, 0x29, 0x40, // maxBitrate 30*8*(43+1)
+			0x00, 0x00, 0x1A, 0xEA, // avgBitrate 60*8*44100/3072
+			0x05, 0x02, 0x12, 0x10, // DecoderSpecificInfo, the AudioSpecificConfig
+			0x06, 0x01, 0x02, // SLConfigDescriptor
+		}},
+		// 960 sample frames, the config is kept as it is with its padding
+		{"LC 48 kHz 960", []byte{0x11, 0x94}, [][]byte{make([]byte, 100), make([]byte, 100)}, 48000, 2 * 960, []byte{
+			0x00, 0x00, 0x00, 0x27, 'e', 's', 'd', 's', 0x00, 0x00, 0x00, 0x00,
+			0x03, 0x19, 0x00, 0x00, 0x00,
+			0x04, 0x11, 0x40, 0x15,
+			0x00, 0x00, 0x64,
+			0x00, 0x00, 0x9F, 0x60, // 100*8*(50+1)
+			0x00, 0x00, 0x9C, 0x40, // 200*8*48000/1920
+			0x05, 0x02, 0x11, 0x94,
+			0x06, 0x01, 0x02,
+		}},
+		{"HE-AAC", []byte{0x2B, 0x92, 0x08, 0x00}, [][]byte{make([]byte, 8)}, 22050, 1024, []byte{
+			0x00, 0x00, 0x00, 0x29, 'e', 's', 'd', 's', 0x00, 0x00, 0x00, 0x00,
+			0x03, 0x1B, 0x00, 0x00, 0x00,
+			0x04, 0x13, 0x40, 0x15,
+			0x00, 0x00, 0x08,
+			0x00, 0x00, 0x05, 0x80, // 8*8*(21+1)
+			0x00, 0x00, 0x05, 0x62, // 8*8*22050/1024
+			0x05, 0x04, 0x2B, 0x92, 0x08, 0x00,
+			0x06, 0x01, 0x02,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseAudioSpecificConfig(tt.asc)
+			if err != nil {
+				t.Fatalf("ParseAudioSpecificConfig failed, err:%v", err)
+			}
+			name := filepath.Join(dir, "test.m4a")
+			w, err := newM4aWriter(name, c)
+			if err != nil {
+				t.Fatalf("newM4aWriter failed, err:%v", err)
+			}
+			var mdat []byte
+			for i, frame := range tt.frames {
+				frame[0] = byte(i + 1)
+				mdat = append(mdat, frame...)
+				if err = w.WriteFrame(frame); err != nil {
+					t.Fatalf("WriteFrame failed, err:%v", err)
+				}
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("Close failed, err:%v", err)
+			}
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+			}
+
+			ftyp := []byte{0x00, 0x00, 0x00, 0x1C, 'f', 't', 'y', 'p', 'M', '4', 'A', ' ', 0, 0, 0, 0, 'M', '4', 'A', ' ', 'm', 'p', '4', '2', 'i', 's', 'o', 'm'}
+			if !bytes.HasPrefix(data, ftyp) {
+				t.Fatalf("ftyp = %x, want %x", data[:len(ftyp)], ftyp)
+			}
+			// mdat with size 1 and the 64-bit largesize
+			header := append([]byte{0x00, 0x00, 0x00, 0x01, 'm', 'd', 'a', 't'}, u64(uint64(16+len(mdat)))...)
+			if got := data[28:44]; !bytes.Equal(got, header) {
+				t.Fatalf("mdat header = %x, want %x", got, header)
+			}
+			if got := data[44 : 44+len(mdat)]; !bytes.Equal(got, mdat) {
+				t.Fatalf("mdat differs")
+			}
+			moov := data[44+len(mdat):]
+
+			version, timescale, duration := mp4HeaderDuration(findMp4Box(t, moov, "moov", "mvhd"))
+			if version != 0 || timescale != tt.wantTimescale || duration != tt.wantDuration {
+				t.Fatalf("mvhd version %v timescale %v duration %v, want 0 %v %v", version, timescale, duration, tt.wantTimescale, tt.wantDuration)
+			}
+			if version, duration = tkhdDuration(findMp4Box(t, moov, "moov", "trak", "tkhd")); version != 0 || duration != tt.wantDuration {
+				t.Fatalf("tkhd version %v duration %v, want 0 %v", version, duration, tt.wantDuration)
+			}
+			version, timescale, duration = mp4HeaderDuration(findMp4Box(t, moov, "moov", "trak", "mdia", "mdhd"))
+			if version != 0 || timescale != tt.wantTimescale || duration != tt.wantDuration {
+				t.Fatalf("mdhd version %v timescale %v duration %v, want 0 %v %v", version, timescale, duration, tt.wantTimescale, tt.wantDuration)
+			}
+
+			stbl := []string{"moov", "trak", "mdia", "minf", "stbl"}
+			samples := tt.wantDuration / uint64(len(tt.frames))
+			stts := bytesJoin(u32(0), u32(1), u32(uint32(len(tt.frames))), u32(uint32(samples)))
+			if got := findMp4Box(t, moov, append(stbl, "stts")...); !bytes.Equal(got, stts) {
+				t.Fatalf("stts = %x, want %x", got, stts)
+			}
+			stsz := bytesJoin(u32(0), u32(0), u32(uint32(len(tt.frames))))
+			for _, frame := range tt.frames {
+				stsz = append(stsz, u32(uint32(len(frame)))...)
+			}
+			if got := findMp4Box(t, moov, append(stbl, "stsz")...); !bytes.Equal(got, stsz) {
+				t.Fatalf("stsz = %x, want %x", got, stsz)
+			}
+			if got := findMp4Box(t, moov, append(stbl, "stco")...); !bytes.Equal(got, bytesJoin(u32(0), u32(1), u32(44))) {
+				t.Fatalf("stco = %x, want the chunk at 44", got)
+			}
+			esds := findMp4Box(t, moov, append(stbl, "stsd", "mp4a")...)
+			if !bytes.Equal(esds, tt.wantEsds) {
+				t.Fatalf("esds = %x, want %x", esds, tt.wantEsds)
+			}
+		})
+	}
+}
+
+func TestM4aWriterVersion1(t *testing.T) {
+	// 4194305 frames of 1024 samples are 2^32 + 1024 samples
+	c, err := ParseAudioSpecificConfig([]byte{0x15, 0x88})
+	if err != nil {
+		t.Fatalf("ParseAudioSpecificConfig failed, err:%v", err)
+	}
+	w := &m4aWriter{config: c, mdatOffset: 28, sizes: make([]uint32, 1<<22+1)}
+	moov := w.moov()
+
+	want := uint64(1<<32 + 1024)
+	version, timescale, duration := mp4HeaderDuration(findMp4Box(t, moov, "moov", "mvhd"))
+	if version != 1 || timescale != 8000 || duration != want {
+		t.Fatalf("mvhd version %v timescale %v duration %v, want 1 8000 %v", version, timescale, duration, want)
+	}
+	if version, duration = tkhdDuration(findMp4Box(t, moov, "moov", "trak", "tkhd")); version != 1 || duration != want {
+		t.Fatalf("tkhd version %v duration %v, want 1 %v", version, duration, want)
+	}
+	version, timescale, duration = mp4HeaderDuration(findMp4Box(t, moov, "moov", "trak", "mdia", "mdhd"))
+	if version != 1 || timescale != 8000 || duration != want {
+		t.Fatalf("mdhd version %v timescale %v duration %v, want 1 8000 %v", version, timescale, duration, want)
+	}
+	// the sizes of the version 1 boxes
+	for _, tt := range []struct {
+		path []string
+		size int
+	}{
+		{[]string{"moov", "mvhd"}, 112},
+		{[]string{"moov", "trak", "tkhd"}, 96},
+		{[]string{"moov", "trak", "mdia", "mdhd"}, 36},
+	} {
+		if got := len(findMp4Box(t, moov, tt.path...)); got != tt.size {
+			t.Fatalf("%v payload len %v, want %v", tt.path, got, tt.size)
+		}
+	}
+
+	// one frame less still fits version 0
+	w.sizes = w.sizes[:1<<22-1]
+	version, _, duration = mp4HeaderDuration(findMp4Box(t, w.moov(), "moov", "mvhd"))
+	if version != 0 || duration != 1<<32-1024 {
+		t.Fatalf("mvhd version %v duration %v, want 0 %v", version, duration, uint64(1<<32-1024))
+	}
+}
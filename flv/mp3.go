@@ -0,0 +1,330 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	Mp3Version25 = 0
+	Mp3Version2  = 2
+	Mp3Version1  = 3
+
+	Mp3LayerIII = 1
+	Mp3LayerII  = 2
+	Mp3LayerI   = 3
+
+	Mp3ChannelModeMono = 3
+
+	mp3HeaderSize     = 4
+	mp3XingFlagFrames = 0x01
+	mp3XingFlagBytes  = 0x02
+	mp3XingFlagToc    = 0x04
+	mp3XingTocSize    = 100
+)
+
+var Mp3VersionMap = map[uint8]string{
+	Mp3Version25: "MPEG 2.5",
+	Mp3Version2:  "MPEG 2",
+	Mp3Version1:  "MPEG 1",
+}
+
+var Mp3LayerMap = map[uint8]string{
+	Mp3LayerIII: "Layer III",
+	Mp3LayerII:  "Layer II",
+	Mp3LayerI:   "Layer I",
+}
+
+// mp3Bitrates in kbit/s, indexed by MPEG 1 or not, the layer and the bitrate index
+var mp3Bitrates = [2][4][16]uint32{
+	{ // MPEG 2 and 2.5
+		Mp3LayerIII: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		Mp3LayerII:  {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		Mp3LayerI:   {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	},
+	{ // MPEG 1
+		Mp3LayerIII: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		Mp3LayerII:  {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		Mp3LayerI:   {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	},
+}
+
+var mp3SampleRates = map[uint8][3]uint32{
+	Mp3Version1:  {44100, 48000, 32000},
+	Mp3Version2:  {22050, 24000, 16000},
+	Mp3Version25: {11025, 12000, 8000},
+}
+
+type Mp3FrameHeader struct {
+	Version      uint8
+	Layer        uint8
+	Protection   bool // a CRC follows the header
+	BitrateIndex uint8
+	Bitrate      uint32 // kbit/s
+	SampleRate   uint32
+	Padding      uint8
+	ChannelMode  uint8
+	FrameSize    int
+	Samples      int
+}
+
+func parseMp3FrameHeader(b []byte) (*Mp3FrameHeader, error) {
+	if len(b) < mp3HeaderSize {
+		return nil, fmt.Errorf("mp3 frame header len %v < %v", len(b), mp3HeaderSize)
+	}
+	if b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return nil, fmt.Errorf("mp3 frame sync not found, header:%x", b[:mp3HeaderSize])
+	}
+
+	h := &Mp3FrameHeader{
+		Version:      (b[1] >> 3) & 0b11,
+		Layer:        (b[1] >> 1) & 0b11,
+		Protection:   b[1]&0x01 == 0,
+		BitrateIndex: b[2] >> 4,
+		Padding:      (b[2] >> 1) & 0x01,
+		ChannelMode:  b[3] >> 6,
+	}
+	if _, ok := Mp3VersionMap[h.Version]; !ok {
+		return nil, fmt.Errorf("mp3 version is reserved")
+	}
+	if _, ok := Mp3LayerMap[h.Layer]; !ok {
+		return nil, fmt.Errorf("mp3 layer is reserved")
+	}
+	if h.BitrateIndex == 0 || h.BitrateIndex == 0x0F {
+		return nil, fmt.Errorf("mp3 bitrate index %v is not supported", h.BitrateIndex)
+	}
+	sampleRateIndex := (b[2] >> 2) & 0b11
+	if sampleRateIndex == 0b11 {
+		return nil, fmt.Errorf("mp3 sample rate index is reserved")
+	}
+
+	mpeg1 := 0
+	if h.Version == Mp3Version1 {
+		mpeg1 = 1
+	}
+	h.Bitrate = mp3Bitrates[mpeg1][h.Layer][h.BitrateIndex]
+	h.SampleRate = mp3SampleRates[h.Version][sampleRateIndex]
+	h.FrameSize, h.Samples = mp3FrameSize(h.Version, h.Layer, h.Bitrate, h.SampleRate, h.Padding)
+
+	return h, nil
+}
+
+func mp3FrameSize(version uint8, layer uint8, bitrate uint32, sampleRate uint32, padding uint8) (int, int) {
+	switch {
+	case layer == Mp3LayerI:
+		return int(12*bitrate*1000/sampleRate+uint32(padding)) * 4, 384
+	case layer == Mp3LayerIII && version != Mp3Version1:
+		return int(72*bitrate*1000/sampleRate + uint32(padding)), 576
+	default:
+		return int(144*bitrate*1000/sampleRate + uint32(padding)), 1152
+	}
+}
+
+// mp3SideInfoSize is where a Xing or Info tag starts after the frame header
+func mp3SideInfoSize(h *Mp3FrameHeader) int {
+	mono := h.ChannelMode == Mp3ChannelModeMono
+	switch {
+	case h.Version == Mp3Version1 && mono:
+		return 17
+	case h.Version == Mp3Version1:
+		return 32
+	case mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// mp3VbrTag returns the Xing, Info or VBRI tag of a frame, if any
+func mp3VbrTag(h *Mp3FrameHeader, frame []byte) string {
+	if h.Layer != Mp3LayerIII {
+		return ""
+	}
+	offset := mp3HeaderSize + mp3SideInfoSize(h)
+	if len(frame) >= offset+4 {
+		if tag := string(frame[offset : offset+4]); tag == "Xing" || tag == "Info" {
+			return tag
+		}
+	}
+	if len(frame) >= mp3HeaderSize+32+4 && string(frame[mp3HeaderSize+32:mp3HeaderSize+32+4]) == "VBRI" {
+		return "VBRI"
+	}
+	return ""
+}
+
+func (f *Flv) parseMp3AudioData(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+
+	// frames may span tags, the tail of the last tag is kept
+	data := append(f.mp3Pending, buf[index:end]...)
+	f.mp3Pending = nil
+
+	frames := 0
+	for len(data) >= mp3HeaderSize {
+		h, err := parseMp3FrameHeader(data)
+		if err != nil {
+			// a 0xFF at the end may start a frame continued in the next tag
+			skip := 1
+			for skip < len(data)-1 && !(data[skip] == 0xFF && data[skip+1]&0xE0 == 0xE0) {
+				skip++
+			}
+			if skip == len(data)-1 && data[skip] != 0xFF {
+				skip++
+			}
+			f.printf("%v, %v bytes skipped\n", err, skip)
+			data = data[skip:]
+			continue
+		}
+		if len(data) < h.FrameSize {
+			break
+		}
+		frame := data[:h.FrameSize]
+		data = data[h.FrameSize:]
+
+		if tag := mp3VbrTag(h, frame); tag != "" {
+			f.printf("mp3 %v tag frame\n", tag)
+			if f.Mp3XingHeader {
+				// replaced by the header written on close
+				continue
+			}
+		} else {
+			frames++
+			if f.mp3Bitrate == 0 {
+				f.printf("mp3 %v %v, %v Hz, %v kbit/s, frame size is %v\n",
+					Mp3VersionMap[h.Version], Mp3LayerMap[h.Layer], h.SampleRate, h.Bitrate, h.FrameSize)
+			} else if f.mp3Bitrate != h.Bitrate && !f.Mp3IsVbr {
+				f.Mp3IsVbr = true
+				f.printf("mp3 bitrate changed from %v to %v kbit/s, the stream is VBR\n", f.mp3Bitrate, h.Bitrate)
+			}
+			f.mp3Bitrate = h.Bitrate
+		}
+
+		if f.DisableExtract {
+			continue
+		}
+		if f.mp3File == nil {
+			f.mp3File, err = newMp3Writer(f.trackFileName("./test.mp3"), h, f.Mp3XingHeader)
+			if err != nil {
+				return 0, fmt.Errorf("newMp3Writer failed, err:%v", err)
+			}
+		}
+		if err = f.mp3File.WriteFrame(frame); err != nil {
+			return 0, fmt.Errorf("mp3File.WriteFrame failed, err:%v", err)
+		}
+	}
+	if len(data) > 0 {
+		f.mp3Pending = append([]byte(nil), data...)
+	}
+	f.printf("mp3 frames in tag is %v\n", frames)
+
+	return end, nil
+}
+
+// mp3Writer copies the frames, with Xing it reserves the first frame for a
+// Xing or Info tag written on Close
+type mp3Writer struct {
+	file    *os.File
+	xing    []byte
+	first   *Mp3FrameHeader
+	vbr     bool
+	bytes   uint64
+	offsets []uint64 // of every frame after the Xing frame
+}
+
+func newMp3Writer(name string, first *Mp3FrameHeader, xing bool) (*mp3Writer, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(%q) failed, err:%v", name, err)
+	}
+
+	w := &mp3Writer{file: file, first: first}
+	if xing && first.Layer == Mp3LayerIII {
+		w.xing = mp3XingFrame(first)
+		if _, err = file.Write(w.xing); err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("file.Write failed, err:%v", err)
+		}
+		w.bytes = uint64(len(w.xing))
+	}
+	return w, nil
+}
+
+// mp3XingFrame builds an empty frame like the first one, with the smallest
+// bitrate that leaves room for the Xing tag
+func mp3XingFrame(first *Mp3FrameHeader) []byte {
+	h := *first
+	h.Padding = 0
+	need := mp3HeaderSize + mp3SideInfoSize(&h) + 4 + 4 + 4 + 4 + mp3XingTocSize
+	mpeg1 := 0
+	if h.Version == Mp3Version1 {
+		mpeg1 = 1
+	}
+	for h.BitrateIndex = 1; h.BitrateIndex < 0x0E; h.BitrateIndex++ {
+		h.Bitrate = mp3Bitrates[mpeg1][h.Layer][h.BitrateIndex]
+		if h.FrameSize, _ = mp3FrameSize(h.Version, h.Layer, h.Bitrate, h.SampleRate, 0); h.FrameSize >= need {
+			break
+		}
+	}
+
+	frame := make([]byte, h.FrameSize)
+	frame[0] = 0xFF
+	frame[1] = 0xE0 | h.Version<<3 | h.Layer<<1 | 0x01 // no CRC
+	frame[2] = h.BitrateIndex<<4 | mp3SampleRateIndex(&h)<<2
+	frame[3] = h.ChannelMode << 6
+	return frame
+}
+
+func mp3SampleRateIndex(h *Mp3FrameHeader) uint8 {
+	for i, sampleRate := range mp3SampleRates[h.Version] {
+		if sampleRate == h.SampleRate {
+			return uint8(i)
+		}
+	}
+	return 0
+}
+
+func (w *mp3Writer) WriteFrame(frame []byte) error {
+	if w.xing != nil {
+		w.offsets = append(w.offsets, w.bytes)
+		if h, err := parseMp3FrameHeader(frame); err == nil && h.Bitrate != w.first.Bitrate {
+			w.vbr = true
+		}
+	}
+	if _, err := w.file.Write(frame); err != nil {
+		return fmt.Errorf("w.file.Write failed, err:%v", err)
+	}
+	w.bytes += uint64(len(frame))
+	return nil
+}
+
+// Close fills in the Xing tag for VBR streams or the Info tag for CBR ones,
+// with the frame count, the byte count and the seek table
+func (w *mp3Writer) Close() error {
+	if w.xing == nil {
+		return w.file.Close()
+	}
+
+	tag := w.xing[mp3HeaderSize+mp3SideInfoSize(w.first):]
+	copy(tag[0:4], "Info")
+	if w.vbr {
+		copy(tag[0:4], "Xing")
+	}
+	binary.BigEndian.PutUint32(tag[4:8], mp3XingFlagFrames|mp3XingFlagBytes|mp3XingFlagToc)
+	binary.BigEndian.PutUint32(tag[8:12], uint32(len(w.offsets)))
+	binary.BigEndian.PutUint32(tag[12:16], uint32(w.bytes))
+	toc := tag[16 : 16+mp3XingTocSize]
+	for i := range toc {
+		if len(w.offsets) == 0 {
+			break
+		}
+		offset := w.offsets[i*len(w.offsets)/mp3XingTocSize]
+		toc[i] = byte(offset * 256 / w.bytes)
+	}
+
+	if _, err := w.file.WriteAt(w.xing, 0); err != nil {
+		_ = w.file.Close()
+		return fmt.Errorf("w.file.WriteAt failed, err:%v", err)
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,227 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// mp3Frame is an MPEG 1 Layer III 44.1 kHz joint stereo frame of silence
+func mp3Frame(bitrateIndex byte) []byte {
+	h, _ := parseMp3FrameHeader([]byte{0xFF, 0xFB, bitrateIndex << 4, 0x64})
+	frame := make([]byte, h.FrameSize)
+	copy(frame, []byte{0xFF, 0xFB, bitrateIndex << 4, 0x64})
+	return frame
+}
+
+func TestParseMp3AudioDataSplitFrames(t *testing.T) {
+	// 128 and 160 kbit/s, the second frame makes the stream VBR once parsed
+	first, second := mp3Frame(9), mp3Frame(10)
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name        string
+		tags        [][]byte
+		wantPending [][]byte // after each tag
+	}{
+		{"split after the 0xFF", [][]byte{
+			cat(first, second[:1]),
+			second[1:],
+		}, [][]byte{{0xFF}, nil}},
+		{"split after the 0xFF behind garbage", [][]byte{
+			cat([]byte{0x12, 0x34}, first, []byte{0x00, 0x56, 0x78}, second[:1]),
+			second[1:],
+		}, [][]byte{{0xFF}, nil}},
+		{"split in the header", [][]byte{
+			cat(first, second[:3]),
+			second[3:],
+		}, [][]byte{second[:3], nil}},
+		{"split in the frame", [][]byte{
+			cat(first, second[:100]),
+			second[100:],
+		}, [][]byte{second[:100], nil}},
+		{"0xFF alone in a tag", [][]byte{
+			first,
+			{0xFF},
+			second[1:],
+		}, [][]byte{nil, {0xFF}, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Flv{Quiet: true, DisableExtract: true}
+			for i, data := range tt.tags {
+				// the audio tag header byte before the frames
+				buf := append([]byte{0x2F}, data...)
+				f.CurrentTag = &CurrentTag{Length: len(buf)}
+				if _, err := f.parseMp3AudioData(buf, 1); err != nil {
+					t.Fatalf("parseMp3AudioData of tag %v failed, err:%v", i, err)
+				}
+				if !bytes.Equal(f.mp3Pending, tt.wantPending[i]) {
+					t.Fatalf("mp3Pending after tag %v = %x, want %x", i, f.mp3Pending, tt.wantPending[i])
+				}
+			}
+			if !f.Mp3IsVbr || f.mp3Bitrate != 160 {
+				t.Fatalf("Mp3IsVbr %v bitrate %v, want the 160 kbit/s frame parsed", f.Mp3IsVbr, f.mp3Bitrate)
+			}
+		})
+	}
+}
+
+func TestParseMp3AudioDataGarbage(t *testing.T) {
+	f := &Flv{Quiet: true, DisableExtract: true}
+	// sync bits with a reserved layer, then a trailing byte that can not start
+	// a frame
+	buf := []byte{0x2F, 0x00, 0xFF, 0xE0, 0x00, 0x00, 0x12, 0x34}
+	f.CurrentTag = &CurrentTag{Length: len(buf)}
+	if _, err := f.parseMp3AudioData(buf, 1); err != nil {
+		t.Fatalf("parseMp3AudioData failed, err:%v", err)
+	}
+	if len(f.mp3Pending) != 0 || f.mp3Bitrate != 0 {
+		t.Fatalf("mp3Pending %x bitrate %v, want nothing kept", f.mp3Pending, f.mp3Bitrate)
+	}
+}
+
+// mp3Toc is the Xing seek table of frames starting at offsets, each entry
+// repeated for its share of the 100 entries
+func mp3Toc(entries ...[2]int) []byte {
+	var toc []byte
+	for _, entry := range entries {
+		toc = append(toc, bytes.Repeat([]byte{byte(entry[0])}, entry[1])...)
+	}
+	return toc
+}
+
+func TestMp3WriterXingHeader(t *testing.T) {
+	dir := inTempDir(t)
+	mpeg2Mono := func() []byte {
+		// MPEG 2 Layer III 22.05 kHz mono at 32 kbit/s, 104 bytes
+		h, _ := parseMp3FrameHeader([]byte{0xFF, 0xF3, 0x40, 0xC4})
+		frame := make([]byte, h.FrameSize)
+		copy(frame, []byte{0xFF, 0xF3, 0x40, 0xC4})
+		return frame
+	}
+
+	tests := []struct {
+		name       string
+		frames     [][]byte
+		wantHeader []byte // of the Xing frame
+		wantSize   int    // of the Xing frame
+		tagOffset  int
+		wantTag    string
+		wantBytes  uint32
+		wantToc    []byte
+	}{
+		// 48 kbit/s is the smallest MPEG 1 frame that holds the tag after the
+		// 32 byte side info, the frames are 417 bytes
+		{"CBR", [][]byte{mp3Frame(9), mp3Frame(9), mp3Frame(9), mp3Frame(9)},
+			[]byte{0xFF, 0xFB, 0x30, 0x40}, 156, 36, "Info", 156 + 4*417,
+			mp3Toc([2]int{156 * 256 / 1824, 25}, [2]int{573 * 256 / 1824, 25}, [2]int{990 * 256 / 1824, 25}, [2]int{1407 * 256 / 1824, 25})},
+		// a 522 byte 160 kbit/s frame in between
+		{"VBR", [][]byte{mp3Frame(9), mp3Frame(10), mp3Frame(9)},
+			[]byte{0xFF, 0xFB, 0x30, 0x40}, 156, 36, "Xing", 156 + 417 + 522 + 417,
+			mp3Toc([2]int{156 * 256 / 1512, 34}, [2]int{573 * 256 / 1512, 33}, [2]int{1095 * 256 / 1512, 33})},
+		// 40 kbit/s after the 9 byte side info of MPEG 2 mono
+		{"MPEG 2 mono", [][]byte{mpeg2Mono(), mpeg2Mono()},
+			[]byte{0xFF, 0xF3, 0x50, 0xC0}, 130, 13, "Info", 130 + 2*104,
+			mp3Toc([2]int{130 * 256 / 338, 50}, [2]int{234 * 256 / 338, 50})},
+		{"no frames", nil,
+			[]byte{0xFF, 0xFB, 0x30, 0x40}, 156, 36, "Info", 156, make([]byte, mp3XingTocSize)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := mp3Frame(9)
+			if len(tt.frames) > 0 {
+				first = tt.frames[0]
+			}
+			h, err := parseMp3FrameHeader(first)
+			if err != nil {
+				t.Fatalf("parseMp3FrameHeader failed, err:%v", err)
+			}
+			name := filepath.Join(dir, "test.mp3")
+			w, err := newMp3Writer(name, h, true)
+			if err != nil {
+				t.Fatalf("newMp3Writer failed, err:%v", err)
+			}
+			for _, frame := range tt.frames {
+				if err = w.WriteFrame(frame); err != nil {
+					t.Fatalf("WriteFrame failed, err:%v", err)
+				}
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("Close failed, err:%v", err)
+			}
+
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+			}
+			if len(data) != int(tt.wantBytes) {
+				t.Fatalf("file size = %v, want %v", len(data), tt.wantBytes)
+			}
+			if !bytes.HasPrefix(data, tt.wantHeader) {
+				t.Fatalf("Xing frame header = %x, want %x", data[:4], tt.wantHeader)
+			}
+			xing, err := parseMp3FrameHeader(data)
+			if err != nil || xing.FrameSize != tt.wantSize {
+				t.Fatalf("Xing frame = %+v err:%v, want %v bytes", xing, err, tt.wantSize)
+			}
+			if tag := mp3VbrTag(xing, data[:xing.FrameSize]); tag != tt.wantTag {
+				t.Fatalf("mp3VbrTag = %q, want %q", tag, tt.wantTag)
+			}
+			if got := data[xing.FrameSize:]; !bytes.Equal(got, bytes.Join(tt.frames, nil)) {
+				t.Fatalf("frames after the Xing frame differ")
+			}
+
+			tag := data[tt.tagOffset:xing.FrameSize]
+			if flags := binary.BigEndian.Uint32(tag[4:8]); flags != 0x07 {
+				t.Fatalf("flags = %#x, want frames, bytes and TOC", flags)
+			}
+			if frames := binary.BigEndian.Uint32(tag[8:12]); frames != uint32(len(tt.frames)) {
+				t.Fatalf("frames = %v, want %v", frames, len(tt.frames))
+			}
+			if size := binary.BigEndian.Uint32(tag[12:16]); size != tt.wantBytes {
+				t.Fatalf("bytes = %v, want %v", size, tt.wantBytes)
+			}
+			if toc := tag[16 : 16+mp3XingTocSize]; !bytes.Equal(toc, tt.wantToc) {
+				t.Fatalf("toc = %x, want %x", toc, tt.wantToc)
+			}
+		})
+	}
+}
+
+func TestParseMp3AudioDataXingHeader(t *testing.T) {
+	dir := inTempDir(t)
+
+	// the Info frame of the source stream is replaced, only the audio frames
+	// are counted
+	h, _ := parseMp3FrameHeader(mp3Frame(9))
+	info := mp3XingFrame(h)
+	copy(info[mp3HeaderSize+mp3SideInfoSize(h):], "Info")
+	frames := [][]byte{info, mp3Frame(9), mp3Frame(10)}
+
+	f := &Flv{Quiet: true, Mp3XingHeader: true}
+	for _, frame := range frames {
+		buf := append([]byte{0x2F}, frame...)
+		f.CurrentTag = &CurrentTag{Length: len(buf)}
+		if _, err := f.parseMp3AudioData(buf, 1); err != nil {
+			t.Fatalf("parseMp3AudioData failed, err:%v", err)
+		}
+	}
+	if err := f.mp3File.Close(); err != nil {
+		t.Fatalf("Close failed, err:%v", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "test.mp3"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+	}
+	if len(data) != len(info)+417+522 {
+		t.Fatalf("file size = %v, want %v", len(data), len(info)+417+522)
+	}
+	tag := data[mp3HeaderSize+mp3SideInfoSize(h):]
+	if string(tag[0:4]) != "Xing" || binary.BigEndian.Uint32(tag[8:12]) != 2 {
+		t.Fatalf("tag %q frames %v, want Xing with 2 frames", tag[0:4], binary.BigEndian.Uint32(tag[8:12]))
+	}
+}
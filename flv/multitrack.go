@@ -0,0 +1,189 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+	"strings"
+)
+
+// TrackPayload is one track of a multitrack tag, Data is only valid during OnTag
+type TrackPayload struct {
+	TrackId uint8
+	FourCC  string
+	Data    []byte
+}
+
+// parseMultitrackHeader reads the AvMultitrackType and the packet type shared
+// by all tracks, the FourCC is read by the caller unless every track has its own
+func (f *Flv) parseMultitrackHeader(buf []byte, index int, packetTypeMap map[uint8]string) (int, error) {
+	if len(buf[index:]) < 1 {
+		return 0, fmt.Errorf("len(buf[index:]) < 1")
+	}
+
+	multitrackType := (buf[index] & AvMultitrackTypeMark) >> 4
+	multitrackTypeString, ok := AvMultitrackTypeMap[multitrackType]
+	if !ok {
+		return 0, fmt.Errorf("AvMultitrackTypeMap[multitrackType] is not ok, multitrackType:%v", multitrackType)
+	}
+	packetType := buf[index] & 0b00001111
+	packetTypeString, ok := packetTypeMap[packetType]
+	if !ok || packetType == VideoPacketTypeMultitrack || packetType == AudioPacketTypeMultitrack {
+		return 0, fmt.Errorf("illegal multitrack packetType:%v", packetType)
+	}
+	f.CurrentTag.IsMultitrack = true
+	f.CurrentTag.MultitrackType = multitrackType
+	f.CurrentTag.MultitrackPacketType = packetType
+	f.printf("AvMultitrackType is %v\n", multitrackTypeString)
+	f.printf("multitrack PacketType is %v\n", packetTypeString)
+
+	return index + 1, nil
+}
+
+func (f *Flv) parseMultitrackBody(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	tagType := f.CurrentTag.TagType
+
+	fourCC := f.CurrentTag.VideoFourCC
+	fourCCMap := VideoFourCCMap
+	trackIds := f.VideoTrackIds
+	if tagType == TagTypeAudio {
+		fourCC = f.CurrentTag.AudioFourCC
+		fourCCMap = AudioFourCCMap
+		trackIds = f.AudioTrackIds
+	}
+
+	for index < end {
+		if f.CurrentTag.MultitrackType == AvMultitrackTypeManyTracksManyCodecs {
+			if end-index < 4 {
+				return 0, fmt.Errorf("track FourCC len %v < 4", end-index)
+			}
+			fourCC = string(buf[index : index+4])
+			if _, ok := fourCCMap[fourCC]; !ok {
+				return 0, fmt.Errorf("fourCCMap[fourCC] is not ok, fourCC:%q", fourCC)
+			}
+			index += 4
+		}
+
+		if end-index < 1 {
+			return 0, fmt.Errorf("trackId len %v < 1", end-index)
+		}
+		trackId := buf[index]
+		index += 1
+
+		size := end - index
+		if f.CurrentTag.MultitrackType != AvMultitrackTypeOneTrack {
+			if end-index < 3 {
+				return 0, fmt.Errorf("sizeOfTrack len %v < 3", end-index)
+			}
+			trackSize, err := util.BytesToUint32ByBigEndian(buf[index : index+3])
+			if err != nil {
+				return 0, fmt.Errorf("util.BytesToUint32ByBigEndian failed, err:%v", err)
+			}
+			index += 3
+			if end-index < int(trackSize) {
+				return 0, fmt.Errorf("track %v size %v > remaining %v", trackId, trackSize, end-index)
+			}
+			size = int(trackSize)
+		}
+
+		f.CurrentTag.Tracks = append(f.CurrentTag.Tracks, &TrackPayload{
+			TrackId: trackId,
+			FourCC:  fourCC,
+			Data:    buf[index : index+size],
+		})
+		f.printf("track %v is %v, size is %v\n", trackId, fourCCMap[fourCC], size)
+
+		if trackSelected(trackIds, trackId) {
+			if err := f.parseTrackPayload(buf, index, index+size, trackId, fourCC); err != nil {
+				return 0, fmt.Errorf("track %v: f.parseTrackPayload failed, err:%v", trackId, err)
+			}
+		}
+		index += size
+
+		if f.CurrentTag.MultitrackType == AvMultitrackTypeOneTrack {
+			break
+		}
+	}
+
+	return end, nil
+}
+
+// parseTrackPayload parses one track with the state of that track. The body
+// parsers stop at CurrentTag.Length, so the track sees a copy of the tag that
+// ends with its payload.
+func (f *Flv) parseTrackPayload(buf []byte, index int, end int, trackId uint8, fourCC string) error {
+	tag := *f.CurrentTag
+	tag.Length = end
+	tag.IsMultitrack = false
+	tag.Tracks = nil
+
+	t := f.track(tag.TagType, trackId)
+	saved := t.CurrentTag
+	t.CurrentTag = &tag
+	defer func() { t.CurrentTag = saved }()
+
+	var err error
+	if tag.TagType == TagTypeAudio {
+		tag.AudioFourCC = fourCC
+		_, err = t.parseExAudioTagBody(buf, index)
+		return err
+	}
+
+	tag.VideoFourCC = fourCC
+	index, err = t.parseExVideoCompositionTime(buf, index)
+	if err != nil {
+		return err
+	}
+	_, err = t.parseExVideoTagBody(buf, index)
+	return err
+}
+
+// track returns the parser state of a track. Track 0 is the main stream, the
+// others get their own codec configuration and extracted files, with the
+// options of the main stream.
+func (f *Flv) track(tagType uint8, trackId uint8) *Flv {
+	if trackId == 0 {
+		return f
+	}
+
+	key := uint16(tagType)<<8 | uint16(trackId)
+	if f.tracks == nil {
+		f.tracks = make(map[uint16]*Flv)
+	}
+	t, ok := f.tracks[key]
+	if !ok {
+		t = &Flv{
+			Quiet:             f.Quiet,
+			DisableExtract:    f.DisableExtract,
+			RenderScreenVideo: f.RenderScreenVideo,
+			PcmBigEndian:      f.PcmBigEndian,
+			Mp3XingHeader:     f.Mp3XingHeader,
+			AacM4a:            f.AacM4a,
+			AacLoas:           f.AacLoas,
+			Timeline:          TimestampNormalizer{BackwardJumpTolerance: f.Timeline.BackwardJumpTolerance},
+			trackId:           trackId,
+		}
+		f.tracks[key] = t
+	}
+	return t
+}
+
+func trackSelected(trackIds []uint8, trackId uint8) bool {
+	if trackIds == nil {
+		return true
+	}
+	for _, id := range trackIds {
+		if id == trackId {
+			return true
+		}
+	}
+	return false
+}
+
+// trackFileName names the files of track N ./test.trackN.*
+func (f *Flv) trackFileName(name string) string {
+	if f.trackId == 0 {
+		return name
+	}
+	return strings.Replace(name, "./test.", fmt.Sprintf("./test.track%v.", f.trackId), 1)
+}
@@ -0,0 +1,150 @@
+package flv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// inTempDir runs the test in an empty directory, the extracted ./test.* files
+// end up there
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "flv")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed, err:%v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd failed, err:%v", err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatalf("os.Chdir failed, err:%v", err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+		_ = os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func TestTrackOptions(t *testing.T) {
+	f := &Flv{
+		Quiet:             true,
+		DisableExtract:    true,
+		RenderScreenVideo: true,
+		PcmBigEndian:      true,
+		Mp3XingHeader:     true,
+		AacM4a:            true,
+		AacLoas:           true,
+		Timeline:          TimestampNormalizer{BackwardJumpTolerance: 1234},
+	}
+	if got := f.track(TagTypeAudio, 0); got != f {
+		t.Fatalf("track 0 is not the main stream")
+	}
+
+	track := f.track(TagTypeAudio, 2)
+	want := &Flv{
+		Quiet:             true,
+		DisableExtract:    true,
+		RenderScreenVideo: true,
+		PcmBigEndian:      true,
+		Mp3XingHeader:     true,
+		AacM4a:            true,
+		AacLoas:           true,
+		Timeline:          TimestampNormalizer{BackwardJumpTolerance: 1234},
+		trackId:           2,
+	}
+	if !reflect.DeepEqual(track, want) {
+		t.Fatalf("track = %+v, want %+v", track, want)
+	}
+	if f.track(TagTypeAudio, 2) != track {
+		t.Fatalf("track 2 is created twice")
+	}
+	if f.track(TagTypeVideo, 2) == track {
+		t.Fatalf("video track 2 is audio track 2")
+	}
+}
+
+// multitrackAac is a ManyTracks mp4a tag, ManyTracks carries a size per track
+func multitrackAac(packetType uint8, tracks map[uint8][]byte) []byte {
+	body := []byte{SoundFormatExHeader<<4 | AudioPacketTypeMultitrack, AvMultitrackTypeManyTracks<<4 | packetType}
+	body = append(body, AudioFourCCAac...)
+	var ids []int
+	for id := range tracks {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		data := tracks[uint8(id)]
+		body = append(body, uint8(id), 0x00, 0x00, byte(len(data)))
+		body = append(body, data...)
+	}
+	return body
+}
+
+func TestMultitrackExtraction(t *testing.T) {
+	tags := []synthTag{
+		// LC 44.1 kHz stereo on track 1, LC 48 kHz mono on track 2
+		{TagTypeAudio, 0, multitrackAac(AudioPacketTypeSequenceStart, map[uint8][]byte{1: {0x12, 0x10}, 2: {0x11, 0x88}})},
+		{TagTypeAudio, 23, multitrackAac(AudioPacketTypeCodedFrames, map[uint8][]byte{1: {0x21, 0x10}, 2: {0x21, 0x20, 0x30}})},
+		{TagTypeAudio, 46, multitrackAac(AudioPacketTypeCodedFrames, map[uint8][]byte{1: {0x21, 0x11}, 2: {0x21, 0x21, 0x31}})},
+	}
+
+	tests := []struct {
+		name          string
+		audioTrackIds []uint8
+		want          map[string][]byte // file name and the start of its content
+	}{
+		{"all tracks", nil, map[string][]byte{
+			"test.track1.aac": {0xFF, 0xF1, 0x50, 0x80},
+			"test.track1.m4a": {0x00, 0x00, 0x00, 0x1C, 'f', 't', 'y', 'p'},
+			"test.track2.aac": {0xFF, 0xF1, 0x4C, 0x40},
+			"test.track2.m4a": {0x00, 0x00, 0x00, 0x1C, 'f', 't', 'y', 'p'},
+		}},
+		{"track 2 selected", []uint8{2}, map[string][]byte{
+			"test.track2.aac": {0xFF, 0xF1, 0x4C, 0x40},
+			"test.track2.m4a": {0x00, 0x00, 0x00, 0x1C, 'f', 't', 'y', 'p'},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := inTempDir(t)
+
+			// the options of the main stream apply to every track
+			f := &Flv{Quiet: true, AacM4a: true, AudioTrackIds: tt.audioTrackIds}
+			if _, err := f.Parse(synthFlv(tags)); err != nil {
+				t.Fatalf("f.Parse failed, err:%v", err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatalf("f.Close failed, err:%v", err)
+			}
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("ioutil.ReadDir failed, err:%v", err)
+			}
+			got := make(map[string]bool)
+			for _, file := range files {
+				if file.Size() > 0 {
+					got[file.Name()] = true
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("extracted %v, want %v", got, tt.want)
+			}
+			for name, prefix := range tt.want {
+				data, err := ioutil.ReadFile(name)
+				if err != nil {
+					t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+				}
+				if !bytes.HasPrefix(data, prefix) {
+					t.Fatalf("%v starts with %x, want %x", name, data[:len(prefix)], prefix)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package flv
+
+import (
+	"fmt"
+)
+
+const (
+	nellymoserBlockSize    = 64
+	nellymoserBlockSamples = 256
+)
+
+// nellymoserSampleRate returns the rate implied by the sound format, the
+// generic format takes it from SoundRate
+func nellymoserSampleRate(soundFormat uint8, soundRate uint8) uint32 {
+	switch soundFormat {
+	case SoundFormatNellymoser16kHzMono:
+		return 16000
+	case SoundFormatNellymoser8kHzMono:
+		return 8000
+	default:
+		return SoundRateHz[soundRate]
+	}
+}
+
+// parseNellymoserAudioData copies the 64-byte blocks into a raw file whose name
+// carries the sample rate, e.g. ./test.8000hz.nelly, as there is no common
+// container for Nellymoser besides FLV
+func (f *Flv) parseNellymoserAudioData(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	data := buf[index:end]
+
+	sampleRate := nellymoserSampleRate(f.CurrentTag.SoundFormat, f.CurrentTag.SoundRate)
+	if len(data)%nellymoserBlockSize != 0 {
+		f.printf("nellymoser data size %v is not a multiple of %v\n", len(data), nellymoserBlockSize)
+	}
+	blocks := len(data) / nellymoserBlockSize
+	f.printf("nellymoser blocks is %v, %v Hz, duration is %v ms\n",
+		blocks, sampleRate, blocks*nellymoserBlockSamples*1000/int(sampleRate))
+
+	if f.DisableExtract {
+		return end, nil
+	}
+	if f.nellymoserFile == nil {
+		f.nellymoserSampleRate = sampleRate
+		if err := f.openExtractFile(&f.nellymoserFile, fmt.Sprintf("./test.%vhz.nelly", sampleRate)); err != nil {
+			return 0, fmt.Errorf("f.openExtractFile failed, err:%v", err)
+		}
+	}
+	if f.nellymoserSampleRate != sampleRate {
+		f.printf("nellymoser sample rate changed, blocks are not extracted\n")
+		return end, nil
+	}
+	_, _ = f.nellymoserFile.Write(data[:blocks*nellymoserBlockSize])
+
+	return end, nil
+}
@@ -0,0 +1,90 @@
+package flv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNellymoserSampleRate(t *testing.T) {
+	tests := []struct {
+		soundFormat uint8
+		soundRate   uint8
+		want        uint32
+	}{
+		{SoundFormatNellymoser16kHzMono, SoundRate5_5kHz, 16000},
+		{SoundFormatNellymoser8kHzMono, SoundRate44kHz, 8000},
+		{SoundFormatNellymoser, SoundRate5_5kHz, 5512},
+		{SoundFormatNellymoser, SoundRate11kHz, 11025},
+		{SoundFormatNellymoser, SoundRate22kHz, 22050},
+		{SoundFormatNellymoser, SoundRate44kHz, 44100},
+	}
+	for _, tt := range tests {
+		if got := nellymoserSampleRate(tt.soundFormat, tt.soundRate); got != tt.want {
+			t.Fatalf("nellymoserSampleRate(%v, %v) = %v, want %v", tt.soundFormat, tt.soundRate, got, tt.want)
+		}
+	}
+}
+
+func TestParseNellymoserAudioData(t *testing.T) {
+	block := func(b byte) []byte { return bytes.Repeat([]byte{b}, nellymoserBlockSize) }
+	type tag struct {
+		soundFormat, soundRate uint8
+		data                   []byte
+	}
+	tests := []struct {
+		name     string
+		tags     []tag
+		wantFile string
+		want     []byte
+	}{
+		{"8 kHz", []tag{
+			{SoundFormatNellymoser8kHzMono, SoundRate5_5kHz, append(block(1), block(2)...)},
+			{SoundFormatNellymoser8kHzMono, SoundRate5_5kHz, block(3)},
+		}, "test.8000hz.nelly", bytes.Join([][]byte{block(1), block(2), block(3)}, nil)},
+		{"generic at 22 kHz", []tag{
+			{SoundFormatNellymoser, SoundRate22kHz, block(1)},
+		}, "test.22050hz.nelly", block(1)},
+		// the partial block is dropped
+		{"partial block", []tag{
+			{SoundFormatNellymoser16kHzMono, SoundRate5_5kHz, append(block(1), 0xAA, 0xBB)},
+		}, "test.16000hz.nelly", block(1)},
+		{"rate change is not extracted", []tag{
+			{SoundFormatNellymoser16kHzMono, SoundRate5_5kHz, block(1)},
+			{SoundFormatNellymoser8kHzMono, SoundRate5_5kHz, block(2)},
+			{SoundFormatNellymoser, SoundRate44kHz, block(3)},
+			{SoundFormatNellymoser16kHzMono, SoundRate44kHz, block(4)},
+		}, "test.16000hz.nelly", append(block(1), block(4)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := inTempDir(t)
+			f := &Flv{Quiet: true}
+			for _, tag := range tt.tags {
+				buf := append([]byte{tag.soundFormat << 4}, tag.data...)
+				f.CurrentTag = &CurrentTag{Length: len(buf), SoundFormat: tag.soundFormat, SoundRate: tag.soundRate}
+				if _, err := f.parseNellymoserAudioData(buf, 1); err != nil {
+					t.Fatalf("parseNellymoserAudioData failed, err:%v", err)
+				}
+			}
+			if err := f.Close(); err != nil {
+				t.Fatalf("f.Close failed, err:%v", err)
+			}
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("ioutil.ReadDir failed, err:%v", err)
+			}
+			if len(files) != 1 || files[0].Name() != tt.wantFile {
+				t.Fatalf("files = %v, want only %v", len(files), tt.wantFile)
+			}
+			data, err := ioutil.ReadFile(tt.wantFile)
+			if err != nil {
+				t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+			}
+			if !bytes.Equal(data, tt.want) {
+				t.Fatalf("%v = %x, want %x", tt.wantFile, data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	oggHeaderTypeContinued = 0x01
+	oggHeaderTypeBos       = 0x02
+	oggHeaderTypeEos       = 0x04
+
+	oggMaxSegments = 255
+)
+
+var oggCrcTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := 0; i < 256; i++ {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func oggCrc(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCrcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// oggWriter writes one logical bitstream, one packet per page. The last page
+// is held back so that Close can mark it as end of stream.
+type oggWriter struct {
+	file     *os.File
+	serial   uint32
+	sequence uint32
+	pages    int
+	pending  []byte
+}
+
+func newOggWriter(name string, serial uint32) (*oggWriter, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(%q) failed, err:%v", name, err)
+	}
+	return &oggWriter{file: file, serial: serial}, nil
+}
+
+// WritePacket writes packet with the granule position of its last sample. A
+// packet with more than 255 segments spans several pages.
+func (w *oggWriter) WritePacket(packet []byte, granule int64) error {
+	first := true
+	for {
+		segments := len(packet)/255 + 1
+		size := len(packet)
+		complete := true
+		if segments > oggMaxSegments {
+			segments = oggMaxSegments
+			size = oggMaxSegments * 255
+			complete = false
+		}
+
+		var headerType byte
+		if w.pages == 0 {
+			headerType |= oggHeaderTypeBos
+		}
+		if !first {
+			headerType |= oggHeaderTypeContinued
+		}
+		pageGranule := granule
+		if !complete {
+			pageGranule = -1
+		}
+
+		if err := w.flush(false); err != nil {
+			return err
+		}
+		w.pending = w.page(headerType, pageGranule, packet[:size], segments)
+		w.pages++
+
+		packet = packet[size:]
+		first = false
+		if complete {
+			return nil
+		}
+	}
+}
+
+func (w *oggWriter) page(headerType byte, granule int64, data []byte, segments int) []byte {
+	page := make([]byte, 27+segments, 27+segments+len(data))
+	copy(page[0:4], "OggS")
+	page[4] = 0
+	page[5] = headerType
+	binary.LittleEndian.PutUint64(page[6:14], uint64(granule))
+	binary.LittleEndian.PutUint32(page[14:18], w.serial)
+	binary.LittleEndian.PutUint32(page[18:22], w.sequence)
+	page[26] = byte(segments)
+
+	remain := len(data)
+	for i := 0; i < segments; i++ {
+		if remain >= 255 {
+			page[27+i] = 255
+			remain -= 255
+		} else {
+			page[27+i] = byte(remain)
+			remain = 0
+		}
+	}
+	page = append(page, data...)
+	w.sequence++
+	return page
+}
+
+func (w *oggWriter) flush(eos bool) error {
+	if w.pending == nil {
+		return nil
+	}
+	if eos {
+		w.pending[5] |= oggHeaderTypeEos
+	}
+	binary.LittleEndian.PutUint32(w.pending[22:26], 0)
+	binary.LittleEndian.PutUint32(w.pending[22:26], oggCrc(w.pending))
+	_, err := w.file.Write(w.pending)
+	w.pending = nil
+	if err != nil {
+		return fmt.Errorf("w.file.Write failed, err:%v", err)
+	}
+	return nil
+}
+
+func (w *oggWriter) Close() error {
+	if err := w.flush(true); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,125 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type oggPage struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	sequence   uint32
+	lacing     []byte
+	data       []byte
+}
+
+// readOggPages splits an Ogg file into its pages and checks their CRC
+func readOggPages(t *testing.T, buf []byte) []oggPage {
+	t.Helper()
+	var pages []oggPage
+	for len(buf) > 0 {
+		if len(buf) < 27 || string(buf[0:4]) != "OggS" || buf[4] != 0 {
+			t.Fatalf("no page header at %x", buf)
+		}
+		segments := int(buf[26])
+		size := 27 + segments
+		for _, lacing := range buf[27 : 27+segments] {
+			size += int(lacing)
+		}
+		page := append([]byte(nil), buf[:size]...)
+		crc := binary.LittleEndian.Uint32(page[22:26])
+		binary.LittleEndian.PutUint32(page[22:26], 0)
+		if got := oggCrc(page); got != crc {
+			t.Fatalf("page %v crc 0x%08x, want 0x%08x", len(pages), crc, got)
+		}
+		pages = append(pages, oggPage{
+			headerType: page[5],
+			granule:    int64(binary.LittleEndian.Uint64(page[6:14])),
+			serial:     binary.LittleEndian.Uint32(page[14:18]),
+			sequence:   binary.LittleEndian.Uint32(page[18:22]),
+			lacing:     page[27 : 27+segments],
+			data:       page[27+segments:],
+		})
+		buf = buf[size:]
+	}
+	return pages
+}
+
+func TestOggCrcCheckValue(t *testing.T) {
+	// CRC-32 with polynomial 0x04C11DB7, no reflection, initial value 0 and no
+	// final xor, the check value of "123456789"
+	if crc := oggCrc([]byte("123456789")); crc != 0x89A1897F {
+		t.Fatalf("oggCrc = 0x%08x, want 0x89a1897f", crc)
+	}
+}
+
+func TestOggWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ogg")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed, err:%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	large := bytes.Repeat([]byte{0xAB}, 255*255+10)
+	exact := bytes.Repeat([]byte{0xCD}, 255)
+	name := filepath.Join(dir, "test.ogg")
+	w, err := newOggWriter(name, 0x12345678)
+	if err != nil {
+		t.Fatalf("newOggWriter failed, err:%v", err)
+	}
+	for _, packet := range []struct {
+		data    []byte
+		granule int64
+	}{
+		{[]byte("head"), 0},
+		{large, 960},
+		{exact, 1920},
+	} {
+		if err = w.WritePacket(packet.data, packet.granule); err != nil {
+			t.Fatalf("WritePacket failed, err:%v", err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed, err:%v", err)
+	}
+
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+	}
+	pages := readOggPages(t, buf)
+	want := []struct {
+		headerType byte
+		granule    int64
+		lacing     []byte
+		data       []byte
+	}{
+		{oggHeaderTypeBos, 0, []byte{4}, []byte("head")},
+		// 255 full segments do not end the packet, the page has no granule
+		{0, -1, bytes.Repeat([]byte{255}, 255), large[:255*255]},
+		{oggHeaderTypeContinued, 960, []byte{10}, large[255*255:]},
+		// a packet of a multiple of 255 bytes ends with a 0 lacing value
+		{oggHeaderTypeEos, 1920, []byte{255, 0}, exact},
+	}
+	if len(pages) != len(want) {
+		t.Fatalf("%v pages, want %v", len(pages), len(want))
+	}
+	for i, page := range pages {
+		if page.serial != 0x12345678 || page.sequence != uint32(i) {
+			t.Fatalf("page %v serial 0x%x sequence %v, want 0x12345678 %v", i, page.serial, page.sequence, i)
+		}
+		if page.headerType != want[i].headerType || page.granule != want[i].granule {
+			t.Fatalf("page %v header type %v granule %v, want %v %v",
+				i, page.headerType, page.granule, want[i].headerType, want[i].granule)
+		}
+		if !bytes.Equal(page.lacing, want[i].lacing) || !bytes.Equal(page.data, want[i].data) {
+			t.Fatalf("page %v lacing %v and %v bytes, want %v and %v bytes",
+				i, page.lacing, len(page.data), want[i].lacing, len(want[i].data))
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	opusSampleRate = 48000
+	opusOggSerial  = 0x4F707573
+)
+
+type OpusHead struct {
+	Version              uint8
+	ChannelCount         uint8
+	PreSkip              uint16
+	InputSampleRate      uint32
+	OutputGain           int16
+	ChannelMappingFamily uint8
+	Raw                  []byte
+}
+
+// defaultOpusHead is used when the stream has no SequenceStart, which is
+// optional for Opus
+var defaultOpusHead = []byte{'O', 'p', 'u', 's', 'H', 'e', 'a', 'd', 1, 2, 0x38, 0x01, 0x80, 0xBB, 0x00, 0x00, 0x00, 0x00, 0}
+
+func (f *Flv) parseOpusAudioData(buf []byte, index int) (int, error) {
+
+	var err error
+
+	switch f.CurrentTag.AudioPacketType {
+	case AudioPacketTypeSequenceStart:
+		index, err = f.parseOpusHead(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseOpusHead failed, err:%v", err)
+		}
+	case AudioPacketTypeCodedFrames:
+		index, err = f.parseOpusPacket(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseOpusPacket failed, err:%v", err)
+		}
+	default:
+		index = f.CurrentTag.Length
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseOpusHead(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	if end-index < 19 {
+		return 0, fmt.Errorf("OpusHead len %v < 19", end-index)
+	}
+	if string(buf[index:index+8]) != "OpusHead" {
+		return 0, fmt.Errorf("magic signature is not OpusHead, magic signature:%q", buf[index:index+8])
+	}
+
+	head := &OpusHead{
+		Version:              buf[index+8],
+		ChannelCount:         buf[index+9],
+		PreSkip:              binary.LittleEndian.Uint16(buf[index+10:]),
+		InputSampleRate:      binary.LittleEndian.Uint32(buf[index+12:]),
+		OutputGain:           int16(binary.LittleEndian.Uint16(buf[index+16:])),
+		ChannelMappingFamily: buf[index+18],
+		Raw:                  append([]byte(nil), buf[index:end]...),
+	}
+	f.printf("opus version is %v\n", head.Version)
+	f.printf("opus channelCount is %v\n", head.ChannelCount)
+	f.printf("opus preSkip is %v\n", head.PreSkip)
+	f.printf("opus inputSampleRate is %v\n", head.InputSampleRate)
+	f.printf("opus outputGain is %v\n", head.OutputGain)
+	f.printf("opus channelMappingFamily is %v\n", head.ChannelMappingFamily)
+
+	f.OpusHead = head
+	return end, nil
+}
+
+func (f *Flv) parseOpusPacket(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	packet := buf[index:end]
+
+	samples, err := opusPacketSamples(packet)
+	if err != nil {
+		return 0, fmt.Errorf("opusPacketSamples failed, err:%v", err)
+	}
+	f.printf("opus packet size is %v, samples is %v\n", len(packet), samples)
+
+	if f.DisableExtract {
+		return end, nil
+	}
+
+	if f.opusFile == nil {
+		f.opusFile, err = newOggWriter(f.trackFileName("./test.opus"), opusOggSerial)
+		if err != nil {
+			return 0, fmt.Errorf("newOggWriter failed, err:%v", err)
+		}
+		f.opusGranule = 0
+
+		head := defaultOpusHead
+		if f.OpusHead != nil {
+			head = f.OpusHead.Raw
+		}
+		if err = f.opusFile.WritePacket(head, 0); err != nil {
+			return 0, fmt.Errorf("opusFile.WritePacket failed, err:%v", err)
+		}
+		if err = f.opusFile.WritePacket(oggVorbisComment("OpusTags"), 0); err != nil {
+			return 0, fmt.Errorf("opusFile.WritePacket failed, err:%v", err)
+		}
+	}
+
+	f.opusGranule += int64(samples)
+	if err = f.opusFile.WritePacket(packet, f.opusGranule); err != nil {
+		return 0, fmt.Errorf("opusFile.WritePacket failed, err:%v", err)
+	}
+
+	return end, nil
+}
+
+// opusPacketSamples returns the duration of an Opus packet in 48 kHz samples
+func opusPacketSamples(packet []byte) (int, error) {
+	if len(packet) < 1 {
+		return 0, fmt.Errorf("empty opus packet")
+	}
+
+	toc := packet[0]
+	config := toc >> 3
+	var frameSamples int
+	switch {
+	case config < 12: // SILK 10, 20, 40, 60 ms
+		frameSamples = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // Hybrid 10, 20 ms
+		frameSamples = []int{480, 960}[config%2]
+	default: // CELT 2.5, 5, 10, 20 ms
+		frameSamples = []int{120, 240, 480, 960}[config%4]
+	}
+
+	frames := 1
+	switch toc & 0b11 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, fmt.Errorf("opus code 3 packet without frame count")
+		}
+		frames = int(packet[1] & 0b00111111)
+	}
+
+	return frameSamples * frames, nil
+}
+
+// oggVorbisComment builds a comment header with the vendor string only
+func oggVorbisComment(magic string) []byte {
+	vendor := "flvParse"
+	comment := make([]byte, 0, len(magic)+8+len(vendor))
+	comment = append(comment, magic...)
+	comment = append(comment, byte(len(vendor)), 0, 0, 0)
+	comment = append(comment, vendor...)
+	comment = append(comment, 0, 0, 0, 0)
+	return comment
+}
@@ -0,0 +1,127 @@
+package flv
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpusPacketSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  []byte
+		want    int
+		wantErr bool
+	}{
+		{"SILK 10 ms", []byte{0 << 3}, 480, false},
+		{"SILK 20 ms", []byte{1 << 3}, 960, false},
+		{"SILK 40 ms", []byte{2 << 3}, 1920, false},
+		{"SILK 60 ms", []byte{11 << 3}, 2880, false},
+		{"Hybrid 10 ms", []byte{12 << 3}, 480, false},
+		{"Hybrid 20 ms", []byte{15 << 3}, 960, false},
+		{"CELT 2.5 ms", []byte{16 << 3}, 120, false},
+		{"CELT 5 ms", []byte{17 << 3}, 240, false},
+		{"CELT 20 ms stereo", []byte{31<<3 | 0b100}, 960, false},
+		{"two equal frames", []byte{1<<3 | 1}, 1920, false},
+		{"two frames of different size", []byte{31<<3 | 2, 0x10}, 1920, false},
+		{"code 3 with 6 frames", []byte{16<<3 | 3, 6}, 720, false},
+		{"code 3 with VBR and padding flags", []byte{19<<3 | 3, 0b11000011}, 2880, false},
+		{"empty", nil, 0, true},
+		{"code 3 without frame count", []byte{1<<3 | 3}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := opusPacketSamples(tt.packet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("opusPacketSamples err:%v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("opusPacketSamples = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOpusHead(t *testing.T) {
+	// RFC 7845 OpusHead, version 1, stereo, pre-skip 312, 44.1 kHz input,
+	// output gain -256, mapping family 0
+	head := []byte{'O', 'p', 'u', 's', 'H', 'e', 'a', 'd', 1, 2, 0x38, 0x01, 0x44, 0xAC, 0x00, 0x00, 0x00, 0xFF, 0}
+	f := tagFlv(head)
+	if _, err := f.parseOpusHead(head, 0); err != nil {
+		t.Fatalf("parseOpusHead failed, err:%v", err)
+	}
+	want := &OpusHead{
+		Version:         1,
+		ChannelCount:    2,
+		PreSkip:         312,
+		InputSampleRate: 44100,
+		OutputGain:      -256,
+		Raw:             head,
+	}
+	if !reflect.DeepEqual(f.OpusHead, want) {
+		t.Fatalf("OpusHead = %+v, want %+v", f.OpusHead, want)
+	}
+
+	errTests := []struct {
+		name    string
+		buf     []byte
+		wantErr string
+	}{
+		{"short", head[:18], "OpusHead len 18 < 19"},
+		{"magic", append([]byte("OpusTags"), head[8:]...), "magic signature is not OpusHead"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tagFlv(tt.buf).parseOpusHead(tt.buf, 0); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseOpusHead err:%v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseOpusPacket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opus")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed, err:%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the packets go to an Ogg file headed by the default OpusHead and OpusTags
+	f := &Flv{Quiet: true}
+	f.opusFile, err = newOggWriter(dir+"/test.opus", opusOggSerial)
+	if err != nil {
+		t.Fatalf("newOggWriter failed, err:%v", err)
+	}
+	if err = f.opusFile.WritePacket(defaultOpusHead, 0); err != nil {
+		t.Fatalf("WritePacket failed, err:%v", err)
+	}
+	for _, packet := range [][]byte{{1 << 3, 0xAA}, {1<<3 | 1, 0xBB, 0xCC}} {
+		f.CurrentTag = &CurrentTag{Length: len(packet)}
+		if _, err = f.parseOpusPacket(packet, 0); err != nil {
+			t.Fatalf("parseOpusPacket failed, err:%v", err)
+		}
+	}
+	if err = f.opusFile.Close(); err != nil {
+		t.Fatalf("Close failed, err:%v", err)
+	}
+
+	buf, err := ioutil.ReadFile(dir + "/test.opus")
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+	}
+	var granules []int64
+	for _, page := range readOggPages(t, buf) {
+		granules = append(granules, page.granule)
+	}
+	// 20 ms, then two 20 ms frames
+	if want := []int64{0, 960, 2880}; !reflect.DeepEqual(granules, want) {
+		t.Fatalf("granules = %v, want %v", granules, want)
+	}
+
+	f.CurrentTag = &CurrentTag{Length: 0}
+	if _, err = f.parseOpusPacket(nil, 0); err == nil {
+		t.Fatalf("parseOpusPacket of an empty packet succeeded")
+	}
+}
@@ -0,0 +1,209 @@
+package flv
+
+import (
+	"encoding/binary"
+	"flvParse/util"
+	"fmt"
+)
+
+const (
+	g711SampleRate = 8000
+	adpcmMaxCodes  = 4095 // codes per channel after the initial sample of a block
+)
+
+var SoundRateHz = map[uint8]uint32{
+	SoundRate5_5kHz: 5512,
+	SoundRate11kHz:  11025,
+	SoundRate22kHz:  22050,
+	SoundRate44kHz:  44100,
+}
+
+var adpcmStepTable = [89]int{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17,
+	19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+	50, 55, 60, 66, 73, 80, 88, 97, 107, 118,
+	130, 143, 157, 173, 190, 209, 230, 253, 279, 307,
+	337, 371, 408, 449, 494, 544, 598, 658, 724, 796,
+	876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+	2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358,
+	5894, 6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899,
+	15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+}
+
+// adpcmIndexTables are indexed by the code size in bits minus 2
+var adpcmIndexTables = [4][]int{
+	{-1, 2},
+	{-1, -1, 2, 4},
+	{-1, -1, -1, -1, 2, 4, 6, 8},
+	{-1, -1, -1, -1, -1, -1, -1, -1, 1, 2, 4, 6, 8, 10, 13, 16},
+}
+
+// parsePcmAudioData decodes PCM, Flash ADPCM and G.711 into ./test.wav. The
+// WAV format is taken from the first tag.
+func (f *Flv) parsePcmAudioData(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	data := buf[index:end]
+
+	sampleRate := SoundRateHz[f.CurrentTag.SoundRate]
+	channels := uint16(f.CurrentTag.SoundType) + 1
+	bitsPerSample := uint16(8)
+	if f.CurrentTag.SoundSize == SoundSize16BitSamples {
+		bitsPerSample = 16
+	}
+
+	var samples []byte
+	var err error
+	switch f.CurrentTag.SoundFormat {
+	case SoundFormatLinearPcmPlatformEndian, SoundFormatLinearPcmLittleEndian:
+		samples = data
+		if bitsPerSample == 16 && f.CurrentTag.SoundFormat == SoundFormatLinearPcmPlatformEndian && f.PcmBigEndian {
+			samples = swapPcm16(data)
+		}
+	case SoundFormatAdpcm:
+		bitsPerSample = 16
+		samples, err = decodeAdpcm(data, int(channels))
+		if err != nil {
+			return 0, fmt.Errorf("decodeAdpcm failed, err:%v", err)
+		}
+	case SoundFormatG711ALawLogarithmicPcm, SoundFormatG711MuLawLogarithmicPcm:
+		// G.711 is always 8 kHz mono
+		sampleRate, channels, bitsPerSample = g711SampleRate, 1, 16
+		expand := alawToLinear
+		if f.CurrentTag.SoundFormat == SoundFormatG711MuLawLogarithmicPcm {
+			expand = ulawToLinear
+		}
+		samples = make([]byte, 2*len(data))
+		for i, b := range data {
+			binary.LittleEndian.PutUint16(samples[2*i:], uint16(expand(b)))
+		}
+	}
+	f.printf("pcm samples size is %v, %v Hz, %v channels, %v bits\n", len(samples), sampleRate, channels, bitsPerSample)
+
+	if f.DisableExtract {
+		return end, nil
+	}
+	if f.wavFile == nil {
+		f.wavFile, err = newWavWriter(f.trackFileName("./test.wav"), sampleRate, channels, bitsPerSample)
+		if err != nil {
+			return 0, fmt.Errorf("newWavWriter failed, err:%v", err)
+		}
+	}
+	if f.wavFile.SampleRate != sampleRate || f.wavFile.Channels != channels || f.wavFile.BitsPerSample != bitsPerSample {
+		f.printf("pcm format changed, samples are not extracted\n")
+		return end, nil
+	}
+	if err = f.wavFile.Write(samples); err != nil {
+		return 0, fmt.Errorf("wavFile.Write failed, err:%v", err)
+	}
+
+	return end, nil
+}
+
+func swapPcm16(data []byte) []byte {
+	samples := make([]byte, len(data)&^1)
+	for i := 0; i+1 < len(data); i += 2 {
+		samples[i], samples[i+1] = data[i+1], data[i]
+	}
+	return samples
+}
+
+func alawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0F) << 4
+	segment := (a & 0x70) >> 4
+	switch segment {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t = (t + 0x108) << (segment - 1)
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+func ulawToLinear(u byte) int16 {
+	const bias = 0x84
+	u = ^u
+	t := (int(u&0x0F) << 3) + bias
+	t <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return int16(bias - t)
+	}
+	return int16(t - bias)
+}
+
+// decodeAdpcm decodes the Flash ADPCM of one tag into 16-bit little endian
+// samples. Every block starts with the initial sample and step index of each
+// channel, followed by up to 4095 interleaved codes per channel.
+func decodeAdpcm(data []byte, channels int) ([]byte, error) {
+	r := util.NewBitReader(data)
+
+	codeSize, err := r.ReadBits(2)
+	if err != nil {
+		return nil, err
+	}
+	bits := int(codeSize) + 2
+	indexTable := adpcmIndexTables[codeSize]
+	signMask := 1 << uint(bits-1)
+
+	predictor := make([]int, channels)
+	stepIndex := make([]int, channels)
+	samples := make([]byte, 0, len(data)*8/bits*2)
+	put := func(sample int) {
+		samples = append(samples, byte(sample), byte(sample>>8))
+	}
+
+	for r.BitsLeft() >= 22*channels {
+		for i := 0; i < channels; i++ {
+			initialSample, _ := r.ReadBits(16)
+			initialIndex, _ := r.ReadBits(6)
+			predictor[i] = int(int16(initialSample))
+			stepIndex[i] = int(initialIndex)
+			put(predictor[i])
+		}
+
+		for count := 0; count < adpcmMaxCodes && r.BitsLeft() >= bits*channels; count++ {
+			for i := 0; i < channels; i++ {
+				code, _ := r.ReadBits(bits)
+				delta := int(code)
+				step := adpcmStepTable[stepIndex[i]]
+
+				// diff = (delta + 0.5) * step / 4 for 4-bit codes
+				diff := 0
+				for k := signMask >> 1; k > 0; k >>= 1 {
+					if delta&k != 0 {
+						diff += step
+					}
+					step >>= 1
+				}
+				diff += step
+
+				if delta&signMask != 0 {
+					predictor[i] -= diff
+				} else {
+					predictor[i] += diff
+				}
+				if predictor[i] > 32767 {
+					predictor[i] = 32767
+				} else if predictor[i] < -32768 {
+					predictor[i] = -32768
+				}
+
+				stepIndex[i] += indexTable[delta&^signMask]
+				if stepIndex[i] < 0 {
+					stepIndex[i] = 0
+				} else if stepIndex[i] > len(adpcmStepTable)-1 {
+					stepIndex[i] = len(adpcmStepTable) - 1
+				}
+
+				put(predictor[i])
+			}
+		}
+	}
+
+	return samples, nil
+}
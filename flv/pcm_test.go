@@ -0,0 +1,225 @@
+package flv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pcm16 packs 16-bit little endian samples
+func pcm16(samples ...int16) []byte {
+	var buf []byte
+	for _, sample := range samples {
+		buf = append(buf, byte(sample), byte(uint16(sample)>>8))
+	}
+	return buf
+}
+
+func TestG711ToLinear(t *testing.T) {
+	// the values of the ITU-T G.711 reference decoder
+	tests := []struct {
+		code byte
+		alaw int16
+		ulaw int16
+	}{
+		{0xD5, 8, 716},
+		{0x55, -8, -716},
+		{0xD4, 24, 748},
+		{0xAA, 32256, 5372},
+		{0x2A, -32256, -5372},
+		{0x80, 5504, 32124},
+		{0x00, -5504, -32124},
+		{0xFF, 848, 0},
+		{0x7F, -848, 0},
+		{0xFE, 880, 8},
+		{0x7E, -880, -8},
+	}
+	for _, tt := range tests {
+		if got := alawToLinear(tt.code); got != tt.alaw {
+			t.Fatalf("alawToLinear(%#x) = %v, want %v", tt.code, got, tt.alaw)
+		}
+		if got := ulawToLinear(tt.code); got != tt.ulaw {
+			t.Fatalf("ulawToLinear(%#x) = %v, want %v", tt.code, got, tt.ulaw)
+		}
+	}
+}
+
+func TestDecodeAdpcm(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		data     []byte
+		want     []byte
+		wantErr  string
+	}{
+		// step 7: 01 adds 7+3, 11 subtracts 9+4 at step index 2, 00 adds
+		// half of the step
+		{"2 bit mono", 1, bitFields(0, 2, 1000, 16, 0, 6, 1, 2, 3, 2, 0, 2, 0, 2),
+			pcm16(1000, 1010, 997, 1002, 1007), ""},
+		// 0111 adds 7+3+1, 1111 subtracts 16+8+4+2 at step index 8
+		{"4 bit mono", 1, bitFields(2, 2, 0, 16, 0, 6, 0x7, 4, 0xF, 4),
+			pcm16(0, 11, -19), ""},
+		{"4 bit stereo", 2, bitFields(2, 2, 100, 16, 0, 6, 0xFF9C, 16, 0, 6, 0x7, 4, 0xF, 4),
+			pcm16(100, -100, 111, -111), ""},
+		// 01111 raises the step index by 16 up to 88, the predictor stays
+		// within 16 bits
+		{"clamped", 1, bitFields(3, 2, 0, 16, 63, 6, 0x0F, 5, 0x0F, 5, 0x1F, 5, 0x1F, 5, 0, 5, 0, 5),
+			pcm16(0, 5859, 32767, -30716, -32768, -30721, -28859), ""},
+		// 0xFFFF is -1, 01000 adds 7, the 3 padding bits are no code
+		{"5 bit with padding", 1, bitFields(3, 2, 0xFFFF, 16, 0, 6, 0x08, 5),
+			pcm16(-1, 6), ""},
+		{"empty", 1, nil, nil, "bits left"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeAdpcm(tt.data, tt.channels)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeAdpcm err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeAdpcm failed, err:%v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("decodeAdpcm = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwapPcm16(t *testing.T) {
+	if got, want := swapPcm16([]byte{0x12, 0x34, 0x56, 0x78, 0x9A}), []byte{0x34, 0x12, 0x78, 0x56}; !bytes.Equal(got, want) {
+		t.Fatalf("swapPcm16 = %x, want %x", got, want)
+	}
+}
+
+func TestParsePcmAudioData(t *testing.T) {
+	inTempDir(t)
+
+	type tag struct {
+		soundFormat, soundRate, soundSize, soundType uint8
+		data                                         []byte
+	}
+	tests := []struct {
+		name         string
+		pcmBigEndian bool
+		tags         []tag
+		wantHeader   wavWriter
+		wantSamples  []byte
+	}{
+		{"platform endian", false, []tag{
+			{SoundFormatLinearPcmPlatformEndian, SoundRate44kHz, SoundSize16BitSamples, soundTypeStereoSound, []byte{0x12, 0x34, 0x56, 0x78}},
+		}, wavWriter{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, []byte{0x12, 0x34, 0x56, 0x78}},
+		{"big endian", true, []tag{
+			{SoundFormatLinearPcmPlatformEndian, SoundRate44kHz, SoundSize16BitSamples, soundTypeStereoSound, []byte{0x12, 0x34, 0x56, 0x78}},
+		}, wavWriter{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, []byte{0x34, 0x12, 0x78, 0x56}},
+		{"little endian is not swapped", true, []tag{
+			{SoundFormatLinearPcmLittleEndian, SoundRate22kHz, SoundSize16BitSamples, soundTypeMonoSound, []byte{0x12, 0x34}},
+		}, wavWriter{SampleRate: 22050, Channels: 1, BitsPerSample: 16}, []byte{0x12, 0x34}},
+		{"8 bit is not swapped", true, []tag{
+			{SoundFormatLinearPcmPlatformEndian, SoundRate5_5kHz, SoundSize8BitSamples, soundTypeMonoSound, []byte{0x80, 0x81}},
+		}, wavWriter{SampleRate: 5512, Channels: 1, BitsPerSample: 8}, []byte{0x80, 0x81}},
+		// the tag rate, size and channels are ignored
+		{"A-law", false, []tag{
+			{SoundFormatG711ALawLogarithmicPcm, SoundRate44kHz, SoundSize8BitSamples, soundTypeStereoSound, []byte{0xD5, 0x2A}},
+		}, wavWriter{SampleRate: 8000, Channels: 1, BitsPerSample: 16}, pcm16(8, -32256)},
+		{"mu-law", false, []tag{
+			{SoundFormatG711MuLawLogarithmicPcm, SoundRate11kHz, SoundSize8BitSamples, soundTypeMonoSound, []byte{0x80, 0xFE}},
+		}, wavWriter{SampleRate: 8000, Channels: 1, BitsPerSample: 16}, pcm16(32124, 8)},
+		// ADPCM is always decoded to 16 bit
+		{"ADPCM", false, []tag{
+			{SoundFormatAdpcm, SoundRate11kHz, SoundSize8BitSamples, soundTypeMonoSound, bitFields(2, 2, 0, 16, 0, 6, 0x7, 4, 0xF, 4)},
+		}, wavWriter{SampleRate: 11025, Channels: 1, BitsPerSample: 16}, pcm16(0, 11, -19)},
+		{"format change is not extracted", false, []tag{
+			{SoundFormatLinearPcmLittleEndian, SoundRate44kHz, SoundSize16BitSamples, soundTypeMonoSound, []byte{0x01, 0x02}},
+			{SoundFormatLinearPcmLittleEndian, SoundRate22kHz, SoundSize16BitSamples, soundTypeMonoSound, []byte{0x03, 0x04}},
+			{SoundFormatLinearPcmLittleEndian, SoundRate44kHz, SoundSize16BitSamples, soundTypeStereoSound, []byte{0x05, 0x06, 0x07, 0x08}},
+			{SoundFormatLinearPcmLittleEndian, SoundRate44kHz, SoundSize16BitSamples, soundTypeMonoSound, []byte{0x09, 0x0A}},
+		}, wavWriter{SampleRate: 44100, Channels: 1, BitsPerSample: 16}, []byte{0x01, 0x02, 0x09, 0x0A}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Flv{Quiet: true, PcmBigEndian: tt.pcmBigEndian}
+			for _, tag := range tt.tags {
+				f.CurrentTag = &CurrentTag{Length: len(tag.data), SoundFormat: tag.soundFormat,
+					SoundRate: tag.soundRate, SoundSize: tag.soundSize, SoundType: tag.soundType}
+				if _, err := f.parsePcmAudioData(tag.data, 0); err != nil {
+					t.Fatalf("parsePcmAudioData failed, err:%v", err)
+				}
+			}
+			w := f.wavFile
+			if got := (wavWriter{SampleRate: w.SampleRate, Channels: w.Channels, BitsPerSample: w.BitsPerSample}); !reflect.DeepEqual(got, tt.wantHeader) {
+				t.Fatalf("wav format = %+v, want %+v", got, tt.wantHeader)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed, err:%v", err)
+			}
+			data, err := ioutil.ReadFile("test.wav")
+			if err != nil {
+				t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+			}
+			if got := data[wavHeaderSize:]; !bytes.Equal(got, tt.wantSamples) {
+				t.Fatalf("wav samples = %x, want %x", got, tt.wantSamples)
+			}
+		})
+	}
+
+	f := tagFlv(nil)
+	f.CurrentTag.SoundFormat = SoundFormatAdpcm
+	if _, err := f.parsePcmAudioData(nil, 0); err == nil || !strings.Contains(err.Error(), "decodeAdpcm failed") {
+		t.Fatalf("parsePcmAudioData err:%v, want decodeAdpcm failed", err)
+	}
+}
+
+func TestWavWriter(t *testing.T) {
+	name := filepath.Join(inTempDir(t), "test.wav")
+	w, err := newWavWriter(name, 8000, 1, 16)
+	if err != nil {
+		t.Fatalf("newWavWriter failed, err:%v", err)
+	}
+	if err = w.Write(pcm16(1, -1)); err != nil {
+		t.Fatalf("Write failed, err:%v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed, err:%v", err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+	}
+	want := []byte{
+		'R', 'I', 'F', 'F', 0x28, 0x00, 0x00, 0x00, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 0x10, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x01, 0x00, // PCM, mono
+		0x40, 0x1F, 0x00, 0x00, // 8000 Hz
+		0x80, 0x3E, 0x00, 0x00, // 16000 bytes per second
+		0x02, 0x00, 0x10, 0x00, // block align 2, 16 bits
+		'd', 'a', 't', 'a', 0x04, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0xFF, 0xFF,
+	}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("wav = %x, want %x", data, want)
+	}
+
+	// the RIFF size field must hold the data size plus 36
+	w, err = newWavWriter(name, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("newWavWriter failed, err:%v", err)
+	}
+	defer w.Close()
+	w.dataSize = wavMaxRiffLength - (wavHeaderSize - 8) - 2
+	if err = w.Write(pcm16(1)); err != nil {
+		t.Fatalf("Write up to the limit failed, err:%v", err)
+	}
+	if err = w.Write([]byte{0x00}); err == nil || !strings.Contains(err.Error(), "exceeds 4 GiB") {
+		t.Fatalf("Write err:%v, want exceeds 4 GiB", err)
+	}
+	if w.dataSize != wavMaxRiffLength-(wavHeaderSize-8) {
+		t.Fatalf("dataSize = %v after the failed write", w.dataSize)
+	}
+}
@@ -0,0 +1,68 @@
+package flv
+
+// reorderWindow is the DPB size limit of H.264 and H.265, frames further back
+// in decoding order can not be reordered any more
+const reorderWindow = 16
+
+// VideoReorderStats describes the B-frame reordering of the coded video frames
+type VideoReorderStats struct {
+	Frames             int
+	MinCompositionTime int32
+	MaxCompositionTime int32
+	// NegativeCompositionTimes counts frames presented before they are decoded
+	NegativeCompositionTimes int
+	// ReorderedFrames counts frames presented before a frame decoded earlier
+	ReorderedFrames int
+	// MaxReorderDepth is the most frames preceding a frame in decoding order
+	// and following it in presentation order, max_num_reorder_frames of the
+	// stream
+	MaxReorderDepth int
+}
+
+// setCompositionTime sets the SI24 CompositionTime and the PTS of the tag,
+// coded frames count towards VideoReorder
+func (f *Flv) setCompositionTime(compositionTime int32, codedFrame bool) {
+	f.CurrentTag.CompositionTime = compositionTime
+	f.CurrentTag.Pts = int64(f.CurrentTag.Timestamp) + int64(compositionTime)
+	f.printf("CompositionTime is %v\n", compositionTime)
+	f.printf("Pts is %v\n", f.CurrentTag.Pts)
+	if codedFrame {
+		f.updateVideoReorder(compositionTime, f.CurrentTag.Pts)
+	}
+}
+
+func (f *Flv) updateVideoReorder(compositionTime int32, pts int64) {
+	s := &f.VideoReorder
+	if s.Frames == 0 || compositionTime < s.MinCompositionTime {
+		s.MinCompositionTime = compositionTime
+	}
+	if s.Frames == 0 || compositionTime > s.MaxCompositionTime {
+		s.MaxCompositionTime = compositionTime
+	}
+	s.Frames++
+	if compositionTime < 0 {
+		s.NegativeCompositionTimes++
+	}
+
+	depth := 0
+	for _, p := range f.reorderPts {
+		if p > pts {
+			depth++
+		}
+	}
+	if depth > 0 {
+		s.ReorderedFrames++
+	}
+	if depth > s.MaxReorderDepth {
+		s.MaxReorderDepth = depth
+		f.printf("MaxReorderDepth is %v\n", depth)
+		if sps := f.avcLastSps; sps != nil && sps.BitstreamRestriction && uint32(depth) > sps.MaxNumReorderFrames {
+			f.printf("reorder depth %v > max_num_reorder_frames %v\n", depth, sps.MaxNumReorderFrames)
+		}
+	}
+
+	f.reorderPts = append(f.reorderPts, pts)
+	if len(f.reorderPts) > reorderWindow {
+		f.reorderPts = f.reorderPts[1:]
+	}
+}
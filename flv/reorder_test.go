@@ -0,0 +1,53 @@
+package flv
+
+import (
+	"testing"
+)
+
+func TestUpdateVideoReorder(t *testing.T) {
+	// CompositionTimes in decoding order, one frame every 40 ms
+	tests := []struct {
+		name             string
+		compositionTimes []int32
+		want             VideoReorderStats
+	}{
+		// I0 P3 B1 B2 P6 B4 B5 P9 B7 B8 presented 40 ms late, each B-frame
+		// follows the P-frame decoded before it
+		{"IBBP", []int32{40, 120, 0, 0, 120, 0, 0, 120, 0, 0}, VideoReorderStats{
+			Frames: 10, MinCompositionTime: 0, MaxCompositionTime: 120,
+			ReorderedFrames: 6, MaxReorderDepth: 1,
+		}},
+		// the B-frames presented before they are decoded
+		{"IBBP without delay", []int32{0, 80, -40, -40}, VideoReorderStats{
+			Frames: 4, MinCompositionTime: -40, MaxCompositionTime: 80,
+			NegativeCompositionTimes: 2, ReorderedFrames: 2, MaxReorderDepth: 1,
+		}},
+		// I0 P4 B2 b1 b3, b1 follows P4 and B2
+		{"B-pyramid", []int32{80, 200, 80, 0, 40}, VideoReorderStats{
+			Frames: 5, MinCompositionTime: 0, MaxCompositionTime: 200,
+			ReorderedFrames: 3, MaxReorderDepth: 2,
+		}},
+		{"no B-frames", []int32{0, 0, 0}, VideoReorderStats{Frames: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Flv{Quiet: true}
+			for i, compositionTime := range tt.compositionTimes {
+				f.updateVideoReorder(compositionTime, int64(i*40)+int64(compositionTime))
+			}
+			if f.VideoReorder != tt.want {
+				t.Fatalf("VideoReorder = %+v, want %+v", f.VideoReorder, tt.want)
+			}
+		})
+	}
+
+	// a frame presented late stops counting 16 frames on in decoding order
+	f := &Flv{Quiet: true}
+	f.updateVideoReorder(2000, 2000)
+	for i := 1; i <= reorderWindow+1; i++ {
+		f.updateVideoReorder(0, int64(i*40))
+	}
+	if f.VideoReorder.ReorderedFrames != reorderWindow {
+		t.Fatalf("ReorderedFrames = %v, want %v", f.VideoReorder.ReorderedFrames, reorderWindow)
+	}
+}
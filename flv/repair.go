@@ -0,0 +1,143 @@
+package flv
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// DefaultRepairMaxGap is the largest step in ms between two tags of a track
+// that is taken as regular
+const DefaultRepairMaxGap = 1000
+
+// TimestampDiscontinuity is a tag whose timestamp went back or jumped ahead
+// more than the max gap, Output is the repaired timestamp
+type TimestampDiscontinuity struct {
+	TagType uint8
+	Input   uint32
+	Delta   int64 // from the previous tag of the track, wraps taken into account
+	Output  int64
+}
+
+// TimestampRepair rewrites the tags given to WriteTag with monotonic
+// timestamps, e.g. as the OnTag callback of the parser. A discontinuity, an
+// encoder restart, negative jump or large gap, is rebased to continue one
+// frame duration after the previous tag of the track. The frame duration
+// comes from the onMetaData framerate or the SPS timing for video, from the
+// AAC frame size for audio, else from the last regular step, or 1 ms before
+// the first one. Only the AVC SPS timing is parsed, HEVC and the other
+// enhanced RTMP codecs without an onMetaData framerate use the last step.
+type TimestampRepair struct {
+	// MaxGap in ms, 0 means DefaultRepairMaxGap
+	MaxGap int64
+
+	Discontinuities []TimestampDiscontinuity
+
+	w             io.Writer
+	f             *Flv
+	headerWritten bool
+	position      int64 // the latest output timestamp
+	tracks        map[uint8]*repairTrack
+}
+
+type repairTrack struct {
+	started   bool
+	lastIn    uint32
+	lastOut   int64
+	lastDelta int64 // the last regular step
+}
+
+// NewTimestampRepair writes the repaired FLV to w. f is the parser the tags
+// come from, its header flags, metadata and codec configuration are used.
+func NewTimestampRepair(w io.Writer, f *Flv) *TimestampRepair {
+	return &TimestampRepair{
+		w:      w,
+		f:      f,
+		tracks: make(map[uint8]*repairTrack),
+	}
+}
+
+func (r *TimestampRepair) WriteTag(tag *CurrentTag) error {
+	if !r.headerWritten {
+		if err := WriteHeader(r.w, r.f.HasAudio, r.f.HasVideo); err != nil {
+			return fmt.Errorf("WriteHeader failed, err:%v", err)
+		}
+		r.headerWritten = true
+	}
+
+	timestamp := r.position
+	if tag.TagType != TagTypeScriptData {
+		timestamp = r.repair(tag)
+	}
+	if timestamp > r.position {
+		r.position = timestamp
+	}
+
+	if err := WriteTag(r.w, tag.TagType, uint32(timestamp), TagBody(tag.Data)); err != nil {
+		return fmt.Errorf("WriteTag failed, err:%v", err)
+	}
+	return nil
+}
+
+func (r *TimestampRepair) repair(tag *CurrentTag) int64 {
+	t, ok := r.tracks[tag.TagType]
+	if !ok {
+		t = new(repairTrack)
+		r.tracks[tag.TagType] = t
+	}
+	if !t.started {
+		t.started = true
+		t.lastIn = tag.Timestamp
+		t.lastOut = int64(tag.Timestamp)
+		return t.lastOut
+	}
+
+	maxGap := r.MaxGap
+	if maxGap == 0 {
+		maxGap = DefaultRepairMaxGap
+	}
+
+	delta := int64(int32(tag.Timestamp - t.lastIn))
+	out := t.lastOut + delta
+	if delta < 0 || delta > maxGap {
+		out = t.lastOut + r.frameDuration(tag, t)
+		r.Discontinuities = append(r.Discontinuities, TimestampDiscontinuity{
+			TagType: tag.TagType,
+			Input:   tag.Timestamp,
+			Delta:   delta,
+			Output:  out,
+		})
+	} else if delta > 0 {
+		t.lastDelta = delta
+	}
+
+	t.lastIn = tag.Timestamp
+	t.lastOut = out
+	return out
+}
+
+func (r *TimestampRepair) frameDuration(tag *CurrentTag, t *repairTrack) int64 {
+	if tag.TagType == TagTypeVideo {
+		frameRate := r.f.MetaData["framerate"]
+		if frameRate <= 0 && r.f.avcLastSps != nil {
+			frameRate = r.f.avcLastSps.FrameRate()
+		}
+		if frameRate > 0 {
+			return int64(math.Round(1000 / frameRate))
+		}
+	}
+
+	isAac := tag.SoundFormat == SoundFormatAAC || tag.AudioFourCC == AudioFourCCAac
+	if c := r.f.AudioSpecificConfig; tag.TagType == TagTypeAudio && isAac && c != nil && c.SamplingFrequency > 0 {
+		samples := 1024
+		if c.FrameLengthFlag {
+			samples = 960
+		}
+		return int64(math.Round(float64(samples) * 1000 / float64(c.SamplingFrequency)))
+	}
+
+	if t.lastDelta > 0 {
+		return t.lastDelta
+	}
+	return 1
+}
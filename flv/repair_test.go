@@ -0,0 +1,134 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type synthTag struct {
+	tagType   uint8
+	timestamp uint32
+	body      []byte
+}
+
+// onMetaData encodes an onMetaData script tag body with a framerate
+func onMetaData(frameRate float64) []byte {
+	body := []byte{0x02, 0x00, 0x0A}
+	body = append(body, "onMetaData"...)
+	body = append(body, 0x08, 0x00, 0x00, 0x00, 0x01, 0x00, 0x09)
+	body = append(body, "framerate"...)
+	body = append(body, 0x00)
+	body = append(body, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(body[len(body)-8:], math.Float64bits(frameRate))
+	return append(body, 0x00, 0x00, 0x09)
+}
+
+func synthFlv(tags []synthTag) []byte {
+	buf := new(bytes.Buffer)
+	_ = WriteHeader(buf, true, true)
+	for _, tag := range tags {
+		_ = WriteTag(buf, tag.tagType, tag.timestamp, tag.body)
+	}
+	return buf.Bytes()
+}
+
+// parseTags parses an FLV file into its tags
+func parseTags(t *testing.T, data []byte) []synthTag {
+	t.Helper()
+	var tags []synthTag
+	f := &Flv{Quiet: true, DisableExtract: true}
+	f.OnTag = func(tag *CurrentTag) error {
+		tags = append(tags, synthTag{tag.TagType, tag.Timestamp, append([]byte(nil), TagBody(tag.Data)...)})
+		return nil
+	}
+	if _, err := f.Parse(data); err != nil {
+		t.Fatalf("f.Parse failed, err:%v", err)
+	}
+	return tags
+}
+
+func TestTimestampRepair(t *testing.T) {
+	avcFrame := []byte{0x27, 0x01, 0x00, 0x00, 0x00}
+	hevcFrame := []byte{0x80 | 0x10 | VideoPacketTypeCodedFramesX, 'h', 'v', 'c', '1'}
+	aacFrame := []byte{0xAF, 0x01, 0x21, 0x00}
+	video := func(timestamp uint32) synthTag { return synthTag{TagTypeVideo, timestamp, avcFrame} }
+	audio := func(timestamp uint32) synthTag { return synthTag{TagTypeAudio, timestamp, aacFrame} }
+	// LC 44.1 kHz stereo, 1024 samples
+	aac1024 := synthTag{TagTypeAudio, 0, []byte{0xAF, 0x00, 0x12, 0x10}}
+	// LC 48 kHz stereo with frameLengthFlag, 960 samples
+	aac960 := synthTag{TagTypeAudio, 0, []byte{0xAF, 0x00, 0x11, 0x94}}
+
+	tests := []struct {
+		name            string
+		maxGap          int64
+		tags            []synthTag
+		want            []uint32
+		discontinuities []TimestampDiscontinuity
+	}{
+		{"regular", 0,
+			[]synthTag{{TagTypeScriptData, 0, onMetaData(25)}, video(0), audio(0), video(40), audio(23), video(80)},
+			[]uint32{0, 0, 0, 40, 23, 80}, nil},
+		{"negative jump with the onMetaData framerate", 0,
+			[]synthTag{{TagTypeScriptData, 0, onMetaData(25)}, video(0), video(40), video(80), video(120), video(60), video(100)},
+			[]uint32{0, 0, 40, 80, 120, 160, 200},
+			[]TimestampDiscontinuity{{TagTypeVideo, 60, -60, 160}}},
+		// the repeated onMetaData takes the current position
+		{"encoder restart to 0 with AAC 1024 samples", 0,
+			[]synthTag{aac1024, audio(0), audio(23), audio(46), audio(70), {TagTypeScriptData, 0, onMetaData(25)}, aac1024, audio(0), audio(23)},
+			[]uint32{0, 0, 23, 46, 70, 70, 93, 93, 116},
+			[]TimestampDiscontinuity{{TagTypeAudio, 0, -70, 93}}},
+		{"gap with AAC 960 samples", 0,
+			[]synthTag{aac960, audio(0), audio(20), audio(40), audio(3040), audio(3060)},
+			[]uint32{0, 0, 20, 40, 60, 80},
+			[]TimestampDiscontinuity{{TagTypeAudio, 3040, 3000, 60}}},
+		{"gap larger than MaxGap", 500,
+			[]synthTag{{TagTypeScriptData, 0, onMetaData(30)}, video(0), video(33), video(67), video(567), video(1100), video(1133)},
+			[]uint32{0, 0, 33, 67, 567, 600, 633},
+			[]TimestampDiscontinuity{{TagTypeVideo, 1100, 533, 600}}},
+		{"no framerate uses the last step", 0,
+			[]synthTag{video(0), video(40), video(80), video(5080), video(5120)},
+			[]uint32{0, 40, 80, 120, 160},
+			[]TimestampDiscontinuity{{TagTypeVideo, 5080, 5000, 120}}},
+		{"enhanced RTMP HEVC without a framerate uses the last step", 0,
+			[]synthTag{{TagTypeVideo, 0, hevcFrame}, {TagTypeVideo, 50, hevcFrame}, {TagTypeVideo, 0, hevcFrame}},
+			[]uint32{0, 50, 100},
+			[]TimestampDiscontinuity{{TagTypeVideo, 0, -50, 100}}},
+		{"discontinuity before a regular step takes 1 ms", 0,
+			[]synthTag{video(100), video(50)},
+			[]uint32{100, 101},
+			[]TimestampDiscontinuity{{TagTypeVideo, 50, -50, 101}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			f := &Flv{Quiet: true, DisableExtract: true}
+			r := NewTimestampRepair(out, f)
+			r.MaxGap = tt.maxGap
+			f.OnTag = r.WriteTag
+			if _, err := f.Parse(synthFlv(tt.tags)); err != nil {
+				t.Fatalf("f.Parse failed, err:%v", err)
+			}
+
+			got := parseTags(t, out.Bytes())
+			if len(got) != len(tt.tags) {
+				t.Fatalf("%v tags, want %v", len(got), len(tt.tags))
+			}
+			var timestamps []uint32
+			for i, tag := range got {
+				if tag.tagType != tt.tags[i].tagType || !bytes.Equal(tag.body, tt.tags[i].body) {
+					t.Fatalf("tag %v changed from %v %x to %v %x", i, tt.tags[i].tagType, tt.tags[i].body, tag.tagType, tag.body)
+				}
+				timestamps = append(timestamps, tag.timestamp)
+			}
+			if !reflect.DeepEqual(timestamps, tt.want) {
+				t.Fatalf("timestamps = %v, want %v", timestamps, tt.want)
+			}
+			if !reflect.DeepEqual(r.Discontinuities, tt.discontinuities) {
+				t.Fatalf("Discontinuities = %+v, want %+v", r.Discontinuities, tt.discontinuities)
+			}
+		})
+	}
+}
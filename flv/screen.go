@@ -0,0 +1,257 @@
+package flv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"flvParse/util"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	ScreenVideoColorDepth24Bit = 0
+	ScreenVideoColorDepth8Bit  = 1
+
+	screenVideoBlockUnit = 16
+)
+
+var ScreenVideoColorDepthMap = map[uint8]string{
+	ScreenVideoColorDepth24Bit: "24-bit BGR",
+	ScreenVideoColorDepth8Bit:  "8-bit palette and 15-bit RGB",
+}
+
+// ScreenVideoPacket is a SCREENVIDEOPACKET or, with Version 2, a SCREENV2VIDEOPACKET
+type ScreenVideoPacket struct {
+	Version        uint8
+	BlockWidth     uint16
+	ImageWidth     uint16
+	BlockHeight    uint16
+	ImageHeight    uint16
+	HasIFrameImage bool
+	HasPaletteInfo bool
+	PaletteInfo    *ScreenVideoBlock
+	Blocks         []*ScreenVideoBlock
+}
+
+// ScreenVideoBlock is an IMAGEBLOCK or an IMAGEBLOCKV2. Blocks are ordered from
+// the bottom left, a block without data is unchanged since the last frame.
+type ScreenVideoBlock struct {
+	DataSize uint16
+
+	ColorDepth                uint8
+	HasDiffBlocks             bool
+	ZlibPrimeCompressCurrent  bool
+	ZlibPrimeCompressPrevious bool
+	DiffRowStart              uint8
+	DiffHeight                uint8
+	PrimeBlockColumn          uint8
+	PrimeBlockRow             uint8
+
+	Data []byte // zlib compressed pixels
+}
+
+func (f *Flv) parseScreenVideoPacket(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	if end-index < 4 {
+		return 0, fmt.Errorf("screen video header len %v < 4", end-index)
+	}
+
+	packet := new(ScreenVideoPacket)
+	packet.Version = 1
+	if f.CurrentTag.CodeId == CodecIDScreenVideoVersion2 {
+		packet.Version = 2
+	}
+
+	r := util.NewBitReader(buf[index : index+4])
+	blockWidth, _ := r.ReadBits(4)
+	imageWidth, _ := r.ReadBits(12)
+	blockHeight, _ := r.ReadBits(4)
+	imageHeight, _ := r.ReadBits(12)
+	packet.BlockWidth = uint16(blockWidth+1) * screenVideoBlockUnit
+	packet.ImageWidth = uint16(imageWidth)
+	packet.BlockHeight = uint16(blockHeight+1) * screenVideoBlockUnit
+	packet.ImageHeight = uint16(imageHeight)
+	index += 4
+	f.printf("screen video version is %v\n", packet.Version)
+	f.printf("screen video block size is %vx%v\n", packet.BlockWidth, packet.BlockHeight)
+	f.printf("screen video image size is %vx%v\n", packet.ImageWidth, packet.ImageHeight)
+	if packet.ImageWidth == 0 || packet.ImageHeight == 0 {
+		return 0, fmt.Errorf("screen video image size %vx%v is illegal", packet.ImageWidth, packet.ImageHeight)
+	}
+	f.VideoWidth, f.VideoHeight = packet.ImageWidth, packet.ImageHeight
+
+	var err error
+	if packet.Version == 2 {
+		if end-index < 1 {
+			return 0, fmt.Errorf("screen video v2 flags len %v < 1", end-index)
+		}
+		reserved := buf[index] >> 2
+		if reserved != 0 {
+			return 0, fmt.Errorf("screen video v2 reserved != 0, reserved:%v", reserved)
+		}
+		packet.HasIFrameImage = buf[index]&0b10 != 0
+		packet.HasPaletteInfo = buf[index]&0b01 != 0
+		index += 1
+		f.printf("screen video hasIFrameImage is %v\n", packet.HasIFrameImage)
+		f.printf("screen video hasPaletteInfo is %v\n", packet.HasPaletteInfo)
+
+		if packet.HasPaletteInfo {
+			packet.PaletteInfo, index, err = parseScreenVideoBlock(buf, index, end, packet.Version)
+			if err != nil {
+				return 0, fmt.Errorf("PaletteInfo: parseScreenVideoBlock failed, err:%v", err)
+			}
+		}
+	}
+
+	cols := (int(packet.ImageWidth) + int(packet.BlockWidth) - 1) / int(packet.BlockWidth)
+	rows := (int(packet.ImageHeight) + int(packet.BlockHeight) - 1) / int(packet.BlockHeight)
+	changed := 0
+	for i := 0; i < cols*rows; i++ {
+		var block *ScreenVideoBlock
+		block, index, err = parseScreenVideoBlock(buf, index, end, packet.Version)
+		if err != nil {
+			return 0, fmt.Errorf("block %v: parseScreenVideoBlock failed, err:%v", i, err)
+		}
+		if block.DataSize > 0 {
+			changed++
+		}
+		packet.Blocks = append(packet.Blocks, block)
+	}
+	f.printf("screen video blocks are %vx%v, %v changed\n", cols, rows, changed)
+	f.CurrentTag.ScreenVideo = packet
+
+	if f.RenderScreenVideo {
+		if err = f.renderScreenVideo(packet, cols); err != nil {
+			return 0, fmt.Errorf("f.renderScreenVideo failed, err:%v", err)
+		}
+	}
+
+	return end, nil
+}
+
+func parseScreenVideoBlock(buf []byte, index int, end int, version uint8) (*ScreenVideoBlock, int, error) {
+	if end-index < 2 {
+		return nil, 0, fmt.Errorf("DataSize len %v < 2", end-index)
+	}
+	dataSize, err := util.BytesToUint16ByBigEndian(buf[index : index+2])
+	if err != nil {
+		return nil, 0, fmt.Errorf("util.BytesToUint16ByBigEndian failed, err:%v", err)
+	}
+	index += 2
+	if end-index < int(dataSize) {
+		return nil, 0, fmt.Errorf("DataSize %v > remaining %v", dataSize, end-index)
+	}
+
+	block := &ScreenVideoBlock{DataSize: dataSize}
+	data := buf[index : index+int(dataSize)]
+	index += int(dataSize)
+	if dataSize == 0 || version == 1 {
+		block.Data = data
+		return block, index, nil
+	}
+
+	// the v2 DataSize also counts the format byte and the optional positions
+	format := data[0]
+	block.ColorDepth = (format >> 3) & 0b11
+	block.HasDiffBlocks = format&0b100 != 0
+	block.ZlibPrimeCompressCurrent = format&0b10 != 0
+	block.ZlibPrimeCompressPrevious = format&0b01 != 0
+	data = data[1:]
+	if block.HasDiffBlocks {
+		if len(data) < 2 {
+			return nil, 0, fmt.Errorf("IMAGEDIFFPOSITION len %v < 2", len(data))
+		}
+		block.DiffRowStart, block.DiffHeight = data[0], data[1]
+		data = data[2:]
+	}
+	if block.ZlibPrimeCompressCurrent {
+		if len(data) < 2 {
+			return nil, 0, fmt.Errorf("IMAGEPRIMEPOSITION len %v < 2", len(data))
+		}
+		block.PrimeBlockColumn, block.PrimeBlockRow = data[0], data[1]
+		data = data[2:]
+	}
+	block.Data = data
+
+	return block, index, nil
+}
+
+// renderScreenVideo applies the changed blocks to the current picture and
+// writes it to ./test.screen.<frame>.png
+func (f *Flv) renderScreenVideo(packet *ScreenVideoPacket, cols int) error {
+	width, height := int(packet.ImageWidth), int(packet.ImageHeight)
+	if f.screenFrame == nil || f.screenFrame.Rect.Dx() != width || f.screenFrame.Rect.Dy() != height {
+		f.screenFrame = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+
+	for i, block := range packet.Blocks {
+		if block.DataSize == 0 {
+			continue
+		}
+		if block.ZlibPrimeCompressCurrent || block.ZlibPrimeCompressPrevious {
+			f.printf("screen video block %v is zlib primed, not rendered\n", i)
+			continue
+		}
+		if block.ColorDepth != ScreenVideoColorDepth24Bit {
+			f.printf("screen video block %v color depth is %v, not rendered\n", i, ScreenVideoColorDepthMap[block.ColorDepth])
+			continue
+		}
+
+		zr, err := zlib.NewReader(bytes.NewReader(block.Data))
+		if err != nil {
+			return fmt.Errorf("block %v: zlib.NewReader failed, err:%v", i, err)
+		}
+		pixels, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return fmt.Errorf("block %v: zlib decompress failed, err:%v", i, err)
+		}
+
+		// block rows and the pixel rows inside a block go from the bottom up
+		x0 := (i % cols) * int(packet.BlockWidth)
+		bottom := height - (i/cols)*int(packet.BlockHeight)
+		blockWidth, blockHeight := int(packet.BlockWidth), int(packet.BlockHeight)
+		if blockWidth > width-x0 {
+			blockWidth = width - x0
+		}
+		if blockHeight > bottom {
+			blockHeight = bottom
+		}
+		rowStart, rowCount := 0, blockHeight
+		if block.HasDiffBlocks {
+			rowStart, rowCount = int(block.DiffRowStart), int(block.DiffHeight)
+			if rowStart+rowCount > blockHeight {
+				return fmt.Errorf("block %v: diff rows %v+%v > block height %v", i, rowStart, rowCount, blockHeight)
+			}
+		}
+		if len(pixels) < rowCount*blockWidth*3 {
+			return fmt.Errorf("block %v: %v bytes < %vx%v BGR pixels", i, len(pixels), blockWidth, rowCount)
+		}
+
+		for k := 0; k < rowCount; k++ {
+			y := bottom - 1 - rowStart - k
+			for x := 0; x < blockWidth; x++ {
+				p := pixels[(k*blockWidth+x)*3:]
+				f.screenFrame.SetRGBA(x0+x, y, color.RGBA{R: p[2], G: p[1], B: p[0], A: 0xFF})
+			}
+		}
+	}
+
+	if f.DisableExtract {
+		return nil
+	}
+	name := f.trackFileName(fmt.Sprintf("./test.screen.%06d.png", f.screenFrames))
+	f.screenFrames++
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile(%q) failed, err:%v", name, err)
+	}
+	if err = png.Encode(file, f.screenFrame); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("png.Encode failed, err:%v", err)
+	}
+	return file.Close()
+}
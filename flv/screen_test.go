@@ -0,0 +1,216 @@
+package flv
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// screenPixel is the color of the pixel x of row k, counted from the bottom, in
+// block i
+func screenPixel(i, x, k int) color.RGBA {
+	return color.RGBA{R: byte(i * 50), G: byte(k), B: byte(x), A: 0xFF}
+}
+
+// screenBlockPixels compresses width x rows BGR pixels, bottom row first
+func screenBlockPixels(i, width, rows int) []byte {
+	var pixels []byte
+	for k := 0; k < rows; k++ {
+		for x := 0; x < width; x++ {
+			c := screenPixel(i, x, k)
+			pixels = append(pixels, c.B, c.G, c.R)
+		}
+	}
+	buf := new(bytes.Buffer)
+	w := zlib.NewWriter(buf)
+	_, _ = w.Write(pixels)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+// screenPacket is the 4 byte header and the blocks with their DataSize
+func screenPacket(blockWidth, imageWidth, blockHeight, imageHeight uint32, flags []byte, blocks ...[]byte) []byte {
+	buf := bitFields(blockWidth/16-1, 4, imageWidth, 12, blockHeight/16-1, 4, imageHeight, 12)
+	buf = append(buf, flags...)
+	for _, block := range blocks {
+		buf = append(buf, byte(len(block)>>8), byte(len(block)))
+		buf = append(buf, block...)
+	}
+	return buf
+}
+
+func parseScreen(t *testing.T, f *Flv, codecId uint8, buf []byte) *ScreenVideoPacket {
+	t.Helper()
+	f.CurrentTag = &CurrentTag{Length: len(buf), CodeId: codecId}
+	if _, err := f.parseScreenVideoPacket(buf, 0); err != nil {
+		t.Fatalf("parseScreenVideoPacket failed, err:%v", err)
+	}
+	return f.CurrentTag.ScreenVideo
+}
+
+func TestParseScreenVideoPacket(t *testing.T) {
+	// 40x20 in 32x16 blocks, 2 columns and 2 rows, the right and top blocks
+	// are cut
+	f := &Flv{Quiet: true, DisableExtract: true}
+	blocks := [][]byte{{0x78, 0x01}, {}, {0xAA}, {}}
+	packet := parseScreen(t, f, CodecIDScreenVideo, screenPacket(32, 40, 16, 20, nil, blocks...))
+	want := &ScreenVideoPacket{
+		Version: 1, BlockWidth: 32, ImageWidth: 40, BlockHeight: 16, ImageHeight: 20,
+		Blocks: []*ScreenVideoBlock{
+			{DataSize: 2, Data: []byte{0x78, 0x01}},
+			{Data: []byte{}},
+			{DataSize: 1, Data: []byte{0xAA}},
+			{Data: []byte{}},
+		},
+	}
+	if !reflect.DeepEqual(packet, want) {
+		t.Fatalf("ScreenVideo = %+v, want %+v", packet, want)
+	}
+	if f.VideoWidth != 40 || f.VideoHeight != 20 {
+		t.Fatalf("size = %vx%v, want 40x20", f.VideoWidth, f.VideoHeight)
+	}
+
+	// version 2 with palette info, a diff block and a primed block
+	v2Blocks := [][]byte{
+		{0x00}, // 24 bit, no options
+		{0x04 | 0x02, 0x03, 0x05, 0x01, 0x00, 0xEE}, // diff rows 3+5, primed from block 1,0
+		{ScreenVideoColorDepth8Bit << 3},
+		{},
+	}
+	packet = parseScreen(t, f, CodecIDScreenVideoVersion2, screenPacket(32, 40, 16, 20, []byte{0x03, 0x00, 0x02, 0x00, 0xDD}, v2Blocks...))
+	want = &ScreenVideoPacket{
+		Version: 2, BlockWidth: 32, ImageWidth: 40, BlockHeight: 16, ImageHeight: 20,
+		HasIFrameImage: true, HasPaletteInfo: true,
+		PaletteInfo: &ScreenVideoBlock{DataSize: 2, Data: []byte{0xDD}},
+		Blocks: []*ScreenVideoBlock{
+			{DataSize: 1, Data: []byte{}},
+			{DataSize: 6, HasDiffBlocks: true, ZlibPrimeCompressCurrent: true, DiffRowStart: 3, DiffHeight: 5,
+				PrimeBlockColumn: 1, Data: []byte{0xEE}},
+			{DataSize: 1, ColorDepth: ScreenVideoColorDepth8Bit, Data: []byte{}},
+			{Data: []byte{}},
+		},
+	}
+	if !reflect.DeepEqual(packet, want) {
+		t.Fatalf("ScreenVideo v2 = %+v, want %+v", packet, want)
+	}
+
+	errTests := []struct {
+		name    string
+		codecId uint8
+		buf     []byte
+		wantErr string
+	}{
+		{"short header", CodecIDScreenVideo, []byte{0x10, 0x28, 0x00}, "screen video header len 3 < 4"},
+		{"zero image size", CodecIDScreenVideo, screenPacket(32, 0, 16, 20, nil), "image size 0x20 is illegal"},
+		{"missing block", CodecIDScreenVideo, screenPacket(32, 40, 16, 20, nil, blocks[:3]...), "block 3: parseScreenVideoBlock failed, err:DataSize len 0 < 2"},
+		{"block past the end", CodecIDScreenVideo, append(screenPacket(32, 40, 16, 20, nil), 0x00, 0x05, 0xAA), "DataSize 5 > remaining 1"},
+		{"v2 without flags", CodecIDScreenVideoVersion2, screenPacket(32, 40, 16, 20, nil), "screen video v2 flags len 0 < 1"},
+		{"v2 reserved flags", CodecIDScreenVideoVersion2, screenPacket(32, 40, 16, 20, []byte{0x04}), "reserved != 0"},
+		{"v2 truncated diff position", CodecIDScreenVideoVersion2, screenPacket(32, 40, 16, 20, []byte{0x00}, []byte{0x04, 0x03}), "IMAGEDIFFPOSITION len 1 < 2"},
+		{"v2 truncated prime position", CodecIDScreenVideoVersion2, screenPacket(32, 40, 16, 20, []byte{0x00}, []byte{0x02}), "IMAGEPRIMEPOSITION len 0 < 2"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tagFlv(tt.buf)
+			f.CurrentTag.CodeId = tt.codecId
+			if _, err := f.parseScreenVideoPacket(tt.buf, 0); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseScreenVideoPacket err:%v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// wantScreen is the 40x20 picture of 32x16 blocks, blocks from the bottom
+// left and their rows from the bottom up, only the blocks in changed
+func wantScreen(changed map[int]bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			fromBottom := 19 - y
+			i := fromBottom/16*2 + x/32
+			if changed[i] {
+				img.SetRGBA(x, y, screenPixel(i, x%32, fromBottom%16))
+			}
+		}
+	}
+	return img
+}
+
+func TestRenderScreenVideo(t *testing.T) {
+	dir := inTempDir(t)
+	f := &Flv{Quiet: true, RenderScreenVideo: true}
+
+	// the cut blocks carry only their visible pixels
+	parseScreen(t, f, CodecIDScreenVideo, screenPacket(32, 40, 16, 20, nil,
+		screenBlockPixels(0, 32, 16), screenBlockPixels(1, 8, 16), screenBlockPixels(2, 32, 4), nil))
+	if want := wantScreen(map[int]bool{0: true, 1: true, 2: true}); !reflect.DeepEqual(f.screenFrame, want) {
+		t.Fatalf("first frame differs")
+	}
+
+	// the unchanged blocks are kept
+	parseScreen(t, f, CodecIDScreenVideo, screenPacket(32, 40, 16, 20, nil,
+		nil, nil, nil, screenBlockPixels(3, 8, 4)))
+	want := wantScreen(map[int]bool{0: true, 1: true, 2: true, 3: true})
+	if !reflect.DeepEqual(f.screenFrame, want) {
+		t.Fatalf("second frame differs")
+	}
+
+	// a v2 diff block replaces rows 2 to 4 of the bottom left block
+	diff := append([]byte{0x04, 0x02, 0x03}, screenBlockPixels(4, 32, 3)...)
+	parseScreen(t, f, CodecIDScreenVideoVersion2, screenPacket(32, 40, 16, 20, []byte{0x00}, diff, nil, nil, nil))
+	for k := 0; k < 3; k++ {
+		for x := 0; x < 32; x++ {
+			want.SetRGBA(x, 19-2-k, screenPixel(4, x, k))
+		}
+	}
+	if !reflect.DeepEqual(f.screenFrame, want) {
+		t.Fatalf("diff frame differs")
+	}
+
+	for frame := 0; frame < 3; frame++ {
+		file, err := os.Open(fmt.Sprintf("%v/test.screen.%06d.png", dir, frame))
+		if err != nil {
+			t.Fatalf("os.Open failed, err:%v", err)
+		}
+		img, err := png.Decode(file)
+		file.Close()
+		if err != nil {
+			t.Fatalf("png.Decode failed, err:%v", err)
+		}
+		if got := color.RGBAModel.Convert(img.At(5, 17)); frame == 2 && got != screenPixel(4, 5, 0) {
+			t.Fatalf("png pixel 5,17 = %v, want the diff block", got)
+		}
+	}
+
+	errTests := []struct {
+		name    string
+		block   []byte
+		wantErr string
+	}{
+		{"too few pixels", screenBlockPixels(0, 32, 15), "bytes < 32x16 BGR pixels"},
+		{"diff rows past the block", append([]byte{0x04, 0x0E, 0x03}, screenBlockPixels(0, 32, 3)...), "diff rows 14+3 > block height 16"},
+		{"not zlib", []byte{0x00, 0x01, 0x02}, "zlib.NewReader failed"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Flv{Quiet: true, DisableExtract: true, RenderScreenVideo: true}
+			flags := []byte{0x00}
+			block := tt.block
+			if block[0] != 0x04 {
+				block = append([]byte{0x00}, block...)
+			}
+			buf := screenPacket(32, 40, 16, 20, flags, block, nil, nil, nil)
+			f.CurrentTag = &CurrentTag{Length: len(buf), CodeId: CodecIDScreenVideoVersion2}
+			if _, err := f.parseScreenVideoPacket(buf, 0); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseScreenVideoPacket err:%v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+)
+
+const (
+	SeiPayloadTypeBufferingPeriod                    = 0
+	SeiPayloadTypePicTiming                          = 1
+	SeiPayloadTypeUserDataRegisteredItuTT35          = 4
+	SeiPayloadTypeUserDataUnregistered               = 5
+	SeiPayloadTypeRecoveryPoint                      = 6
+	SeiPayloadTypeFramePacking                       = 45
+	SeiPayloadTypeMasteringDisplayColour             = 137
+	SeiPayloadTypeContentLightLevel                  = 144
+	SeiPayloadTypeAlternativeTransferCharacteristics = 147
+
+	ituTT35CountryCodeUs    = 0xB5
+	ituTT35ProviderCodeAtsc = 0x0031
+	atscUserIdentifierGa94  = "GA94"
+	atscUserDataTypeCcData  = 0x03
+	seiUuidSize             = 16
+
+	CcTypeNtscField1 = 0
+	CcTypeNtscField2 = 1
+	CcTypeDtvccData  = 2
+	CcTypeDtvccStart = 3
+)
+
+var SeiPayloadTypeMap = map[uint32]string{
+	SeiPayloadTypeBufferingPeriod:                    "buffering_period",
+	SeiPayloadTypePicTiming:                          "pic_timing",
+	SeiPayloadTypeUserDataRegisteredItuTT35:          "user_data_registered_itu_t_t35",
+	SeiPayloadTypeUserDataUnregistered:               "user_data_unregistered",
+	SeiPayloadTypeRecoveryPoint:                      "recovery_point",
+	SeiPayloadTypeFramePacking:                       "frame_packing_arrangement",
+	SeiPayloadTypeMasteringDisplayColour:             "mastering_display_colour_volume",
+	SeiPayloadTypeContentLightLevel:                  "content_light_level_info",
+	SeiPayloadTypeAlternativeTransferCharacteristics: "alternative_transfer_characteristics",
+}
+
+var CcTypeMap = map[uint8]string{
+	CcTypeNtscField1: "CEA-608 field 1",
+	CcTypeNtscField2: "CEA-608 field 2",
+	CcTypeDtvccData:  "CEA-708 DTVCC data",
+	CcTypeDtvccStart: "CEA-708 DTVCC start",
+}
+
+// avcNumClockTs is indexed by pic_struct
+var avcNumClockTs = [9]int{1, 1, 1, 2, 2, 3, 3, 2, 3}
+
+// AvcSeiMessage is one sei_message, only the fields of its payload type are set
+type AvcSeiMessage struct {
+	PayloadType uint32
+	PayloadSize int
+
+	// user_data_registered_itu_t_t35
+	CountryCode    uint8
+	ProviderCode   uint16
+	UserIdentifier string
+	CcData         []CcData
+
+	// user_data_unregistered
+	Uuid     []byte
+	UserData []byte
+
+	PicTiming *AvcPicTiming
+}
+
+// CcData is one cc_data triplet of ATSC A/53
+type CcData struct {
+	Valid bool
+	Type  uint8
+	Data1 byte
+	Data2 byte
+}
+
+type AvcPicTiming struct {
+	CpbRemovalDelay uint32
+	DpbOutputDelay  uint32
+	PicStruct       uint8
+	Timecodes       []AvcTimecode
+}
+
+type AvcTimecode struct {
+	Hours     uint8
+	Minutes   uint8
+	Seconds   uint8
+	Frames    uint8
+	DropFrame bool
+}
+
+// String is HH:MM:SS:FF, with ; before the frames for drop frame timecodes
+func (t AvcTimecode) String() string {
+	sep := ":"
+	if t.DropFrame {
+		sep = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%v%02d", t.Hours, t.Minutes, t.Seconds, sep, t.Frames)
+}
+
+// parseAvcSei parses the sei_messages of a SEI NAL unit including its header
+// byte. pic_timing depends on the VUI of sps and is skipped without it.
+func parseAvcSei(nal []byte, sps *AvcSps) ([]*AvcSeiMessage, error) {
+	rbsp := util.RemoveEmulationPrevention(nal[1:])
+
+	var messages []*AvcSeiMessage
+	index := 0
+	// more_rbsp_data, the last byte is the rbsp_trailing_bits
+	for len(rbsp)-index > 1 || (len(rbsp)-index == 1 && rbsp[index] != 0x80) {
+		payloadType, n := readSeiValue(rbsp[index:])
+		index += n
+		payloadSize, n := readSeiValue(rbsp[index:])
+		index += n
+		if n == 0 || len(rbsp)-index < int(payloadSize) {
+			return messages, fmt.Errorf("sei payload size %v > remaining %v", payloadSize, len(rbsp)-index)
+		}
+		payload := rbsp[index : index+int(payloadSize)]
+		index += int(payloadSize)
+
+		m := &AvcSeiMessage{PayloadType: payloadType, PayloadSize: int(payloadSize)}
+		switch payloadType {
+		case SeiPayloadTypeUserDataRegisteredItuTT35:
+			parseSeiUserDataRegistered(m, payload)
+		case SeiPayloadTypeUserDataUnregistered:
+			if len(payload) >= seiUuidSize {
+				m.Uuid = append([]byte(nil), payload[:seiUuidSize]...)
+				m.UserData = append([]byte(nil), payload[seiUuidSize:]...)
+			}
+		case SeiPayloadTypePicTiming:
+			if sps != nil {
+				picTiming, err := parseAvcPicTiming(payload, sps)
+				if err != nil {
+					return messages, fmt.Errorf("pic_timing: %v", err)
+				}
+				m.PicTiming = picTiming
+			}
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// readSeiValue reads a payloadType or payloadSize coded as 0xFF bytes and a
+// last byte, returning the bytes read
+func readSeiValue(buf []byte) (uint32, int) {
+	var value uint32
+	for i, b := range buf {
+		value += uint32(b)
+		if b != 0xFF {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// parseSeiUserDataRegistered reads the ATSC A/53 cc_data carried with the
+// GA94 user identifier, other registered user data is left as is
+func parseSeiUserDataRegistered(m *AvcSeiMessage, payload []byte) {
+	if len(payload) < 1 {
+		return
+	}
+	m.CountryCode = payload[0]
+	payload = payload[1:]
+	if m.CountryCode == 0xFF { // itu_t_t35_country_code_extension_byte
+		if len(payload) < 1 {
+			return
+		}
+		payload = payload[1:]
+	}
+	if len(payload) < 2 {
+		return
+	}
+	m.ProviderCode = uint16(payload[0])<<8 | uint16(payload[1])
+	payload = payload[2:]
+	if m.CountryCode != ituTT35CountryCodeUs || m.ProviderCode != ituTT35ProviderCodeAtsc || len(payload) < 4 {
+		return
+	}
+	m.UserIdentifier = string(payload[:4])
+	payload = payload[4:]
+	if m.UserIdentifier != atscUserIdentifierGa94 || len(payload) < 3 || payload[0] != atscUserDataTypeCcData {
+		return
+	}
+
+	processCcData := payload[1]&0x40 != 0
+	ccCount := int(payload[1] & 0x1F)
+	payload = payload[3:] // user_data_type_code, flags and cc_count, em_data
+	if !processCcData {
+		return
+	}
+	for i := 0; i < ccCount && len(payload) >= 3; i++ {
+		m.CcData = append(m.CcData, CcData{
+			Valid: payload[0]&0x04 != 0,
+			Type:  payload[0] & 0x03,
+			Data1: payload[1],
+			Data2: payload[2],
+		})
+		payload = payload[3:]
+	}
+}
+
+func parseAvcPicTiming(payload []byte, sps *AvcSps) (*AvcPicTiming, error) {
+	r := util.NewBitReader(payload)
+	t := new(AvcPicTiming)
+	var err error
+	if sps.CpbDpbDelaysPresent {
+		if t.CpbRemovalDelay, err = r.ReadBits(int(sps.CpbRemovalDelayLength)); err != nil {
+			return nil, fmt.Errorf("cpb_removal_delay: %v", err)
+		}
+		if t.DpbOutputDelay, err = r.ReadBits(int(sps.DpbOutputDelayLength)); err != nil {
+			return nil, fmt.Errorf("dpb_output_delay: %v", err)
+		}
+	}
+	if !sps.PicStructPresent {
+		return t, nil
+	}
+
+	picStruct, err := r.ReadBits(4)
+	if err != nil {
+		return nil, fmt.Errorf("pic_struct: %v", err)
+	}
+	if int(picStruct) >= len(avcNumClockTs) {
+		return nil, fmt.Errorf("pic_struct %v is reserved", picStruct)
+	}
+	t.PicStruct = uint8(picStruct)
+
+	for i := 0; i < avcNumClockTs[picStruct]; i++ {
+		clockTimestampFlag, err := r.ReadFlag()
+		if err != nil {
+			return nil, fmt.Errorf("clock_timestamp_flag: %v", err)
+		}
+		if !clockTimestampFlag {
+			continue
+		}
+		var tc AvcTimecode
+		_, _ = r.ReadBits(2) // ct_type
+		_, _ = r.ReadBits(1) // nuit_field_based_flag
+		_, _ = r.ReadBits(5) // counting_type
+		fullTimestamp, _ := r.ReadFlag()
+		_, _ = r.ReadFlag() // discontinuity_flag
+		tc.DropFrame, _ = r.ReadFlag()
+		frames, err := r.ReadBits(8)
+		if err != nil {
+			return nil, fmt.Errorf("n_frames: %v", err)
+		}
+		tc.Frames = uint8(frames)
+		var seconds, minutes, hours uint32
+		if fullTimestamp {
+			seconds, _ = r.ReadBits(6)
+			minutes, _ = r.ReadBits(6)
+			hours, err = r.ReadBits(5)
+		} else if secondsFlag, _ := r.ReadFlag(); secondsFlag {
+			seconds, _ = r.ReadBits(6)
+			if minutesFlag, _ := r.ReadFlag(); minutesFlag {
+				minutes, _ = r.ReadBits(6)
+				if hoursFlag, _ := r.ReadFlag(); hoursFlag {
+					hours, err = r.ReadBits(5)
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("clock timestamp: %v", err)
+		}
+		if sps.TimeOffsetLength > 0 {
+			if err = r.Skip(int(sps.TimeOffsetLength)); err != nil {
+				return nil, fmt.Errorf("time_offset: %v", err)
+			}
+		}
+		tc.Seconds, tc.Minutes, tc.Hours = uint8(seconds), uint8(minutes), uint8(hours)
+		t.Timecodes = append(t.Timecodes, tc)
+	}
+	return t, nil
+}
+
+// parseAvcSeiNalu prints the messages of a SEI NAL unit and decodes the
+// CEA-608 field 1 pairs for the caption files
+func (f *Flv) parseAvcSeiNalu(nal []byte, summary *AvcTagSummary) {
+	messages, err := parseAvcSei(nal, f.avcLastSps)
+	if err != nil {
+		f.printf("sei is not fully parsed, err:%v\n", err)
+	}
+	summary.Sei = append(summary.Sei, messages...)
+
+	pts := int64(f.CurrentTag.Timestamp) + int64(f.CurrentTag.CompositionTime)
+	for _, m := range messages {
+		payloadTypeString, ok := SeiPayloadTypeMap[m.PayloadType]
+		if !ok {
+			payloadTypeString = fmt.Sprintf("payload type %v", m.PayloadType)
+		}
+		f.printf("sei %v size is %v\n", payloadTypeString, m.PayloadSize)
+
+		switch {
+		case m.UserIdentifier == atscUserIdentifierGa94:
+			counts := make(map[uint8]int)
+			for _, cc := range m.CcData {
+				if !cc.Valid {
+					continue
+				}
+				counts[cc.Type]++
+				if cc.Type == CcTypeNtscField1 && !f.DisableExtract {
+					if f.captions == nil {
+						f.captions = new(cea608Decoder)
+					}
+					f.captions.push(captionData{pts: pts, data1: cc.Data1, data2: cc.Data2}, int64(f.CurrentTag.Timestamp))
+				}
+			}
+			for ccType := uint8(CcTypeNtscField1); ccType <= CcTypeDtvccStart; ccType++ {
+				if counts[ccType] > 0 {
+					f.printf("sei %v cc_data count is %v\n", CcTypeMap[ccType], counts[ccType])
+				}
+			}
+		case m.Uuid != nil:
+			f.printf("sei uuid is %x, user data size is %v\n", m.Uuid, len(m.UserData))
+		case m.PicTiming != nil:
+			for _, tc := range m.PicTiming.Timecodes {
+				f.printf("sei pic_timing timecode is %v\n", tc)
+			}
+		}
+	}
+}
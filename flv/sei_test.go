@@ -0,0 +1,142 @@
+package flv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ga94Sei is a SEI NAL unit with the ATSC A/53 cc_data of count cc_data
+// triplets, without emulation prevention bytes
+func ga94Sei(count int, triplets []byte) []byte {
+	payload := append([]byte{ituTT35CountryCodeUs, 0x00, 0x31, 'G', 'A', '9', '4', atscUserDataTypeCcData, 0x40 | byte(count), 0xFF}, triplets...)
+	nal := append([]byte{0x06, SeiPayloadTypeUserDataRegisteredItuTT35, byte(len(payload))}, payload...)
+	return append(nal, 0x80)
+}
+
+func TestParseAvcSei(t *testing.T) {
+	uuid := []byte{0xDC, 0x45, 0xE9, 0xBD, 0xE6, 0xD9, 0x48, 0xB7, 0x96, 0x2C, 0xD8, 0x20, 0xD9, 0x23, 0xEE, 0xEF}
+
+	tests := []struct {
+		name    string
+		nal     []byte
+		want    []*AvcSeiMessage
+		wantErr string
+	}{
+		{"GA94 cc_data", ga94Sei(3, []byte{0xFC, 0x94, 0x20, 0xFD, 0x80, 0x80, 0xFA, 0x00, 0x00}), []*AvcSeiMessage{{
+			PayloadType: SeiPayloadTypeUserDataRegisteredItuTT35, PayloadSize: 19,
+			CountryCode: 0xB5, ProviderCode: 0x31, UserIdentifier: "GA94",
+			CcData: []CcData{
+				{Valid: true, Type: CcTypeNtscField1, Data1: 0x94, Data2: 0x20},
+				{Valid: true, Type: CcTypeNtscField2, Data1: 0x80, Data2: 0x80},
+				{Valid: false, Type: CcTypeDtvccData, Data1: 0x00, Data2: 0x00},
+			},
+		}}, ""},
+		{"process_cc_data_flag off", []byte{0x06, 0x04, 0x0D, 0xB5, 0x00, 0x31, 'G', 'A', '9', '4', 0x03, 0x01, 0xFF, 0xFC, 0x94, 0x20, 0x80}, []*AvcSeiMessage{{
+			PayloadType: SeiPayloadTypeUserDataRegisteredItuTT35, PayloadSize: 13,
+			CountryCode: 0xB5, ProviderCode: 0x31, UserIdentifier: "GA94",
+		}}, ""},
+		{"other provider", []byte{0x06, 0x04, 0x05, 0xB5, 0x00, 0x2F, 0x03, 0x01, 0x80}, []*AvcSeiMessage{{
+			PayloadType: SeiPayloadTypeUserDataRegisteredItuTT35, PayloadSize: 5,
+			CountryCode: 0xB5, ProviderCode: 0x2F,
+		}}, ""},
+		// the payload size counts the bytes without the emulation prevention
+		{"user_data_unregistered", append(append([]byte{0x06, 0x05, 0x14}, uuid...), 0x00, 0x00, 0x03, 0x01, 0x01, 0x80), []*AvcSeiMessage{{
+			PayloadType: SeiPayloadTypeUserDataUnregistered, PayloadSize: 20,
+			Uuid: uuid, UserData: []byte{0x00, 0x00, 0x01, 0x01},
+		}}, ""},
+		// payloadType 255 + 5, then a second message
+		{"two messages", append(append([]byte{0x06, 0xFF, 0x05, 0x01, 0xAA, 0x05, 0x10}, uuid...), 0x80), []*AvcSeiMessage{
+			{PayloadType: 260, PayloadSize: 1},
+			{PayloadType: SeiPayloadTypeUserDataUnregistered, PayloadSize: 16, Uuid: uuid},
+		}, ""},
+		{"pic_timing without sps", []byte{0x06, 0x01, 0x01, 0x10, 0x80}, []*AvcSeiMessage{
+			{PayloadType: SeiPayloadTypePicTiming, PayloadSize: 1},
+		}, ""},
+		{"payload past the end", []byte{0x06, 0x05, 0x10, 0x00, 0x01, 0x80}, nil, "sei payload size 16 > remaining 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAvcSei(tt.nal, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseAvcSei err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAvcSei failed, err:%v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseAvcSei = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAvcPicTiming(t *testing.T) {
+	hrd := &AvcSps{CpbDpbDelaysPresent: true, CpbRemovalDelayLength: 24, DpbOutputDelayLength: 24, PicStructPresent: true, TimeOffsetLength: 24}
+	picStruct := &AvcSps{PicStructPresent: true}
+
+	tests := []struct {
+		name          string
+		sps           *AvcSps
+		payload       []byte
+		want          *AvcPicTiming
+		wantTimecodes []string
+		wantErr       string
+	}{
+		{"full timestamp", hrd, bitFields(
+			2, 24, 4, 24, // cpb_removal_delay, dpb_output_delay
+			0, 4, 1, 1, // pic_struct frame, clock_timestamp_flag
+			0, 2, 0, 1, 4, 5, // ct_type, nuit_field_based_flag, counting_type
+			1, 1, 0, 1, 1, 1, // full_timestamp_flag, discontinuity_flag, cnt_dropped_flag
+			29, 8, 59, 6, 9, 6, 1, 5, // n_frames, seconds, minutes, hours
+			0, 24, // time_offset
+		), &AvcPicTiming{CpbRemovalDelay: 2, DpbOutputDelay: 4, PicStruct: 0,
+			Timecodes: []AvcTimecode{{Hours: 1, Minutes: 9, Seconds: 59, Frames: 29, DropFrame: true}},
+		}, []string{"01:09:59;29"}, ""},
+		// frame doubling has two clock timestamps, the first is absent, the
+		// second stops after the minutes
+		{"seconds and minutes flags", picStruct, bitFields(
+			7, 4,
+			0, 1,
+			1, 1, 0, 2, 0, 1, 0, 5, 0, 1, 0, 1, 0, 1,
+			5, 8, 1, 1, 10, 6, 1, 1, 2, 6, 0, 1, // n_frames, seconds_flag, seconds, minutes_flag, minutes, hours_flag
+		), &AvcPicTiming{PicStruct: 7,
+			Timecodes: []AvcTimecode{{Minutes: 2, Seconds: 10, Frames: 5}},
+		}, []string{"00:02:10:05"}, ""},
+		{"frames only", picStruct, bitFields(0, 4, 1, 1, 0, 2, 0, 1, 0, 5, 0, 1, 0, 1, 0, 1, 12, 8, 0, 1),
+			&AvcPicTiming{Timecodes: []AvcTimecode{{Frames: 12}}}, []string{"00:00:00:12"}, ""},
+		{"no pic_struct", &AvcSps{CpbDpbDelaysPresent: true, CpbRemovalDelayLength: 8, DpbOutputDelayLength: 8}, []byte{0x01, 0x02},
+			&AvcPicTiming{CpbRemovalDelay: 1, DpbOutputDelay: 2}, nil, ""},
+		{"reserved pic_struct", picStruct, bitFields(9, 4), nil, nil, "pic_struct 9 is reserved"},
+		{"n_frames past the end", picStruct, bitFields(0, 4, 1, 1, 0, 2, 0, 1, 0, 5, 1, 1, 0, 1, 0, 1), nil, nil, "n_frames: read 8 bits with 0 bits left"},
+		{"time_offset past the end", hrd, bitFields(2, 24, 4, 24, 0, 4, 1, 1, 0, 2, 0, 1, 4, 5, 1, 1, 0, 1, 1, 1, 29, 8, 59, 6, 9, 6, 1, 5),
+			nil, nil, "time_offset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAvcPicTiming(tt.payload, tt.sps)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseAvcPicTiming err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAvcPicTiming failed, err:%v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseAvcPicTiming = %+v, want %+v", got, tt.want)
+			}
+			var timecodes []string
+			for _, tc := range got.Timecodes {
+				timecodes = append(timecodes, tc.String())
+			}
+			if !reflect.DeepEqual(timecodes, tt.wantTimecodes) {
+				t.Fatalf("timecodes = %q, want %q", timecodes, tt.wantTimecodes)
+			}
+		})
+	}
+}
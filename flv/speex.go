@@ -0,0 +1,81 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Speex in FLV is always 16 kHz mono wideband with 20 ms frames
+	speexSampleRate   = 16000
+	speexFrameSamples = 320
+	speexModeWideband = 1
+	speexHeaderSize   = 80
+	speexOggSerial    = 0x53706578
+)
+
+// speexHeader builds the Ogg Speex identification header
+func speexHeader() []byte {
+	header := make([]byte, speexHeaderSize)
+	copy(header[0:8], "Speex   ")
+	copy(header[8:28], "1.2")
+	fields := []int32{
+		1,                 // speex_version_id
+		speexHeaderSize,   // header_size
+		speexSampleRate,   // rate
+		speexModeWideband, // mode
+		4,                 // mode_bitstream_version
+		1,                 // nb_channels
+		-1,                // bitrate
+		speexFrameSamples, // frame_size
+		0,                 // vbr
+		1,                 // frames_per_packet
+		0,                 // extra_headers
+	}
+	for i, v := range fields {
+		binary.LittleEndian.PutUint32(header[28+4*i:], uint32(v))
+	}
+	return header
+}
+
+// parseSpeexAudioData writes the packets into ./test.spx. The granule position
+// of a packet comes from the tag timestamp, so gaps in the recording are kept.
+func (f *Flv) parseSpeexAudioData(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	packet := buf[index:end]
+	f.printf("speex packet size is %v\n", len(packet))
+
+	if f.DisableExtract || len(packet) == 0 {
+		return end, nil
+	}
+
+	var err error
+	if f.speexFile == nil {
+		f.speexFile, err = newOggWriter(f.trackFileName("./test.spx"), speexOggSerial)
+		if err != nil {
+			return 0, fmt.Errorf("newOggWriter failed, err:%v", err)
+		}
+		f.speexFirstTimestamp = f.CurrentTag.NormalizedTimestamp
+		f.speexGranule = 0
+
+		if err = f.speexFile.WritePacket(speexHeader(), 0); err != nil {
+			return 0, fmt.Errorf("speexFile.WritePacket failed, err:%v", err)
+		}
+		if err = f.speexFile.WritePacket(oggVorbisComment(""), 0); err != nil {
+			return 0, fmt.Errorf("speexFile.WritePacket failed, err:%v", err)
+		}
+	}
+
+	// the granule is the end of the packet and never goes backwards, also not
+	// for a timestamp before the first one
+	granule := (f.CurrentTag.NormalizedTimestamp-f.speexFirstTimestamp)*speexSampleRate/1000 + speexFrameSamples
+	if granule < f.speexGranule+speexFrameSamples {
+		granule = f.speexGranule + speexFrameSamples
+	}
+	f.speexGranule = granule
+	if err = f.speexFile.WritePacket(packet, granule); err != nil {
+		return 0, fmt.Errorf("speexFile.WritePacket failed, err:%v", err)
+	}
+
+	return end, nil
+}
@@ -0,0 +1,88 @@
+package flv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSpeexHeader(t *testing.T) {
+	want := []byte{
+		'S', 'p', 'e', 'e', 'x', ' ', ' ', ' ',
+		'1', '.', '2', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x01, 0x00, 0x00, 0x00, // speex_version_id
+		0x50, 0x00, 0x00, 0x00, // header_size 80
+		0x80, 0x3E, 0x00, 0x00, // rate 16000
+		0x01, 0x00, 0x00, 0x00, // mode wideband
+		0x04, 0x00, 0x00, 0x00, // mode_bitstream_version
+		0x01, 0x00, 0x00, 0x00, // nb_channels
+		0xFF, 0xFF, 0xFF, 0xFF, // bitrate unknown
+		0x40, 0x01, 0x00, 0x00, // frame_size 320
+		0x00, 0x00, 0x00, 0x00, // vbr
+		0x01, 0x00, 0x00, 0x00, // frames_per_packet
+		0x00, 0x00, 0x00, 0x00, // extra_headers
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // reserved
+	}
+	if got := speexHeader(); !bytes.Equal(got, want) {
+		t.Fatalf("speexHeader = %x, want %x", got, want)
+	}
+}
+
+func TestParseSpeexAudioData(t *testing.T) {
+	inTempDir(t)
+
+	tags := []struct {
+		timestamp int64
+		packet    []byte
+	}{
+		{1000, []byte{0x01}},
+		{1020, []byte{0x02, 0x02}},
+		{1040, []byte{0x03}},
+		{1100, []byte{0x04}}, // 40 ms lost
+		{1090, []byte{0x05}}, // backwards
+		{1120, nil},          // empty tags are skipped
+	}
+	f := &Flv{Quiet: true}
+	for _, tag := range tags {
+		buf := append([]byte{0xB2}, tag.packet...)
+		f.CurrentTag = &CurrentTag{Length: len(buf), NormalizedTimestamp: tag.timestamp}
+		if _, err := f.parseSpeexAudioData(buf, 1); err != nil {
+			t.Fatalf("parseSpeexAudioData failed, err:%v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("f.Close failed, err:%v", err)
+	}
+
+	data, err := ioutil.ReadFile("test.spx")
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+	}
+	pages := readOggPages(t, data)
+	want := []struct {
+		headerType byte
+		granule    int64
+		data       []byte
+	}{
+		{oggHeaderTypeBos, 0, speexHeader()},
+		{0, 0, append([]byte{0x08, 0x00, 0x00, 0x00}, "flvParse\x00\x00\x00\x00"...)},
+		// the end of the packet at 16 samples per ms, 320 samples per packet
+		{0, 320, []byte{0x01}},
+		{0, 640, []byte{0x02, 0x02}},
+		{0, 960, []byte{0x03}},
+		{0, 1920, []byte{0x04}},
+		{oggHeaderTypeEos, 2240, []byte{0x05}},
+	}
+	if len(pages) != len(want) {
+		t.Fatalf("pages = %v, want %v", len(pages), len(want))
+	}
+	for i, page := range pages {
+		if page.serial != speexOggSerial || page.sequence != uint32(i) {
+			t.Fatalf("page %v serial %x sequence %v", i, page.serial, page.sequence)
+		}
+		if page.headerType != want[i].headerType || page.granule != want[i].granule || !bytes.Equal(page.data, want[i].data) {
+			t.Fatalf("page %v = type %v granule %v data %x, want type %v granule %v data %x",
+				i, page.headerType, page.granule, page.data, want[i].headerType, want[i].granule, want[i].data)
+		}
+	}
+}
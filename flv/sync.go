@@ -0,0 +1,186 @@
+package flv
+
+import "encoding/json"
+
+// DefaultSyncMissingThreshold is how long in ms a track may have no tags while
+// the other one goes on before it counts as missing
+const DefaultSyncMissingThreshold = 1000
+
+// SyncReport describes the interleaving of the audio and video tags. Times are
+// in ms on the normalized timeline, a positive lead is audio ahead of video.
+type SyncReport struct {
+	AudioTags int `json:"audioTags"`
+	VideoTags int `json:"videoTags"`
+
+	FirstAudioTimestamp *int64 `json:"firstAudioTimestamp"`
+	FirstVideoTimestamp *int64 `json:"firstVideoTimestamp"`
+	// StartOffset is the first video minus the first audio timestamp
+	StartOffset *int64 `json:"startOffset"`
+
+	MaxAudioLead int64 `json:"maxAudioLead"`
+	MaxAudioLag  int64 `json:"maxAudioLag"`
+	// EndDrift is the lead at the last tag
+	EndDrift int64 `json:"endDrift"`
+
+	// MaxInterleaveBytes and MaxInterleaveMs are the longest run of tags of one
+	// track without a tag of the other one
+	MaxInterleaveBytes int64 `json:"maxInterleaveBytes"`
+	MaxInterleaveMs    int64 `json:"maxInterleaveMs"`
+
+	MissingStretches []SyncMissingStretch `json:"missingStretches"`
+}
+
+// SyncMissingStretch is a time range without tags of Track, "audio" or
+// "video", while the other track went on
+type SyncMissingStretch struct {
+	Track    string `json:"track"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Duration int64  `json:"duration"`
+}
+
+// SyncAnalyzer collects the SyncReport from the tags given to AddTag, e.g. as
+// the OnTag callback of the parser
+type SyncAnalyzer struct {
+	// MissingThreshold in ms, 0 means DefaultSyncMissingThreshold
+	MissingThreshold int64
+
+	report SyncReport
+	tracks [2]syncTrack
+
+	runTagType uint8
+	runBytes   int64
+	runStart   int64
+}
+
+// syncTrack compares a track with its own earlier tags only, the timestamps of
+// the two tracks may drift apart without a track missing
+type syncTrack struct {
+	started bool
+	first   int64
+	last    int64
+	// other counts the tags of the other track since the last tag of this one,
+	// otherLast is the last timestamp of the other track at that tag
+	other     int
+	otherLast int64
+}
+
+func (a *SyncAnalyzer) AddTag(tag *CurrentTag) error {
+	if tag.TagType != TagTypeAudio && tag.TagType != TagTypeVideo {
+		return nil
+	}
+
+	timestamp := tag.NormalizedTimestamp
+	t, other := &a.tracks[0], &a.tracks[1]
+	if tag.TagType == TagTypeAudio {
+		a.report.AudioTags++
+	} else {
+		a.report.VideoTags++
+		t, other = other, t
+	}
+
+	threshold := a.MissingThreshold
+	if threshold == 0 {
+		threshold = DefaultSyncMissingThreshold
+	}
+
+	if !t.started {
+		t.started = true
+		t.first = timestamp
+		// the other track went on from here at the earliest
+		other.otherLast = timestamp
+		first := timestamp
+		if tag.TagType == TagTypeAudio {
+			a.report.FirstAudioTimestamp = &first
+		} else {
+			a.report.FirstVideoTimestamp = &first
+		}
+		if other.started {
+			offset := *a.report.FirstVideoTimestamp - *a.report.FirstAudioTimestamp
+			a.report.StartOffset = &offset
+
+			// a track starting late is missing from the start of the other
+			// one, if the other one went on for longer than the threshold
+			if other.last-other.first > threshold {
+				a.report.MissingStretches = appendMissingStretch(a.report.MissingStretches, tag.TagType, other.first, other.last)
+			}
+		}
+	} else if t.other > 0 && timestamp-t.last > threshold {
+		// a gap between two tags of this track with tags of the other one
+		a.report.MissingStretches = appendMissingStretch(a.report.MissingStretches, tag.TagType, t.last, timestamp)
+	}
+	t.last = timestamp
+	t.other = 0
+	t.otherLast = other.last
+	other.other++
+
+	// a run is the tags of one track in a row, its bytes include PreviousTagSize
+	size := int64(len(tag.Data)) + 4
+	if a.runBytes == 0 || tag.TagType != a.runTagType {
+		a.runTagType = tag.TagType
+		a.runBytes = 0
+		a.runStart = timestamp
+	}
+	a.runBytes += size
+	if a.runBytes > a.report.MaxInterleaveBytes {
+		a.report.MaxInterleaveBytes = a.runBytes
+	}
+	if timestamp-a.runStart > a.report.MaxInterleaveMs {
+		a.report.MaxInterleaveMs = timestamp - a.runStart
+	}
+
+	if a.tracks[0].started && a.tracks[1].started {
+		lead := a.tracks[0].last - a.tracks[1].last
+		if lead > a.report.MaxAudioLead {
+			a.report.MaxAudioLead = lead
+		}
+		if -lead > a.report.MaxAudioLag {
+			a.report.MaxAudioLag = -lead
+		}
+		a.report.EndDrift = lead
+	}
+
+	return nil
+}
+
+func appendMissingStretch(stretches []SyncMissingStretch, tagType uint8, start int64, end int64) []SyncMissingStretch {
+	return append(stretches, SyncMissingStretch{
+		Track:    TagTypeMap[tagType],
+		Start:    start,
+		End:      end,
+		Duration: end - start,
+	})
+}
+
+// Report returns the report up to the last tag. A track that started after
+// the other one went on for more than the threshold is missing from the start,
+// one that stopped while the other one went on for more than the threshold is
+// missing until the end, for as long as the other one went on. A track
+// without any tag is not missing, the stream has only the other one.
+func (a *SyncAnalyzer) Report() *SyncReport {
+	report := a.report
+	report.MissingStretches = append([]SyncMissingStretch(nil), a.report.MissingStretches...)
+
+	threshold := a.MissingThreshold
+	if threshold == 0 {
+		threshold = DefaultSyncMissingThreshold
+	}
+	audio, video := a.tracks[0], a.tracks[1]
+	if audio.started && video.started {
+		if gap := video.last - audio.otherLast; audio.other > 0 && gap > threshold {
+			report.MissingStretches = appendMissingStretch(report.MissingStretches, TagTypeAudio, audio.last, audio.last+gap)
+		}
+		if gap := audio.last - video.otherLast; video.other > 0 && gap > threshold {
+			report.MissingStretches = appendMissingStretch(report.MissingStretches, TagTypeVideo, video.last, video.last+gap)
+		}
+	}
+	if report.MissingStretches == nil {
+		report.MissingStretches = []SyncMissingStretch{}
+	}
+	return &report
+}
+
+// JSON returns the report as indented JSON
+func (a *SyncAnalyzer) JSON() ([]byte, error) {
+	return json.MarshalIndent(a.Report(), "", "  ")
+}
@@ -0,0 +1,153 @@
+package flv
+
+import (
+	"reflect"
+	"testing"
+)
+
+// syncTags feeds audio and video tags of 9 and 45 body bytes to a
+func syncTags(t *testing.T, a *SyncAnalyzer, tags []synthTag) {
+	t.Helper()
+	for _, tag := range tags {
+		size := 9
+		if tag.tagType == TagTypeVideo {
+			size = 45
+		}
+		err := a.AddTag(&CurrentTag{
+			TagType:             tag.tagType,
+			NormalizedTimestamp: int64(tag.timestamp),
+			Data:                make([]byte, 11+size),
+		})
+		if err != nil {
+			t.Fatalf("a.AddTag failed, err:%v", err)
+		}
+	}
+}
+
+func TestSyncAnalyzerJSON(t *testing.T) {
+	audio := func(timestamp uint32) synthTag { return synthTag{TagTypeAudio, timestamp, nil} }
+	video := func(timestamp uint32) synthTag { return synthTag{TagTypeVideo, timestamp, nil} }
+
+	tests := []struct {
+		name string
+		tags []synthTag
+		want string
+	}{
+		{"interleaved with an audio gap and video ending early", []synthTag{
+			// video starts 40 ms after audio, audio leads by up to 60 ms and
+			// lags by up to 40 ms while both go on
+			audio(0), video(40), audio(100), video(80), video(120), audio(140),
+			// audio is missing from 140 to 1300 while video goes on, lagging
+			// by up to 1100 ms
+			video(160), video(1200), video(1240), audio(1300),
+			video(1280), audio(1320),
+			// video ends at 1280, audio goes on for 1120 ms from 1300 and
+			// leads by 1140 ms at the end
+			audio(2400), audio(2420),
+			{TagTypeScriptData, 2420, nil},
+		}, `{
+  "audioTags": 7,
+  "videoTags": 7,
+  "firstAudioTimestamp": 0,
+  "firstVideoTimestamp": 40,
+  "startOffset": 40,
+  "maxAudioLead": 1140,
+  "maxAudioLag": 1100,
+  "endDrift": 1140,
+  "maxInterleaveBytes": 180,
+  "maxInterleaveMs": 1100,
+  "missingStretches": [
+    {
+      "track": "audio",
+      "start": 140,
+      "end": 1300,
+      "duration": 1160
+    },
+    {
+      "track": "video",
+      "start": 1280,
+      "end": 2400,
+      "duration": 1120
+    }
+  ]
+}`},
+		{"video starts late", []synthTag{
+			audio(0), audio(500), audio(1000), audio(1500), video(1500), audio(1520), video(1540),
+		}, `{
+  "audioTags": 5,
+  "videoTags": 2,
+  "firstAudioTimestamp": 0,
+  "firstVideoTimestamp": 1500,
+  "startOffset": 1500,
+  "maxAudioLead": 20,
+  "maxAudioLag": 20,
+  "endDrift": -20,
+  "maxInterleaveBytes": 96,
+  "maxInterleaveMs": 1500,
+  "missingStretches": [
+    {
+      "track": "video",
+      "start": 0,
+      "end": 1500,
+      "duration": 1500
+    }
+  ]
+}`},
+		{"audio only", []synthTag{audio(0), audio(5000)}, `{
+  "audioTags": 2,
+  "videoTags": 0,
+  "firstAudioTimestamp": 0,
+  "firstVideoTimestamp": null,
+  "startOffset": null,
+  "maxAudioLead": 0,
+  "maxAudioLag": 0,
+  "endDrift": 0,
+  "maxInterleaveBytes": 48,
+  "maxInterleaveMs": 5000,
+  "missingStretches": []
+}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := new(SyncAnalyzer)
+			syncTags(t, a, tt.tags)
+			got, err := a.JSON()
+			if err != nil {
+				t.Fatalf("a.JSON failed, err:%v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("JSON =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncAnalyzerDrift(t *testing.T) {
+	// interleaved tags of 40 ms video frames, audio drifts 20 ms ahead per
+	// frame up to 3980 ms, neither track has a gap
+	var tags []synthTag
+	for i := uint32(0); i < 200; i++ {
+		tags = append(tags, synthTag{TagTypeVideo, 40 * i, nil}, synthTag{TagTypeAudio, 60 * i, nil})
+	}
+	a := new(SyncAnalyzer)
+	syncTags(t, a, tags)
+
+	report := a.Report()
+	// the lag is the video tag of 40 ms before the audio tag of 0
+	if report.MaxAudioLead != 3980 || report.MaxAudioLag != 40 || report.EndDrift != 3980 {
+		t.Fatalf("maxAudioLead %v maxAudioLag %v endDrift %v, want 3980 40 3980", report.MaxAudioLead, report.MaxAudioLag, report.EndDrift)
+	}
+	if len(report.MissingStretches) != 0 {
+		t.Fatalf("missingStretches = %+v, want none", report.MissingStretches)
+	}
+
+	// a video gap of 1200 ms while audio goes on is still missing
+	a = new(SyncAnalyzer)
+	syncTags(t, a, append(tags,
+		synthTag{TagTypeAudio, 12000, nil}, synthTag{TagTypeAudio, 12600, nil},
+		synthTag{TagTypeVideo, 9160, nil}, synthTag{TagTypeAudio, 12640, nil}))
+	want := []SyncMissingStretch{{Track: "video", Start: 7960, End: 9160, Duration: 1200}}
+	if got := a.Report().MissingStretches; !reflect.DeepEqual(got, want) {
+		t.Fatalf("missingStretches = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package flv
+
+// DefaultBackwardJumpTolerance is how far the timestamps of interleaved audio
+// and video tags may step back without being taken as a discontinuity
+const DefaultBackwardJumpTolerance = 1000
+
+// TimestampNormalizer maps the 32-bit millisecond tag timestamps onto a 64-bit
+// timeline. The 32-bit timestamps wrap after about 49.7 days of a live
+// recording, a wrap continues the timeline. A step back further than the
+// tolerance, e.g. an encoder restart, is rebased to continue from the previous
+// tag. NormalizeTrack keeps the positions of each track from going back.
+type TimestampNormalizer struct {
+	// BackwardJumpTolerance in ms, 0 means DefaultBackwardJumpTolerance
+	BackwardJumpTolerance int64
+
+	Wraps         int
+	BackwardJumps int
+	// TrackStepsBack counts the track timestamps held at the last position of
+	// their track
+	TrackStepsBack int
+
+	started bool
+	last    uint32
+	current int64
+	tracks  map[uint8]int64
+}
+
+// Normalize returns the position of timestamp on the timeline
+func (n *TimestampNormalizer) Normalize(timestamp uint32) int64 {
+	if !n.started {
+		n.started = true
+		n.last = timestamp
+		n.current = int64(timestamp)
+		return n.current
+	}
+
+	// the difference modulo 2^32 is the shorter way around a wrap
+	delta := int64(int32(timestamp - n.last))
+	if timestamp < n.last && delta > 0 {
+		n.Wraps++
+	}
+
+	tolerance := n.BackwardJumpTolerance
+	if tolerance == 0 {
+		tolerance = DefaultBackwardJumpTolerance
+	}
+	if delta < -tolerance {
+		n.BackwardJumps++
+		delta = 0
+	}
+
+	n.last = timestamp
+	n.current += delta
+	return n.current
+}
+
+// NormalizeTrack returns the position of a timestamp of track, e.g. the tag
+// type, on the timeline. The timeline may step back inside the tolerance
+// between interleaved tracks, a step back within one track keeps the last
+// position of the track.
+func (n *TimestampNormalizer) NormalizeTrack(track uint8, timestamp uint32) int64 {
+	position := n.Normalize(timestamp)
+	if n.tracks == nil {
+		n.tracks = make(map[uint8]int64)
+	}
+	if last, ok := n.tracks[track]; ok && position < last {
+		n.TrackStepsBack++
+		position = last
+	}
+	n.tracks[track] = position
+	return position
+}
+
+// Current returns the timeline position of the last normalized timestamp
+func (n *TimestampNormalizer) Current() int64 {
+	return n.current
+}
+
+// normalizeTimestamp puts audio and video tags on f.Timeline, each of them
+// monotonic. Script data like a repeated onMetaData often restarts at 0, it
+// takes the current position.
+func (f *Flv) normalizeTimestamp() {
+	wraps, backwardJumps, stepsBack := f.Timeline.Wraps, f.Timeline.BackwardJumps, f.Timeline.TrackStepsBack
+	if f.CurrentTag.TagType == TagTypeScriptData {
+		f.CurrentTag.NormalizedTimestamp = f.Timeline.Current()
+	} else {
+		f.CurrentTag.NormalizedTimestamp = f.Timeline.NormalizeTrack(f.CurrentTag.TagType, f.CurrentTag.Timestamp)
+	}
+	f.printf("NormalizedTimestamp is %v\n", f.CurrentTag.NormalizedTimestamp)
+
+	if f.Timeline.Wraps != wraps {
+		f.printf("timestamp wrapped around 2^32 ms\n")
+	}
+	if f.Timeline.BackwardJumps != backwardJumps {
+		f.printf("timestamp jumped back, rebased the timeline\n")
+	}
+	if f.Timeline.TrackStepsBack != stepsBack {
+		f.printf("timestamp stepped back within the track, kept at %v\n", f.CurrentTag.NormalizedTimestamp)
+	}
+}
@@ -0,0 +1,90 @@
+package flv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTimestampNormalizer(t *testing.T) {
+	tests := []struct {
+		name          string
+		tolerance     int64
+		timestamps    []uint32
+		want          []int64
+		wraps         int
+		backwardJumps int
+		monotonic     bool
+	}{
+		{"increasing", 0, []uint32{0, 40, 80}, []int64{0, 40, 80}, 0, 0, true},
+		{"starts late", 0, []uint32{5000, 5040}, []int64{5000, 5040}, 0, 0, true},
+		{"wrap", 0,
+			[]uint32{0xFFFFFE00, 0xFFFFFF00, 0x00000100, 0x00000200},
+			[]int64{0xFFFFFE00, 0xFFFFFF00, 0x100000100, 0x100000200}, 1, 0, true},
+		{"wrap twice", 0,
+			[]uint32{0xFFFFFF00, 0x00000100, 0x7FFFFF00, 0xFFFFFE00, 0x00000100},
+			[]int64{0xFFFFFF00, 0x100000100, 0x17FFFFF00, 0x1FFFFFE00, 0x200000100}, 2, 0, true},
+		// interleaved audio and video, the step back is kept
+		{"step back inside the tolerance", 0, []uint32{1000, 1040, 1020, 1080}, []int64{1000, 1040, 1020, 1080}, 0, 0, false},
+		{"step back of exactly the tolerance", 0, []uint32{5000, 4000, 4040}, []int64{5000, 4000, 4040}, 0, 0, false},
+		// an encoder restart continues from the previous tag
+		{"step back beyond the tolerance", 0, []uint32{5000, 5040, 0, 40, 80}, []int64{5000, 5040, 5040, 5080, 5120}, 0, 1, true},
+		{"smaller tolerance", 100, []uint32{1000, 1040, 900, 940}, []int64{1000, 1040, 1040, 1080}, 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &TimestampNormalizer{BackwardJumpTolerance: tt.tolerance}
+			var got []int64
+			for _, timestamp := range tt.timestamps {
+				got = append(got, n.Normalize(timestamp))
+				if n.Current() != got[len(got)-1] {
+					t.Fatalf("Current() = %v, want %v", n.Current(), got[len(got)-1])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Normalize = %#x, want %#x", got, tt.want)
+			}
+			if n.Wraps != tt.wraps || n.BackwardJumps != tt.backwardJumps {
+				t.Fatalf("Wraps %v BackwardJumps %v, want %v %v", n.Wraps, n.BackwardJumps, tt.wraps, tt.backwardJumps)
+			}
+			if tt.monotonic {
+				for i := 1; i < len(got); i++ {
+					if got[i] < got[i-1] {
+						t.Fatalf("Normalize went back from %v to %v", got[i-1], got[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTimestampNormalizerTrack(t *testing.T) {
+	// interleaved audio and video stepping back by jitter and an encoder
+	// restart
+	tags := []struct {
+		track     uint8
+		timestamp uint32
+		want      int64
+	}{
+		{TagTypeVideo, 1000, 1000},
+		{TagTypeAudio, 990, 990},
+		{TagTypeVideo, 1040, 1040},
+		{TagTypeAudio, 1030, 1030},
+		{TagTypeVideo, 1020, 1040}, // held at the last video position
+		{TagTypeAudio, 1050, 1050},
+		{TagTypeVideo, 1080, 1080},
+		{TagTypeAudio, 0, 1080}, // restart, rebased
+		{TagTypeVideo, 10, 1090},
+		{TagTypeAudio, 20, 1100},
+		{TagTypeVideo, 5, 1090}, // 1085 on the timeline
+		{TagTypeAudio, 30, 1110},
+	}
+	n := new(TimestampNormalizer)
+	for i, tag := range tags {
+		if got := n.NormalizeTrack(tag.track, tag.timestamp); got != tag.want {
+			t.Fatalf("tag %v: NormalizeTrack(%v, %#x) = %v, want %v", i, tag.track, tag.timestamp, got, tag.want)
+		}
+	}
+	if n.BackwardJumps != 1 || n.TrackStepsBack != 2 {
+		t.Fatalf("BackwardJumps %v TrackStepsBack %v, want 1 2", n.BackwardJumps, n.TrackStepsBack)
+	}
+}
@@ -0,0 +1,158 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+)
+
+const (
+	Vp6HorizontalAdjustmentMark byte = 0b11110000
+	Vp6VerticalAdjustmentMark   byte = 0b00001111
+
+	vp6MacroblockSize = 16
+	vp6MaxSubVersion  = 8
+)
+
+// Vp6FrameHeader is the FLV adjustment and the start of the VP6 frame header.
+// The dimensions are only present in key frames.
+type Vp6FrameHeader struct {
+	HorizontalAdjustment uint8
+	VerticalAdjustment   uint8
+	OffsetToAlpha        uint32 // VP6 with alpha channel only
+	AlphaDataLength      int
+
+	KeyFrame       bool
+	Quantizer      uint8
+	SeparatedCoeff bool
+	SubVersion     uint8
+	FilterHeader   uint8
+	Interlaced     bool
+	CoeffOffset    uint16
+	MacroblockRows uint8
+	MacroblockCols uint8
+	DisplayRows    uint8
+	DisplayCols    uint8
+	Width          uint16 // the displayed size minus the adjustment
+	Height         uint16
+}
+
+func (f *Flv) parseVp6VideoPacket(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	withAlpha := f.CurrentTag.CodeId == CodecIDOn2Vp6WithAlphaChannel
+
+	if end-index < 1 {
+		return 0, fmt.Errorf("VP6 adjustment len %v < 1", end-index)
+	}
+	header := new(Vp6FrameHeader)
+	header.HorizontalAdjustment = (buf[index] & Vp6HorizontalAdjustmentMark) >> 4
+	header.VerticalAdjustment = buf[index] & Vp6VerticalAdjustmentMark
+	index += 1
+	f.printf("vp6 horizontalAdjustment is %v\n", header.HorizontalAdjustment)
+	f.printf("vp6 verticalAdjustment is %v\n", header.VerticalAdjustment)
+
+	// the ivf frames keep OffsetToAlpha, the VP6 alpha decoders expect it
+	frame := buf[index:end]
+	colorData := frame
+	if withAlpha {
+		if end-index < 3 {
+			return 0, fmt.Errorf("OffsetToAlpha len %v < 3", end-index)
+		}
+		offsetToAlpha, err := util.BytesToUint32ByBigEndian(buf[index : index+3])
+		if err != nil {
+			return 0, fmt.Errorf("util.BytesToUint32ByBigEndian failed, err:%v", err)
+		}
+		index += 3
+		if end-index < int(offsetToAlpha) {
+			return 0, fmt.Errorf("OffsetToAlpha %v > remaining %v", offsetToAlpha, end-index)
+		}
+		header.OffsetToAlpha = offsetToAlpha
+		colorData = buf[index : index+int(offsetToAlpha)]
+		header.AlphaDataLength = end - index - int(offsetToAlpha)
+		f.printf("vp6 offsetToAlpha is %v, alpha data size is %v\n", offsetToAlpha, header.AlphaDataLength)
+	}
+
+	if err := parseVp6FrameHeader(colorData, header); err != nil {
+		return 0, fmt.Errorf("parseVp6FrameHeader failed, err:%v", err)
+	}
+	f.CurrentTag.Vp6Header = header
+
+	f.printf("vp6 keyFrame is %v\n", header.KeyFrame)
+	f.printf("vp6 quantizer is %v\n", header.Quantizer)
+	if header.KeyFrame {
+		f.VideoWidth, f.VideoHeight = header.Width, header.Height
+		f.printf("vp6 subVersion is %v\n", header.SubVersion)
+		f.printf("vp6 macroblocks are %vx%v, displayed %vx%v\n",
+			header.MacroblockCols, header.MacroblockRows, header.DisplayCols, header.DisplayRows)
+		f.printf("vp6 picture size is %vx%v\n", header.Width, header.Height)
+	}
+
+	w, name, fourCC := &f.vp6IvfFile, "./test.vp6.ivf", "VP6F"
+	if withAlpha {
+		w, name, fourCC = &f.vp6aIvfFile, "./test.vp6a.ivf", "VP6A"
+	}
+	if err := f.openIvfWriter(w, name, fourCC); err != nil {
+		return 0, fmt.Errorf("f.openIvfWriter failed, err:%v", err)
+	}
+	if *w != nil {
+		if (*w).Width == 0 {
+			(*w).Width, (*w).Height = f.VideoWidth, f.VideoHeight
+		}
+		if err := (*w).WriteFrame(uint64(f.CurrentTag.Timestamp), frame); err != nil {
+			return 0, fmt.Errorf("ivfWriter.WriteFrame failed, err:%v", err)
+		}
+	}
+
+	return end, nil
+}
+
+func parseVp6FrameHeader(data []byte, header *Vp6FrameHeader) error {
+	if len(data) < 1 {
+		return fmt.Errorf("empty VP6 frame")
+	}
+
+	header.KeyFrame = data[0]&0x80 == 0
+	header.Quantizer = (data[0] >> 1) & 0x3F
+	header.SeparatedCoeff = data[0]&0x01 == 1
+	if !header.KeyFrame {
+		return nil
+	}
+
+	if len(data) < 2 {
+		return fmt.Errorf("VP6 key frame header len %v < 2", len(data))
+	}
+	header.SubVersion = data[1] >> 3
+	if header.SubVersion > vp6MaxSubVersion {
+		return fmt.Errorf("VP6 sub version %v > %v", header.SubVersion, vp6MaxSubVersion)
+	}
+	header.FilterHeader = (data[1] >> 1) & 0b11
+	header.Interlaced = data[1]&0x01 == 1
+
+	data = data[2:]
+	if header.SeparatedCoeff || header.FilterHeader == 0 {
+		if len(data) < 2 {
+			return fmt.Errorf("VP6 coeff offset len %v < 2", len(data))
+		}
+		coeffOffset, err := util.BytesToUint16ByBigEndian(data[0:2])
+		if err != nil {
+			return fmt.Errorf("util.BytesToUint16ByBigEndian failed, err:%v", err)
+		}
+		header.CoeffOffset = coeffOffset
+		data = data[2:]
+	}
+
+	if len(data) < 4 {
+		return fmt.Errorf("VP6 dimensions len %v < 4", len(data))
+	}
+	header.MacroblockRows = data[0]
+	header.MacroblockCols = data[1]
+	header.DisplayRows = data[2]
+	header.DisplayCols = data[3]
+	width := int(header.DisplayCols)*vp6MacroblockSize - int(header.HorizontalAdjustment)
+	height := int(header.DisplayRows)*vp6MacroblockSize - int(header.VerticalAdjustment)
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("VP6 picture size %vx%v is illegal", width, height)
+	}
+	header.Width, header.Height = uint16(width), uint16(height)
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// vp6KeyFrame is a quantizer 20 key frame header with 20x15 macroblocks, the
+// start of the frame data follows
+func vp6KeyFrame() []byte {
+	return []byte{
+		0x28,                   // key frame, quantizer 20, no separated coefficients
+		0x46,                   // sub version 8, filter header 3, progressive
+		0x0F, 0x14, 0x0F, 0x14, // 15 rows and 20 columns coded and displayed
+		0xAA, 0xBB,
+	}
+}
+
+func TestParseVp6FrameHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		adjustment uint8
+		data       []byte
+		want       Vp6FrameHeader
+		wantErr    string
+	}{
+		{"key frame", 0, vp6KeyFrame(), Vp6FrameHeader{
+			KeyFrame: true, Quantizer: 20, SubVersion: 8, FilterHeader: 3,
+			MacroblockRows: 15, MacroblockCols: 20, DisplayRows: 15, DisplayCols: 20, Width: 320, Height: 240,
+		}, ""},
+		{"key frame with adjustment", 0x42, vp6KeyFrame(), Vp6FrameHeader{
+			HorizontalAdjustment: 4, VerticalAdjustment: 2,
+			KeyFrame: true, Quantizer: 20, SubVersion: 8, FilterHeader: 3,
+			MacroblockRows: 15, MacroblockCols: 20, DisplayRows: 15, DisplayCols: 20, Width: 316, Height: 238,
+		}, ""},
+		{"separated coefficients", 0, []byte{0x29, 0x47, 0x01, 0x00, 0x0F, 0x14, 0x0F, 0x14}, Vp6FrameHeader{
+			KeyFrame: true, Quantizer: 20, SeparatedCoeff: true, SubVersion: 8, FilterHeader: 3, Interlaced: true,
+			CoeffOffset: 256, MacroblockRows: 15, MacroblockCols: 20, DisplayRows: 15, DisplayCols: 20, Width: 320, Height: 240,
+		}, ""},
+		{"no filter header", 0, []byte{0x28, 0x30, 0x00, 0x80, 0x09, 0x0B, 0x09, 0x0B}, Vp6FrameHeader{
+			KeyFrame: true, Quantizer: 20, SubVersion: 6,
+			CoeffOffset: 128, MacroblockRows: 9, MacroblockCols: 11, DisplayRows: 9, DisplayCols: 11, Width: 176, Height: 144,
+		}, ""},
+		{"inter frame", 0, []byte{0x80 | 33<<1, 0xAA}, Vp6FrameHeader{Quantizer: 33}, ""},
+		{"empty", 0, nil, Vp6FrameHeader{}, "empty VP6 frame"},
+		{"key frame without sub version", 0, []byte{0x28}, Vp6FrameHeader{}, "VP6 key frame header len 1 < 2"},
+		{"sub version 9", 0, []byte{0x28, 0x4E, 0x0F, 0x14, 0x0F, 0x14}, Vp6FrameHeader{}, "VP6 sub version 9 > 8"},
+		{"truncated coefficient offset", 0, []byte{0x29, 0x46, 0x01}, Vp6FrameHeader{}, "VP6 coeff offset len 1 < 2"},
+		{"truncated dimensions", 0, vp6KeyFrame()[:5], Vp6FrameHeader{}, "VP6 dimensions len 3 < 4"},
+		{"adjustment larger than the picture", 0xF0, []byte{0x28, 0x46, 0x01, 0x01, 0x01, 0x00}, Vp6FrameHeader{}, "VP6 picture size -15x16 is illegal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := &Vp6FrameHeader{HorizontalAdjustment: tt.adjustment >> 4, VerticalAdjustment: tt.adjustment & 0x0F}
+			err := parseVp6FrameHeader(tt.data, header)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseVp6FrameHeader err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVp6FrameHeader failed, err:%v", err)
+			}
+			if !reflect.DeepEqual(*header, tt.want) {
+				t.Fatalf("parseVp6FrameHeader = %+v, want %+v", *header, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVp6AlphaVideoPacket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vp6")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed, err:%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	color := vp6KeyFrame()
+	alpha := []byte{0x28, 0x46, 0x0F, 0x14, 0x0F, 0x14, 0xCC}
+	// adjustment, OffsetToAlpha, the color frame, the alpha frame
+	frame := append([]byte{0x00, 0x00, byte(len(color))}, color...)
+	frame = append(frame, alpha...)
+	buf := append([]byte{0x42}, frame...)
+
+	f := tagFlv(buf)
+	f.CurrentTag.CodeId = CodecIDOn2Vp6WithAlphaChannel
+	f.vp6aIvfFile, err = newIvfWriter(filepath.Join(dir, "test.vp6a.ivf"), "VP6A")
+	if err != nil {
+		t.Fatalf("newIvfWriter failed, err:%v", err)
+	}
+	if _, err = f.parseVp6VideoPacket(buf, 0); err != nil {
+		t.Fatalf("parseVp6VideoPacket failed, err:%v", err)
+	}
+	header := f.CurrentTag.Vp6Header
+	if header.OffsetToAlpha != uint32(len(color)) || header.AlphaDataLength != len(alpha) {
+		t.Fatalf("OffsetToAlpha %v AlphaDataLength %v, want %v %v", header.OffsetToAlpha, header.AlphaDataLength, len(color), len(alpha))
+	}
+	if f.VideoWidth != 316 || f.VideoHeight != 238 {
+		t.Fatalf("size = %vx%v, want 316x238", f.VideoWidth, f.VideoHeight)
+	}
+	if err = f.vp6aIvfFile.Close(); err != nil {
+		t.Fatalf("Close failed, err:%v", err)
+	}
+
+	// the ivf frame keeps OffsetToAlpha and the alpha data
+	ivf, err := ioutil.ReadFile(filepath.Join(dir, "test.vp6a.ivf"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+	}
+	if width, height := binary.LittleEndian.Uint16(ivf[12:14]), binary.LittleEndian.Uint16(ivf[14:16]); width != 316 || height != 238 {
+		t.Fatalf("ivf size = %vx%v, want 316x238", width, height)
+	}
+	if got := ivf[ivfHeaderSize+12:]; !bytes.Equal(got, frame) {
+		t.Fatalf("ivf frame = %x, want %x", got, frame)
+	}
+
+	errTests := []struct {
+		name    string
+		buf     []byte
+		wantErr string
+	}{
+		{"no adjustment", nil, "VP6 adjustment len 0 < 1"},
+		{"truncated OffsetToAlpha", []byte{0x00, 0x00, 0x00}, "OffsetToAlpha len 2 < 3"},
+		{"OffsetToAlpha past the end", []byte{0x00, 0x00, 0x00, 0x09, 0x28}, "OffsetToAlpha 9 > remaining 1"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tagFlv(tt.buf)
+			f.CurrentTag.CodeId = CodecIDOn2Vp6WithAlphaChannel
+			if _, err := f.parseVp6VideoPacket(tt.buf, 0); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseVp6VideoPacket err:%v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
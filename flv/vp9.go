@@ -0,0 +1,185 @@
+package flv
+
+import (
+	"flvParse/util"
+	"fmt"
+)
+
+const (
+	vp9FrameMarker   = 2
+	vp9SyncCode      = 0x498342
+	vp9ColorSpaceRgb = 7
+)
+
+type VpCodecConfigurationRecord struct {
+	Profile                 uint8
+	Level                   uint8
+	BitDepth                uint8
+	ChromaSubsampling       uint8
+	VideoFullRangeFlag      uint8
+	ColourPrimaries         uint8
+	TransferCharacteristics uint8
+	MatrixCoefficients      uint8
+	CodecInitializationData []byte
+}
+
+func (f *Flv) parseVp9ExVideoPacket(buf []byte, index int) (int, error) {
+
+	var err error
+
+	switch f.CurrentTag.VideoPacketType {
+	case VideoPacketTypeSequenceStart:
+		index, err = f.parseVpCodecConfigurationRecord(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseVpCodecConfigurationRecord failed, err:%v", err)
+		}
+	case VideoPacketTypeCodedFrames, VideoPacketTypeCodedFramesX:
+		index, err = f.parseVp9Frame(buf, index)
+		if err != nil {
+			return 0, fmt.Errorf("f.parseVp9Frame failed, err:%v", err)
+		}
+	default:
+		index = f.CurrentTag.Length
+	}
+
+	return index, nil
+}
+
+func (f *Flv) parseVpCodecConfigurationRecord(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	if end-index < 12 {
+		return 0, fmt.Errorf("VPCodecConfigurationRecord len %v < 12", end-index)
+	}
+
+	// the record is stored with the vpcC full box version and flags
+	version := buf[index]
+	if version != 1 {
+		return 0, fmt.Errorf("vpcC version != 1, version:%v", version)
+	}
+	f.printf("vpcC version is 1\n")
+	index += 4
+
+	config := new(VpCodecConfigurationRecord)
+	config.Profile = buf[index]
+	config.Level = buf[index+1]
+	config.BitDepth = buf[index+2] >> 4
+	config.ChromaSubsampling = (buf[index+2] >> 1) & 0b111
+	config.VideoFullRangeFlag = buf[index+2] & 0b1
+	config.ColourPrimaries = buf[index+3]
+	config.TransferCharacteristics = buf[index+4]
+	config.MatrixCoefficients = buf[index+5]
+	index += 6
+	f.printf("profile is %v\n", config.Profile)
+	f.printf("level is %v\n", config.Level)
+	f.printf("bitDepth is %v\n", config.BitDepth)
+	f.printf("chromaSubsampling is %v\n", config.ChromaSubsampling)
+	f.printf("videoFullRangeFlag is %v\n", config.VideoFullRangeFlag)
+	f.printf("colourPrimaries is %v, transferCharacteristics is %v, matrixCoefficients is %v\n",
+		config.ColourPrimaries, config.TransferCharacteristics, config.MatrixCoefficients)
+
+	codecInitializationDataSize, err := util.BytesToUint16ByBigEndian(buf[index : index+2])
+	if err != nil {
+		return 0, fmt.Errorf("util.BytesToUint16ByBigEndian failed, err:%v", err)
+	}
+	index += 2
+	if end-index < int(codecInitializationDataSize) {
+		return 0, fmt.Errorf("codecInitializationDataSize %v > remaining %v", codecInitializationDataSize, end-index)
+	}
+	config.CodecInitializationData = append([]byte(nil), buf[index:index+int(codecInitializationDataSize)]...)
+	f.printf("codecInitializationDataSize is %v\n", codecInitializationDataSize)
+
+	f.Vp9Config = config
+	return end, nil
+}
+
+func (f *Flv) parseVp9Frame(buf []byte, index int) (int, error) {
+	end := f.CurrentTag.Length
+	frame := buf[index:end]
+
+	width, height, keyFrame, err := parseVp9UncompressedHeader(frame)
+	if err != nil {
+		return 0, fmt.Errorf("parseVp9UncompressedHeader failed, err:%v", err)
+	}
+	if keyFrame {
+		f.VideoWidth, f.VideoHeight = width, height
+		f.printf("vp9 key frame is %vx%v\n", width, height)
+	}
+	f.printf("vp9 frame size is %v\n", len(frame))
+
+	if err = f.openIvfWriter(&f.vp9IvfFile, "./test.vp9.ivf", "VP90"); err != nil {
+		return 0, fmt.Errorf("f.openIvfWriter failed, err:%v", err)
+	}
+	if f.vp9IvfFile != nil {
+		if f.vp9IvfFile.Width == 0 {
+			f.vp9IvfFile.Width, f.vp9IvfFile.Height = f.VideoWidth, f.VideoHeight
+		}
+		if err = f.vp9IvfFile.WriteFrame(uint64(f.CurrentTag.Timestamp), frame); err != nil {
+			return 0, fmt.Errorf("vp9IvfFile.WriteFrame failed, err:%v", err)
+		}
+	}
+
+	return end, nil
+}
+
+// parseVp9UncompressedHeader reads the frame size of key frames
+func parseVp9UncompressedHeader(frame []byte) (uint16, uint16, bool, error) {
+	r := util.NewBitReader(frame)
+
+	frameMarker, err := r.ReadBits(2)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if frameMarker != vp9FrameMarker {
+		return 0, 0, false, fmt.Errorf("frame_marker != 2, frame_marker:%v", frameMarker)
+	}
+	profileLowBit, _ := r.ReadBits(1)
+	profileHighBit, _ := r.ReadBits(1)
+	profile := profileHighBit<<1 | profileLowBit
+	if profile == 3 {
+		_, _ = r.ReadBits(1)
+	}
+
+	showExistingFrame, _ := r.ReadBits(1)
+	if showExistingFrame == 1 {
+		return 0, 0, false, nil
+	}
+	frameType, _ := r.ReadBits(1)
+	_, _ = r.ReadBits(1)   // show_frame
+	_, err = r.ReadBits(1) // error_resilient_mode
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if frameType != 0 {
+		return 0, 0, false, nil
+	}
+
+	syncCode, err := r.ReadBits(24)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if syncCode != vp9SyncCode {
+		return 0, 0, false, fmt.Errorf("frame_sync_code != 0x498342, frame_sync_code:%x", syncCode)
+	}
+
+	// color_config
+	if profile >= 2 {
+		_, _ = r.ReadBits(1) // ten_or_twelve_bit
+	}
+	colorSpace, _ := r.ReadBits(3)
+	if colorSpace != vp9ColorSpaceRgb {
+		_, _ = r.ReadBits(1) // color_range
+		if profile == 1 || profile == 3 {
+			_ = r.Skip(3) // subsampling_x, subsampling_y, reserved_zero
+		}
+	} else if profile == 1 || profile == 3 {
+		_ = r.Skip(1)
+	}
+
+	widthMinusOne, _ := r.ReadBits(16)
+	heightMinusOne, err := r.ReadBits(16)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return uint16(widthMinusOne + 1), uint16(heightMinusOne + 1), true, nil
+}
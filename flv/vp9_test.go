@@ -0,0 +1,158 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVp9UncompressedHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		frame      []byte
+		wantWidth  uint16
+		wantHeight uint16
+		wantKey    bool
+		wantErr    string
+	}{
+		// the start of a profile 0 640x360 key frame
+		{"profile 0 key frame", []byte{0x82, 0x49, 0x83, 0x42, 0x00, 0x27, 0xF0, 0x16, 0x74}, 640, 360, true, ""},
+		{"profile 1 key frame", bitFields(
+			2, 2, // frame_marker
+			1, 1, 0, 1, // profile_low_bit, profile_high_bit
+			0, 1, // show_existing_frame
+			0, 1, // frame_type
+			1, 1, 0, 1, // show_frame, error_resilient_mode
+			0x498342, 24,
+			1, 3, // color_space BT.601
+			0, 1, // color_range
+			1, 1, 0, 1, 0, 1, // subsampling_x, subsampling_y, reserved_zero
+			1919, 16, 1079, 16,
+		), 1920, 1080, true, ""},
+		{"profile 2 RGB key frame", bitFields(
+			2, 2, 0, 1, 1, 1,
+			0, 1, 0, 1, 1, 1, 0, 1,
+			0x498342, 24,
+			1, 1, // ten_or_twelve_bit
+			vp9ColorSpaceRgb, 3,
+			351, 16, 287, 16,
+		), 352, 288, true, ""},
+		{"profile 3 key frame", bitFields(
+			2, 2, 1, 1, 1, 1,
+			0, 1, // reserved_zero
+			0, 1, 0, 1, 1, 1, 0, 1,
+			0x498342, 24,
+			0, 1, // ten_or_twelve_bit
+			vp9ColorSpaceRgb, 3,
+			0, 1, // reserved_zero
+			175, 16, 143, 16,
+		), 176, 144, true, ""},
+		{"inter frame", bitFields(2, 2, 0, 1, 0, 1, 0, 1, 1, 1, 1, 1, 0, 1), 0, 0, false, ""},
+		{"show existing frame", bitFields(2, 2, 0, 1, 0, 1, 1, 1, 3, 3), 0, 0, false, ""},
+		{"bad frame marker", []byte{0x42, 0x49, 0x83, 0x42}, 0, 0, false, "frame_marker != 2"},
+		{"bad sync code", []byte{0x82, 0x49, 0x83, 0x43, 0x00, 0x27, 0xF0, 0x16, 0x74}, 0, 0, false, "frame_sync_code"},
+		{"truncated size", []byte{0x82, 0x49, 0x83, 0x42, 0x00, 0x27}, 0, 0, false, "read 16 bits with 12 bits left"},
+		{"empty", nil, 0, 0, false, "read 2 bits with 0 bits left"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, keyFrame, err := parseVp9UncompressedHeader(tt.frame)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseVp9UncompressedHeader err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVp9UncompressedHeader failed, err:%v", err)
+			}
+			if width != tt.wantWidth || height != tt.wantHeight || keyFrame != tt.wantKey {
+				t.Fatalf("parseVp9UncompressedHeader = %vx%v key %v, want %vx%v key %v",
+					width, height, keyFrame, tt.wantWidth, tt.wantHeight, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestParseVpCodecConfigurationRecord(t *testing.T) {
+	// vpcC version 1 and flags, profile 0 level 3.1, 8 bit 4:2:0 colocated
+	// limited range, BT.709
+	vpcC, _ := hex.DecodeString("01000000001f8201010100000000")
+
+	f := tagFlv(vpcC)
+	if _, err := f.parseVpCodecConfigurationRecord(vpcC, 0); err != nil {
+		t.Fatalf("parseVpCodecConfigurationRecord failed, err:%v", err)
+	}
+	want := &VpCodecConfigurationRecord{
+		Level:                   31,
+		BitDepth:                8,
+		ChromaSubsampling:       1,
+		ColourPrimaries:         1,
+		TransferCharacteristics: 1,
+		MatrixCoefficients:      1,
+	}
+	if !reflect.DeepEqual(f.Vp9Config, want) {
+		t.Fatalf("Vp9Config = %+v, want %+v", f.Vp9Config, want)
+	}
+
+	errTests := []struct {
+		name    string
+		buf     []byte
+		wantErr string
+	}{
+		{"short", vpcC[:11], "len 11 < 12"},
+		{"version 0", append([]byte{0x00}, vpcC[1:]...), "vpcC version != 1"},
+		{"initialization data past the end", append(append([]byte(nil), vpcC[:10]...), 0x00, 0x02, 0xAA), "codecInitializationDataSize 2 > remaining 1"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tagFlv(tt.buf).parseVpCodecConfigurationRecord(tt.buf, 0); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseVpCodecConfigurationRecord err:%v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIvfWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ivf")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed, err:%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.ivf")
+	w, err := newIvfWriter(name, "VP90")
+	if err != nil {
+		t.Fatalf("newIvfWriter failed, err:%v", err)
+	}
+	w.Width, w.Height = 640, 360
+	if err = w.WriteFrame(0, []byte{0x82, 0x49}); err != nil {
+		t.Fatalf("WriteFrame failed, err:%v", err)
+	}
+	if err = w.WriteFrame(0x0102030405, []byte{0x86}); err != nil {
+		t.Fatalf("WriteFrame failed, err:%v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed, err:%v", err)
+	}
+
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+	}
+	want, _ := hex.DecodeString(strings.Join([]string{
+		// DKIF, version 0, header size 32, VP90, 640x360, 1000/1, 2 frames, unused
+		"444b4946" + "0000" + "2000" + "56503930" + "8002" + "6801" + "e8030000" + "01000000" + "02000000" + "00000000",
+		// frame size and 64 bit pts, little endian
+		"02000000" + "0000000000000000" + "8249",
+		"01000000" + "0504030201000000" + "86",
+	}, ""))
+	if !bytes.Equal(got, want) {
+		t.Fatalf("ivf = %x, want %x", got, want)
+	}
+}
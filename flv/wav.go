@@ -0,0 +1,75 @@
+package flv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	wavHeaderSize    = 44
+	wavFormatTagPcm  = 1
+	wavMaxRiffLength = 0xFFFFFFFF
+)
+
+// wavWriter writes 8-bit unsigned or 16-bit little endian PCM into a WAV file.
+// The RIFF and data sizes are patched into the header on Close.
+type wavWriter struct {
+	file          *os.File
+	SampleRate    uint32
+	Channels      uint16
+	BitsPerSample uint16
+	dataSize      uint32
+}
+
+func newWavWriter(name string, sampleRate uint32, channels uint16, bitsPerSample uint16) (*wavWriter, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile(%q) failed, err:%v", name, err)
+	}
+
+	w := &wavWriter{file: file, SampleRate: sampleRate, Channels: channels, BitsPerSample: bitsPerSample}
+	if _, err = file.Write(w.header()); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("file.Write failed, err:%v", err)
+	}
+	return w, nil
+}
+
+func (w *wavWriter) header() []byte {
+	blockAlign := w.Channels * w.BitsPerSample / 8
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], wavHeaderSize-8+w.dataSize)
+	copy(header[8:12], "WAVE")
+	copy(header[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], wavFormatTagPcm)
+	binary.LittleEndian.PutUint16(header[22:24], w.Channels)
+	binary.LittleEndian.PutUint32(header[24:28], w.SampleRate)
+	binary.LittleEndian.PutUint32(header[28:32], w.SampleRate*uint32(blockAlign))
+	binary.LittleEndian.PutUint16(header[32:34], blockAlign)
+	binary.LittleEndian.PutUint16(header[34:36], w.BitsPerSample)
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], w.dataSize)
+	return header
+}
+
+func (w *wavWriter) Write(samples []byte) error {
+	if uint64(w.dataSize)+uint64(len(samples)) > wavMaxRiffLength-(wavHeaderSize-8) {
+		return fmt.Errorf("wav data exceeds 4 GiB")
+	}
+	if _, err := w.file.Write(samples); err != nil {
+		return fmt.Errorf("w.file.Write failed, err:%v", err)
+	}
+	w.dataSize += uint32(len(samples))
+	return nil
+}
+
+func (w *wavWriter) Close() error {
+	if _, err := w.file.WriteAt(w.header(), 0); err != nil {
+		_ = w.file.Close()
+		return fmt.Errorf("w.file.WriteAt failed, err:%v", err)
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,56 @@
+package flv
+
+import (
+	"fmt"
+	"io"
+)
+
+// WriteHeader writes the FLV header followed by PreviousTagSize0.
+func WriteHeader(w io.Writer, hasAudio bool, hasVideo bool) error {
+	var typeFlags byte
+	if hasAudio {
+		typeFlags |= TypeFlagsAudioMark
+	}
+	if hasVideo {
+		typeFlags |= TypeFlagsVideoMark
+	}
+
+	header := []byte{0x46, 0x4C, 0x56, 0x01, typeFlags, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00}
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("w.Write failed, err:%v", err)
+	}
+
+	return nil
+}
+
+// WriteTag writes one tag with the given body followed by its PreviousTagSize.
+func WriteTag(w io.Writer, tagType uint8, timestamp uint32, body []byte) error {
+	if len(body) > 0xFFFFFF {
+		return fmt.Errorf("tag body too large, len:%v", len(body))
+	}
+
+	dataSize := len(body)
+	tagSize := 11 + dataSize
+
+	buf := make([]byte, 0, tagSize+4)
+	buf = append(buf, tagType&TagTagTypeMark)
+	buf = append(buf, byte(dataSize>>16), byte(dataSize>>8), byte(dataSize))
+	buf = append(buf, byte(timestamp>>16), byte(timestamp>>8), byte(timestamp), byte(timestamp>>24))
+	buf = append(buf, 0x00, 0x00, 0x00)
+	buf = append(buf, body...)
+	buf = append(buf, byte(tagSize>>24), byte(tagSize>>16), byte(tagSize>>8), byte(tagSize))
+
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("w.Write failed, err:%v", err)
+	}
+
+	return nil
+}
+
+// TagBody returns the body of a complete tag as found in CurrentTag.Data.
+func TagBody(data []byte) []byte {
+	if len(data) < 11 {
+		return nil
+	}
+	return data[11:]
+}
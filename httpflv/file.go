@@ -0,0 +1,50 @@
+package httpflv
+
+import (
+	"flvParse/flv"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const fileIdleTimeout = 30 * time.Second
+
+// ServeFile feeds a growing FLV file into the stream key. It keeps reading as
+// the file grows and returns once nothing was appended for fileIdleTimeout.
+func (s *Server) ServeFile(key string, path string) error {
+	flvFile, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("os.Open failed, err:%v", err)
+	}
+	defer flvFile.Close()
+
+	stream := s.AddStream(key)
+	defer s.RemoveStream(stream)
+
+	f := new(flv.Flv)
+	f.Quiet = true
+	f.DisableExtract = true
+	f.OnTag = func(tag *flv.CurrentTag) error {
+		return stream.WriteTag(tag.TagType, tag.Timestamp, flv.TagBody(tag.Data))
+	}
+
+	reader := flv.NewFollowReader(flvFile, fileIdleTimeout)
+	buf := make([]byte, 0)
+	tmpBuf := make([]byte, 1024000)
+	for {
+		length, errRead := reader.Read(tmpBuf)
+		if errRead != nil && errRead != io.EOF {
+			return fmt.Errorf("reader.Read failed, err:%v", errRead)
+		}
+		if length == 0 {
+			return nil
+		}
+		buf = append(buf, tmpBuf[:length]...)
+
+		buf, err = f.Parse(buf)
+		if err != nil {
+			return fmt.Errorf("f.Parse failed, err:%v", err)
+		}
+	}
+}
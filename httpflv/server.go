@@ -0,0 +1,139 @@
+package httpflv
+
+import (
+	"flvParse/flv"
+	"flvParse/rtmp"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Server serves live streams as chunked HTTP-FLV on /<app>/<name>.flv.
+type Server struct {
+	mu      sync.Mutex
+	streams map[string]*Stream
+}
+
+func NewServer() *Server {
+	return &Server{
+		streams: make(map[string]*Stream),
+	}
+}
+
+// AddStream registers a new source under key, e.g. "live/test". An existing
+// stream with the same key is closed and replaced.
+func (s *Server) AddStream(key string) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.streams[key]; ok {
+		old.Close()
+	}
+	stream := newStream(key)
+	s.streams[key] = stream
+	return stream
+}
+
+// RemoveStream closes and removes stream if it is still the one under its key.
+func (s *Server) RemoveStream(stream *Stream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.streams[stream.Name] == stream {
+		delete(s.streams, stream.Name)
+	}
+	stream.Close()
+}
+
+func (s *Server) getStream(key string) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.streams[key]
+}
+
+// OnPublish can be used as rtmp.Server.OnPublish to feed RTMP publishers into
+// the server.
+func (s *Server) OnPublish(app string, name string) (rtmp.Publisher, error) {
+	if app == "" || name == "" {
+		return nil, fmt.Errorf("empty app or stream name")
+	}
+	stream := s.AddStream(app + "/" + name)
+	return &rtmpPublisher{server: s, stream: stream}, nil
+}
+
+type rtmpPublisher struct {
+	server *Server
+	stream *Stream
+}
+
+func (p *rtmpPublisher) WriteTag(tagType uint8, timestamp uint32, body []byte) error {
+	return p.stream.WriteTag(tagType, timestamp, body)
+}
+
+func (p *rtmpPublisher) Close() {
+	p.server.RemoveStream(p.stream)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.HasSuffix(path, ".flv") {
+		http.NotFound(w, r)
+		return
+	}
+	stream := s.getStream(strings.TrimSuffix(path, ".flv"))
+	if stream == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	start, sub := stream.subscribe()
+	defer stream.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "video/x-flv")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	hasAudio, hasVideo := stream.hasAudioVideo()
+	if err := flv.WriteHeader(w, hasAudio, hasVideo); err != nil {
+		return
+	}
+	for _, packet := range start {
+		if err := flv.WriteTag(w, packet.TagType, packet.Timestamp, packet.Body); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case packet, ok := <-sub.packets:
+			if !ok {
+				return
+			}
+			if err := flv.WriteTag(w, packet.TagType, packet.Timestamp, packet.Body); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package httpflv
+
+import (
+	"bytes"
+	"flvParse/flv"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeHTTPLateJoin(t *testing.T) {
+	s := NewServer()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	publisher, err := s.OnPublish("live", "test")
+	if err != nil {
+		t.Fatalf("OnPublish failed, err:%v", err)
+	}
+	tags := liveTags()
+	for _, packet := range tags {
+		if err = publisher.WriteTag(packet.TagType, packet.Timestamp, packet.Body); err != nil {
+			t.Fatalf("WriteTag failed, err:%v", err)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/live/test.flv")
+	if err != nil {
+		t.Fatalf("http.Get failed, err:%v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "video/x-flv" {
+		t.Fatalf("status %v content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// the start packets are flushed before the live ones, wait for them so
+	// the live tag is not cached into the start
+	header := make([]byte, 13)
+	if _, err = resp.Body.Read(header); err != nil {
+		t.Fatalf("resp.Body.Read failed, err:%v", err)
+	}
+	live := &Packet{flv.TagTypeVideo, 180, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x05}}
+	time.Sleep(50 * time.Millisecond)
+	_ = publisher.WriteTag(live.TagType, live.Timestamp, live.Body)
+	publisher.Close()
+
+	rest, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll failed, err:%v", err)
+	}
+	got := append(header, rest...)
+
+	// header, onMetaData, sequence headers, the GOP from the keyframe at 100
+	want := new(bytes.Buffer)
+	_ = flv.WriteHeader(want, true, true)
+	for _, packet := range []*Packet{tags[0], tags[1], tags[2], tags[8], tags[9], tags[10], live} {
+		_ = flv.WriteTag(want, packet.TagType, packet.Timestamp, packet.Body)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("body = %x\nwant %x", got, want.Bytes())
+	}
+
+	if s.getStream("live/test") != nil {
+		t.Fatalf("stream not removed after the publisher closed")
+	}
+}
+
+func TestServeHTTPVideoOnly(t *testing.T) {
+	s := NewServer()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	stream := s.AddStream("live/video")
+	keyframe := []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x01}
+	_ = stream.WriteTag(flv.TagTypeVideo, 0, keyframe)
+
+	resp, err := http.Get(ts.URL + "/live/video.flv")
+	if err != nil {
+		t.Fatalf("http.Get failed, err:%v", err)
+	}
+	defer resp.Body.Close()
+	header := make([]byte, 13)
+	if _, err = resp.Body.Read(header); err != nil {
+		t.Fatalf("resp.Body.Read failed, err:%v", err)
+	}
+	s.RemoveStream(stream)
+	rest, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll failed, err:%v", err)
+	}
+
+	want := new(bytes.Buffer)
+	_ = flv.WriteHeader(want, false, true)
+	_ = flv.WriteTag(want, flv.TagTypeVideo, 0, keyframe)
+	if got := append(header, rest...); !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("body = %x, want %x", got, want.Bytes())
+	}
+}
+
+func TestServeHTTPErrors(t *testing.T) {
+	s := NewServer()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	s.AddStream("live/test")
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/live/other.flv", http.StatusNotFound},
+		{http.MethodGet, "/live/test", http.StatusNotFound},
+		{http.MethodPost, "/live/test.flv", http.StatusMethodNotAllowed},
+		{http.MethodOptions, "/live/test.flv", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%v %v failed, err:%v", tt.method, tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Fatalf("%v %v = %v, want %v", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+
+	if _, err := s.OnPublish("", "test"); err == nil {
+		t.Fatalf("OnPublish with an empty app succeeded")
+	}
+}
@@ -0,0 +1,210 @@
+package httpflv
+
+import (
+	"bytes"
+	"flvParse/flv"
+	"flvParse/rtmp"
+	"sync"
+)
+
+const (
+	subscriberQueueSize = 1024
+	maxGopPackets       = 8192
+)
+
+// onMetaDataName is the AMF0 name starting an onMetaData script tag
+var onMetaDataName, _ = rtmp.AmfEncode("onMetaData")
+
+// Packet is one FLV tag body.
+type Packet struct {
+	TagType   uint8
+	Timestamp uint32
+	Body      []byte
+}
+
+// Stream keeps the cached headers and the current GOP of one live stream and
+// fans its packets out to the subscribers.
+type Stream struct {
+	Name string
+
+	mu              sync.Mutex
+	metaData        *Packet
+	videoSeqHeaders []trackPacket
+	audioSeqHeaders []trackPacket
+	gop             []*Packet
+	hasAudio        bool
+	hasVideo        bool
+	subscribers     map[*subscriber]struct{}
+	closed          bool
+}
+
+// trackPacket is the sequence header of one multitrack track, track is -1
+// for the single track streams
+type trackPacket struct {
+	track  int
+	packet *Packet
+}
+
+type subscriber struct {
+	packets chan *Packet
+}
+
+func newStream(name string) *Stream {
+	return &Stream{
+		Name:        name,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// WriteTag adds one tag to the stream. body is copied.
+func (s *Stream) WriteTag(tagType uint8, timestamp uint32, body []byte) error {
+	if len(body) == 0 {
+		return nil
+	}
+
+	packet := &Packet{
+		TagType:   tagType,
+		Timestamp: timestamp,
+		Body:      append([]byte(nil), body...),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch tagType {
+	case flv.TagTypeScriptData:
+		// onCuePoint, onTextData and the like only go to the live subscribers
+		if bytes.HasPrefix(body, onMetaDataName) {
+			s.metaData = packet
+		}
+	case flv.TagTypeVideo:
+		s.hasVideo = true
+		frameType := (body[0] & flv.FrameTypeMark) >> 4
+		codecID := body[0] & flv.CodecIDMark
+		isSequenceHeader := (codecID == flv.CodecIDAvc || codecID == flv.CodecIDHevc) &&
+			len(body) > 1 && body[1] == flv.AvcPacketTypeAvcSequenceHeader
+		track := -1
+		if body[0]&flv.VideoIsExHeaderMark != 0 {
+			frameType = (body[0] & flv.ExVideoFrameTypeMark) >> 4
+			isSequenceHeader, track = exSequenceStart(body, body[0]&flv.ExVideoPacketTypeMark,
+				flv.VideoPacketTypeMultitrack, flv.VideoPacketTypeSequenceStart)
+		}
+		if isSequenceHeader {
+			s.videoSeqHeaders = setTrackPacket(s.videoSeqHeaders, track, packet)
+		} else if frameType == flv.FrameTypeKeyFrame {
+			s.gop = s.gop[:0]
+			s.gop = append(s.gop, packet)
+		} else if len(s.gop) > 0 && len(s.gop) < maxGopPackets {
+			s.gop = append(s.gop, packet)
+		}
+	case flv.TagTypeAudio:
+		s.hasAudio = true
+		soundFormat := (body[0] & flv.SoundFormatMark) >> 4
+		isSequenceHeader := soundFormat == flv.SoundFormatAAC && len(body) > 1 && body[1] == flv.AACPacketTypeAacSequenceHeader
+		track := -1
+		if soundFormat == flv.SoundFormatExHeader {
+			isSequenceHeader, track = exSequenceStart(body, body[0]&flv.AudioPacketTypeMark,
+				flv.AudioPacketTypeMultitrack, flv.AudioPacketTypeSequenceStart)
+		}
+		if isSequenceHeader {
+			s.audioSeqHeaders = setTrackPacket(s.audioSeqHeaders, track, packet)
+		} else if len(s.gop) > 0 && len(s.gop) < maxGopPackets {
+			s.gop = append(s.gop, packet)
+		}
+	}
+
+	for sub := range s.subscribers {
+		select {
+		case sub.packets <- packet:
+		default:
+			// too slow, drop it and let the client reconnect
+			close(sub.packets)
+			delete(s.subscribers, sub)
+		}
+	}
+
+	return nil
+}
+
+// subscribe returns the packets a new client starts with and registers it for
+// the following ones.
+func (s *Stream) subscribe() ([]*Packet, *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := make([]*Packet, 0, len(s.gop)+len(s.videoSeqHeaders)+len(s.audioSeqHeaders)+1)
+	if s.metaData != nil {
+		start = append(start, s.metaData)
+	}
+	for _, header := range s.videoSeqHeaders {
+		start = append(start, header.packet)
+	}
+	for _, header := range s.audioSeqHeaders {
+		start = append(start, header.packet)
+	}
+	start = append(start, s.gop...)
+
+	sub := &subscriber{packets: make(chan *Packet, subscriberQueueSize)}
+	if s.closed {
+		close(sub.packets)
+	} else {
+		s.subscribers[sub] = struct{}{}
+	}
+	return start, sub
+}
+
+func (s *Stream) unsubscribe(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[sub]; ok {
+		close(sub.packets)
+		delete(s.subscribers, sub)
+	}
+}
+
+// Close ends the stream for all subscribers.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for sub := range s.subscribers {
+		close(sub.packets)
+		delete(s.subscribers, sub)
+	}
+}
+
+// hasAudioVideo reports the tracks seen so far, both before any tag arrived.
+func (s *Stream) hasAudioVideo() (bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.hasAudio && !s.hasVideo {
+		return true, true
+	}
+	return s.hasAudio, s.hasVideo
+}
+
+// exSequenceStart reports whether an Enhanced RTMP tag starts a sequence and for
+// which track. The first track id of a multitrack tag follows the FourCC in
+// every AvMultitrackType.
+func exSequenceStart(body []byte, packetType byte, multitrack byte, sequenceStart byte) (bool, int) {
+	if packetType != multitrack {
+		return packetType == sequenceStart, -1
+	}
+	if len(body) < 7 {
+		return false, -1
+	}
+	return body[1]&0b00001111 == sequenceStart, int(body[6])
+}
+
+func setTrackPacket(packets []trackPacket, track int, packet *Packet) []trackPacket {
+	for i := range packets {
+		if packets[i].track == track {
+			packets[i].packet = packet
+			return packets
+		}
+	}
+	return append(packets, trackPacket{track: track, packet: packet})
+}
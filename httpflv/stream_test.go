@@ -0,0 +1,97 @@
+package httpflv
+
+import (
+	"flvParse/flv"
+	"flvParse/rtmp"
+	"reflect"
+	"testing"
+)
+
+func scriptTag(name string) *Packet {
+	body, _ := rtmp.AmfEncode(name, rtmp.AmfObject{"duration": 0})
+	return &Packet{flv.TagTypeScriptData, 0, body}
+}
+
+// liveTags is a stream with two GOPs, the sequence headers and script tags
+// around the onMetaData
+func liveTags() []*Packet {
+	return []*Packet{
+		scriptTag("onMetaData"),
+		{flv.TagTypeVideo, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x64, 0x00, 0x28}},
+		{flv.TagTypeAudio, 0, []byte{0xAF, 0x00, 0x12, 0x10}},
+		{flv.TagTypeAudio, 10, []byte{0xAF, 0x01, 0x01}},
+		{flv.TagTypeVideo, 20, []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x01}},
+		{flv.TagTypeAudio, 30, []byte{0xAF, 0x01, 0x02}},
+		{flv.TagTypeVideo, 60, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x02}},
+		scriptTag("onCuePoint"),
+		{flv.TagTypeVideo, 100, []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x03}},
+		{flv.TagTypeAudio, 110, []byte{0xAF, 0x01, 0x03}},
+		{flv.TagTypeVideo, 140, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x04}},
+		scriptTag("onTextData"),
+	}
+}
+
+func TestStreamSubscribeLate(t *testing.T) {
+	tags := liveTags()
+	s := newStream("live/test")
+	for _, packet := range tags {
+		if err := s.WriteTag(packet.TagType, packet.Timestamp, packet.Body); err != nil {
+			t.Fatalf("WriteTag failed, err:%v", err)
+		}
+	}
+
+	// the onMetaData, not the later script tags, the sequence headers, then
+	// the last GOP from its keyframe
+	start, sub := s.subscribe()
+	defer s.unsubscribe(sub)
+	want := []*Packet{tags[0], tags[1], tags[2], tags[8], tags[9], tags[10]}
+	if !reflect.DeepEqual(start, want) {
+		t.Fatalf("start = %v, want %v", start, want)
+	}
+
+	// the live tags follow, script tags included
+	cue := scriptTag("onCuePoint")
+	_ = s.WriteTag(cue.TagType, 150, cue.Body)
+	if packet := <-sub.packets; packet.TagType != flv.TagTypeScriptData || packet.Timestamp != 150 {
+		t.Fatalf("live packet %v, want the onCuePoint", packet)
+	}
+	if hasAudio, hasVideo := s.hasAudioVideo(); !hasAudio || !hasVideo {
+		t.Fatalf("hasAudioVideo = %v %v, want true true", hasAudio, hasVideo)
+	}
+}
+
+func TestStreamSequenceHeaderReplaced(t *testing.T) {
+	s := newStream("live/test")
+	first := []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01}
+	second := []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x02}
+	_ = s.WriteTag(flv.TagTypeVideo, 0, first)
+	_ = s.WriteTag(flv.TagTypeVideo, 40, second)
+
+	// audio before the first keyframe is not cached
+	_ = s.WriteTag(flv.TagTypeAudio, 40, []byte{0xAF, 0x01, 0x01})
+
+	start, sub := s.subscribe()
+	defer s.unsubscribe(sub)
+	want := []*Packet{{flv.TagTypeVideo, 40, second}}
+	if !reflect.DeepEqual(start, want) {
+		t.Fatalf("start = %v, want %v", start, want)
+	}
+	if hasAudio, hasVideo := s.hasAudioVideo(); !hasAudio || !hasVideo {
+		t.Fatalf("hasAudioVideo = %v %v, want true true", hasAudio, hasVideo)
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+	s := newStream("live/test")
+	_, sub := s.subscribe()
+	s.Close()
+	if _, ok := <-sub.packets; ok {
+		t.Fatalf("packets not closed")
+	}
+
+	// a subscriber after Close gets a closed channel
+	_, sub = s.subscribe()
+	if _, ok := <-sub.packets; ok {
+		t.Fatalf("packets of a closed stream not closed")
+	}
+}
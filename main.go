@@ -1,21 +1,91 @@
 package main
 
 import (
+	"flag"
 	"flvParse/flv"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
 
-	flvFile, err := os.Open("./test.flv")
+	input := flag.String("i", "./test.flv", "input flv file")
+	follow := flag.Bool("follow", false, "keep reading as the file grows, like tail -f")
+	idleTimeout := flag.Duration("idle-timeout", 30*time.Second, "with -follow, stop after no bytes were appended for this long, 0 waits forever")
+	audioTracks := flag.String("audio-tracks", "", "comma separated multitrack audio track ids to parse and extract, empty means all")
+	videoTracks := flag.String("video-tracks", "", "comma separated multitrack video track ids to parse and extract, empty means all")
+	screenPng := flag.Bool("screen-png", false, "decompress screen video and write every frame to ./test.screen.<frame>.png")
+	pcmBigEndian := flag.Bool("pcm-big-endian", false, "treat platform endian PCM (SoundFormat 0) as big endian")
+	mp3Xing := flag.Bool("mp3-xing", false, "start ./test.mp3 with a Xing/Info header for accurate durations")
+	aacM4a := flag.Bool("aac-m4a", false, "also write the AAC frames into ./test.m4a")
+	aacLoas := flag.Bool("aac-loas", false, "also write the AAC frames into ./test.loas as LOAS/LATM")
+	repair := flag.String("repair", "", "write the tags with repaired timestamps into this flv file")
+	repairMaxGap := flag.Int64("repair-max-gap", flv.DefaultRepairMaxGap, "with -repair, larger steps in ms between two tags of a track are discontinuities")
+	syncReport := flag.String("sync-report", "", "write the audio/video sync analysis as JSON into this file")
+	syncMissing := flag.Int64("sync-missing", flv.DefaultSyncMissingThreshold, "with -sync-report, a track without tags for longer in ms is missing")
+	flag.Parse()
+
+	flvFile, err := os.Open(*input)
 	if err != nil {
-		fmt.Printf("os.Open(\"./test.flv\") failed, err:%v\n", err)
+		fmt.Printf("os.Open(\"%v\") failed, err:%v\n", *input, err)
+		os.Exit(-1)
+	}
+
+	var reader io.Reader = flvFile
+	if *follow {
+		reader = flv.NewFollowReader(flvFile, *idleTimeout)
 	}
 
 	buf := make([]byte, 0)
 	f := new(flv.Flv)
+	f.RenderScreenVideo = *screenPng
+	f.PcmBigEndian = *pcmBigEndian
+	f.Mp3XingHeader = *mp3Xing
+	f.AacM4a = *aacM4a
+	f.AacLoas = *aacLoas
+	if f.AudioTrackIds, err = parseTrackIds(*audioTracks); err != nil {
+		fmt.Printf("-audio-tracks %q is illegal, err:%v\n", *audioTracks, err)
+		os.Exit(-1)
+	}
+	if f.VideoTrackIds, err = parseTrackIds(*videoTracks); err != nil {
+		fmt.Printf("-video-tracks %q is illegal, err:%v\n", *videoTracks, err)
+		os.Exit(-1)
+	}
+
+	var timestampRepair *flv.TimestampRepair
+	if *repair != "" {
+		repairFile, err := os.Create(*repair)
+		if err != nil {
+			fmt.Printf("os.Create(\"%v\") failed, err:%v\n", *repair, err)
+			os.Exit(-1)
+		}
+		defer repairFile.Close()
+
+		timestampRepair = flv.NewTimestampRepair(repairFile, f)
+		timestampRepair.MaxGap = *repairMaxGap
+	}
+	var syncAnalyzer *flv.SyncAnalyzer
+	if *syncReport != "" {
+		syncAnalyzer = &flv.SyncAnalyzer{MissingThreshold: *syncMissing}
+	}
+	if timestampRepair != nil || syncAnalyzer != nil {
+		f.OnTag = func(tag *flv.CurrentTag) error {
+			if syncAnalyzer != nil {
+				if err := syncAnalyzer.AddTag(tag); err != nil {
+					return err
+				}
+			}
+			if timestampRepair != nil {
+				return timestampRepair.WriteTag(tag)
+			}
+			return nil
+		}
+	}
 
 	//nums := 0
 	//times := 1
@@ -23,7 +93,7 @@ func main() {
 	for true {
 
 		tmpBuf := make([]byte, 1024000)
-		length, errRead := flvFile.Read(tmpBuf)
+		length, errRead := reader.Read(tmpBuf)
 		if errRead != nil && errRead != io.EOF {
 			fmt.Printf("flvFile.Read failed, err:%v\n", errRead)
 		}
@@ -41,7 +111,7 @@ func main() {
 		}
 		if errRead == io.EOF {
 			fmt.Printf("already read and deal")
-			os.Exit(0)
+			break
 		}
 
 		//nums++
@@ -50,5 +120,45 @@ func main() {
 		//}
 	}
 
+	if err = f.Close(); err != nil {
+		fmt.Printf("f.Close failed, err:%v\n", err)
+		os.Exit(-1)
+	}
+
+	if timestampRepair != nil {
+		for _, d := range timestampRepair.Discontinuities {
+			fmt.Printf("repaired %v timestamp %v, step %v ms, to %v\n", flv.TagTypeMap[d.TagType], d.Input, d.Delta, d.Output)
+		}
+		fmt.Printf("repaired %v timestamp discontinuities into %v\n", len(timestampRepair.Discontinuities), *repair)
+	}
+
+	if syncAnalyzer != nil {
+		report, err := syncAnalyzer.JSON()
+		if err != nil {
+			fmt.Printf("syncAnalyzer.JSON failed, err:%v\n", err)
+			os.Exit(-1)
+		}
+		if err = ioutil.WriteFile(*syncReport, append(report, '\n'), 0644); err != nil {
+			fmt.Printf("ioutil.WriteFile(\"%v\") failed, err:%v\n", *syncReport, err)
+			os.Exit(-1)
+		}
+	}
+
 	fmt.Println()
 }
+
+func parseTrackIds(s string) ([]uint8, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var trackIds []uint8
+	for _, field := range strings.Split(s, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		trackIds = append(trackIds, uint8(id))
+	}
+	return trackIds, nil
+}
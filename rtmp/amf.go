@@ -0,0 +1,215 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	Amf0Number      = 0x00
+	Amf0Boolean     = 0x01
+	Amf0String      = 0x02
+	Amf0Object      = 0x03
+	Amf0Null        = 0x05
+	Amf0Undefined   = 0x06
+	Amf0EcmaArray   = 0x08
+	Amf0ObjectEnd   = 0x09
+	Amf0StrictArray = 0x0A
+	Amf0Date        = 0x0B
+	Amf0LongString  = 0x0C
+)
+
+// AmfObject is an AMF0 object or ECMA array.
+type AmfObject map[string]interface{}
+
+// AmfEncode encodes values as AMF0. Supported types are float64, int, bool, string,
+// AmfObject, []interface{} and nil.
+func AmfEncode(values ...interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, v := range values {
+		if err := amfEncodeValue(buf, v); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func amfEncodeValue(buf *bytes.Buffer, v interface{}) error {
+	switch value := v.(type) {
+	case nil:
+		buf.WriteByte(Amf0Null)
+	case float64:
+		buf.WriteByte(Amf0Number)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(value))
+	case int:
+		return amfEncodeValue(buf, float64(value))
+	case uint32:
+		return amfEncodeValue(buf, float64(value))
+	case bool:
+		buf.WriteByte(Amf0Boolean)
+		if value {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case string:
+		if len(value) > 0xFFFF {
+			buf.WriteByte(Amf0LongString)
+			_ = binary.Write(buf, binary.BigEndian, uint32(len(value)))
+			buf.WriteString(value)
+		} else {
+			buf.WriteByte(Amf0String)
+			amfEncodeKey(buf, value)
+		}
+	case AmfObject:
+		buf.WriteByte(Amf0Object)
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			amfEncodeKey(buf, k)
+			if err := amfEncodeValue(buf, value[k]); err != nil {
+				return err
+			}
+		}
+		buf.Write([]byte{0x00, 0x00, Amf0ObjectEnd})
+	case []interface{}:
+		buf.WriteByte(Amf0StrictArray)
+		_ = binary.Write(buf, binary.BigEndian, uint32(len(value)))
+		for _, item := range value {
+			if err := amfEncodeValue(buf, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("amf0 unsupported type %T", v)
+	}
+	return nil
+}
+
+func amfEncodeKey(buf *bytes.Buffer, key string) {
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(key)))
+	buf.WriteString(key)
+}
+
+// AmfDecode decodes all AMF0 values in buf.
+func AmfDecode(buf []byte) ([]interface{}, error) {
+	values := make([]interface{}, 0)
+	index := 0
+	for index < len(buf) {
+		value, next, err := amfDecodeValue(buf, index)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+		index = next
+	}
+	return values, nil
+}
+
+func amfDecodeValue(buf []byte, index int) (interface{}, int, error) {
+	if len(buf[index:]) < 1 {
+		return nil, 0, fmt.Errorf("len(buf[index:]) < 1")
+	}
+
+	valueType := buf[index]
+	index++
+
+	switch valueType {
+	case Amf0Number:
+		if len(buf[index:]) < 8 {
+			return nil, 0, fmt.Errorf("amf0 number: len(buf[index:]) < 8")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(buf[index:])), index + 8, nil
+	case Amf0Boolean:
+		if len(buf[index:]) < 1 {
+			return nil, 0, fmt.Errorf("amf0 boolean: len(buf[index:]) < 1")
+		}
+		return buf[index] != 0, index + 1, nil
+	case Amf0String:
+		return amfDecodeKey(buf, index)
+	case Amf0LongString:
+		if len(buf[index:]) < 4 {
+			return nil, 0, fmt.Errorf("amf0 long string: len(buf[index:]) < 4")
+		}
+		length := int(binary.BigEndian.Uint32(buf[index:]))
+		index += 4
+		if len(buf[index:]) < length {
+			return nil, 0, fmt.Errorf("amf0 long string: len(buf[index:]) < %v", length)
+		}
+		return string(buf[index : index+length]), index + length, nil
+	case Amf0Object:
+		return amfDecodeProperties(buf, index)
+	case Amf0EcmaArray:
+		if len(buf[index:]) < 4 {
+			return nil, 0, fmt.Errorf("amf0 ecma array: len(buf[index:]) < 4")
+		}
+		return amfDecodeProperties(buf, index+4)
+	case Amf0StrictArray:
+		if len(buf[index:]) < 4 {
+			return nil, 0, fmt.Errorf("amf0 strict array: len(buf[index:]) < 4")
+		}
+		count := binary.BigEndian.Uint32(buf[index:])
+		index += 4
+		array := make([]interface{}, 0)
+		for i := uint32(0); i < count; i++ {
+			value, next, err := amfDecodeValue(buf, index)
+			if err != nil {
+				return nil, 0, err
+			}
+			array = append(array, value)
+			index = next
+		}
+		return array, index, nil
+	case Amf0Date:
+		if len(buf[index:]) < 10 {
+			return nil, 0, fmt.Errorf("amf0 date: len(buf[index:]) < 10")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(buf[index:])), index + 10, nil
+	case Amf0Null, Amf0Undefined:
+		return nil, index, nil
+	}
+
+	return nil, 0, fmt.Errorf("amf0 unsupported type:%v", valueType)
+}
+
+func amfDecodeKey(buf []byte, index int) (string, int, error) {
+	if len(buf[index:]) < 2 {
+		return "", 0, fmt.Errorf("amf0 string: len(buf[index:]) < 2")
+	}
+	length := int(binary.BigEndian.Uint16(buf[index:]))
+	index += 2
+	if len(buf[index:]) < length {
+		return "", 0, fmt.Errorf("amf0 string: len(buf[index:]) < %v", length)
+	}
+	return string(buf[index : index+length]), index + length, nil
+}
+
+func amfDecodeProperties(buf []byte, index int) (interface{}, int, error) {
+	object := make(AmfObject)
+	for {
+		if len(buf[index:]) >= 3 && buf[index] == 0 && buf[index+1] == 0 && buf[index+2] == Amf0ObjectEnd {
+			return object, index + 3, nil
+		}
+		// some encoders omit the end marker at the end of the message
+		if len(buf[index:]) == 0 {
+			return object, index, nil
+		}
+
+		key, next, err := amfDecodeKey(buf, index)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, next, err := amfDecodeValue(buf, next)
+		if err != nil {
+			return nil, 0, err
+		}
+		object[key] = value
+		index = next
+	}
+}
@@ -0,0 +1,128 @@
+package rtmp
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAmfEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []interface{}
+		want   string
+	}{
+		{"number", []interface{}{1.5}, "003ff8000000000000"},
+		{"int", []interface{}{1}, "003ff0000000000000"},
+		{"bool", []interface{}{true, false}, "01010100"},
+		{"string", []interface{}{"connect"}, "020007636f6e6e656374"},
+		{"null", []interface{}{nil}, "05"},
+		{"object keys sorted", []interface{}{AmfObject{"b": true, "a": nil}}, "03000161050001620101000009"},
+		{"strict array", []interface{}{[]interface{}{1.0, "x"}}, "0a00000002003ff000000000000002000178"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AmfEncode(tt.values...)
+			if err != nil {
+				t.Fatalf("AmfEncode failed, err:%v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Fatalf("AmfEncode = %x, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmfRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 0x10000)
+	tests := []struct {
+		name   string
+		values []interface{}
+		want   []interface{}
+	}{
+		{"number", []interface{}{0.0, -1.25, 1e300}, []interface{}{0.0, -1.25, 1e300}},
+		{"int and uint32 decode as numbers", []interface{}{7, uint32(0xFFFFFFFF)}, []interface{}{7.0, float64(0xFFFFFFFF)}},
+		{"bool", []interface{}{true, false}, []interface{}{true, false}},
+		{"string", []interface{}{"", "onStatus"}, []interface{}{"", "onStatus"}},
+		{"long string", []interface{}{long}, []interface{}{long}},
+		{"null", []interface{}{nil}, []interface{}{nil}},
+		{"object", []interface{}{AmfObject{
+			"code":  "NetStream.Play.Start",
+			"level": "status",
+			"nested": AmfObject{
+				"width": 1920,
+				"empty": AmfObject{},
+			},
+		}}, []interface{}{AmfObject{
+			"code":  "NetStream.Play.Start",
+			"level": "status",
+			"nested": AmfObject{
+				"width": 1920.0,
+				"empty": AmfObject{},
+			},
+		}}},
+		{"strict array", []interface{}{[]interface{}{1, "a", nil, []interface{}{}}}, []interface{}{[]interface{}{1.0, "a", nil, []interface{}{}}}},
+		{"command", []interface{}{"_result", 1, nil, 1}, []interface{}{"_result", 1.0, nil, 1.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := AmfEncode(tt.values...)
+			if err != nil {
+				t.Fatalf("AmfEncode failed, err:%v", err)
+			}
+			got, err := AmfDecode(data)
+			if err != nil {
+				t.Fatalf("AmfDecode(%x) failed, err:%v", data, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("AmfDecode(AmfEncode(%v)) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmfDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []interface{}
+	}{
+		// onMetaData with an ECMA array of two entries
+		{"ecma array", "02000a6f6e4d6574614461746108000000020005776964746800409e000000000000000668696464656e0101000009",
+			[]interface{}{"onMetaData", AmfObject{"width": 1920.0, "hidden": true}}},
+		{"object without end marker", "030001610101", []interface{}{AmfObject{"a": true}}},
+		{"undefined", "06", []interface{}{nil}},
+		// the time zone is skipped
+		{"date", "0b3ff00000000000000000", []interface{}{1.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.data)
+			got, err := AmfDecode(data)
+			if err != nil {
+				t.Fatalf("AmfDecode(%v) failed, err:%v", tt.data, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("AmfDecode(%v) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmfDecodeTruncated(t *testing.T) {
+	data, _ := AmfEncode("onStatus", 1, nil, AmfObject{"code": "NetStream.Play.Start"}, []interface{}{1.0})
+	for i := 1; i < len(data); i++ {
+		// truncated inside a value, the object end marker may be omitted
+		values, err := AmfDecode(data[:i])
+		if err == nil && len(values) == 5 {
+			t.Fatalf("AmfDecode(%x) of %v bytes decoded all values", data[:i], i)
+		}
+	}
+	if _, err := AmfDecode([]byte{0x04}); err == nil {
+		t.Fatalf("AmfDecode of the movieclip type succeeded")
+	}
+	if _, err := AmfEncode(struct{}{}); err == nil {
+		t.Fatalf("AmfEncode of a struct succeeded")
+	}
+}
@@ -0,0 +1,251 @@
+package rtmp
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultPort = "1935"
+
+// Client is an RTMP client connection for one publish or play stream.
+type Client struct {
+	*Conn
+
+	URL      string
+	App      string
+	Stream   string
+	StreamID uint32
+
+	publishing    bool
+	transactionID float64
+}
+
+// Dial connects to an rtmp://host[:port]/app/stream url, does the handshake and
+// the connect command.
+func Dial(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse failed, err:%v", err)
+	}
+	if u.Scheme != "rtmp" {
+		return nil, fmt.Errorf("unsupported scheme:%v", u.Scheme)
+	}
+
+	path := strings.Trim(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	if slash <= 0 {
+		return nil, fmt.Errorf("url has no app or stream name, url:%v", rawURL)
+	}
+
+	c := &Client{
+		URL:    rawURL,
+		App:    path[:slash],
+		Stream: path[slash+1:],
+	}
+	if u.RawQuery != "" {
+		c.Stream += "?" + u.RawQuery
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	netConn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("net.DialTimeout failed, err:%v", err)
+	}
+	c.Conn = newConn(netConn)
+
+	if err = c.clientHandshake(); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("c.clientHandshake failed, err:%v", err)
+	}
+
+	if err = c.SetChunkSize(outChunkSize); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("c.SetChunkSize failed, err:%v", err)
+	}
+
+	if err = c.connect(u); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("c.connect failed, err:%v", err)
+	}
+
+	return c, nil
+}
+
+func (c *Client) connect(u *url.URL) error {
+	tcURL := fmt.Sprintf("rtmp://%v/%v", u.Host, c.App)
+	_, err := c.call(0, "connect", AmfObject{
+		"app":           c.App,
+		"type":          "nonprivate",
+		"flashVer":      "FMLE/3.0 (compatible; flvParse)",
+		"tcUrl":         tcURL,
+		"fpad":          false,
+		"capabilities":  15,
+		"audioCodecs":   3191,
+		"videoCodecs":   252,
+		"videoFunction": 1,
+	})
+	return err
+}
+
+// call sends a command and waits for its _result.
+func (c *Client) call(streamID uint32, name string, args ...interface{}) ([]interface{}, error) {
+	c.transactionID++
+	transactionID := c.transactionID
+
+	values := append([]interface{}{name, transactionID}, args...)
+	if err := c.WriteCommand(streamID, values...); err != nil {
+		return nil, fmt.Errorf("c.WriteCommand(%v) failed, err:%v", name, err)
+	}
+
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return nil, fmt.Errorf("c.ReadMessage failed, err:%v", err)
+		}
+		if msg.Type != MessageTypeAmf0Command {
+			continue
+		}
+
+		result, err := AmfDecode(msg.Data)
+		if err != nil || len(result) < 2 {
+			continue
+		}
+		if id, _ := result[1].(float64); id != transactionID {
+			continue
+		}
+
+		switch result[0] {
+		case "_result":
+			return result, nil
+		case "_error":
+			return nil, fmt.Errorf("%v returned _error, result:%v", name, result[2:])
+		}
+	}
+}
+
+func (c *Client) createStream() error {
+	result, err := c.call(0, "createStream", nil)
+	if err != nil {
+		return err
+	}
+	if len(result) < 4 {
+		return fmt.Errorf("createStream result has no stream id, result:%v", result)
+	}
+	streamID, ok := result[3].(float64)
+	if !ok {
+		return fmt.Errorf("createStream stream id is not a number, result:%v", result)
+	}
+	c.StreamID = uint32(streamID)
+	return nil
+}
+
+// waitStatus waits for an onStatus with one of the codes.
+func (c *Client) waitStatus(codes ...string) error {
+	for {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("c.ReadMessage failed, err:%v", err)
+		}
+		if msg.Type != MessageTypeAmf0Command {
+			continue
+		}
+
+		values, err := AmfDecode(msg.Data)
+		if err != nil || len(values) < 4 || values[0] != "onStatus" {
+			continue
+		}
+		info, _ := values[3].(AmfObject)
+		code, _ := info["code"].(string)
+		for _, c := range codes {
+			if code == c {
+				return nil
+			}
+		}
+		if level, _ := info["level"].(string); level == "error" {
+			return fmt.Errorf("onStatus error, code:%v, description:%v", code, info["description"])
+		}
+	}
+}
+
+// Publish starts publishing the stream given in the url.
+func (c *Client) Publish() error {
+	if err := c.WriteCommand(0, "releaseStream", c.nextTransactionID(), nil, c.Stream); err != nil {
+		return fmt.Errorf("releaseStream failed, err:%v", err)
+	}
+	if err := c.WriteCommand(0, "FCPublish", c.nextTransactionID(), nil, c.Stream); err != nil {
+		return fmt.Errorf("FCPublish failed, err:%v", err)
+	}
+	if err := c.createStream(); err != nil {
+		return fmt.Errorf("c.createStream failed, err:%v", err)
+	}
+	if err := c.WriteCommand(c.StreamID, "publish", c.nextTransactionID(), nil, c.Stream, "live"); err != nil {
+		return fmt.Errorf("publish failed, err:%v", err)
+	}
+	c.publishing = true
+	return c.waitStatus("NetStream.Publish.Start")
+}
+
+// Play starts playing the stream given in the url.
+func (c *Client) Play() error {
+	if err := c.writeWindowAckSize(defaultWindowAck); err != nil {
+		return fmt.Errorf("c.writeWindowAckSize failed, err:%v", err)
+	}
+	if err := c.createStream(); err != nil {
+		return fmt.Errorf("c.createStream failed, err:%v", err)
+	}
+	if err := c.writeUserControl(UserControlSetBufferLength, c.StreamID, 1000); err != nil {
+		return fmt.Errorf("c.writeUserControl failed, err:%v", err)
+	}
+	if err := c.WriteCommand(c.StreamID, "play", c.nextTransactionID(), nil, c.Stream, -2000); err != nil {
+		return fmt.Errorf("play failed, err:%v", err)
+	}
+	return c.waitStatus("NetStream.Play.Start", "NetStream.Play.Reset")
+}
+
+func (c *Client) nextTransactionID() float64 {
+	c.transactionID++
+	return c.transactionID
+}
+
+// WriteTag sends one FLV tag body on the published stream. Script data is sent
+// with the @setDataFrame prefix servers expect for onMetaData.
+func (c *Client) WriteTag(tagType uint8, timestamp uint32, body []byte) error {
+	msg := &Message{
+		Type:      tagType,
+		StreamID:  c.StreamID,
+		Timestamp: timestamp,
+		Data:      body,
+	}
+
+	switch tagType {
+	case MessageTypeAudio:
+		msg.ChunkStreamID = ChunkStreamAudio
+	case MessageTypeVideo:
+		msg.ChunkStreamID = ChunkStreamVideo
+	case MessageTypeAmf0Data:
+		msg.ChunkStreamID = ChunkStreamData
+		prefix, _ := AmfEncode("@setDataFrame")
+		msg.Data = append(prefix, body...)
+	default:
+		return fmt.Errorf("unsupported tag type:%v", tagType)
+	}
+
+	return c.WriteMessage(msg)
+}
+
+// CloseStream unpublishes or stops the stream and closes the connection.
+func (c *Client) CloseStream() error {
+	if c.publishing {
+		_ = c.WriteCommand(0, "FCUnpublish", c.nextTransactionID(), nil, c.Stream)
+	}
+	if c.StreamID != 0 {
+		_ = c.WriteCommand(c.StreamID, "deleteStream", c.nextTransactionID(), nil, c.StreamID)
+	}
+	return c.Close()
+}
@@ -0,0 +1,527 @@
+package rtmp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	MessageTypeSetChunkSize     = 1
+	MessageTypeAbort            = 2
+	MessageTypeAcknowledgement  = 3
+	MessageTypeUserControl      = 4
+	MessageTypeWindowAckSize    = 5
+	MessageTypeSetPeerBandwidth = 6
+	MessageTypeAudio            = 8
+	MessageTypeVideo            = 9
+	MessageTypeAmf3Data         = 15
+	MessageTypeAmf3Command      = 17
+	MessageTypeAmf0Data         = 18
+	MessageTypeAmf0Command      = 20
+	MessageTypeAggregate        = 22
+
+	UserControlStreamBegin      = 0
+	UserControlStreamEOF        = 1
+	UserControlStreamDry        = 2
+	UserControlSetBufferLength  = 3
+	UserControlStreamIsRecorded = 4
+	UserControlPingRequest      = 6
+	UserControlPingResponse     = 7
+
+	ChunkStreamProtocol = 2
+	ChunkStreamCommand  = 3
+	ChunkStreamAudio    = 4
+	ChunkStreamVideo    = 6
+	ChunkStreamData     = 5
+
+	handshakeSize       = 1536
+	defaultChunkSize    = 128
+	outChunkSize        = 4096
+	defaultWindowAck    = 2500000
+	extendedTimestamp   = 0xFFFFFF
+	maxMessageLength    = 16 * 1024 * 1024
+	defaultReadTimeout  = 30 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+)
+
+// Message is a complete RTMP message.
+type Message struct {
+	ChunkStreamID uint32
+	Type          uint8
+	StreamID      uint32
+	Timestamp     uint32
+	Data          []byte
+}
+
+type chunkStream struct {
+	timestamp      uint32
+	timestampDelta uint32
+	length         uint32
+	typeID         uint8
+	streamID       uint32
+	extended       bool
+	buf            []byte
+}
+
+// Conn is an RTMP connection after the handshake, reading and writing messages
+// over the chunk stream.
+type Conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	writeMu sync.Mutex
+
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	inChunkSize   uint32
+	outChunkSize  uint32
+	inWindowAck   uint32
+	lastAckBytes  uint32
+	chunkStreams  map[uint32]*chunkStream
+	countedReader *countingReader
+}
+
+type countingReader struct {
+	r io.Reader
+	n uint32
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint32(n)
+	return n, err
+}
+
+func newConn(netConn net.Conn) *Conn {
+	counted := &countingReader{r: netConn}
+	return &Conn{
+		netConn:       netConn,
+		reader:        bufio.NewReaderSize(counted, 64*1024),
+		writer:        bufio.NewWriterSize(netConn, 64*1024),
+		ReadTimeout:   defaultReadTimeout,
+		WriteTimeout:  defaultWriteTimeout,
+		inChunkSize:   defaultChunkSize,
+		outChunkSize:  defaultChunkSize,
+		inWindowAck:   defaultWindowAck,
+		chunkStreams:  make(map[uint32]*chunkStream),
+		countedReader: counted,
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.netConn.Close()
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.netConn.RemoteAddr()
+}
+
+func (c *Conn) clientHandshake() error {
+	c.setDeadline()
+
+	c0c1 := make([]byte, 1+handshakeSize)
+	c0c1[0] = 0x03
+	binary.BigEndian.PutUint32(c0c1[1:5], uint32(time.Now().Unix()))
+	if _, err := rand.Read(c0c1[9:]); err != nil {
+		return fmt.Errorf("rand.Read failed, err:%v", err)
+	}
+	if _, err := c.netConn.Write(c0c1); err != nil {
+		return fmt.Errorf("write c0c1 failed, err:%v", err)
+	}
+
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	if _, err := io.ReadFull(c.reader, s0s1s2); err != nil {
+		return fmt.Errorf("read s0s1s2 failed, err:%v", err)
+	}
+	if s0s1s2[0] != 0x03 {
+		return fmt.Errorf("s0 != 0x03, s0:%x", s0s1s2[0])
+	}
+
+	// C2 echoes S1
+	if _, err := c.netConn.Write(s0s1s2[1 : 1+handshakeSize]); err != nil {
+		return fmt.Errorf("write c2 failed, err:%v", err)
+	}
+
+	return nil
+}
+
+func (c *Conn) serverHandshake() error {
+	c.setDeadline()
+
+	c0c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(c.reader, c0c1); err != nil {
+		return fmt.Errorf("read c0c1 failed, err:%v", err)
+	}
+	if c0c1[0] != 0x03 {
+		return fmt.Errorf("c0 != 0x03, c0:%x", c0c1[0])
+	}
+
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	s0s1s2[0] = 0x03
+	binary.BigEndian.PutUint32(s0s1s2[1:5], uint32(time.Now().Unix()))
+	if _, err := rand.Read(s0s1s2[9 : 1+handshakeSize]); err != nil {
+		return fmt.Errorf("rand.Read failed, err:%v", err)
+	}
+	copy(s0s1s2[1+handshakeSize:], c0c1[1:])
+	if _, err := c.netConn.Write(s0s1s2); err != nil {
+		return fmt.Errorf("write s0s1s2 failed, err:%v", err)
+	}
+
+	c2 := make([]byte, handshakeSize)
+	if _, err := io.ReadFull(c.reader, c2); err != nil {
+		return fmt.Errorf("read c2 failed, err:%v", err)
+	}
+
+	return nil
+}
+
+func (c *Conn) setDeadline() {
+	if c.ReadTimeout > 0 {
+		_ = c.netConn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
+	}
+	if c.WriteTimeout > 0 {
+		_ = c.netConn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+	}
+}
+
+// ReadMessage reads the next message. Protocol control messages are handled
+// internally and also returned to the caller.
+func (c *Conn) ReadMessage() (*Message, error) {
+	for {
+		if c.ReadTimeout > 0 {
+			_ = c.netConn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
+		}
+
+		msg, err := c.readChunk()
+		if err != nil {
+			return nil, err
+		}
+
+		if err = c.sendAckIfNeeded(); err != nil {
+			return nil, err
+		}
+
+		if msg == nil {
+			continue
+		}
+
+		if err = c.handleProtocolMessage(msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+}
+
+func (c *Conn) readChunk() (*Message, error) {
+	basic, err := c.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	format := basic >> 6
+	csid := uint32(basic & 0x3F)
+	switch csid {
+	case 0:
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		csid = uint32(b) + 64
+	case 1:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, b); err != nil {
+			return nil, err
+		}
+		csid = uint32(b[1])*256 + uint32(b[0]) + 64
+	}
+
+	cs, ok := c.chunkStreams[csid]
+	if !ok {
+		if format != 0 {
+			return nil, fmt.Errorf("first chunk of chunk stream %v has format %v", csid, format)
+		}
+		cs = new(chunkStream)
+		c.chunkStreams[csid] = cs
+	}
+
+	headerSize := []int{11, 7, 3, 0}[format]
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return nil, err
+	}
+
+	var timestamp uint32
+	if format < 3 {
+		timestamp = uint32(header[0])<<16 | uint32(header[1])<<8 | uint32(header[2])
+		cs.extended = timestamp == extendedTimestamp
+	}
+	if format < 2 {
+		cs.length = uint32(header[3])<<16 | uint32(header[4])<<8 | uint32(header[5])
+		cs.typeID = header[6]
+		if cs.length > maxMessageLength {
+			return nil, fmt.Errorf("message length too large, length:%v", cs.length)
+		}
+	}
+	if format == 0 {
+		cs.streamID = binary.LittleEndian.Uint32(header[7:11])
+	}
+
+	if cs.extended {
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(c.reader, b); err != nil {
+			return nil, err
+		}
+		if format < 3 {
+			timestamp = binary.BigEndian.Uint32(b)
+		}
+	}
+
+	newMessage := len(cs.buf) == 0
+	switch format {
+	case 0:
+		cs.timestamp = timestamp
+		cs.timestampDelta = 0
+	case 1, 2:
+		cs.timestampDelta = timestamp
+		cs.timestamp += timestamp
+	case 3:
+		if newMessage {
+			cs.timestamp += cs.timestampDelta
+		}
+	}
+
+	remain := cs.length - uint32(len(cs.buf))
+	size := remain
+	if size > c.inChunkSize {
+		size = c.inChunkSize
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return nil, err
+	}
+	cs.buf = append(cs.buf, payload...)
+
+	if uint32(len(cs.buf)) < cs.length {
+		return nil, nil
+	}
+
+	msg := &Message{
+		ChunkStreamID: csid,
+		Type:          cs.typeID,
+		StreamID:      cs.streamID,
+		Timestamp:     cs.timestamp,
+		Data:          cs.buf,
+	}
+	cs.buf = nil
+	return msg, nil
+}
+
+func (c *Conn) sendAckIfNeeded() error {
+	received := c.countedReader.n - uint32(c.reader.Buffered())
+	if received-c.lastAckBytes < c.inWindowAck/2 {
+		return nil
+	}
+	c.lastAckBytes = received
+
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, received)
+	return c.WriteMessage(&Message{
+		ChunkStreamID: ChunkStreamProtocol,
+		Type:          MessageTypeAcknowledgement,
+		Data:          data,
+	})
+}
+
+func (c *Conn) handleProtocolMessage(msg *Message) error {
+	switch msg.Type {
+	case MessageTypeSetChunkSize:
+		if len(msg.Data) < 4 {
+			return fmt.Errorf("set chunk size: len(msg.Data) < 4")
+		}
+		size := binary.BigEndian.Uint32(msg.Data) & 0x7FFFFFFF
+		if size == 0 {
+			return fmt.Errorf("set chunk size: size is 0")
+		}
+		c.inChunkSize = size
+	case MessageTypeAbort:
+		if len(msg.Data) < 4 {
+			return fmt.Errorf("abort: len(msg.Data) < 4")
+		}
+		if cs, ok := c.chunkStreams[binary.BigEndian.Uint32(msg.Data)]; ok {
+			cs.buf = nil
+		}
+	case MessageTypeWindowAckSize:
+		if len(msg.Data) < 4 {
+			return fmt.Errorf("window ack size: len(msg.Data) < 4")
+		}
+		c.inWindowAck = binary.BigEndian.Uint32(msg.Data)
+	case MessageTypeUserControl:
+		if len(msg.Data) >= 6 && binary.BigEndian.Uint16(msg.Data) == UserControlPingRequest {
+			data := make([]byte, 6)
+			binary.BigEndian.PutUint16(data, UserControlPingResponse)
+			copy(data[2:], msg.Data[2:6])
+			return c.WriteMessage(&Message{
+				ChunkStreamID: ChunkStreamProtocol,
+				Type:          MessageTypeUserControl,
+				Data:          data,
+			})
+		}
+	}
+	return nil
+}
+
+// WriteMessage writes msg as one type 0 chunk followed by type 3 chunks.
+func (c *Conn) WriteMessage(msg *Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.WriteTimeout > 0 {
+		_ = c.netConn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+	}
+
+	if err := c.writeMessage(msg); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+func (c *Conn) writeMessage(msg *Message) error {
+	if len(msg.Data) > 0xFFFFFF {
+		return fmt.Errorf("message too large, len:%v", len(msg.Data))
+	}
+
+	timestamp := msg.Timestamp
+	extended := timestamp >= extendedTimestamp
+	if extended {
+		timestamp = extendedTimestamp
+	}
+
+	header := make([]byte, 0, 18)
+	header = append(header, c.basicHeader(0, msg.ChunkStreamID)...)
+	header = append(header, byte(timestamp>>16), byte(timestamp>>8), byte(timestamp))
+	length := len(msg.Data)
+	header = append(header, byte(length>>16), byte(length>>8), byte(length))
+	header = append(header, msg.Type)
+	streamID := make([]byte, 4)
+	binary.LittleEndian.PutUint32(streamID, msg.StreamID)
+	header = append(header, streamID...)
+	extendedBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(extendedBytes, msg.Timestamp)
+	if extended {
+		header = append(header, extendedBytes...)
+	}
+	if _, err := c.writer.Write(header); err != nil {
+		return err
+	}
+
+	continuation := c.basicHeader(3, msg.ChunkStreamID)
+	data := msg.Data
+	for {
+		size := len(data)
+		if size > int(c.outChunkSize) {
+			size = int(c.outChunkSize)
+		}
+		if _, err := c.writer.Write(data[:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+		if len(data) == 0 {
+			return nil
+		}
+		if _, err := c.writer.Write(continuation); err != nil {
+			return err
+		}
+		if extended {
+			if _, err := c.writer.Write(extendedBytes); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *Conn) basicHeader(format uint8, csid uint32) []byte {
+	if csid < 64 {
+		return []byte{format<<6 | byte(csid)}
+	}
+	if csid < 320 {
+		return []byte{format << 6, byte(csid - 64)}
+	}
+	return []byte{format<<6 | 1, byte((csid - 64) & 0xFF), byte((csid - 64) >> 8)}
+}
+
+// SetChunkSize tells the peer and the writer to use a new outgoing chunk size.
+func (c *Conn) SetChunkSize(size uint32) error {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, size)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.writeMessage(&Message{
+		ChunkStreamID: ChunkStreamProtocol,
+		Type:          MessageTypeSetChunkSize,
+		Data:          data,
+	}); err != nil {
+		return err
+	}
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+	c.outChunkSize = size
+	return nil
+}
+
+func (c *Conn) writeWindowAckSize(size uint32) error {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, size)
+	return c.WriteMessage(&Message{
+		ChunkStreamID: ChunkStreamProtocol,
+		Type:          MessageTypeWindowAckSize,
+		Data:          data,
+	})
+}
+
+func (c *Conn) writeSetPeerBandwidth(size uint32, limitType uint8) error {
+	data := make([]byte, 5)
+	binary.BigEndian.PutUint32(data, size)
+	data[4] = limitType
+	return c.WriteMessage(&Message{
+		ChunkStreamID: ChunkStreamProtocol,
+		Type:          MessageTypeSetPeerBandwidth,
+		Data:          data,
+	})
+}
+
+func (c *Conn) writeUserControl(event uint16, values ...uint32) error {
+	data := make([]byte, 2+4*len(values))
+	binary.BigEndian.PutUint16(data, event)
+	for i, v := range values {
+		binary.BigEndian.PutUint32(data[2+4*i:], v)
+	}
+	return c.WriteMessage(&Message{
+		ChunkStreamID: ChunkStreamProtocol,
+		Type:          MessageTypeUserControl,
+		Data:          data,
+	})
+}
+
+// WriteCommand writes an AMF0 command message.
+func (c *Conn) WriteCommand(streamID uint32, values ...interface{}) error {
+	data, err := AmfEncode(values...)
+	if err != nil {
+		return fmt.Errorf("AmfEncode failed, err:%v", err)
+	}
+	return c.WriteMessage(&Message{
+		ChunkStreamID: ChunkStreamCommand,
+		Type:          MessageTypeAmf0Command,
+		StreamID:      streamID,
+		Data:          data,
+	})
+}
@@ -0,0 +1,221 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// writeChunks chunks msgs with the outgoing chunk size
+func writeChunks(t *testing.T, chunkSize uint32, msgs ...*Message) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	c := &Conn{writer: bufio.NewWriter(buf), outChunkSize: chunkSize}
+	for _, msg := range msgs {
+		if err := c.writeMessage(msg); err != nil {
+			t.Fatalf("c.writeMessage failed, err:%v", err)
+		}
+	}
+	if err := c.writer.Flush(); err != nil {
+		t.Fatalf("c.writer.Flush failed, err:%v", err)
+	}
+	return buf.Bytes()
+}
+
+// readChunks reassembles the messages in data with the incoming chunk size
+func readChunks(t *testing.T, chunkSize uint32, data []byte) []*Message {
+	t.Helper()
+	c := &Conn{
+		reader:       bufio.NewReader(bytes.NewReader(data)),
+		inChunkSize:  chunkSize,
+		chunkStreams: make(map[uint32]*chunkStream),
+	}
+	var msgs []*Message
+	for {
+		msg, err := c.readChunk()
+		if err == io.EOF {
+			return msgs
+		}
+		if err != nil {
+			t.Fatalf("c.readChunk failed after %v messages, err:%v", len(msgs), err)
+		}
+		if msg != nil {
+			msgs = append(msgs, msg)
+		}
+	}
+}
+
+func payload(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+func TestWriteMessageChunks(t *testing.T) {
+	data := payload(300)
+	got := writeChunks(t, 128, &Message{ChunkStreamID: ChunkStreamVideo, Type: MessageTypeVideo, StreamID: 1, Timestamp: 1000, Data: data})
+
+	header, _ := hex.DecodeString("060003e800012c0901000000")
+	want := append(header, data[:128]...)
+	want = append(want, 0xC6)
+	want = append(want, data[128:256]...)
+	want = append(want, 0xC6)
+	want = append(want, data[256:]...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("chunks = %x, want %x", got, want)
+	}
+}
+
+func TestWriteMessageExtendedTimestamp(t *testing.T) {
+	data := payload(200)
+	got := writeChunks(t, 128, &Message{ChunkStreamID: ChunkStreamAudio, Type: MessageTypeAudio, StreamID: 1, Timestamp: 0x01000000, Data: data})
+
+	// the extended timestamp follows the type 0 header and is repeated in
+	// the type 3 chunk
+	header, _ := hex.DecodeString("04ffffff0000c8080100000001000000")
+	want := append(header, data[:128]...)
+	want = append(want, 0xC4, 0x01, 0x00, 0x00, 0x00)
+	want = append(want, data[128:]...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("chunks = %x, want %x", got, want)
+	}
+}
+
+func TestChunkRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkSize uint32
+		msg       *Message
+	}{
+		{"empty", 128, &Message{ChunkStreamID: ChunkStreamCommand, Type: MessageTypeAmf0Command}},
+		{"one chunk", 128, &Message{ChunkStreamID: ChunkStreamAudio, Type: MessageTypeAudio, StreamID: 1, Timestamp: 23, Data: payload(128)}},
+		{"split", 128, &Message{ChunkStreamID: ChunkStreamVideo, Type: MessageTypeVideo, StreamID: 1, Timestamp: 40, Data: payload(1000)}},
+		{"large chunk size", 4096, &Message{ChunkStreamID: ChunkStreamVideo, Type: MessageTypeVideo, StreamID: 1, Timestamp: 40, Data: payload(10000)}},
+		{"chunk size 1", 1, &Message{ChunkStreamID: ChunkStreamData, Type: MessageTypeAmf0Data, StreamID: 1, Data: payload(5)}},
+		{"timestamp below extended", 128, &Message{ChunkStreamID: ChunkStreamVideo, Type: MessageTypeVideo, StreamID: 1, Timestamp: 0xFFFFFE, Data: payload(300)}},
+		{"timestamp 0xffffff", 128, &Message{ChunkStreamID: ChunkStreamVideo, Type: MessageTypeVideo, StreamID: 1, Timestamp: 0xFFFFFF, Data: payload(300)}},
+		{"extended timestamp", 128, &Message{ChunkStreamID: ChunkStreamVideo, Type: MessageTypeVideo, StreamID: 1, Timestamp: 0xFFFFFFFF, Data: payload(300)}},
+		{"two byte chunk stream id", 128, &Message{ChunkStreamID: 64, Type: MessageTypeAudio, StreamID: 1, Data: payload(300)}},
+		{"three byte chunk stream id", 128, &Message{ChunkStreamID: 65599, Type: MessageTypeAudio, StreamID: 1, Data: payload(300)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs := readChunks(t, tt.chunkSize, writeChunks(t, tt.chunkSize, tt.msg))
+			if len(msgs) != 1 || !reflect.DeepEqual(msgs[0], tt.msg) {
+				t.Fatalf("messages = %+v, want %+v", msgs, tt.msg)
+			}
+		})
+	}
+}
+
+func TestReadChunkInterleaved(t *testing.T) {
+	audio := payload(150)
+	video := payload(200)
+
+	var data []byte
+	// audio type 0, 150 bytes at 100 ms, first chunk
+	data = append(data, 0x04, 0x00, 0x00, 0x64, 0x00, 0x00, 0x96, 0x08, 0x01, 0x00, 0x00, 0x00)
+	data = append(data, audio[:128]...)
+	// video type 0, 200 bytes at 0xFFFFFF+1 ms, first chunk
+	data = append(data, 0x06, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0xC8, 0x09, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00)
+	data = append(data, video[:128]...)
+	// audio type 3, the rest
+	data = append(data, 0xC4)
+	data = append(data, audio[128:]...)
+	// video type 3 with the extended timestamp, the rest
+	data = append(data, 0xC6, 0x01, 0x00, 0x00, 0x00)
+	data = append(data, video[128:]...)
+	// audio type 2, a delta of 20 ms with the same length and type
+	data = append(data, 0x84, 0x00, 0x00, 0x14)
+	data = append(data, audio[:128]...)
+	data = append(data, 0xC4)
+	data = append(data, audio[128:]...)
+	// audio type 3 starting a new message, the delta is applied again
+	data = append(data, 0xC4)
+	data = append(data, audio[:128]...)
+	data = append(data, 0xC4)
+	data = append(data, audio[128:]...)
+	// audio type 1, a delta of 23 ms and a new length
+	data = append(data, 0x44, 0x00, 0x00, 0x17, 0x00, 0x00, 0x04, 0x08)
+	data = append(data, audio[:4]...)
+
+	want := []*Message{
+		{ChunkStreamID: ChunkStreamAudio, Type: MessageTypeAudio, StreamID: 1, Timestamp: 100, Data: audio},
+		{ChunkStreamID: ChunkStreamVideo, Type: MessageTypeVideo, StreamID: 1, Timestamp: 0x1000000, Data: video},
+		{ChunkStreamID: ChunkStreamAudio, Type: MessageTypeAudio, StreamID: 1, Timestamp: 120, Data: audio},
+		{ChunkStreamID: ChunkStreamAudio, Type: MessageTypeAudio, StreamID: 1, Timestamp: 140, Data: audio},
+		{ChunkStreamID: ChunkStreamAudio, Type: MessageTypeAudio, StreamID: 1, Timestamp: 163, Data: audio[:4]},
+	}
+	got := readChunks(t, 128, data)
+	if len(got) != len(want) {
+		t.Fatalf("%v messages, want %v", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("message %v = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadChunkErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"first chunk is type 3", "c4"},
+		{"message too large", "04000000ffffff0801000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.data)
+			c := &Conn{
+				reader:       bufio.NewReader(bytes.NewReader(data)),
+				inChunkSize:  defaultChunkSize,
+				chunkStreams: make(map[uint32]*chunkStream),
+			}
+			if _, err := c.readChunk(); err == nil {
+				t.Fatalf("c.readChunk(%v) succeeded", tt.data)
+			}
+		})
+	}
+}
+
+func TestConnSetChunkSize(t *testing.T) {
+	a, b := net.Pipe()
+	writer, reader := newConn(a), newConn(b)
+	defer writer.Close()
+	defer reader.Close()
+
+	msg := &Message{ChunkStreamID: ChunkStreamVideo, Type: MessageTypeVideo, StreamID: 1, Timestamp: 0x12345678, Data: payload(10000)}
+	errs := make(chan error, 1)
+	go func() {
+		if err := writer.SetChunkSize(outChunkSize); err != nil {
+			errs <- err
+			return
+		}
+		errs <- writer.WriteMessage(msg)
+	}()
+
+	got, err := reader.ReadMessage()
+	if err != nil || got.Type != MessageTypeSetChunkSize {
+		t.Fatalf("ReadMessage = %+v, %v, want a set chunk size", got, err)
+	}
+	if reader.inChunkSize != outChunkSize {
+		t.Fatalf("inChunkSize = %v, want %v", reader.inChunkSize, outChunkSize)
+	}
+	if got, err = reader.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage failed, err:%v", err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Fatalf("ReadMessage = %+v, want %+v", got, msg)
+	}
+	if err = <-errs; err != nil {
+		t.Fatalf("write failed, err:%v", err)
+	}
+}
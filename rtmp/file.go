@@ -0,0 +1,239 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"flvParse/flv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// PublishFile reads the tags of an FLV file with the parser and publishes them
+// to rawURL, paced by their timestamps. With loop the file is sent again and
+// again with continuing timestamps.
+func PublishFile(rawURL string, path string, loop bool) error {
+	c, err := Dial(rawURL)
+	if err != nil {
+		return fmt.Errorf("Dial failed, err:%v", err)
+	}
+	defer c.CloseStream()
+
+	if err = c.Publish(); err != nil {
+		return fmt.Errorf("c.Publish failed, err:%v", err)
+	}
+
+	// drain acknowledgements and pings while publishing
+	go func() {
+		for {
+			if _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	var offset uint32
+	for {
+		last, err := publishFileOnce(c, path, start, offset)
+		if err != nil {
+			return err
+		}
+		if !loop {
+			return nil
+		}
+		offset = last + 40
+	}
+}
+
+func publishFileOnce(c *Client, path string, start time.Time, offset uint32) (uint32, error) {
+	flvFile, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("os.Open failed, err:%v", err)
+	}
+	defer flvFile.Close()
+
+	f := new(flv.Flv)
+	f.Quiet = true
+	f.DisableExtract = true
+
+	// pace by the normalized timestamps, which survive wraps and encoder restarts
+	first := true
+	var base int64
+	var last uint32
+	f.OnTag = func(tag *flv.CurrentTag) error {
+		if first {
+			base = tag.NormalizedTimestamp
+			first = false
+		}
+		timestamp := offset
+		if tag.NormalizedTimestamp > base {
+			timestamp += uint32(tag.NormalizedTimestamp - base)
+		}
+		last = timestamp
+
+		wait := time.Until(start.Add(time.Duration(timestamp) * time.Millisecond))
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		if err := c.WriteTag(tag.TagType, timestamp, flv.TagBody(tag.Data)); err != nil {
+			return fmt.Errorf("c.WriteTag failed, err:%v", err)
+		}
+		return nil
+	}
+
+	buf := make([]byte, 0)
+	tmpBuf := make([]byte, 1024000)
+	for {
+		length, errRead := flvFile.Read(tmpBuf)
+		if errRead != nil && errRead != io.EOF {
+			return 0, fmt.Errorf("flvFile.Read failed, err:%v", errRead)
+		}
+		if length == 0 {
+			return last, nil
+		}
+		buf = append(buf, tmpBuf[:length]...)
+
+		buf, err = f.Parse(buf)
+		if err != nil {
+			return 0, fmt.Errorf("f.Parse failed, err:%v", err)
+		}
+	}
+}
+
+// PlayToFile plays rawURL and writes the received audio, video and data
+// messages into an FLV file until the stream ends or duration has passed.
+// A zero duration plays until the stream ends.
+func PlayToFile(rawURL string, path string, duration time.Duration) error {
+	c, err := Dial(rawURL)
+	if err != nil {
+		return fmt.Errorf("Dial failed, err:%v", err)
+	}
+	defer c.CloseStream()
+
+	if err = c.Play(); err != nil {
+		return fmt.Errorf("c.Play failed, err:%v", err)
+	}
+
+	flvFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("os.Create failed, err:%v", err)
+	}
+	defer flvFile.Close()
+
+	if err = flv.WriteHeader(flvFile, true, true); err != nil {
+		return fmt.Errorf("flv.WriteHeader failed, err:%v", err)
+	}
+
+	if duration > 0 {
+		// a deadline instead of a check between messages, a silent stream
+		// must not block past the duration
+		c.ReadTimeout = 0
+		_ = c.netConn.SetReadDeadline(time.Now().Add(duration))
+	}
+
+	for {
+		msg, err := c.ReadMessage()
+		// the peer may close in the middle of a chunk, the tags written so
+		// far are still a valid recording
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() && duration > 0 {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("c.ReadMessage failed, err:%v", err)
+		}
+
+		switch msg.Type {
+		case MessageTypeAudio, MessageTypeVideo:
+			if len(msg.Data) == 0 {
+				continue
+			}
+			if err = flv.WriteTag(flvFile, msg.Type, msg.Timestamp, msg.Data); err != nil {
+				return fmt.Errorf("flv.WriteTag failed, err:%v", err)
+			}
+		case MessageTypeAmf0Data:
+			data := stripSetDataFrame(msg.Data)
+			if data == nil {
+				continue
+			}
+			if err = flv.WriteTag(flvFile, msg.Type, msg.Timestamp, data); err != nil {
+				return fmt.Errorf("flv.WriteTag failed, err:%v", err)
+			}
+		case MessageTypeAggregate:
+			if err = writeAggregate(flvFile, msg); err != nil {
+				return fmt.Errorf("writeAggregate failed, err:%v", err)
+			}
+		case MessageTypeUserControl:
+			if len(msg.Data) >= 2 && binary.BigEndian.Uint16(msg.Data) == UserControlStreamEOF {
+				return nil
+			}
+		case MessageTypeAmf0Command:
+			values, err := AmfDecode(msg.Data)
+			if err != nil || len(values) < 4 || values[0] != "onStatus" {
+				continue
+			}
+			info, _ := values[3].(AmfObject)
+			switch info["code"] {
+			case "NetStream.Play.Stop", "NetStream.Play.Complete", "NetStream.Play.UnpublishNotify":
+				return nil
+			}
+		}
+	}
+}
+
+// stripSetDataFrame returns the onMetaData body of a data message, or nil for
+// other data messages such as |RtmpSampleAccess.
+func stripSetDataFrame(data []byte) []byte {
+	values, err := AmfDecode(data)
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+	name, _ := values[0].(string)
+	if name == "@setDataFrame" {
+		prefix, _ := AmfEncode(name)
+		return data[len(prefix):]
+	}
+	if name == "onMetaData" {
+		return data
+	}
+	return nil
+}
+
+// writeAggregate splits an aggregate message into its FLV tags. The tag
+// timestamps are relative to the first one and rebased on the message timestamp.
+func writeAggregate(w io.Writer, msg *Message) error {
+	data := msg.Data
+	var base uint32
+	first := true
+	for len(data) >= 11 {
+		dataSize := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		if len(data) < 11+dataSize {
+			return fmt.Errorf("aggregate sub message truncated")
+		}
+		timestamp := uint32(data[7])<<24 | uint32(data[4])<<16 | uint32(data[5])<<8 | uint32(data[6])
+		if first {
+			base = timestamp
+			first = false
+		}
+
+		tagType := data[0] & flv.TagTagTypeMark
+		body := data[11 : 11+dataSize]
+		if tagType == MessageTypeAudio || tagType == MessageTypeVideo {
+			if err := flv.WriteTag(w, tagType, msg.Timestamp+timestamp-base, body); err != nil {
+				return err
+			}
+		}
+
+		data = data[11+dataSize:]
+		// back pointer
+		if len(data) >= 4 {
+			data = data[4:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package rtmp
+
+import (
+	"bytes"
+	"flvParse/flv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keeps the published tags, after limit tags it fails the publish
+type recorder struct {
+	mu     sync.Mutex
+	tags   []testTag
+	limit  int
+	closed chan struct{}
+}
+
+func newRecorder(limit int) *recorder {
+	return &recorder{limit: limit, closed: make(chan struct{})}
+}
+
+func (r *recorder) OnPublish(app string, stream string) (Publisher, error) {
+	return r, nil
+}
+
+func (r *recorder) WriteTag(tagType uint8, timestamp uint32, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.limit > 0 && len(r.tags) >= r.limit {
+		return fmt.Errorf("recorded %v tags", r.limit)
+	}
+	r.tags = append(r.tags, testTag{tagType, timestamp, append([]byte(nil), body...)})
+	return nil
+}
+
+func (r *recorder) Close() {
+	close(r.closed)
+}
+
+func (r *recorder) recorded() []testTag {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]testTag(nil), r.tags...)
+}
+
+// writeTestFile writes tags as an FLV file in a temporary directory
+func writeTestFile(t *testing.T, tags []testTag) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "rtmp")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed, err:%v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	buf := new(bytes.Buffer)
+	_ = flv.WriteHeader(buf, true, true)
+	for _, tag := range tags {
+		_ = flv.WriteTag(buf, tag.tagType, tag.timestamp, tag.body)
+	}
+	path := filepath.Join(dir, "in.flv")
+	if err = ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile failed, err:%v", err)
+	}
+	return path
+}
+
+// fileTags is a short AVC and AAC recording, the AVC frames carry no NAL units
+func fileTags() []testTag {
+	metaData, _ := AmfEncode("onMetaData", AmfObject{"framerate": 25})
+	return []testTag{
+		{flv.TagTypeScriptData, 0, metaData},
+		{flv.TagTypeVideo, 0, []byte{0x17, 0x02, 0x00, 0x00, 0x00}},
+		{flv.TagTypeAudio, 0, []byte{0xAF, 0x00, 0x12, 0x10}},
+		{flv.TagTypeVideo, 40, []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+		{flv.TagTypeAudio, 46, []byte{0xAF, 0x01, 0x21, 0x00}},
+		{flv.TagTypeVideo, 80, []byte{0x27, 0x01, 0x00, 0x00, 0x00}},
+	}
+}
+
+func TestPublishFile(t *testing.T) {
+	r := newRecorder(0)
+	url := startServer(t, &Server{OnPublish: r.OnPublish})
+	tags := fileTags()
+	path := writeTestFile(t, tags)
+
+	start := time.Now()
+	if err := PublishFile(url+"test", path, false); err != nil {
+		t.Fatalf("PublishFile failed, err:%v", err)
+	}
+	// paced by the timestamps, the last tag is at 80 ms
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("published in %v, want at least 80ms", elapsed)
+	}
+
+	select {
+	case <-r.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("publisher not closed")
+	}
+	if got := r.recorded(); !reflect.DeepEqual(got, tags) {
+		t.Fatalf("recorded %+v, want %+v", got, tags)
+	}
+}
+
+func TestPublishFileLoop(t *testing.T) {
+	// the publish fails after the first tags of the third pass
+	r := newRecorder(14)
+	url := startServer(t, &Server{OnPublish: r.OnPublish})
+	tags := fileTags()
+	path := writeTestFile(t, tags)
+
+	published := make(chan error, 1)
+	go func() {
+		published <- PublishFile(url+"test", path, true)
+	}()
+	select {
+	case err := <-published:
+		if err == nil {
+			t.Fatalf("PublishFile with loop returned without an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("PublishFile did not end after the server closed the connection")
+	}
+
+	// every pass continues 40 ms after the last tag of the previous one
+	var want []testTag
+	for _, offset := range []uint32{0, 120, 240} {
+		for _, tag := range tags {
+			want = append(want, testTag{tag.tagType, tag.timestamp + offset, tag.body})
+		}
+	}
+	if got := r.recorded(); !reflect.DeepEqual(got, want[:14]) {
+		t.Fatalf("recorded %+v, want %+v", got, want[:14])
+	}
+}
+
+func TestPlayToFileDuration(t *testing.T) {
+	r := newRelay()
+	url := startServer(t, &Server{OnPublish: r.OnPublish, OnPlay: r.OnPlay})
+	dir, err := ioutil.TempDir("", "rtmp")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed, err:%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// nothing is published, the stream stays silent
+	start := time.Now()
+	if err = PlayToFile(url+"test", filepath.Join(dir, "play.flv"), 200*time.Millisecond); err != nil {
+		t.Fatalf("PlayToFile failed, err:%v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("PlayToFile of 200ms returned after %v", elapsed)
+	}
+}
@@ -0,0 +1,307 @@
+package rtmp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Publisher receives the tags of one published stream. Script data is passed
+// without the @setDataFrame prefix.
+type Publisher interface {
+	WriteTag(tagType uint8, timestamp uint32, body []byte) error
+	Close()
+}
+
+// Server accepts RTMP publish sessions and hands their tags to the Publisher
+// returned by OnPublish. A stream is published by one connection at a time, a
+// second publish is rejected with NetStream.Publish.BadName.
+//
+// Play is supported when OnPlay is set. OnPlay gets the play session as a
+// Publisher to write the tags to and returns a function that is called when
+// the session ends. Closing the player ends the session.
+type Server struct {
+	Addr      string
+	OnPublish func(app string, stream string) (Publisher, error)
+	OnPlay    func(app string, stream string, player Publisher) (func(), error)
+
+	mu         sync.Mutex
+	publishing map[string]*serverSession
+}
+
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("net.Listen failed, err:%v", err)
+	}
+	return s.Serve(l)
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	for {
+		netConn, err := l.Accept()
+		if err != nil {
+			return fmt.Errorf("l.Accept failed, err:%v", err)
+		}
+		go func() {
+			if err := s.serveConn(netConn); err != nil {
+				fmt.Printf("rtmp conn %v closed, err:%v\n", netConn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+type serverSession struct {
+	*Conn
+	server     *Server
+	app        string
+	publishKey string
+	publisher  Publisher
+	stopPlay   func()
+}
+
+// claimPublish reserves app/stream for session, false if another session
+// publishes it
+func (s *Server) claimPublish(key string, session *serverSession) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.publishing == nil {
+		s.publishing = make(map[string]*serverSession)
+	}
+	if _, ok := s.publishing[key]; ok {
+		return false
+	}
+	s.publishing[key] = session
+	return true
+}
+
+func (s *Server) releasePublish(key string, session *serverSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.publishing[key] == session {
+		delete(s.publishing, key)
+	}
+}
+
+func (s *Server) serveConn(netConn net.Conn) error {
+	session := &serverSession{
+		Conn:   newConn(netConn),
+		server: s,
+	}
+	defer session.close()
+
+	if err := session.serverHandshake(); err != nil {
+		return fmt.Errorf("session.serverHandshake failed, err:%v", err)
+	}
+
+	for {
+		msg, err := session.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		switch msg.Type {
+		case MessageTypeAudio, MessageTypeVideo:
+			if session.publisher == nil {
+				continue
+			}
+			if err = session.publisher.WriteTag(msg.Type, msg.Timestamp, msg.Data); err != nil {
+				return fmt.Errorf("publisher.WriteTag failed, err:%v", err)
+			}
+		case MessageTypeAmf0Data:
+			data := stripSetDataFrame(msg.Data)
+			if session.publisher == nil || data == nil {
+				continue
+			}
+			if err = session.publisher.WriteTag(msg.Type, msg.Timestamp, data); err != nil {
+				return fmt.Errorf("publisher.WriteTag failed, err:%v", err)
+			}
+		case MessageTypeAmf0Command:
+			done, err := session.handleCommand(msg)
+			if err != nil {
+				return err
+			}
+			if done {
+				return nil
+			}
+		}
+	}
+}
+
+func (session *serverSession) handleCommand(msg *Message) (bool, error) {
+	values, err := AmfDecode(msg.Data)
+	if err != nil || len(values) < 2 {
+		return false, nil
+	}
+	name, _ := values[0].(string)
+	transactionID := values[1]
+
+	switch name {
+	case "connect":
+		if len(values) > 2 {
+			properties, _ := values[2].(AmfObject)
+			session.app, _ = properties["app"].(string)
+		}
+		if err = session.writeWindowAckSize(defaultWindowAck); err != nil {
+			return false, err
+		}
+		if err = session.writeSetPeerBandwidth(defaultWindowAck, 2); err != nil {
+			return false, err
+		}
+		if err = session.SetChunkSize(outChunkSize); err != nil {
+			return false, err
+		}
+		return false, session.WriteCommand(0, "_result", transactionID,
+			AmfObject{"fmsVer": "FMS/3,0,1,123", "capabilities": 31},
+			AmfObject{
+				"level":          "status",
+				"code":           "NetConnection.Connect.Success",
+				"description":    "Connection succeeded.",
+				"objectEncoding": 0,
+			})
+	case "releaseStream", "FCPublish":
+		return false, session.WriteCommand(0, "_result", transactionID, nil)
+	case "createStream":
+		return false, session.WriteCommand(0, "_result", transactionID, nil, 1)
+	case "publish":
+		if len(values) < 4 {
+			return false, fmt.Errorf("publish without stream name")
+		}
+		stream, _ := values[3].(string)
+		if i := strings.Index(stream, "?"); i >= 0 {
+			stream = stream[:i]
+		}
+
+		key := session.app + "/" + stream
+		if session.publisher != nil || !session.server.claimPublish(key, session) {
+			_ = session.WriteCommand(msg.StreamID, "onStatus", 0, nil, AmfObject{
+				"level":       "error",
+				"code":        "NetStream.Publish.BadName",
+				"description": fmt.Sprintf("%v is already being published", key),
+			})
+			return true, fmt.Errorf("%v is already being published", key)
+		}
+		session.publishKey = key
+
+		publisher, err := session.server.OnPublish(session.app, stream)
+		if err != nil {
+			_ = session.WriteCommand(msg.StreamID, "onStatus", 0, nil, AmfObject{
+				"level":       "error",
+				"code":        "NetStream.Publish.BadName",
+				"description": err.Error(),
+			})
+			return true, fmt.Errorf("OnPublish failed, err:%v", err)
+		}
+		session.publisher = publisher
+
+		if err = session.writeUserControl(UserControlStreamBegin, msg.StreamID); err != nil {
+			return false, err
+		}
+		return false, session.WriteCommand(msg.StreamID, "onStatus", 0, nil, AmfObject{
+			"level":       "status",
+			"code":        "NetStream.Publish.Start",
+			"description": "Start publishing.",
+		})
+	case "play":
+		if session.server.OnPlay == nil || session.stopPlay != nil || len(values) < 4 {
+			_ = session.WriteCommand(msg.StreamID, "onStatus", 0, nil, AmfObject{
+				"level":       "error",
+				"code":        "NetStream.Play.Failed",
+				"description": "play is not supported, use http-flv",
+			})
+			return true, nil
+		}
+		stream, _ := values[3].(string)
+		if i := strings.Index(stream, "?"); i >= 0 {
+			stream = stream[:i]
+		}
+
+		// the status goes out before OnPlay so it precedes the first tag
+		if err = session.writeUserControl(UserControlStreamBegin, msg.StreamID); err != nil {
+			return false, err
+		}
+		if err = session.WriteCommand(msg.StreamID, "onStatus", 0, nil, AmfObject{
+			"level":       "status",
+			"code":        "NetStream.Play.Start",
+			"description": "Start playing.",
+		}); err != nil {
+			return false, err
+		}
+
+		stopPlay, err := session.server.OnPlay(session.app, stream, &serverPlayer{Conn: session.Conn, streamID: msg.StreamID})
+		if err != nil {
+			_ = session.WriteCommand(msg.StreamID, "onStatus", 0, nil, AmfObject{
+				"level":       "error",
+				"code":        "NetStream.Play.StreamNotFound",
+				"description": err.Error(),
+			})
+			return true, fmt.Errorf("OnPlay failed, err:%v", err)
+		}
+		session.stopPlay = stopPlay
+
+		// a player only sends control messages and may stay silent for the
+		// whole stream
+		session.ReadTimeout = 0
+		_ = session.netConn.SetReadDeadline(time.Time{})
+		return false, nil
+	case "FCUnpublish", "deleteStream", "closeStream":
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (session *serverSession) close() {
+	if session.stopPlay != nil {
+		session.stopPlay()
+		session.stopPlay = nil
+	}
+	if session.publisher != nil {
+		session.publisher.Close()
+		session.publisher = nil
+	}
+	if session.publishKey != "" {
+		session.server.releasePublish(session.publishKey, session)
+		session.publishKey = ""
+	}
+	_ = session.Close()
+}
+
+// serverPlayer writes the tags of a played stream to the play session
+type serverPlayer struct {
+	*Conn
+	streamID uint32
+}
+
+func (p *serverPlayer) WriteTag(tagType uint8, timestamp uint32, body []byte) error {
+	msg := &Message{
+		Type:      tagType,
+		StreamID:  p.streamID,
+		Timestamp: timestamp,
+		Data:      body,
+	}
+
+	switch tagType {
+	case MessageTypeAudio:
+		msg.ChunkStreamID = ChunkStreamAudio
+	case MessageTypeVideo:
+		msg.ChunkStreamID = ChunkStreamVideo
+	case MessageTypeAmf0Data:
+		msg.ChunkStreamID = ChunkStreamData
+	default:
+		return fmt.Errorf("unsupported tag type:%v", tagType)
+	}
+
+	return p.WriteMessage(msg)
+}
+
+// Close sends StreamEOF and closes the connection, which ends the session.
+func (p *serverPlayer) Close() {
+	_ = p.writeUserControl(UserControlStreamEOF, p.streamID)
+	_ = p.Conn.Close()
+}
@@ -0,0 +1,212 @@
+package rtmp
+
+import (
+	"bytes"
+	"flvParse/flv"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// relay passes the tags of the published streams to their players
+type relay struct {
+	mu      sync.Mutex
+	players map[string]map[Publisher]struct{}
+	playing chan string
+}
+
+func newRelay() *relay {
+	return &relay{
+		players: make(map[string]map[Publisher]struct{}),
+		playing: make(chan string, 16),
+	}
+}
+
+func (r *relay) OnPublish(app string, stream string) (Publisher, error) {
+	return &relayPublisher{relay: r, key: app + "/" + stream}, nil
+}
+
+func (r *relay) OnPlay(app string, stream string, player Publisher) (func(), error) {
+	key := app + "/" + stream
+	r.mu.Lock()
+	if r.players[key] == nil {
+		r.players[key] = make(map[Publisher]struct{})
+	}
+	r.players[key][player] = struct{}{}
+	r.mu.Unlock()
+
+	r.playing <- key
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.players[key], player)
+	}, nil
+}
+
+type relayPublisher struct {
+	relay *relay
+	key   string
+}
+
+func (p *relayPublisher) WriteTag(tagType uint8, timestamp uint32, body []byte) error {
+	p.relay.mu.Lock()
+	defer p.relay.mu.Unlock()
+	for player := range p.relay.players[p.key] {
+		if err := player.WriteTag(tagType, timestamp, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *relayPublisher) Close() {
+	p.relay.mu.Lock()
+	defer p.relay.mu.Unlock()
+	for player := range p.relay.players[p.key] {
+		player.Close()
+	}
+}
+
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen failed, err:%v", err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { l.Close() })
+	return "rtmp://" + l.Addr().String() + "/live/"
+}
+
+type testTag struct {
+	tagType   uint8
+	timestamp uint32
+	body      []byte
+}
+
+func TestServerPublishPlay(t *testing.T) {
+	r := newRelay()
+	url := startServer(t, &Server{OnPublish: r.OnPublish, OnPlay: r.OnPlay})
+
+	dir, err := ioutil.TempDir("", "rtmp")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed, err:%v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "play.flv")
+
+	played := make(chan error, 1)
+	go func() {
+		played <- PlayToFile(url+"test", path, 10*time.Second)
+	}()
+	select {
+	case key := <-r.playing:
+		if key != "live/test" {
+			t.Fatalf("playing %v, want live/test", key)
+		}
+	case err := <-played:
+		t.Fatalf("PlayToFile failed, err:%v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("play did not start")
+	}
+
+	metaData, _ := AmfEncode("onMetaData", AmfObject{"framerate": 25, "width": 1920})
+	bigFrame := make([]byte, 20000)
+	for i := range bigFrame {
+		bigFrame[i] = byte(i)
+	}
+	tags := []testTag{
+		{flv.TagTypeScriptData, 0, metaData},
+		{flv.TagTypeVideo, 0, []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x64, 0x00, 0x28}},
+		{flv.TagTypeAudio, 0, []byte{0xAF, 0x00, 0x12, 0x10}},
+		{flv.TagTypeVideo, 40, append([]byte{0x17, 0x01, 0x00, 0x00, 0x00}, bigFrame...)},
+		{flv.TagTypeAudio, 46, []byte{0xAF, 0x01, 0x21, 0x00}},
+		// past the 24 bit timestamp field
+		{flv.TagTypeVideo, 0x1000000, []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0xAA}},
+	}
+
+	publisher, err := Dial(url + "test")
+	if err != nil {
+		t.Fatalf("Dial failed, err:%v", err)
+	}
+	if err = publisher.Publish(); err != nil {
+		t.Fatalf("Publish failed, err:%v", err)
+	}
+	want := new(bytes.Buffer)
+	_ = flv.WriteHeader(want, true, true)
+	for _, tag := range tags {
+		if err = publisher.WriteTag(tag.tagType, tag.timestamp, tag.body); err != nil {
+			t.Fatalf("WriteTag failed, err:%v", err)
+		}
+		_ = flv.WriteTag(want, tag.tagType, tag.timestamp, tag.body)
+	}
+	_ = publisher.CloseStream()
+
+	select {
+	case err := <-played:
+		if err != nil {
+			t.Fatalf("PlayToFile failed, err:%v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("play did not end after the publisher closed")
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile failed, err:%v", err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("played %v bytes, want the %v published bytes", len(got), want.Len())
+	}
+}
+
+func TestServerRejectsSecondPublisher(t *testing.T) {
+	r := newRelay()
+	url := startServer(t, &Server{OnPublish: r.OnPublish})
+
+	first, err := Dial(url + "test")
+	if err != nil {
+		t.Fatalf("Dial failed, err:%v", err)
+	}
+	defer first.CloseStream()
+	if err = first.Publish(); err != nil {
+		t.Fatalf("Publish failed, err:%v", err)
+	}
+
+	second, err := Dial(url + "test?token=1")
+	if err != nil {
+		t.Fatalf("Dial failed, err:%v", err)
+	}
+	defer second.CloseStream()
+	if err = second.Publish(); err == nil || !strings.Contains(err.Error(), "NetStream.Publish.BadName") {
+		t.Fatalf("second Publish err:%v, want NetStream.Publish.BadName", err)
+	}
+
+	other, err := Dial(url + "other")
+	if err != nil {
+		t.Fatalf("Dial failed, err:%v", err)
+	}
+	defer other.CloseStream()
+	if err = other.Publish(); err != nil {
+		t.Fatalf("Publish of another stream failed, err:%v", err)
+	}
+}
+
+func TestServerPlayNotSupported(t *testing.T) {
+	r := newRelay()
+	url := startServer(t, &Server{OnPublish: r.OnPublish})
+
+	c, err := Dial(url + "test")
+	if err != nil {
+		t.Fatalf("Dial failed, err:%v", err)
+	}
+	defer c.CloseStream()
+	if err = c.Play(); err == nil || !strings.Contains(err.Error(), "NetStream.Play.Failed") {
+		t.Fatalf("Play err:%v, want NetStream.Play.Failed", err)
+	}
+}
@@ -0,0 +1,155 @@
+package util
+
+import "fmt"
+
+// BitReader reads big endian bit fields from a byte slice.
+type BitReader struct {
+	buf []byte
+	pos int
+}
+
+func NewBitReader(buf []byte) *BitReader {
+	return &BitReader{buf: buf}
+}
+
+func (r *BitReader) ReadBits(n int) (uint32, error) {
+	if n > 32 {
+		return 0, fmt.Errorf("can not read more than 32 bits, n:%v", n)
+	}
+	if r.BitsLeft() < n {
+		return 0, fmt.Errorf("read %v bits with %v bits left", n, r.BitsLeft())
+	}
+
+	var x uint32
+	for i := 0; i < n; i++ {
+		bit := (r.buf[r.pos>>3] >> (7 - uint(r.pos&7))) & 1
+		x = x<<1 | uint32(bit)
+		r.pos++
+	}
+	return x, nil
+}
+
+func (r *BitReader) ReadFlag() (bool, error) {
+	x, err := r.ReadBits(1)
+	return x == 1, err
+}
+
+func (r *BitReader) Skip(n int) error {
+	if r.BitsLeft() < n {
+		return fmt.Errorf("skip %v bits with %v bits left", n, r.BitsLeft())
+	}
+	r.pos += n
+	return nil
+}
+
+// ReadUE reads an unsigned exp-Golomb code.
+func (r *BitReader) ReadUE() (uint32, error) {
+	leadingZeros := 0
+	for {
+		bit, err := r.ReadBits(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+		leadingZeros++
+		if leadingZeros > 31 {
+			return 0, fmt.Errorf("exp-Golomb code with more than 31 leading zeros")
+		}
+	}
+	if leadingZeros == 0 {
+		return 0, nil
+	}
+	x, err := r.ReadBits(leadingZeros)
+	if err != nil {
+		return 0, err
+	}
+	return (1<<uint(leadingZeros) - 1) + x, nil
+}
+
+// ReadSE reads a signed exp-Golomb code.
+func (r *BitReader) ReadSE() (int32, error) {
+	x, err := r.ReadUE()
+	if err != nil {
+		return 0, err
+	}
+	if x&1 == 1 {
+		return int32((x + 1) / 2), nil
+	}
+	return -int32(x / 2), nil
+}
+
+// ByteAlign skips to the next byte boundary.
+func (r *BitReader) ByteAlign() {
+	r.pos = (r.pos + 7) &^ 7
+	if r.pos > len(r.buf)*8 {
+		r.pos = len(r.buf) * 8
+	}
+}
+
+func (r *BitReader) BitsLeft() int {
+	return len(r.buf)*8 - r.pos
+}
+
+func (r *BitReader) BitPos() int {
+	return r.pos
+}
+
+// BitWriter writes big endian bit fields.
+type BitWriter struct {
+	buf []byte
+	pos int
+}
+
+func (w *BitWriter) WriteBits(x uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos&7 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if (x>>uint(i))&1 == 1 {
+			w.buf[len(w.buf)-1] |= 1 << (7 - uint(w.pos&7))
+		}
+		w.pos++
+	}
+}
+
+// WriteBytes writes the first n bits of buf.
+func (w *BitWriter) WriteBytes(buf []byte, n int) {
+	for i := 0; i < n; i++ {
+		w.WriteBits(uint32(buf[i>>3]>>(7-uint(i&7))), 1)
+	}
+}
+
+// ByteAlign pads with zero bits to the next byte boundary.
+func (w *BitWriter) ByteAlign() {
+	w.pos = (w.pos + 7) &^ 7
+}
+
+func (w *BitWriter) BitPos() int {
+	return w.pos
+}
+
+func (w *BitWriter) Bytes() []byte {
+	return w.buf
+}
+
+// RemoveEmulationPrevention returns the RBSP of a NAL unit, without the 0x03
+// bytes inserted after every 0x00 0x00.
+func RemoveEmulationPrevention(nal []byte) []byte {
+	rbsp := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		rbsp = append(rbsp, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return rbsp
+}
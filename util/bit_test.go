@@ -0,0 +1,84 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadUE(t *testing.T) {
+	// 1, 010, 011, 00100, 00111, 0001000 are 0, 1, 2, 3, 6, 7
+	r := NewBitReader([]byte{0xA6, 0x43, 0x88, 0x00})
+	for _, want := range []uint32{0, 1, 2, 3, 6, 7} {
+		got, err := r.ReadUE()
+		if err != nil {
+			t.Fatalf("ReadUE failed, err:%v", err)
+		}
+		if got != want {
+			t.Fatalf("ReadUE = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestReadUELarge(t *testing.T) {
+	// 31 leading zeros, the largest code that fits, then one too many
+	w := new(BitWriter)
+	w.WriteBits(0, 31)
+	w.WriteBits(1, 1)
+	w.WriteBits(0x7FFFFFFF, 31)
+	r := NewBitReader(w.Bytes())
+	if got, err := r.ReadUE(); err != nil || got != 0xFFFFFFFE {
+		t.Fatalf("ReadUE = %v, %v, want 0xfffffffe", got, err)
+	}
+
+	r = NewBitReader(make([]byte, 5))
+	if _, err := r.ReadUE(); err == nil {
+		t.Fatalf("ReadUE of 32 leading zeros succeeded")
+	}
+}
+
+func TestReadUETruncated(t *testing.T) {
+	// 0001 needs three more bits
+	r := NewBitReader([]byte{0x01})
+	r.pos = 4
+	if _, err := r.ReadUE(); err == nil {
+		t.Fatalf("ReadUE of a truncated code succeeded")
+	}
+}
+
+func TestReadSE(t *testing.T) {
+	// ue 0, 1, 2, 3, 4 are se 0, 1, -1, 2, -2
+	r := NewBitReader([]byte{0xA6, 0x42, 0x80})
+	for _, want := range []int32{0, 1, -1, 2, -2} {
+		got, err := r.ReadSE()
+		if err != nil {
+			t.Fatalf("ReadSE failed, err:%v", err)
+		}
+		if got != want {
+			t.Fatalf("ReadSE = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRemoveEmulationPrevention(t *testing.T) {
+	tests := []struct {
+		name string
+		nal  []byte
+		want []byte
+	}{
+		{"none", []byte{0x67, 0x00, 0x01, 0x00}, []byte{0x67, 0x00, 0x01, 0x00}},
+		{"before 00", []byte{0x00, 0x00, 0x03, 0x00}, []byte{0x00, 0x00, 0x00}},
+		{"before 01", []byte{0x00, 0x00, 0x03, 0x01}, []byte{0x00, 0x00, 0x01}},
+		{"before 03", []byte{0x00, 0x00, 0x03, 0x03}, []byte{0x00, 0x00, 0x03}},
+		{"at the end", []byte{0x10, 0x00, 0x00, 0x03}, []byte{0x10, 0x00, 0x00}},
+		{"twice", []byte{0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x01}, []byte{0x00, 0x00, 0x00, 0x00, 0x01}},
+		{"zero count restarts", []byte{0x00, 0x03, 0x00, 0x03}, []byte{0x00, 0x03, 0x00, 0x03}},
+		{"after a removed 03", []byte{0x00, 0x00, 0x03, 0x03, 0x00}, []byte{0x00, 0x00, 0x03, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RemoveEmulationPrevention(tt.nal); !bytes.Equal(got, tt.want) {
+				t.Fatalf("RemoveEmulationPrevention(%x) = %x, want %x", tt.nal, got, tt.want)
+			}
+		})
+	}
+}
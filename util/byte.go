@@ -6,6 +6,8 @@ import (
 	"fmt"
 )
 
+// BytesToInt32ByBigEndian sign extends a buf shorter than 4 bytes, e.g. the
+// SI24 CompositionTime
 func BytesToInt32ByBigEndian(buf []byte) (int32, error) {
 
 	if len(buf) > 4 {
@@ -14,6 +16,11 @@ func BytesToInt32ByBigEndian(buf []byte) (int32, error) {
 
 	b := make([]byte, 4)
 	less := 4 - len(buf)
+	if len(buf) > 0 && buf[0]&0x80 != 0 {
+		for i := 0; i < less; i++ {
+			b[i] = 0xFF
+		}
+	}
 	for i := 0; i < len(buf); i++ {
 		b[i+less] = buf[i]
 	}
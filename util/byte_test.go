@@ -0,0 +1,44 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBytesToInt32ByBigEndian(t *testing.T) {
+	tests := []struct {
+		name    string
+		buf     []byte
+		want    int32
+		wantErr string
+	}{
+		// SI24 CompositionTime
+		{"SI24 max", []byte{0x7F, 0xFF, 0xFF}, 8388607, ""},
+		{"SI24 min", []byte{0x80, 0x00, 0x00}, -8388608, ""},
+		{"SI24 -1", []byte{0xFF, 0xFF, 0xFF}, -1, ""},
+		{"SI24 zero", []byte{0x00, 0x00, 0x00}, 0, ""},
+		{"SI24 -42", []byte{0xFF, 0xFF, 0xD6}, -42, ""},
+		{"SI16 min", []byte{0x80, 0x00}, -32768, ""},
+		{"SI8 -1", []byte{0xFF}, -1, ""},
+		{"SI32 min", []byte{0x80, 0x00, 0x00, 0x00}, -2147483648, ""},
+		{"empty", nil, 0, ""},
+		{"too long", make([]byte, 5), 0, "buf len more than 4, len:5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BytesToInt32ByBigEndian(tt.buf)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("BytesToInt32ByBigEndian err:%v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BytesToInt32ByBigEndian failed, err:%v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("BytesToInt32ByBigEndian(%x) = %v, want %v", tt.buf, got, tt.want)
+			}
+		})
+	}
+}